@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// IDs of the access code modal opened by clicking Accept on an invitation with an access_code.
+const (
+	accessCodeCallbackID = "access_code"
+	accessCodeBlockID    = "access_code"
+	accessCodeActionID   = "access_code_input"
+)
+
+// maxAccessCodeLength bounds an invitation's access_code, and what the modal accepts.
+const maxAccessCodeLength = 64
+
+// maxAccessCodeAttempts is how many wrong codes a recipient can enter before they can no longer
+// accept the invitation.
+const maxAccessCodeAttempts = 3
+
+var (
+	// errWrongAccessCode is returned for a wrong code while the recipient has tries left.
+	errWrongAccessCode = errors.New("wrong access code")
+	// errAccessCodeLocked is returned once a recipient has entered too many wrong codes.
+	errAccessCodeLocked = errors.New("too many wrong access codes")
+)
+
+// accessCodePrompt is the private metadata of the access code modal: the Accept button's
+// value, checked again on submission, and the invitation message it was clicked on.
+type accessCodePrompt struct {
+	Value   string `json:"value"`
+	Channel string `json:"channel"`
+	TS      string `json:"ts"`
+}
+
+// accessCodeRequired reports whether userID must enter inviteID's access code to accept it,
+// and how many tries they have left. Recipients who already accepted aren't asked again.
+func (t *rsvpTracker) accessCodeRequired(inviteID, userID string) (bool, int, error) {
+	record, ok, err := t.load(inviteID)
+	if err != nil || !ok || record.AccessCode == "" || record.Responses[userID].Status == rsvpAccepted {
+		return false, 0, err
+	}
+	return true, maxAccessCodeAttempts - record.CodeAttempts[userID], nil
+}
+
+// checkAccessCode checks code against inviteID's access code, counting wrong ones against
+// userID. It returns errWrongAccessCode with the tries left, or errAccessCodeLocked once they
+// are used up; invitations without an access code accept any code.
+func (t *rsvpTracker) checkAccessCode(inviteID, userID, code string) (int, error) {
+	// Only a wrong code changes the record; the outcome is set on every call of the change.
+	var remaining int
+	var outcome error
+	_, err := t.update(inviteID, func(record *rsvpRecord, ok bool) error {
+		remaining, outcome = 0, nil
+		if !ok || record.AccessCode == "" {
+			return errUnchanged
+		}
+		if record.CodeAttempts[userID] >= maxAccessCodeAttempts {
+			outcome = errAccessCodeLocked
+			return errUnchanged
+		}
+		if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(code)), []byte(record.AccessCode)) == 1 {
+			remaining = maxAccessCodeAttempts - record.CodeAttempts[userID]
+			return errUnchanged
+		}
+		if record.CodeAttempts == nil {
+			record.CodeAttempts = map[string]int{}
+		}
+		record.CodeAttempts[userID]++
+		if remaining = maxAccessCodeAttempts - record.CodeAttempts[userID]; remaining <= 0 {
+			remaining, outcome = 0, errAccessCodeLocked
+		} else {
+			outcome = errWrongAccessCode
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return remaining, outcome
+}
+
+// accessCodeModal builds the modal asking for the access code of game's invitation.
+// metadata is the encoded accessCodePrompt.
+func accessCodeModal(game, metadata string, remaining int) slack.ModalViewRequest {
+	input := slack.NewPlainTextInputBlockElement(slack.NewTextBlockObject("plain_text", "Code from the organizer", false, false), accessCodeActionID)
+	input.MaxLength = maxAccessCodeLength
+	intro := fmt.Sprintf("The organizer of *%s* shared an access code for it. Enter it to accept.", game)
+	if remaining < maxAccessCodeAttempts {
+		intro += fmt.Sprintf(" You have %s left.", triesLeft(remaining))
+	}
+	return slack.ModalViewRequest{
+		Type:            slack.VTModal,
+		CallbackID:      accessCodeCallbackID,
+		Title:           slack.NewTextBlockObject("plain_text", "Access code", false, false),
+		Submit:          slack.NewTextBlockObject("plain_text", "Accept", false, false),
+		Close:           slack.NewTextBlockObject("plain_text", "Cancel", false, false),
+		PrivateMetadata: metadata,
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", intro, false, false), nil, nil),
+			slack.NewInputBlock(accessCodeBlockID, slack.NewTextBlockObject("plain_text", "Access code", false, false), nil, input),
+		}},
+	}
+}
+
+// triesLeft describes a number of remaining tries, such as "2 tries".
+func triesLeft(remaining int) string {
+	if remaining == 1 {
+		return "1 try"
+	}
+	return fmt.Sprintf("%d tries", remaining)
+}
+
+// promptForAccessCode opens the access code modal if the clicking user must enter one to
+// accept, reporting whether the click was handled that way. Recipients out of tries are told
+// so instead.
+func (h *InteractionHandler) promptForAccessCode(callback *slack.InteractionCallback, action *slack.BlockAction, value inviteActionValue, channelID string) bool {
+	if value.InviteID == "" {
+		return false
+	}
+	required, remaining, err := h.rsvps.accessCodeRequired(value.InviteID, callback.User.ID)
+	if err != nil {
+		logger.Error("Error loading the invitation's access code", "event_type", callback.Type, "user_id", callback.User.ID, "invite_id", value.InviteID, "error", err)
+		h.replyAboutAccessCode(callback, channelID, "Sorry, I couldn't record that. Please try again shortly.")
+		return true
+	}
+	if !required {
+		return false
+	}
+	if remaining <= 0 {
+		h.replyAboutAccessCode(callback, channelID, fmt.Sprintf("You've entered a wrong access code too many times, so you can't accept the %s invite. Ask the organizer for help.", value.Game))
+		return true
+	}
+	metadata, err := json.Marshal(accessCodePrompt{Value: action.Value, Channel: channelID, TS: callback.Container.MessageTs})
+	if err != nil {
+		// Marshalling strings can't fail.
+		panic(err)
+	}
+	if _, err := h.slackClient.OpenView(callback.TriggerID, accessCodeModal(value.Game, string(metadata), remaining)); err != nil {
+		logger.Error("Failed to open the access code prompt", "event_type", callback.Type, "user_id", callback.User.ID, "invite_id", value.InviteID, "error", err)
+		h.replyAboutAccessCode(callback, channelID, "Sorry, I couldn't ask for the access code. Please try again shortly.")
+	}
+	return true
+}
+
+// submitAccessCode handles the access code modal: a correct code records the acceptance, a
+// wrong one keeps the modal open with an inline error.
+func (h *InteractionHandler) submitAccessCode(callback *slack.InteractionCallback) *slack.ViewSubmissionResponse {
+	var prompt accessCodePrompt
+	if err := json.Unmarshal([]byte(callback.View.PrivateMetadata), &prompt); err != nil {
+		logger.Info("Ignoring access code with unusable metadata", "event_type", callback.Type, "user_id", callback.User.ID, "error", err)
+		return nil
+	}
+	value, err := decodeInviteActionValue(prompt.Value, h.secret)
+	if err != nil {
+		logger.Warn("Rejecting access code for an invalid button value", "event_type", callback.Type, "user_id", callback.User.ID, "error", err)
+		return nil
+	}
+	code := callback.View.State.Values[accessCodeBlockID][accessCodeActionID].Value
+	remaining, err := h.rsvps.checkAccessCode(value.InviteID, callback.User.ID, code)
+	switch {
+	case errors.Is(err, errWrongAccessCode):
+		logger.Info("Wrong access code entered", "event_type", callback.Type, "user_id", callback.User.ID, "invite_id", value.InviteID, "remaining", remaining)
+		return slack.NewErrorsViewSubmissionResponse(map[string]string{
+			accessCodeBlockID: fmt.Sprintf("That code isn't right. You have %s left.", triesLeft(remaining)),
+		})
+	case errors.Is(err, errAccessCodeLocked):
+		logger.Info("Access code attempts used up", "event_type", callback.Type, "user_id", callback.User.ID, "invite_id", value.InviteID)
+		return slack.NewErrorsViewSubmissionResponse(map[string]string{
+			accessCodeBlockID: "That code isn't right, and you're out of tries. Ask the organizer for help.",
+		})
+	case err != nil:
+		logger.Error("Error checking the access code", "event_type", callback.Type, "user_id", callback.User.ID, "invite_id", value.InviteID, "error", err)
+		return slack.NewErrorsViewSubmissionResponse(map[string]string{
+			accessCodeBlockID: "Sorry, I couldn't check the code. Please try again shortly.",
+		})
+	}
+
+	logger.Info("Invitation answered", "event_type", callback.Type, "user_id", callback.User.ID, "status", rsvpAccepted, "game", value.Game, "inviter_id", value.InviterID)
+	h.replyAboutAccessCode(callback, prompt.Channel, fmt.Sprintf("You accepted the %s invite.", value.Game))
+	h.recordAnswer(callback, value, rsvpAccepted, "accepted", inviteMessage{Channel: prompt.Channel, TS: prompt.TS}, nil)
+	return nil
+}
+
+// replyAboutAccessCode shows text only to the user answering the invitation in channelID.
+func (h *InteractionHandler) replyAboutAccessCode(callback *slack.InteractionCallback, channelID, text string) {
+	if _, err := h.slackClient.PostEphemeral(channelID, callback.User.ID, slack.MsgOptionText(text, false)); err != nil {
+		logger.Error("Failed to reply about the access code", "event_type", callback.Type, "user_id", callback.User.ID, "error", h.sender.scopes.explain(methodPostEphemeral, err))
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/slack-go/slack"
+)
+
+func TestAccessCodes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// A step either clicks an invitation button or, with a code, submits the last modal opened.
+	type step struct {
+		actionID string
+		code     string
+	}
+	tests := []struct {
+		name         string
+		accessCode   string
+		steps        []step
+		wantViews    int
+		wantErrors   []string // the inline error of each submission, "" when it was accepted
+		wantAccepted []string
+		wantLast     string // the last ephemeral reply to the recipient
+	}{
+		{
+			name:         "correct code accepts",
+			accessCode:   "open sesame",
+			steps:        []step{{actionAcceptGame, ""}, {"", " open sesame "}},
+			wantViews:    1,
+			wantErrors:   []string{""},
+			wantAccepted: []string{"Bob Baker"},
+			wantLast:     "You accepted the Catan invite.",
+		},
+		{
+			name:         "wrong code shows an inline error",
+			accessCode:   "open sesame",
+			steps:        []step{{actionAcceptGame, ""}, {"", "abracadabra"}, {"", "open sesame"}},
+			wantViews:    1,
+			wantErrors:   []string{"That code isn't right. You have 2 tries left.", ""},
+			wantAccepted: []string{"Bob Baker"},
+			wantLast:     "You accepted the Catan invite.",
+		},
+		{
+			name:       "codes are case sensitive",
+			accessCode: "Open Sesame",
+			steps:      []step{{actionAcceptGame, ""}, {"", "open sesame"}},
+			wantViews:  1,
+			wantErrors: []string{"That code isn't right. You have 2 tries left."},
+		},
+		{
+			name:       "retry limit",
+			accessCode: "open sesame",
+			steps: []step{
+				{actionAcceptGame, ""}, {"", "one"}, {"", "two"}, {"", "three"}, {"", "open sesame"},
+				{actionAcceptGame, ""},
+			},
+			wantViews: 1,
+			wantErrors: []string{
+				"That code isn't right. You have 2 tries left.",
+				"That code isn't right. You have 1 try left.",
+				"That code isn't right, and you're out of tries. Ask the organizer for help.",
+				"That code isn't right, and you're out of tries. Ask the organizer for help.",
+			},
+			wantLast: "You've entered a wrong access code too many times, so you can't accept the Catan invite. Ask the organizer for help.",
+		},
+		{
+			name:         "accepters aren't asked again",
+			accessCode:   "open sesame",
+			steps:        []step{{actionAcceptGame, ""}, {"", "open sesame"}, {actionAcceptGame, ""}},
+			wantViews:    1,
+			wantErrors:   []string{""},
+			wantAccepted: []string{"Bob Baker"},
+			wantLast:     "You accepted the Catan invite.",
+		},
+		{
+			name:     "maybe needs no code",
+			steps:    []step{{actionMaybeGame, ""}},
+			wantLast: "You might join the Catan invite.",
+		},
+		{
+			name:         "invitations without a code accept right away",
+			steps:        []step{{actionAcceptGame, ""}},
+			wantAccepted: []string{"Bob Baker"},
+			wantLast:     "You accepted the Catan invite.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			h := newTestInteractionHandler(t, fake, 0)
+			if err := h.rsvps.start("inv1", "Catan", "U1", nil, tt.accessCode); err != nil {
+				t.Fatal(err)
+			}
+			value := inviteActionValue{Game: "Catan", InviterID: "U1", InviteID: "inv1"}
+			channel := slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: "DU2"}}}
+
+			var gotErrors []string
+			for _, step := range tt.steps {
+				if step.actionID != "" {
+					callback := &slack.InteractionCallback{Type: slack.InteractionTypeBlockActions, User: slack.User{ID: "U2"}, TriggerID: "trigger", Channel: channel}
+					h.router.dispatch(callback, &slack.BlockAction{ActionID: step.actionID, Value: encodeInviteActionValue(value, []byte(testActionSecret))})
+					continue
+				}
+				views := fake.allViews()
+				if len(views) == 0 {
+					t.Fatal("no access code prompt was opened")
+				}
+				response := submitView(t, h, "U2", views[len(views)-1], map[string]map[string]slack.BlockAction{
+					accessCodeBlockID: {accessCodeActionID: {Value: step.code}},
+				})
+				if response == nil {
+					gotErrors = append(gotErrors, "")
+					continue
+				}
+				if response.ResponseAction != slack.RAErrors {
+					t.Fatalf("response_action = %q, want errors", response.ResponseAction)
+				}
+				gotErrors = append(gotErrors, response.Errors[accessCodeBlockID])
+			}
+			h.wait()
+
+			if got := len(fake.allViews()); got != tt.wantViews {
+				t.Errorf("opened %d prompts, want %d", got, tt.wantViews)
+			}
+			if strings.Join(gotErrors, "|") != strings.Join(tt.wantErrors, "|") {
+				t.Errorf("submission errors = %q, want %q", gotErrors, tt.wantErrors)
+			}
+			tally, _, err := h.rsvps.get("inv1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(tally.Accepted.Names, ",") != strings.Join(tt.wantAccepted, ",") {
+				t.Errorf("accepted = %q, want %q", tally.Accepted.Names, tt.wantAccepted)
+			}
+			replies := fake.ephemeralsFor("U2")
+			last := ""
+			if len(replies) > 0 {
+				last = replies[len(replies)-1]
+			}
+			if last != tt.wantLast {
+				t.Errorf("replies = %q, want the last to be %q", replies, tt.wantLast)
+			}
+		})
+	}
+}
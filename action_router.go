@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// actionHandlerFunc handles a single block action from an interaction payload.
+type actionHandlerFunc func(callback *slack.InteractionCallback, action *slack.BlockAction)
+
+// viewSubmissionFunc handles a modal submission, returning the response that keeps the modal
+// open, such as inline errors, or nil to close it.
+type viewSubmissionFunc func(callback *slack.InteractionCallback) *slack.ViewSubmissionResponse
+
+// actionRoute pairs an action_id prefix with its handler.
+type actionRoute struct {
+	prefix  string
+	handler actionHandlerFunc
+}
+
+// actionRouter dispatches block actions to handlers by action_id prefix.
+// When several prefixes match, the longest one wins; unknown actions go to the fallback.
+type actionRouter struct {
+	routes   []actionRoute
+	fallback actionHandlerFunc
+}
+
+// newActionRouter creates a router whose fallback logs and otherwise ignores unknown actions.
+func newActionRouter() *actionRouter {
+	return &actionRouter{
+		fallback: func(callback *slack.InteractionCallback, action *slack.BlockAction) {
+			logger.Info("Ignoring unknown action", "event_type", "block_actions", "action_id", action.ActionID, "user_id", callback.User.ID)
+		},
+	}
+}
+
+// handle registers handler for every action whose action_id starts with prefix.
+func (r *actionRouter) handle(prefix string, handler actionHandlerFunc) {
+	r.routes = append(r.routes, actionRoute{prefix: prefix, handler: handler})
+}
+
+// dispatch calls the handler registered for the action, or the fallback if none matches.
+func (r *actionRouter) dispatch(callback *slack.InteractionCallback, action *slack.BlockAction) {
+	var best *actionRoute
+	for i := range r.routes {
+		route := &r.routes[i]
+		if strings.HasPrefix(action.ActionID, route.prefix) && (best == nil || len(route.prefix) > len(best.prefix)) {
+			best = route
+		}
+	}
+	if best == nil {
+		r.fallback(callback, action)
+		return
+	}
+	best.handler(callback, action)
+}
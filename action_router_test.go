@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+func TestActionRouterDispatch(t *testing.T) {
+	var got []string
+	record := func(name string) actionHandlerFunc {
+		return func(callback *slack.InteractionCallback, action *slack.BlockAction) {
+			got = append(got, name+":"+action.ActionID)
+		}
+	}
+	router := newActionRouter()
+	router.handle("accept_", record("accept"))
+	router.handle("accept_game", record("accept_game"))
+	router.handle("decline_game", record("decline"))
+	fallback := router.fallback
+	router.fallback = func(callback *slack.InteractionCallback, action *slack.BlockAction) {
+		record("fallback")(callback, action)
+		fallback(callback, action)
+	}
+
+	tests := []struct {
+		actionID string
+		want     string
+	}{
+		{actionID: "accept_game", want: "accept_game:accept_game"},
+		{actionID: "accept_game_slot_2", want: "accept_game:accept_game_slot_2"},
+		{actionID: "accept_reminder", want: "accept:accept_reminder"},
+		{actionID: "decline_game", want: "decline:decline_game"},
+		{actionID: "snooze_game", want: "fallback:snooze_game"},
+		{actionID: "", want: "fallback:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.actionID, func(t *testing.T) {
+			got = nil
+			router.dispatch(&slack.InteractionCallback{User: slack.User{ID: "U2"}}, &slack.BlockAction{ActionID: tt.actionID})
+			if len(got) != 1 || got[0] != tt.want {
+				t.Errorf("dispatch(%q) ran %q, want %q", tt.actionID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvitationActionsAreRouted(t *testing.T) {
+	tests := []struct {
+		actionID   string
+		wantStatus string // the RSVP recorded, "" for none
+	}{
+		{actionID: actionAcceptGame, wantStatus: rsvpAccepted},
+		{actionID: actionMaybeGame, wantStatus: rsvpInterested},
+		{actionID: actionDeclineGame, wantStatus: rsvpDeclined},
+		{actionID: "launch_rockets"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.actionID, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			h := newTestInteractionHandler(t, fake, 0)
+			if err := h.rsvps.start("inv1", "Catan", "U1", nil, ""); err != nil {
+				t.Fatal(err)
+			}
+			click(h, "U2", tt.actionID, inviteActionValue{Game: "Catan", InviteID: "inv1", InviterID: "U1"})
+			h.wait()
+
+			tally, _, err := h.rsvps.get("inv1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			counts := map[string]int{rsvpAccepted: tally.Accepted.Count, rsvpInterested: tally.Maybe.Count, rsvpDeclined: tally.Declined.Count}
+			for status, count := range counts {
+				if want := map[bool]int{true: 1}[status == tt.wantStatus]; count != want {
+					t.Errorf("%s count = %d, want %d", status, count, want)
+				}
+			}
+			if tt.wantStatus == "" && (len(fake.allPosts()) != 0 || len(fake.ephemeralsFor("U2")) != 0) {
+				t.Errorf("unknown action posted %+v and %q, want it ignored", fake.allPosts(), fake.ephemeralsFor("U2"))
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler serves operator-only endpoints.
+type AdminHandler struct {
+	userCache *userCache
+}
+
+// NewAdminHandler creates a new AdminHandler.
+func NewAdminHandler(userCache *userCache) *AdminHandler {
+	return &AdminHandler{
+		userCache: userCache,
+	}
+}
+
+// RefreshUsers forces a reload of the cached Slack user list and reports how many users it holds.
+func (h *AdminHandler) RefreshUsers(c *gin.Context) {
+	users, err := h.userCache.forceRefresh()
+	if err != nil {
+		logger.Error("Error refreshing user cache", "event_type", "admin", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh users: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User cache refreshed", "user_count": len(users)})
+}
+
+// requireAdmin rejects requests that don't carry the configured admin key as a bearer token.
+// Admin routes are disabled entirely when no key is configured.
+func requireAdmin(apiKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if apiKey == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin endpoints are disabled; set ADMIN_API_KEY to enable them"})
+			return
+		}
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(apiKey)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid admin credentials"})
+			return
+		}
+		c.Next()
+	}
+}
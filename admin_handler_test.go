@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/slack-go/slack"
+)
+
+func TestRefreshUsers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	fake := newFakeSlack(t, testUsers...)
+	cache := newUserCache(fake.client(), time.Hour)
+	if _, err := cache.getCachedUsers(); err != nil {
+		t.Fatal(err)
+	}
+	dave := slack.User{ID: "U4", Name: "dave", RealName: "Dave Dunn"}
+	fake.setUsers(append(append([]slack.User(nil), testUsers...), dave)...)
+
+	r := gin.New()
+	r.POST("/admin/refresh-users", requireAdmin("admin-key"), NewAdminHandler(cache).RefreshUsers)
+	refresh := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/refresh-users", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := refresh("wrong-key"); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh with the wrong key = %d, want 401", w.Code)
+	}
+	if got := fake.usersListCalls(); got != 1 {
+		t.Fatalf("users.list called %d times after a refused refresh, want 1", got)
+	}
+
+	w := refresh("admin-key")
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh = %d: %s", w.Code, w.Body)
+	}
+	var body struct {
+		UserCount int `json:"user_count"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.UserCount != 4 {
+		t.Errorf("refresh answered %s, want user_count 4", w.Body)
+	}
+	if got := fake.usersListCalls(); got != 2 {
+		t.Errorf("users.list called %d times, want the refresh to skip the fresh cache", got)
+	}
+	users, err := cache.getCachedUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 4 || users[3].ID != "U4" {
+		t.Errorf("cached users = %+v, want Dave added", users)
+	}
+
+	// Refreshes arriving together share one fetch.
+	fake.slowUsers(50 * time.Millisecond)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if w := refresh("admin-key"); w.Code != http.StatusOK {
+				t.Errorf("concurrent refresh = %d: %s", w.Code, w.Body)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := fake.usersListCalls() - 2; got < 1 || got > 2 {
+		t.Errorf("5 concurrent refreshes made %d users.list calls, want them to share", got)
+	}
+}
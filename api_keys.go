@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authenticatedInviterKey is the gin context key holding the user ID an invite request's API
+// key belongs to.
+const authenticatedInviterKey = "authenticated_inviter"
+
+// parseAPIKeys parses INVITE_API_KEYS, a comma separated list of key=user_id pairs.
+func parseAPIKeys(list string) (map[string]string, error) {
+	keys := make(map[string]string)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, userID, ok := strings.Cut(entry, "=")
+		key, userID = strings.TrimSpace(key), strings.TrimSpace(userID)
+		if !ok || key == "" {
+			return nil, errors.New("expected comma separated key=user_id pairs")
+		}
+		if !userIDPattern.MatchString(userID) {
+			return nil, fmt.Errorf("%q is not a Slack user ID", userID)
+		}
+		keys[key] = userID
+	}
+	return keys, nil
+}
+
+// authenticateInviter requires invite requests to carry one of the INVITE_API_KEYS as a bearer
+// token and records the key's user as the inviter. Without keys configured it lets every
+// request through, as before.
+func authenticateInviter(keys map[string]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(keys) == 0 {
+			c.Next()
+			return
+		}
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		for key, userID := range keys {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1 {
+				c.Set(authenticatedInviterKey, userID)
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+	}
+}
+
+// errInviterMismatch is returned when a request names an inviter other than its API key's user.
+var errInviterMismatch = errors.New("inviter_id doesn't match the user of the API key")
+
+// applyAuthenticatedInviter makes the API key's user the inviter of req, so clients don't have
+// to pass inviter_id. Requests that weren't authenticated by key are left unchanged.
+func applyAuthenticatedInviter(c *gin.Context, req *InviteRequest) error {
+	inviterID := c.GetString(authenticatedInviterKey)
+	if inviterID == "" {
+		return nil
+	}
+	if req.InviterID != "" && req.InviterID != inviterID {
+		return errInviterMismatch
+	}
+	req.InviterID = inviterID
+	return nil
+}
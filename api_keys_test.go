@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuthenticateInviter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name       string
+		keys       map[string]string
+		method     string
+		path       string
+		auth       string
+		wantStatus int
+	}{
+		{name: "no keys configured", method: http.MethodGet, path: "/lists", wantStatus: http.StatusOK},
+		{name: "usage guide is public", keys: map[string]string{"k1": "U1"}, method: http.MethodGet, path: "/invite", wantStatus: http.StatusOK},
+		{name: "listing lists without a key", keys: map[string]string{"k1": "U1"}, method: http.MethodGet, path: "/lists", wantStatus: http.StatusUnauthorized},
+		{name: "deleting a list with a wrong key", keys: map[string]string{"k1": "U1"}, method: http.MethodDelete, path: "/lists/raid", auth: "Bearer k2", wantStatus: http.StatusUnauthorized},
+		{name: "cancelling a scheduled invite without a key", keys: map[string]string{"k1": "U1"}, method: http.MethodDelete, path: "/invite/scheduled/Q1", wantStatus: http.StatusUnauthorized},
+		{name: "listing recurring invites with a key", keys: map[string]string{"k1": "U1"}, method: http.MethodGet, path: "/invite/recurring", auth: "Bearer k1", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+			r := gin.New()
+			r.GET("/invite", ok)
+			api := r.Group("", authenticateInviter(tt.keys))
+			api.GET("/lists", ok)
+			api.DELETE("/lists/:name", ok)
+			api.DELETE("/invite/scheduled/:id", ok)
+			api.GET("/invite/recurring", ok)
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("%s %s answered %d, want %d", tt.method, tt.path, w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
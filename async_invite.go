@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// inviteJobKeyPrefix namespaces asynchronous invite jobs in the shared Store.
+const inviteJobKeyPrefix = "invite_job:"
+
+// inviteJobRetention is how long the outcome of an asynchronous invite can be polled.
+const inviteJobRetention = 24 * time.Hour
+
+// Asynchronous invite job statuses.
+const (
+	jobQueued  = "queued"
+	jobSending = "sending"
+	jobDone    = "done"
+)
+
+// InviteJob is the progress of an invite sent with "async": true, as served by
+// GET /invite/:id/status.
+type InviteJob struct {
+	InviteID string `json:"invite_id"`
+	Status   string `json:"status"` // "queued", "sending" or "done"
+	// HTTPStatus and Result are what POST /invite would have answered with, once done.
+	HTTPStatus int       `json:"http_status,omitempty"`
+	Result     gin.H     `json:"result,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// inviteJobs tracks invites sent in the background. Jobs run on the instance that accepted
+// them; their status is kept in the Store so any instance can answer a poll.
+type inviteJobs struct {
+	store   Store
+	running sync.WaitGroup
+}
+
+// newInviteJobs keeps job status in store.
+func newInviteJobs(store Store) *inviteJobs {
+	return &inviteJobs{store: store}
+}
+
+// run records a queued job for inviteID and calls send in the background, saving its result.
+func (j *inviteJobs) run(inviteID string, send func() (int, gin.H)) error {
+	job := InviteJob{InviteID: inviteID, Status: jobQueued, CreatedAt: time.Now()}
+	if err := j.save(&job); err != nil {
+		return err
+	}
+	j.running.Add(1)
+	go func() {
+		defer j.running.Done()
+		job.Status = jobSending
+		j.saveLogged(&job)
+		job.HTTPStatus, job.Result = send()
+		job.Status = jobDone
+		j.saveLogged(&job)
+		logger.Info("Asynchronous invite finished", "event_type", "api_invite", "invite_id", inviteID, "status", job.HTTPStatus)
+	}()
+	return nil
+}
+
+// wait blocks until every job started on this instance has finished.
+func (j *inviteJobs) wait() {
+	j.running.Wait()
+}
+
+// get returns the job for inviteID, reporting whether it is known.
+func (j *inviteJobs) get(inviteID string) (InviteJob, bool, error) {
+	data, ok, err := j.store.Get(inviteJobKeyPrefix + inviteID)
+	if err != nil || !ok {
+		return InviteJob{}, false, err
+	}
+	var job InviteJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		return InviteJob{}, false, fmt.Errorf("decoding invite job %s: %w", inviteID, err)
+	}
+	return job, true, nil
+}
+
+func (j *inviteJobs) save(job *InviteJob) error {
+	job.UpdatedAt = time.Now()
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return j.store.Set(inviteJobKeyPrefix+job.InviteID, data, inviteJobRetention)
+}
+
+// saveLogged saves job from the background worker, where errors can only be logged.
+func (j *inviteJobs) saveLogged(job *InviteJob) {
+	if err := j.save(job); err != nil {
+		logger.Error("Error saving invite job status", "event_type", "api_invite", "invite_id", job.InviteID, "error", err)
+	}
+}
+
+// sendInviteAsync queues req to be sent in the background and answers 202 with the URL to poll.
+func (h *GameInviteHandler) sendInviteAsync(c *gin.Context, req InviteRequest) {
+	if h.config.MaintenanceMode {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": maintenanceReply})
+		return
+	}
+	inviteID := newInviteID()
+	err := h.jobs.run(inviteID, func() (int, gin.H) {
+		return h.sendInviteWithID(req, inviteID)
+	})
+	if err != nil {
+		logger.Error("Error queueing invite", "event_type", "api_invite", "invite_id", inviteID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue the invitation: " + err.Error()})
+		return
+	}
+	statusURL := "/invite/" + inviteID + "/status"
+	c.Header("Location", statusURL)
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":    "Invitation queued",
+		"invite_id":  inviteID,
+		"status_url": statusURL,
+	})
+}
+
+// GetInviteStatus returns the progress of an invite sent with "async": true.
+func (h *GameInviteHandler) GetInviteStatus(c *gin.Context) {
+	job, ok, err := h.jobs.get(c.Param("id"))
+	if err != nil {
+		logger.Error("Error loading invite job", "invite_id", c.Param("id"), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load the invitation status: " + err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No asynchronous invitation with ID " + c.Param("id")})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
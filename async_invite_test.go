@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAsyncInvite(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name           string
+		body           string
+		wantHTTPStatus int // what the finished job reports
+		wantPosts      int
+	}{
+		{name: "sent in the background", body: `{"game_name": "Catan", "user_ids": ["U2", "U3"], "description": "Come play", "async": true}`, wantHTTPStatus: http.StatusOK, wantPosts: 2},
+		{name: "a failed send is reported", body: `{"game_name": "Catan", "user_ids": ["U2"], "channel_id": "C0123456", "thread_ts": "yesterday", "async": true}`, wantHTTPStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			fake.slowPosts(50 * time.Millisecond)
+			h, _ := newTestInviteHandler(t, fake, testConfig())
+			r := gin.New()
+			r.POST("/invite", h.SendInvite)
+			r.GET("/invite/:id/status", h.GetInviteStatus)
+			status := func(url string) (int, InviteJob) {
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+				var job InviteJob
+				json.Unmarshal(w.Body.Bytes(), &job)
+				return w.Code, job
+			}
+
+			start := time.Now()
+			req := httptest.NewRequest(http.MethodPost, "/invite", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("POST /invite = %d: %s", w.Code, w.Body)
+			}
+			if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+				t.Errorf("POST /invite took %s, want it to answer before sending", elapsed)
+			}
+			var accepted struct {
+				InviteID  string `json:"invite_id"`
+				StatusURL string `json:"status_url"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &accepted); err != nil || accepted.InviteID == "" {
+				t.Fatalf("POST /invite answered %s, want an invite ID", w.Body)
+			}
+			if accepted.StatusURL != "/invite/"+accepted.InviteID+"/status" || w.Header().Get("Location") != accepted.StatusURL {
+				t.Errorf("status_url = %q, Location = %q", accepted.StatusURL, w.Header().Get("Location"))
+			}
+
+			h.jobs.wait()
+			code, job := status(accepted.StatusURL)
+			if code != http.StatusOK || job.Status != jobDone || job.HTTPStatus != tt.wantHTTPStatus {
+				t.Fatalf("GET %s = %d %+v, want done with %d", accepted.StatusURL, code, job, tt.wantHTTPStatus)
+			}
+			if tt.wantHTTPStatus == http.StatusOK && job.Result["invite_id"] != accepted.InviteID {
+				t.Errorf("result = %v, want the invitation sent under %s", job.Result, accepted.InviteID)
+			}
+			if tt.wantHTTPStatus != http.StatusOK && job.Result["error"] == nil {
+				t.Errorf("result = %v, want the error", job.Result)
+			}
+			if got := len(fake.allPosts()); got != tt.wantPosts {
+				t.Errorf("posted %d messages, want %d", got, tt.wantPosts)
+			}
+			if code, _ := status("/invite/unknown/status"); code != http.StatusNotFound {
+				t.Errorf("GET an unknown status = %d, want 404", code)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/slack-go/slack"
+)
+
+// InviteAttachment references a file shared with an invitation, such as a rules PDF or a map.
+// Either URL (a pre-hosted file that is linked from the invite) or Content (uploaded to every
+// recipient's DM) must be set.
+type InviteAttachment struct {
+	URL      string `json:"url,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Content  string `json:"content,omitempty"` // base64-encoded file content
+}
+
+// validate checks that the attachment is either a usable link or decodable content.
+func (a *InviteAttachment) validate() error {
+	switch {
+	case a.URL != "" && a.Content != "":
+		return errors.New("attachment must have either url or content, not both")
+	case a.URL != "":
+		u, err := url.Parse(a.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("attachment url %q must be an absolute http(s) URL", a.URL)
+		}
+	case a.Content != "":
+		if a.Filename == "" {
+			return errors.New("attachment filename is required when uploading content")
+		}
+		if _, err := base64.StdEncoding.DecodeString(a.Content); err != nil {
+			return fmt.Errorf("attachment content must be base64 encoded: %w", err)
+		}
+	default:
+		return errors.New("attachment must have a url or content")
+	}
+	return nil
+}
+
+// title returns the display title, defaulting to the filename.
+func (a *InviteAttachment) title() string {
+	if a.Title != "" {
+		return a.Title
+	}
+	if a.Filename != "" {
+		return a.Filename
+	}
+	return "Attachment"
+}
+
+// linkBlock renders a pre-hosted attachment as a section linking to the file.
+func (a *InviteAttachment) linkBlock() slack.Block {
+	return slack.NewSectionBlock(
+		slack.NewTextBlockObject("mrkdwn", fmt.Sprintf(":paperclip: <%s|%s>", a.URL, a.title()), false, false),
+		nil,
+		nil,
+	)
+}
+
+// uploadParams builds the files.uploadV2 request that shares the attachment content in a channel.
+func (a *InviteAttachment) uploadParams(channelID string) (slack.UploadFileV2Parameters, error) {
+	data, err := base64.StdEncoding.DecodeString(a.Content)
+	if err != nil {
+		return slack.UploadFileV2Parameters{}, err
+	}
+	return slack.UploadFileV2Parameters{
+		Channel:  channelID,
+		Content:  string(data),
+		FileSize: len(data),
+		Filename: a.Filename,
+		Title:    a.title(),
+	}, nil
+}
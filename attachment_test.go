@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestInviteAttachments(t *testing.T) {
+	rules := base64.StdEncoding.EncodeToString([]byte("Build roads. Trade sheep."))
+	tests := []struct {
+		name        string
+		attachment  InviteAttachment
+		failUploads string // a DM whose uploads fail
+		wantStatus  int
+		wantUploads []string // channels the file was shared in
+		wantLink    bool
+		wantErrors  int // attachment_errors in the response
+	}{
+		{name: "uploaded to each DM", attachment: InviteAttachment{Filename: "rules.txt", Title: "Catan rules", Content: rules}, wantStatus: http.StatusOK, wantUploads: []string{"U2", "U3"}},
+		{name: "a pre-hosted file is linked", attachment: InviteAttachment{URL: "https://example.com/catan-rules.pdf", Title: "Catan rules"}, wantStatus: http.StatusOK, wantLink: true},
+		{name: "a failed upload still sends the invitation", attachment: InviteAttachment{Filename: "rules.txt", Title: "Catan rules", Content: rules}, failUploads: "U3", wantStatus: http.StatusOK, wantUploads: []string{"U2"}, wantErrors: 1},
+		{name: "content that isn't base64", attachment: InviteAttachment{Filename: "rules.txt", Content: "not base64!"}, wantStatus: http.StatusBadRequest},
+		{name: "a link that isn't http", attachment: InviteAttachment{URL: "file:///etc/passwd"}, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			if tt.failUploads != "" {
+				fake.failUploads(tt.failUploads, "not_allowed_token_type")
+			}
+			h, _ := newTestInviteHandler(t, fake, testConfig())
+			attachment := tt.attachment
+			status, response := h.sendInvite(InviteRequest{GameName: "Catan", UserIDs: []string{"U2", "U3"}, Description: "Come play", Attachment: &attachment})
+			if status != tt.wantStatus {
+				t.Fatalf("sendInvite = %d %v, want %d", status, response, tt.wantStatus)
+			}
+			if errors, _ := response["attachment_errors"].([]string); len(errors) != tt.wantErrors {
+				t.Errorf("attachment_errors = %q, want %d", errors, tt.wantErrors)
+			}
+
+			var channels []string
+			for _, upload := range fake.allUploads() {
+				channels = append(channels, upload.Channel)
+				if upload.Filename != "rules.txt" || upload.Title != "Catan rules" || upload.Content != "Build roads. Trade sheep." {
+					t.Errorf("uploaded %+v, want the decoded rules", upload)
+				}
+			}
+			if strings.Join(sortedCopy(channels), ",") != strings.Join(tt.wantUploads, ",") {
+				t.Errorf("shared in %q, want %q", channels, tt.wantUploads)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if posts := fake.allPosts(); len(posts) != 0 {
+					t.Errorf("posted %+v, want nothing sent", posts)
+				}
+				return
+			}
+			for _, recipient := range []string{"U2", "U3"} {
+				var blocks []string
+				for _, post := range fake.allPosts() {
+					if post.Channel == recipient {
+						blocks = append(blocks, post.Blocks)
+					}
+				}
+				if len(blocks) != 1 {
+					t.Fatalf("%s got %d invitations, want 1", recipient, len(blocks))
+				}
+				if linked := strings.Contains(blocks[0], ":paperclip:") && strings.Contains(blocks[0], "https://example.com/catan-rules.pdf|Catan rules"); linked != tt.wantLink {
+					t.Errorf("%s's invitation links the file: %v, want %v", recipient, linked, tt.wantLink)
+				}
+			}
+		})
+	}
+}
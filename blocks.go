@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// Block Kit limits enforced before sending, see https://api.slack.com/reference/block-kit/blocks.
+const (
+	maxBlocksPerMessage   = 50
+	maxHeaderTextLength   = 150
+	maxSectionTextLength  = 3000
+	maxActionElements     = 25
+	maxContextElements    = 10
+	maxContextTextLength  = 3000
+	maxActionBlockIDChars = 255
+)
+
+// validateBlocks checks constructed blocks against the Block Kit rules Slack enforces, so a
+// malformed message fails with a clear error instead of an opaque invalid_blocks response.
+func validateBlocks(blocks []slack.Block) error {
+	if len(blocks) > maxBlocksPerMessage {
+		return fmt.Errorf("message has %d blocks, at most %d are allowed", len(blocks), maxBlocksPerMessage)
+	}
+	for i, block := range blocks {
+		if err := validateBlock(block); err != nil {
+			return fmt.Errorf("block %d (%s): %w", i, block.BlockType(), err)
+		}
+	}
+	return nil
+}
+
+// validateBlock checks a single block.
+func validateBlock(block slack.Block) error {
+	switch b := block.(type) {
+	case *slack.HeaderBlock:
+		if b.Text == nil || strings.TrimSpace(b.Text.Text) == "" {
+			return fmt.Errorf("header text is empty")
+		}
+		if n := len([]rune(b.Text.Text)); n > maxHeaderTextLength {
+			return fmt.Errorf("header text is %d characters, at most %d are allowed", n, maxHeaderTextLength)
+		}
+	case *slack.SectionBlock:
+		if (b.Text == nil || strings.TrimSpace(b.Text.Text) == "") && len(b.Fields) == 0 {
+			return fmt.Errorf("section has no text or fields")
+		}
+		if b.Text != nil {
+			if n := len([]rune(b.Text.Text)); n > maxSectionTextLength {
+				return fmt.Errorf("section text is %d characters, at most %d are allowed", n, maxSectionTextLength)
+			}
+		}
+	case *slack.ActionBlock:
+		if b.Elements == nil || len(b.Elements.ElementSet) == 0 {
+			return fmt.Errorf("actions block has no elements")
+		}
+		if n := len(b.Elements.ElementSet); n > maxActionElements {
+			return fmt.Errorf("actions block has %d elements, at most %d are allowed", n, maxActionElements)
+		}
+		if len(b.BlockID) > maxActionBlockIDChars {
+			return fmt.Errorf("block_id is longer than %d characters", maxActionBlockIDChars)
+		}
+	case *slack.ContextBlock:
+		if n := len(b.ContextElements.Elements); n == 0 || n > maxContextElements {
+			return fmt.Errorf("context block has %d elements, between 1 and %d are allowed", n, maxContextElements)
+		}
+		for _, element := range b.ContextElements.Elements {
+			if text, ok := element.(*slack.TextBlockObject); ok {
+				if n := len([]rune(text.Text)); n > maxContextTextLength {
+					return fmt.Errorf("context text is %d characters, at most %d are allowed", n, maxContextTextLength)
+				}
+			}
+		}
+	}
+	return nil
+}
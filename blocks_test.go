@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+func TestValidateBlocks(t *testing.T) {
+	text := func(s string) *slack.TextBlockObject { return slack.NewTextBlockObject("mrkdwn", s, false, false) }
+	plain := func(s string) *slack.TextBlockObject { return slack.NewTextBlockObject("plain_text", s, false, false) }
+	button := slack.NewButtonBlockElement(actionAcceptGame, "v", plain("Accept"))
+	buttons := func(n int) []slack.BlockElement {
+		elements := make([]slack.BlockElement, n)
+		for i := range elements {
+			elements[i] = button
+		}
+		return elements
+	}
+	contextElements := func(n int) []slack.MixedElement {
+		elements := make([]slack.MixedElement, n)
+		for i := range elements {
+			elements[i] = text("note")
+		}
+		return elements
+	}
+	valid := []slack.Block{
+		slack.NewHeaderBlock(plain("Game Invitation: Catan")),
+		slack.NewSectionBlock(text("Come play!"), nil, nil),
+		slack.NewContextBlock("", text("Sent by Alice")),
+		slack.NewActionBlock("game_actions", button),
+	}
+
+	tests := []struct {
+		name    string
+		blocks  []slack.Block
+		wantErr string // empty for valid blocks
+	}{
+		{name: "an invitation", blocks: valid},
+		{name: "section with only fields", blocks: []slack.Block{slack.NewSectionBlock(nil, []*slack.TextBlockObject{text("*When:* 7pm")}, nil)}},
+		{name: "limits are inclusive", blocks: []slack.Block{slack.NewHeaderBlock(plain(strings.Repeat("x", maxHeaderTextLength))), slack.NewActionBlock("a", buttons(maxActionElements)...)}},
+		{name: "empty header", blocks: []slack.Block{slack.NewHeaderBlock(plain("  "))}, wantErr: "block 0 (header): header text is empty"},
+		{name: "header without text", blocks: []slack.Block{&slack.HeaderBlock{Type: slack.MBTHeader}}, wantErr: "header text is empty"},
+		{name: "long header", blocks: []slack.Block{slack.NewHeaderBlock(plain(strings.Repeat("é", maxHeaderTextLength+1)))}, wantErr: "header text is 151 characters, at most 150"},
+		{name: "empty section", blocks: append(valid[:1:1], slack.NewSectionBlock(text(""), nil, nil)), wantErr: "block 1 (section): section has no text or fields"},
+		{name: "long section", blocks: []slack.Block{slack.NewSectionBlock(text(strings.Repeat("x", maxSectionTextLength+1)), nil, nil)}, wantErr: "section text is 3001 characters"},
+		{name: "actions without buttons", blocks: []slack.Block{slack.NewActionBlock("a")}, wantErr: "actions block has no elements"},
+		{name: "too many buttons", blocks: []slack.Block{slack.NewActionBlock("a", buttons(maxActionElements+1)...)}, wantErr: "actions block has 26 elements, at most 25"},
+		{name: "long block_id", blocks: []slack.Block{slack.NewActionBlock(strings.Repeat("a", maxActionBlockIDChars+1), button)}, wantErr: "block_id is longer than 255 characters"},
+		{name: "empty context", blocks: []slack.Block{slack.NewContextBlock("")}, wantErr: "context block has 0 elements"},
+		{name: "long context", blocks: []slack.Block{slack.NewContextBlock("", text(strings.Repeat("x", maxContextTextLength+1)))}, wantErr: "context text is 3001 characters"},
+		{name: "crowded context", blocks: []slack.Block{slack.NewContextBlock("", contextElements(maxContextElements+1)...)}, wantErr: "context block has 11 elements"},
+		{name: "too many blocks", blocks: func() []slack.Block {
+			var blocks []slack.Block
+			for len(blocks) <= maxBlocksPerMessage {
+				blocks = append(blocks, valid[1])
+			}
+			return blocks
+		}(), wantErr: "message has 51 blocks, at most 50"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateBlocks(tt.blocks)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateBlocks() = %v, want the blocks accepted", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateBlocks() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInvalidInvitationBlocksAreNotSent(t *testing.T) {
+	fake := newFakeSlack(t, testUsers...)
+	h, _ := newTestInviteHandler(t, fake, testConfig())
+	status, response := h.sendInvite(InviteRequest{GameName: strings.Repeat("Catan ", 30), UserIDs: []string{"U2"}, Description: "Come play"})
+	if status != http.StatusBadRequest {
+		t.Fatalf("sendInvite = %d %v, want 400", status, response)
+	}
+	if got, _ := response["error"].(string); !strings.HasPrefix(got, "Invalid invitation message: block 0 (header): header text is") {
+		t.Errorf("error = %q, want the long header named", got)
+	}
+	if posts := fake.allPosts(); len(posts) != 0 {
+		t.Errorf("posted %+v, want nothing sent", posts)
+	}
+}
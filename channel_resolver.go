@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+var (
+	// channelLinkPattern matches Slack's channel link markup, "<#C0123456|general>" or "<#C0123456>".
+	channelLinkPattern = regexp.MustCompile(`^<#([A-Z0-9]+)(?:\|[^>]*)?>$`)
+	// channelIDPattern matches raw conversation IDs for public (C), private (G) and direct (D) channels.
+	channelIDPattern = regexp.MustCompile(`^[CGD][A-Z0-9]{6,}$`)
+)
+
+var (
+	// errChannelNotFound is returned when a channel reference names no channel the bot can see.
+	errChannelNotFound = errors.New("channel not found")
+	// errChannelLookup is returned when the channel list couldn't be fetched from Slack.
+	errChannelLookup = errors.New("listing channels failed")
+)
+
+// channelResolver turns the channel references users type ("#general", "<#C0123456|general>" or
+// "C0123456") into conversation IDs, validating that the channel exists and the bot is in it.
+// The channel list is cached for ttl.
+type channelResolver struct {
+	slackClient *slack.Client
+	ttl         time.Duration
+
+	mutex     sync.Mutex
+	channels  []slack.Channel
+	fetchedAt time.Time
+}
+
+// newChannelResolver creates a resolver whose channel list is considered fresh for ttl.
+func newChannelResolver(slackClient *slack.Client, ttl time.Duration) *channelResolver {
+	return &channelResolver{
+		slackClient: slackClient,
+		ttl:         ttl,
+	}
+}
+
+// resolve returns the conversation ID for ref. Direct message IDs are passed through, since
+// conversations.list doesn't return them without the im scope.
+func (r *channelResolver) resolve(ref string) (string, error) {
+	ref = strings.TrimSpace(ref)
+	if m := channelLinkPattern.FindStringSubmatch(ref); m != nil {
+		ref = m[1]
+	}
+	if strings.HasPrefix(ref, "D") && channelIDPattern.MatchString(ref) {
+		return ref, nil
+	}
+
+	var match func(slack.Channel) bool
+	switch {
+	case channelIDPattern.MatchString(ref):
+		match = func(ch slack.Channel) bool { return ch.ID == ref }
+	case strings.HasPrefix(ref, "#") && len(ref) > 1:
+		name := strings.ToLower(ref[1:])
+		match = func(ch slack.Channel) bool { return ch.Name == name }
+	default:
+		return "", fmt.Errorf("invalid channel %q, expected #channel-name, a channel link or a channel ID", ref)
+	}
+
+	channels, err := r.list()
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errChannelLookup, err)
+	}
+	for _, ch := range channels {
+		if !match(ch) {
+			continue
+		}
+		if !ch.IsMember {
+			return "", fmt.Errorf("the bot is not a member of #%s, invite it to the channel first", ch.Name)
+		}
+		return ch.ID, nil
+	}
+	return "", fmt.Errorf("%w: %s", errChannelNotFound, ref)
+}
+
+// list returns the cached channel list, fetching every page from conversations.list when it is
+// missing or stale.
+func (r *channelResolver) list() ([]slack.Channel, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.channels != nil && time.Since(r.fetchedAt) <= r.ttl {
+		return r.channels, nil
+	}
+
+	logger.Debug("Refreshing Slack channel cache")
+	var channels []slack.Channel
+	params := &slack.GetConversationsParameters{
+		Types:           []string{"public_channel", "private_channel"},
+		ExcludeArchived: true,
+		Limit:           1000,
+	}
+	for {
+		page, cursor, err := r.slackClient.GetConversations(params)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, page...)
+		if cursor == "" {
+			break
+		}
+		params.Cursor = cursor
+	}
+	r.channels = channels
+	r.fetchedAt = time.Now()
+	logger.Info("Slack channel cache refreshed", "channels", len(channels))
+	return channels, nil
+}
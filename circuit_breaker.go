@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// errCircuitOpen is returned instead of calling a provider whose circuit breaker is open.
+var errCircuitOpen = errors.New("invitation generator is temporarily unavailable after repeated failures")
+
+// Circuit breaker states.
+const (
+	breakerClosed   = "closed"    // calls go through normally
+	breakerOpen     = "open"      // calls are short-circuited until the cooldown passes
+	breakerHalfOpen = "half_open" // a single probe call is allowed through
+)
+
+// breakerStateValues are the circuit_breaker_state gauge values for each state.
+var breakerStateValues = map[string]float64{breakerClosed: 0, breakerHalfOpen: 1, breakerOpen: 2}
+
+// circuitBreaker stops calling a failing dependency after a run of consecutive failures,
+// then lets one probe through once the cooldown has elapsed.
+type circuitBreaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mutex    sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+// newCircuitBreaker creates a closed breaker. A threshold of zero or less disables it. The
+// breaker's state is published as circuit_breaker_state, labelled with name.
+func newCircuitBreaker(name string, threshold int, cooldown time.Duration) *circuitBreaker {
+	b := &circuitBreaker{
+		name:      name,
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+	b.setState(breakerClosed)
+	return b
+}
+
+// setState moves the breaker to state and updates its gauge; the caller holds mutex, except
+// during construction.
+func (b *circuitBreaker) setState(state string) {
+	b.state = state
+	circuitBreakerState.WithLabelValues(b.name).Set(breakerStateValues[state])
+}
+
+// allow reports whether a call may proceed, moving an open breaker to half-open once the cooldown passes.
+func (b *circuitBreaker) allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		logger.Info("Circuit breaker cooldown elapsed, probing", "breaker", b.name)
+		b.setState(breakerHalfOpen)
+		return true
+	case breakerHalfOpen:
+		// A probe is already in flight.
+		return false
+	default:
+		return true
+	}
+}
+
+// record updates the breaker with the outcome of a call that allow let through.
+func (b *circuitBreaker) record(err error) {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err == nil {
+		if b.state != breakerClosed {
+			logger.Info("Circuit breaker call succeeded, closing", "breaker", b.name)
+		}
+		b.setState(breakerClosed)
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		logger.Warn("Circuit breaker opening after consecutive failures", "breaker", b.name, "cooldown", b.cooldown.String(), "failures", b.failures)
+		b.setState(breakerOpen)
+		b.openedAt = time.Now()
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCircuitBreakerStateGauge(t *testing.T) {
+	errFailed := errors.New("failed")
+	type call struct {
+		wait      bool  // let the cooldown elapse before the call
+		err       error // outcome recorded when the call is allowed
+		wantAllow bool
+		wantState string // state after the call
+	}
+	tests := []struct {
+		name  string
+		calls []call
+	}{
+		{
+			name: "opens after consecutive failures",
+			calls: []call{
+				{err: errFailed, wantAllow: true, wantState: breakerClosed},
+				{err: errFailed, wantAllow: true, wantState: breakerOpen},
+				{wantAllow: false, wantState: breakerOpen},
+			},
+		},
+		{
+			name: "success resets the failure count",
+			calls: []call{
+				{err: errFailed, wantAllow: true, wantState: breakerClosed},
+				{wantAllow: true, wantState: breakerClosed},
+				{err: errFailed, wantAllow: true, wantState: breakerClosed},
+			},
+		},
+		{
+			name: "successful probe closes the breaker",
+			calls: []call{
+				{err: errFailed, wantAllow: true},
+				{err: errFailed, wantAllow: true, wantState: breakerOpen},
+				{wait: true, wantAllow: true, wantState: breakerClosed},
+			},
+		},
+		{
+			name: "failed probe reopens the breaker",
+			calls: []call{
+				{err: errFailed, wantAllow: true},
+				{err: errFailed, wantAllow: true, wantState: breakerOpen},
+				{wait: true, err: errFailed, wantAllow: true, wantState: breakerOpen},
+				{wantAllow: false, wantState: breakerOpen},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const cooldown = 20 * time.Millisecond
+			b := newCircuitBreaker("test-"+tt.name, 2, cooldown)
+			gauge := circuitBreakerState.WithLabelValues(b.name)
+			if got := testutil.ToFloat64(gauge); got != breakerStateValues[breakerClosed] {
+				t.Fatalf("new breaker gauge = %v, want closed", got)
+			}
+			for i, c := range tt.calls {
+				if c.wait {
+					time.Sleep(cooldown + 5*time.Millisecond)
+				}
+				allowed := b.allow()
+				if allowed != c.wantAllow {
+					t.Fatalf("call %d: allow() = %v, want %v", i, allowed, c.wantAllow)
+				}
+				if allowed {
+					b.record(c.err)
+				}
+				if c.wantState == "" {
+					continue
+				}
+				if got := testutil.ToFloat64(gauge); got != breakerStateValues[c.wantState] {
+					t.Errorf("call %d: gauge = %v, want %v (%s)", i, got, breakerStateValues[c.wantState], c.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerHalfOpenGauge(t *testing.T) {
+	b := newCircuitBreaker("test-half-open", 1, time.Millisecond)
+	b.record(errors.New("failed"))
+	time.Sleep(5 * time.Millisecond)
+	if !b.allow() {
+		t.Fatal("allow() = false after the cooldown, want a probe")
+	}
+	if got := testutil.ToFloat64(circuitBreakerState.WithLabelValues(b.name)); got != breakerStateValues[breakerHalfOpen] {
+		t.Errorf("gauge while probing = %v, want half-open", got)
+	}
+	if b.allow() {
+		t.Error("allow() = true while a probe is in flight")
+	}
+}
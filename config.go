@@ -0,0 +1,542 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Config holds the tunable settings for the bot, read from the environment at startup.
+type Config struct {
+	// AppEnv selects an environment-specific credential set, e.g. "prod" reads PROD_SLACK_BOT_TOKEN
+	// before falling back to SLACK_BOT_TOKEN.
+	AppEnv string
+	// SlackBotToken, SlackSigningSecret and GeminiAPIKey are secrets and must never be logged.
+	SlackBotToken string
+	// SlackSigningSecret is the app's signing secret, used to verify that requests to the Slack
+	// endpoints come from Slack; empty leaves them unverified.
+	SlackSigningSecret string
+	GeminiAPIKey       string
+	// ListenNetwork and ListenAddr are where the HTTP server listens: "tcp" and HOST:PORT, or
+	// "unix" and a socket path when PORT starts with a slash.
+	ListenNetwork string
+	ListenAddr    string
+	// HTTP server timeouts. Slack events are acknowledged before they are handled, but a
+	// synchronous POST /invite sends to every recipient before responding, so WriteTimeout
+	// must leave room for that.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// ShutdownTimeout bounds how long in-flight requests are drained on SIGINT or SIGTERM.
+	ShutdownTimeout time.Duration
+	// InvitationProvider names the service that writes invitation messages: "gemini" or "openai".
+	InvitationProvider string
+	// InvitationFallback sends InvitationFallbackTemplate, with {inviter}, {recipients} and {game}
+	// filled in, when the generator fails instead of aborting the invite.
+	InvitationFallback         bool
+	InvitationFallbackTemplate string
+	// OpenAIAPIKey and OpenAIModel configure the OpenAI generator.
+	OpenAIAPIKey string
+	OpenAIModel  string
+	// GeneratorTimeout bounds each generator request, and GeneratorMaxAttempts is how many
+	// requests one generation may make when the provider rate limits or fails with a server error.
+	GeneratorTimeout     time.Duration
+	GeneratorMaxAttempts int
+	// PromptTemplate is the parsed text/template used to build the generator prompt,
+	// and PromptPersona an optional voice passed to it.
+	PromptTemplate *template.Template
+	PromptPersona  string
+	// CallToAction asks the generator to end with a call to action and adds suggested reactions
+	// below DM-flow invitations.
+	CallToAction bool
+	// PerRecipientLanguage writes each DM-flow invitation in the language of its recipients'
+	// Slack locale, generating it once per language for at most MaxInviteLanguages languages.
+	PerRecipientLanguage bool
+	MaxInviteLanguages   int
+	// LLMNameSuggestions replies to unmatched names with a generated "did you mean" suggestion.
+	LLMNameSuggestions bool
+	// LLMGameExtraction has the generator pick the game out of a free-form reply at the game step,
+	// asking the user to confirm it before sending.
+	LLMGameExtraction bool
+	// MaxMessageLength caps the length (in characters) of generated invitation text.
+	// Zero or a negative value disables truncation.
+	MaxMessageLength int
+	// StrictEventValidation rejects clearly malformed Slack callbacks with a 400 instead of only logging them.
+	StrictEventValidation bool
+	// BotUsername and BotIconEmoji override the display name and icon used for invitations.
+	// Slack only honours them when the app has the chat:write.customize scope.
+	BotUsername  string
+	BotIconEmoji string
+	// UserCacheTTL is how long the cached Slack user list is reused before it is fetched again.
+	UserCacheTTL time.Duration
+	// AdminAPIKey guards the /admin endpoints; they are disabled when it is empty.
+	AdminAPIKey string
+	// ActionSigningSecret signs the values embedded in invitation buttons so forged clicks can be
+	// rejected. Buttons are unsigned when it is empty.
+	ActionSigningSecret string
+	// MaxNameAttempts is how many unmatched replies the awaiting_names step accepts before the
+	// conversation is reset. Zero or a negative value retries forever.
+	MaxNameAttempts int
+	// MaxNamesInputLength (characters) and MaxNamesPerInvite bound the comma separated names a
+	// user may type in one message, keeping matching cheap. Zero or a negative value disables a limit.
+	MaxNamesInputLength int
+	MaxNamesPerInvite   int
+	// MatchMaxEditDistance is how many typos a name may contain and still match someone when no
+	// handle or real name contains it. Zero disables misspelling tolerance.
+	MatchMaxEditDistance int
+	// StoreBackend selects where all bot state lives: "memory" (default) or "redis". RedisURL is
+	// required for Redis, and ConversationTTL is how long an idle conversation is kept.
+	StoreBackend    string
+	RedisURL        string
+	ConversationTTL time.Duration
+	// RedisFallback keeps the bot working on in-memory state when Redis fails at runtime,
+	// retrying Redis every RedisRetryInterval.
+	RedisFallback      bool
+	RedisRetryInterval time.Duration
+	// AllowSelfInvite keeps the inviter in their own recipient list instead of removing them.
+	AllowSelfInvite bool
+	// GeneratorBreakerThreshold is the number of consecutive generator failures that opens the
+	// circuit breaker; zero disables it. GeneratorBreakerCooldown is how long it stays open.
+	GeneratorBreakerThreshold int
+	GeneratorBreakerCooldown  time.Duration
+	// SlackSendsPerMinute paces every chat.postMessage call to match the app's Slack rate tier,
+	// allowing bursts of SlackSendBurst; zero disables pacing. SlackSendMaxRetries is how often a
+	// send that is still rate limited by Slack is retried.
+	SlackSendsPerMinute int
+	SlackSendBurst      int
+	SlackSendMaxRetries int
+	// SlackHTTPTimeout bounds each Slack Web API request, so a hung connection can't hold up a
+	// flow indefinitely; 0 waits as long as it takes.
+	SlackHTTPTimeout time.Duration
+	// RedirectAllTo, when set, is a user ID that receives every invitation in place of the real
+	// recipients, for end-to-end testing without messaging anyone else.
+	RedirectAllTo string
+	// SendConcurrency bounds how many recipients of one invitation are sent to in parallel.
+	SendConcurrency int
+	// MaxConcurrentSends bounds the sends in flight across all invitations at once; 0 for no limit.
+	MaxConcurrentSends int
+	// BlockedGames refuses invitations to the games listed in BLOCKED_GAMES, matched according
+	// to BLOCKED_GAMES_MATCH ("exact" or "substring", both case-insensitive).
+	BlockedGames *gameBlocklist
+	// GameCooldown is the minimum time between invitations to the same game, 0 for none.
+	// GameCooldowns overrides it for individual games, keyed by lower-cased game name.
+	GameCooldown  time.Duration
+	GameCooldowns map[string]time.Duration
+	// PostGameFeedback DMs accepters of invitations with a game_time when the game ends, asking
+	// how it went.
+	PostGameFeedback bool
+	// RecipientReminders adds a "Remind me" select to invitations, delivering them again to a
+	// recipient in 15 minutes, an hour or the next morning in their timezone.
+	RecipientReminders bool
+	// DayOfConfirmationLead is how long before an invitation's game_time its accepters are asked
+	// whether they're still on, 0 to not ask.
+	DayOfConfirmationLead time.Duration
+	// InviterNotifyWindow is the least time between DMs telling an inviter about answers to one
+	// invitation; answers within it are batched into one update. 0 DMs every answer.
+	InviterNotifyWindow time.Duration
+	// MaxPendingInvites caps the invitations sent through the API that are still awaiting
+	// answers across the workspace, 0 for no cap. Invitations without a game time stop counting
+	// after PendingInviteTTL.
+	MaxPendingInvites int
+	PendingInviteTTL  time.Duration
+	// Regulars are the user IDs invited when someone answers "regulars" at the names step.
+	Regulars []string
+	// InvitationClosing is a sign-off appended to generated invitations, empty for none.
+	// InvitationClosings overrides it for individual games, keyed by lower-cased game name.
+	InvitationClosing  string
+	InvitationClosings map[string]string
+
+	// GreetingDelay splits the greeting of a new conversation from the names prompt, sending the
+	// prompt this long after the greeting; 0 sends them as one message.
+	GreetingDelay time.Duration
+
+	// InviteAPIKeys maps the API keys accepted by the invite API to the user each one invites as.
+	// When set, invite, recurring and list requests must carry one of the keys as a bearer token.
+	InviteAPIKeys map[string]string
+
+	// MatchTimeout bounds fetching the user directory and matching names in the Slack flows;
+	// 0 waits as long as it takes.
+	MatchTimeout time.Duration
+
+	// EventDedupeWindow is how long the IDs of processed Slack events are remembered so retried
+	// deliveries are acknowledged without being processed again; 0 disables deduplication.
+	EventDedupeWindow time.Duration
+
+	// MaintenanceMode stops every invitation from being sent, answering with a "temporarily
+	// unavailable" message instead; health checks and read-only endpoints keep working.
+	MaintenanceMode bool
+
+	// LogLevel is the minimum level of log records written, set by LOG_LEVEL.
+	LogLevel slog.Level
+
+	// Replies are the conversation reply templates, the defaults with any overrides from
+	// REPLY_TEMPLATES_FILE applied.
+	Replies replyTemplates
+}
+
+// loadConfig reads the bot configuration from environment variables, applying defaults.
+// It fails if a required setting is missing or a setting is present but unusable, such as a
+// prompt template that doesn't parse, reporting every problem found rather than only the first.
+func loadConfig() (*Config, error) {
+	var problems []error
+
+	promptText := os.Getenv("PROMPT_TEMPLATE")
+	if promptText == "" {
+		promptText = defaultPromptTemplate
+	}
+	promptTemplate, err := parsePromptTemplate(promptText)
+	if err != nil {
+		problems = append(problems, fmt.Errorf("invalid PROMPT_TEMPLATE: %w", err))
+	}
+
+	replies, err := loadReplyTemplates(os.Getenv("REPLY_TEMPLATES_FILE"))
+	if err != nil {
+		problems = append(problems, fmt.Errorf("invalid REPLY_TEMPLATES_FILE: %w", err))
+	}
+
+	provider := strings.ToLower(strings.TrimSpace(os.Getenv("INVITE_GENERATOR")))
+	switch provider {
+	case "":
+		provider = providerGemini
+	case providerGemini, providerOpenAI:
+	default:
+		problems = append(problems, fmt.Errorf("invalid INVITE_GENERATOR %q, expected %q or %q", provider, providerGemini, providerOpenAI))
+	}
+
+	blockMatch := os.Getenv("BLOCKED_GAMES_MATCH")
+	switch blockMatch {
+	case "":
+		blockMatch = blockMatchExact
+	case blockMatchExact, blockMatchSubstring:
+	default:
+		problems = append(problems, fmt.Errorf("invalid BLOCKED_GAMES_MATCH %q, expected %q or %q", blockMatch, blockMatchExact, blockMatchSubstring))
+	}
+
+	closings, err := parseGameClosings(os.Getenv("INVITATION_CLOSINGS"))
+	if err != nil {
+		problems = append(problems, fmt.Errorf("invalid INVITATION_CLOSINGS: %w", err))
+	}
+
+	gameCooldowns, err := parseGameCooldowns(os.Getenv("GAME_COOLDOWNS"))
+	if err != nil {
+		problems = append(problems, fmt.Errorf("invalid GAME_COOLDOWNS: %w", err))
+	}
+
+	regulars, err := parseUserIDs(os.Getenv("REGULARS"))
+	if err != nil {
+		problems = append(problems, fmt.Errorf("invalid REGULARS: %w", err))
+	}
+
+	logLevel, err := parseLogLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		problems = append(problems, fmt.Errorf("invalid LOG_LEVEL: %w", err))
+	}
+
+	appEnv := strings.TrimSpace(os.Getenv("APP_ENV"))
+	inviteAPIKeys, err := parseAPIKeys(getEnvScoped(appEnv, "INVITE_API_KEYS"))
+	if err != nil {
+		problems = append(problems, fmt.Errorf("invalid INVITE_API_KEYS: %w", err))
+	}
+
+	listenNetwork, listenAddr, err := parseListenAddr(os.Getenv("HOST"), os.Getenv("PORT"))
+	if err != nil {
+		problems = append(problems, err)
+	}
+
+	config := &Config{
+		AppEnv:                     appEnv,
+		SlackBotToken:              getEnvScoped(appEnv, "SLACK_BOT_TOKEN"),
+		SlackSigningSecret:         getEnvScoped(appEnv, "SLACK_SIGNING_SECRET"),
+		GeminiAPIKey:               getEnvScoped(appEnv, "GOOGLE_GEMINI_API_KEY"),
+		ListenNetwork:              listenNetwork,
+		ListenAddr:                 listenAddr,
+		ReadHeaderTimeout:          getEnvDuration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second, &problems),
+		ReadTimeout:                getEnvDuration("HTTP_READ_TIMEOUT", 15*time.Second, &problems),
+		WriteTimeout:               getEnvDuration("HTTP_WRITE_TIMEOUT", 60*time.Second, &problems),
+		IdleTimeout:                getEnvDuration("HTTP_IDLE_TIMEOUT", 120*time.Second, &problems),
+		ShutdownTimeout:            getEnvDuration("SHUTDOWN_TIMEOUT", 10*time.Second, &problems),
+		InvitationProvider:         provider,
+		OpenAIAPIKey:               getEnvScoped(appEnv, "OPENAI_API_KEY"),
+		InvitationFallback:         getEnvBool("INVITATION_FALLBACK", true, &problems),
+		InvitationFallbackTemplate: getEnvString("INVITATION_FALLBACK_TEMPLATE", defaultFallbackTemplate),
+		OpenAIModel:                getEnvString("OPENAI_MODEL", "gpt-4o-mini"),
+		// GEMINI_* predate the OpenAI generator and are still honored.
+		GeneratorTimeout:     getEnvDuration("GENERATOR_TIMEOUT", getEnvDuration("GEMINI_TIMEOUT", 15*time.Second, &problems), &problems),
+		GeneratorMaxAttempts: getEnvInt("GENERATOR_MAX_ATTEMPTS", getEnvInt("GEMINI_MAX_ATTEMPTS", 3, &problems), &problems),
+		PromptTemplate:       promptTemplate,
+		Replies:              replies,
+		PromptPersona:        os.Getenv("PROMPT_PERSONA"),
+		CallToAction:         getEnvBool("CALL_TO_ACTION", false, &problems),
+		PerRecipientLanguage: getEnvBool("PER_RECIPIENT_LANGUAGE", false, &problems),
+		MaxInviteLanguages:   getEnvInt("MAX_INVITE_LANGUAGES", 3, &problems),
+		LLMNameSuggestions:   getEnvBool("LLM_NAME_SUGGESTIONS", false, &problems),
+		LLMGameExtraction:    getEnvBool("LLM_GAME_EXTRACTION", false, &problems),
+		// Slack section blocks accept at most 3000 characters of text.
+		MaxMessageLength:          getEnvInt("MAX_MESSAGE_LENGTH", 3000, &problems),
+		StrictEventValidation:     getEnvBool("STRICT_EVENT_VALIDATION", false, &problems),
+		BotUsername:               os.Getenv("BOT_USERNAME"),
+		BotIconEmoji:              os.Getenv("BOT_ICON_EMOJI"),
+		UserCacheTTL:              getEnvDuration("USER_CACHE_TTL", 5*time.Minute, &problems),
+		AdminAPIKey:               getEnvScoped(appEnv, "ADMIN_API_KEY"),
+		ActionSigningSecret:       getEnvScoped(appEnv, "ACTION_SIGNING_SECRET"),
+		MaxNameAttempts:           getEnvInt("MAX_NAME_ATTEMPTS", 3, &problems),
+		AllowSelfInvite:           getEnvBool("ALLOW_SELF_INVITE", false, &problems),
+		StoreBackend:              getEnvFallback("STORE_BACKEND", "CONVERSATION_STORE"),
+		RedisURL:                  getEnvScoped(appEnv, "REDIS_URL"),
+		RedisFallback:             getEnvBool("REDIS_FALLBACK", true, &problems),
+		RedisRetryInterval:        getEnvDuration("REDIS_RETRY_INTERVAL", 30*time.Second, &problems),
+		ConversationTTL:           getEnvDuration("CONVERSATION_TTL", 30*time.Minute, &problems),
+		MaxNamesInputLength:       getEnvInt("MAX_NAMES_INPUT_LENGTH", 2000, &problems),
+		MaxNamesPerInvite:         getEnvInt("MAX_NAMES_PER_INVITE", 50, &problems),
+		MatchMaxEditDistance:      getEnvInt("MATCH_MAX_EDIT_DISTANCE", 2, &problems),
+		GeneratorBreakerThreshold: getEnvInt("GENERATOR_BREAKER_THRESHOLD", 5, &problems),
+		GeneratorBreakerCooldown:  getEnvDuration("GENERATOR_BREAKER_COOLDOWN", 30*time.Second, &problems),
+		SlackSendsPerMinute:       getEnvInt("SLACK_SENDS_PER_MINUTE", 50, &problems),
+		SlackSendBurst:            getEnvInt("SLACK_SEND_BURST", 5, &problems),
+		SlackSendMaxRetries:       getEnvInt("SLACK_SEND_MAX_RETRIES", 3, &problems),
+		SlackHTTPTimeout:          getEnvDuration("SLACK_HTTP_TIMEOUT", 30*time.Second, &problems),
+		SendConcurrency:           getEnvInt("SEND_CONCURRENCY", 10, &problems),
+		MaxConcurrentSends:        getEnvInt("MAX_CONCURRENT_SENDS", 20, &problems),
+		RedirectAllTo:             os.Getenv("REDIRECT_ALL_TO"),
+		BlockedGames:              newGameBlocklist(os.Getenv("BLOCKED_GAMES"), blockMatch),
+		GameCooldown:              getEnvDuration("GAME_COOLDOWN", 0, &problems),
+		GameCooldowns:             gameCooldowns,
+		PostGameFeedback:          getEnvBool("POST_GAME_FEEDBACK", false, &problems),
+		DayOfConfirmationLead:     getEnvDuration("DAY_OF_CONFIRMATION_LEAD", 0, &problems),
+		RecipientReminders:        getEnvBool("RECIPIENT_REMINDERS", false, &problems),
+		InviterNotifyWindow:       getEnvDuration("INVITER_NOTIFY_WINDOW", 10*time.Minute, &problems),
+		MaxPendingInvites:         getEnvInt("MAX_PENDING_INVITES", 0, &problems),
+		PendingInviteTTL:          getEnvDuration("PENDING_INVITE_TTL", 48*time.Hour, &problems),
+		Regulars:                  dedupeIDs(regulars),
+		InvitationClosing:         strings.TrimSpace(os.Getenv("INVITATION_CLOSING")),
+		InvitationClosings:        closings,
+		LogLevel:                  logLevel,
+		MaintenanceMode:           getEnvBool("MAINTENANCE_MODE", false, &problems),
+		MatchTimeout:              getEnvDuration("MATCH_TIMEOUT", 5*time.Second, &problems),
+		EventDedupeWindow:         getEnvDuration("EVENT_DEDUPE_WINDOW", 10*time.Minute, &problems),
+		InviteAPIKeys:             inviteAPIKeys,
+		GreetingDelay:             getEnvDuration("GREETING_DELAY", 0, &problems),
+	}
+
+	// Report every missing setting at once rather than making operators fix them one per restart.
+	var missing []string
+	if config.SlackBotToken == "" {
+		missing = append(missing, "SLACK_BOT_TOKEN")
+	}
+	switch {
+	case provider == providerGemini && config.GeminiAPIKey == "":
+		missing = append(missing, "GOOGLE_GEMINI_API_KEY")
+	case provider == providerOpenAI && config.OpenAIAPIKey == "":
+		missing = append(missing, "OPENAI_API_KEY")
+	}
+	if err := validateIdentity(config.BotUsername, config.BotIconEmoji); err != nil {
+		problems = append(problems, fmt.Errorf("invalid BOT_USERNAME/BOT_ICON_EMOJI: %w", err))
+	}
+	if err := validateClosings(config.InvitationClosing, config.InvitationClosings, config.MaxMessageLength); err != nil {
+		problems = append(problems, fmt.Errorf("invalid INVITATION_CLOSING/INVITATION_CLOSINGS: %w", err))
+	}
+	if len(missing) > 0 {
+		problems = append([]error{fmt.Errorf("missing required environment variables: %s", strings.Join(missing, ", "))}, problems...)
+	}
+	if len(problems) > 0 {
+		return nil, errors.Join(problems...)
+	}
+	return config, nil
+}
+
+// userIDPattern matches Slack user IDs such as "U0123456".
+var userIDPattern = regexp.MustCompile(`^[UW][A-Z0-9]{6,}$`)
+
+// parseUserIDs parses a comma separated list of Slack user IDs.
+func parseUserIDs(list string) ([]string, error) {
+	var ids []string
+	for _, id := range strings.Split(list, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		if !userIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("%q is not a Slack user ID", id)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// redactSecret hides a secret value, only revealing whether it is set.
+func redactSecret(value string) string {
+	if value == "" {
+		return "(unset)"
+	}
+	return "(redacted)"
+}
+
+// banner renders the effective configuration as key=value pairs with secrets redacted.
+func (c *Config) banner() string {
+	fields := []string{
+		fmt.Sprintf("app_env=%q", c.AppEnv),
+		"listen_addr=" + c.ListenNetwork + ":" + c.ListenAddr,
+		"provider=" + c.InvitationProvider,
+		fmt.Sprintf("invitation_fallback=%t", c.InvitationFallback),
+		fmt.Sprintf("invitation_fallback_template=%q", c.InvitationFallbackTemplate),
+		"openai_api_key=" + redactSecret(c.OpenAIAPIKey),
+		"openai_model=" + c.OpenAIModel,
+		"generator_timeout=" + c.GeneratorTimeout.String(),
+		fmt.Sprintf("generator_max_attempts=%d", c.GeneratorMaxAttempts),
+		fmt.Sprintf("prompt_custom=%t", os.Getenv("PROMPT_TEMPLATE") != ""),
+		fmt.Sprintf("replies_custom=%t", os.Getenv("REPLY_TEMPLATES_FILE") != ""),
+		fmt.Sprintf("prompt_persona=%q", c.PromptPersona),
+		fmt.Sprintf("call_to_action=%t", c.CallToAction),
+		fmt.Sprintf("per_recipient_language=%t", c.PerRecipientLanguage),
+		fmt.Sprintf("max_invite_languages=%d", c.MaxInviteLanguages),
+		fmt.Sprintf("llm_name_suggestions=%t", c.LLMNameSuggestions),
+		fmt.Sprintf("llm_game_extraction=%t", c.LLMGameExtraction),
+		"http_read_header_timeout=" + c.ReadHeaderTimeout.String(),
+		"http_read_timeout=" + c.ReadTimeout.String(),
+		"http_write_timeout=" + c.WriteTimeout.String(),
+		"http_idle_timeout=" + c.IdleTimeout.String(),
+		"shutdown_timeout=" + c.ShutdownTimeout.String(),
+		"slack_bot_token=" + redactSecret(c.SlackBotToken),
+		"slack_signing_secret=" + redactSecret(c.SlackSigningSecret),
+		"gemini_api_key=" + redactSecret(c.GeminiAPIKey),
+		"admin_api_key=" + redactSecret(c.AdminAPIKey),
+		"action_signing_secret=" + redactSecret(c.ActionSigningSecret),
+		fmt.Sprintf("max_message_length=%d", c.MaxMessageLength),
+		fmt.Sprintf("max_name_attempts=%d", c.MaxNameAttempts),
+		fmt.Sprintf("max_names_input_length=%d", c.MaxNamesInputLength),
+		fmt.Sprintf("max_names_per_invite=%d", c.MaxNamesPerInvite),
+		fmt.Sprintf("match_max_edit_distance=%d", c.MatchMaxEditDistance),
+		fmt.Sprintf("allow_self_invite=%t", c.AllowSelfInvite),
+		fmt.Sprintf("store_backend=%q", c.StoreBackend),
+		"redis_url=" + redactSecret(c.RedisURL),
+		fmt.Sprintf("redis_fallback=%t", c.RedisFallback),
+		"redis_retry_interval=" + c.RedisRetryInterval.String(),
+		"conversation_ttl=" + c.ConversationTTL.String(),
+		"user_cache_ttl=" + c.UserCacheTTL.String(),
+		fmt.Sprintf("generator_breaker_threshold=%d", c.GeneratorBreakerThreshold),
+		"generator_breaker_cooldown=" + c.GeneratorBreakerCooldown.String(),
+		fmt.Sprintf("slack_sends_per_minute=%d", c.SlackSendsPerMinute),
+		fmt.Sprintf("slack_send_burst=%d", c.SlackSendBurst),
+		fmt.Sprintf("slack_send_max_retries=%d", c.SlackSendMaxRetries),
+		"slack_http_timeout=" + c.SlackHTTPTimeout.String(),
+		fmt.Sprintf("send_concurrency=%d", c.SendConcurrency),
+		fmt.Sprintf("max_concurrent_sends=%d", c.MaxConcurrentSends),
+		fmt.Sprintf("redirect_all_to=%q", c.RedirectAllTo),
+		fmt.Sprintf("blocked_games=%d", len(c.BlockedGames.games)),
+		"blocked_games_match=" + c.BlockedGames.mode,
+		"game_cooldown=" + c.GameCooldown.String(),
+		fmt.Sprintf("game_cooldowns=%d", len(c.GameCooldowns)),
+		fmt.Sprintf("post_game_feedback=%t", c.PostGameFeedback),
+		"day_of_confirmation_lead=" + c.DayOfConfirmationLead.String(),
+		fmt.Sprintf("recipient_reminders=%t", c.RecipientReminders),
+		"inviter_notify_window=" + c.InviterNotifyWindow.String(),
+		fmt.Sprintf("max_pending_invites=%d", c.MaxPendingInvites),
+		"pending_invite_ttl=" + c.PendingInviteTTL.String(),
+		fmt.Sprintf("regulars=%d", len(c.Regulars)),
+		fmt.Sprintf("closing=%t", c.InvitationClosing != ""),
+		fmt.Sprintf("game_closings=%d", len(c.InvitationClosings)),
+		fmt.Sprintf("strict_event_validation=%t", c.StrictEventValidation),
+		"log_level=" + c.LogLevel.String(),
+		fmt.Sprintf("maintenance_mode=%t", c.MaintenanceMode),
+		"match_timeout=" + c.MatchTimeout.String(),
+		"event_dedupe_window=" + c.EventDedupeWindow.String(),
+		fmt.Sprintf("invite_api_keys=%d", len(c.InviteAPIKeys)),
+		"greeting_delay=" + c.GreetingDelay.String(),
+		fmt.Sprintf("bot_username=%q", c.BotUsername),
+		fmt.Sprintf("bot_icon_emoji=%q", c.BotIconEmoji),
+	}
+	return strings.Join(fields, " ")
+}
+
+// closingFor returns the sign-off for invitations to game: its INVITATION_CLOSINGS entry if it
+// has one, otherwise INVITATION_CLOSING.
+func (c *Config) closingFor(game string) string {
+	if closing, ok := c.InvitationClosings[normalizeGame(game)]; ok {
+		return closing
+	}
+	return c.InvitationClosing
+}
+
+// logBanner logs the effective configuration once at startup.
+func (c *Config) logBanner() {
+	logger.Info("Starting slack-game-inviter", "event_type", "startup", "configuration", c.banner())
+}
+
+// getEnvScoped reads a credential for the given app environment, preferring the prefixed
+// variable (e.g. PROD_SLACK_BOT_TOKEN for "prod") and falling back to the unprefixed one.
+func getEnvScoped(appEnv, key string) string {
+	if appEnv != "" {
+		if value := os.Getenv(strings.ToUpper(appEnv) + "_" + key); value != "" {
+			return value
+		}
+	}
+	return os.Getenv(key)
+}
+
+// getEnvString reads a string environment variable, falling back to def when unset.
+func getEnvString(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
+
+// getEnvFallback reads key, falling back to the older name it replaced.
+func getEnvFallback(key, oldKey string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return os.Getenv(oldKey)
+}
+
+// getEnvInt reads an integer environment variable, falling back to def when unset. A value
+// that isn't a whole number is added to problems.
+func getEnvInt(key string, def int, problems *[]error) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		*problems = append(*problems, fmt.Errorf("invalid %s %q: expected a whole number", key, value))
+		return def
+	}
+	return n
+}
+
+// getEnvBool reads a boolean environment variable, falling back to def when unset. A value
+// that isn't a boolean is added to problems.
+func getEnvBool(key string, def bool, problems *[]error) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		*problems = append(*problems, fmt.Errorf("invalid %s %q: expected true or false", key, value))
+		return def
+	}
+	return b
+}
+
+// getEnvDuration reads a duration environment variable such as "90s" or "5m", falling back to
+// def when unset. A value that isn't a duration is added to problems.
+func getEnvDuration(key string, def time.Duration, problems *[]error) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		*problems = append(*problems, fmt.Errorf("invalid %s %q: expected a duration such as 90s or 5m", key, value))
+		return def
+	}
+	return d
+}
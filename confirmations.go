@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Action IDs of the day-of confirmation buttons.
+const (
+	actionConfirmYes = "confirm_game_yes"
+	actionConfirmNo  = "confirm_game_no"
+)
+
+// confirmationKeyPrefix namespaces the day-of confirmations waiting to be sent.
+const confirmationKeyPrefix = "confirmation:"
+
+// pendingConfirmation is a day-of confirmation waiting for its send time.
+type pendingConfirmation struct {
+	UserID string            `json:"user_id"`
+	SendAt int64             `json:"send_at"` // unix seconds
+	Value  inviteActionValue `json:"value"`   // the invitation accepted, carried by the buttons
+}
+
+// dayOfConfirmations asks accepters of invitations with a game_time whether they are still on,
+// lead before the game starts. Confirmations wait in the shared Store and are sent by a loop
+// checking for due ones every interval; each is taken with GetDel before it is sent, so only
+// one instance sends it. A nil dayOfConfirmations does nothing.
+type dayOfConfirmations struct {
+	store     Store
+	sender    *messageSender
+	secret    []byte // signs the button values, like the invitation buttons
+	lead      time.Duration
+	paused    bool // holds confirmations while MAINTENANCE_MODE is on
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// newDayOfConfirmations keeps confirmations in store, sends them lead before each game and
+// checks for due ones every interval until Close is called.
+func newDayOfConfirmations(store Store, sender *messageSender, signingSecret string, lead time.Duration, paused bool, interval time.Duration) *dayOfConfirmations {
+	c := &dayOfConfirmations{store: store, sender: sender, secret: []byte(signingSecret), lead: lead, paused: paused, stop: make(chan struct{})}
+	go c.run(interval)
+	return c
+}
+
+// Close stops sending confirmations. It is safe to call more than once.
+func (c *dayOfConfirmations) Close() {
+	if c == nil {
+		return
+	}
+	c.closeOnce.Do(func() { close(c.stop) })
+}
+
+func (c *dayOfConfirmations) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case now := <-ticker.C:
+			c.sendDue(now)
+		}
+	}
+}
+
+// confirmationKey identifies userID's confirmation for one game session.
+func confirmationKey(userID string, value inviteActionValue) string {
+	return confirmationKeyPrefix + userID + ":" + strconv.FormatInt(value.GameStart, 10) + ":" + normalizeGame(value.Game)
+}
+
+// schedule queues a confirmation for userID, who accepted the invitation value describes.
+// Invitations without a game time get none. An acceptance closer to the game than the lead
+// time is confirmed on the next check, and one after the game started isn't confirmed at all.
+func (c *dayOfConfirmations) schedule(userID string, value inviteActionValue) {
+	if c == nil || value.GameStart == 0 {
+		return
+	}
+	start := time.Unix(value.GameStart, 0)
+	if !start.After(time.Now()) {
+		return
+	}
+	sendAt := start.Add(-c.lead)
+	data, err := json.Marshal(pendingConfirmation{UserID: userID, SendAt: sendAt.Unix(), Value: value})
+	if err == nil {
+		err = c.store.Set(confirmationKey(userID, value), data, time.Until(start))
+	}
+	if err != nil {
+		logger.Error("Error saving the day-of confirmation", "user_id", userID, "game", value.Game, "error", err)
+		return
+	}
+	logger.Info("Day-of confirmation queued", "user_id", userID, "game", value.Game, "send_at", sendAt.Format(time.RFC3339))
+}
+
+// cancel drops the confirmation queued for userID, who no longer accepts the invitation.
+func (c *dayOfConfirmations) cancel(userID string, value inviteActionValue) {
+	if c == nil || value.GameStart == 0 {
+		return
+	}
+	if _, err := c.store.Delete(confirmationKey(userID, value)); err != nil {
+		logger.Error("Error cancelling the day-of confirmation", "user_id", userID, "game", value.Game, "error", err)
+	}
+}
+
+// sendDue sends every confirmation due at now.
+func (c *dayOfConfirmations) sendDue(now time.Time) {
+	if c.paused {
+		return
+	}
+	keys, err := c.store.Keys(confirmationKeyPrefix)
+	if err != nil {
+		logger.Error("Error loading day-of confirmations", "error", err)
+		return
+	}
+	for _, key := range keys {
+		data, ok, err := c.store.Get(key)
+		if err != nil || !ok {
+			continue
+		}
+		var pending pendingConfirmation
+		if err := json.Unmarshal(data, &pending); err != nil {
+			logger.Warn("Dropping an unreadable day-of confirmation", "key", key, "error", err)
+			_, _ = c.store.Delete(key)
+			continue
+		}
+		if now.Before(time.Unix(pending.SendAt, 0)) {
+			continue
+		}
+		// Taking the entry claims it, so another instance checking at the same time skips it.
+		if _, taken, err := c.store.GetDel(key); err != nil || !taken {
+			continue
+		}
+		if !time.Unix(pending.Value.GameStart, 0).After(now) {
+			continue
+		}
+		c.send(pending)
+	}
+}
+
+// send DMs the confirmation with its yes and no buttons. The game time is rendered by Slack in
+// each reader's own timezone.
+func (c *dayOfConfirmations) send(pending pendingConfirmation) {
+	value := pending.Value
+	start := time.Unix(value.GameStart, 0).UTC()
+	when := fmt.Sprintf("<!date^%d^{date_short_pretty} at {time}|%s>", value.GameStart, start.Format(time.RFC1123))
+	text := fmt.Sprintf("Still on for %s at %s?", value.Game, when)
+	buttonValue := encodeInviteActionValue(value, c.secret)
+	_, _, err := c.sender.post(pending.UserID,
+		slack.MsgOptionText(text, false),
+		slack.MsgOptionBlocks(
+			slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("Still on for *%s* at %s?", value.Game, when), false, false), nil, nil),
+			slack.NewActionBlock("confirmation_actions",
+				slack.NewButtonBlockElement(actionConfirmYes, buttonValue, slack.NewTextBlockObject("plain_text", "Yes, I'm in", false, false)).WithStyle(slack.StylePrimary),
+				slack.NewButtonBlockElement(actionConfirmNo, buttonValue, slack.NewTextBlockObject("plain_text", "Can't make it", false, false)),
+			),
+		),
+	)
+	if err != nil {
+		logger.Error("Failed to send the day-of confirmation", "user_id", pending.UserID, "game", value.Game, "error", err)
+		return
+	}
+	logger.Info("Day-of confirmation sent", "user_id", pending.UserID, "game", value.Game, "invite_id", value.InviteID)
+}
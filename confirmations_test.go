@@ -0,0 +1,143 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// newTestConfirmations builds an InteractionHandler sending day-of confirmations lead before each
+// game, without starting the send loop, so tests drive sendDue themselves.
+func newTestConfirmations(t *testing.T, fake *fakeSlack, lead time.Duration) (*InteractionHandler, *dayOfConfirmations, *rsvpTracker) {
+	t.Helper()
+	store := NewInMemoryStore()
+	client := fake.client()
+	sender := newMessageSender(client, nil, newSendPacer(0, 0), 0, 0)
+	confirmations := &dayOfConfirmations{store: store, sender: sender, secret: []byte(testActionSecret), lead: lead, stop: make(chan struct{})}
+	rsvps := newRSVPTracker(store)
+	h := NewInteractionHandler(client, newUserCache(client, time.Minute), sender, testActionSecret, nil, confirmations, nil, rsvps, newInviterNotifier(store, sender, 0), newPendingInvites(store, 0, 0))
+	t.Cleanup(h.wait)
+	return h, confirmations, rsvps
+}
+
+func TestDayOfConfirmations(t *testing.T) {
+	gameStart := time.Now().Add(3 * time.Hour).Truncate(time.Second)
+	invite := inviteActionValue{Game: "Catan", InviterID: "U1", InviteID: "inv1", GameStart: gameStart.Unix()}
+	tests := []struct {
+		name     string
+		value    inviteActionValue
+		actions  []string      // clicked by U2 on the invitation, in order
+		checkAt  time.Duration // when sendDue runs, relative to the game start
+		paused   bool          // MAINTENANCE_MODE is on
+		wantSent bool
+	}{
+		{name: "not due yet", value: invite, actions: []string{actionAcceptGame}, checkAt: -90 * time.Minute},
+		{name: "due at the lead time", value: invite, actions: []string{actionAcceptGame}, checkAt: -time.Hour, wantSent: true},
+		{name: "declining cancels it", value: invite, actions: []string{actionAcceptGame, actionDeclineGame}, checkAt: -time.Hour},
+		{name: "maybe cancels it", value: invite, actions: []string{actionAcceptGame, actionMaybeGame}, checkAt: -time.Hour},
+		{name: "accepting again after declining", value: invite, actions: []string{actionDeclineGame, actionAcceptGame}, checkAt: -30 * time.Minute, wantSent: true},
+		{name: "no game time", value: inviteActionValue{Game: "Catan", InviterID: "U1", InviteID: "inv1"}, actions: []string{actionAcceptGame}, checkAt: -time.Hour},
+		{name: "game already started", value: invite, actions: []string{actionAcceptGame}, checkAt: time.Minute},
+		{name: "held in maintenance mode", value: invite, actions: []string{actionAcceptGame}, checkAt: -time.Hour, paused: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			h, confirmations, _ := newTestConfirmations(t, fake, time.Hour)
+			confirmations.paused = tt.paused
+			for _, actionID := range tt.actions {
+				click(h, "U2", actionID, tt.value)
+			}
+			h.wait()
+
+			confirmations.sendDue(gameStart.Add(tt.checkAt))
+			confirmations.sendDue(gameStart.Add(tt.checkAt)) // a second check sends nothing more
+
+			var sent []fakePost
+			for _, post := range fake.allPosts() {
+				if post.Channel == "U2" && strings.HasPrefix(post.Text, "Still on for") {
+					sent = append(sent, post)
+				}
+			}
+			if !tt.wantSent {
+				if len(sent) != 0 {
+					t.Fatalf("confirmations sent = %+v, want none", sent)
+				}
+				if tt.paused {
+					// The held confirmation is still queued for when maintenance ends.
+					if keys, err := confirmations.store.Keys(confirmationKeyPrefix); err != nil || len(keys) != 1 {
+						t.Errorf("queued confirmations = %q, %v, want one", keys, err)
+					}
+				}
+				return
+			}
+			if len(sent) != 1 {
+				t.Fatalf("confirmations sent = %d, want 1", len(sent))
+			}
+			if want := "Still on for Catan at <!date^" + strconv.FormatInt(gameStart.Unix(), 10) + "^"; !strings.HasPrefix(sent[0].Text, want) {
+				t.Errorf("confirmation = %q, want it to start with %q", sent[0].Text, want)
+			}
+			for _, actionID := range []string{actionConfirmYes, actionConfirmNo} {
+				if !strings.Contains(sent[0].Blocks, actionID) {
+					t.Errorf("confirmation blocks lack the %s button: %s", actionID, sent[0].Blocks)
+				}
+			}
+		})
+	}
+}
+
+func TestDayOfConfirmationAnswers(t *testing.T) {
+	value := inviteActionValue{Game: "Catan", InviterID: "U1", InviteID: "inv1", GameStart: time.Now().Add(time.Hour).Unix()}
+	tests := []struct {
+		name         string
+		actionID     string
+		wantReply    string
+		wantDeclined []string
+		wantInviter  []string
+	}{
+		{name: "still on", actionID: actionConfirmYes, wantReply: "Great, you're still on for Catan. See you there!"},
+		{
+			name:         "can't make it",
+			actionID:     actionConfirmNo,
+			wantReply:    "Okay, you're out of Catan. I'll let the organizer know.",
+			wantDeclined: []string{"Bob Baker"},
+			wantInviter:  []string{"Bob Baker can no longer make your Catan invite. So far: 0 accepted, 0 maybe, 1 declined."},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			h, _, rsvps := newTestConfirmations(t, fake, time.Hour)
+			click(h, "U2", actionAcceptGame, value)
+			h.wait()
+			before := len(fake.postsTo("U1"))
+
+			callback := &slack.InteractionCallback{Type: slack.InteractionTypeBlockActions, User: slack.User{ID: "U2"}, Container: slack.Container{ChannelID: "DU2", MessageTs: "1700000000.000009"}}
+			h.router.dispatch(callback, &slack.BlockAction{ActionID: tt.actionID, Value: encodeInviteActionValue(value, []byte(testActionSecret))})
+			h.wait()
+
+			var replies []string
+			for _, update := range fake.allUpdates() {
+				if update.Channel == "DU2" && update.TS == "1700000000.000009" {
+					replies = append(replies, update.Text)
+				}
+			}
+			if len(replies) != 1 || replies[0] != tt.wantReply {
+				t.Errorf("confirmation updated to %q, want [%q]", replies, tt.wantReply)
+			}
+			tally, _, err := rsvps.get("inv1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tally.Declined.Names; strings.Join(got, ",") != strings.Join(tt.wantDeclined, ",") {
+				t.Errorf("declined = %q, want %q", got, tt.wantDeclined)
+			}
+			if got := fake.postsTo("U1")[before:]; strings.Join(got, "|") != strings.Join(tt.wantInviter, "|") {
+				t.Errorf("inviter notified %q, want %q", got, tt.wantInviter)
+			}
+		})
+	}
+}
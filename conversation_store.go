@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ConversationStore persists ConversationState between messages, keyed by the user's Slack ID.
+// Implementations return copies, so callers must Set a state after changing it.
+type ConversationStore interface {
+	Get(userID string) (*ConversationState, bool, error)
+	Set(userID string, state *ConversationState) error
+	// Delete removes the user's state, reporting whether there was one.
+	Delete(userID string) (bool, error)
+	// Take returns the user's state, if any, and removes it in the same step.
+	Take(userID string) (*ConversationState, bool, error)
+}
+
+// idleConversationStore is implemented by stores that SlackBotHandler can sweep for
+// conversations that have gone quiet.
+type idleConversationStore interface {
+	ConversationStore
+	// IdleUsers returns the IDs of users whose state was last active before cutoff or can't be read.
+	IdleUsers(cutoff time.Time) []string
+}
+
+// conversationKeyPrefix namespaces conversation state in the shared Store.
+const conversationKeyPrefix = "conversation:"
+
+// conversationStateVersion is the version of ConversationState this release saves. Bump it
+// when a change means states saved by older releases can't be used as they are, and teach
+// migrateConversation to upgrade them or let them be discarded.
+const conversationStateVersion = 1
+
+// conversationStepNames are the steps a saved conversation can be at.
+var conversationStepNames = map[string]bool{"awaiting_names": true, "awaiting_game": true, "confirming_game": true}
+
+// errConversationUnreadable is returned for a saved state that doesn't decode, or that this
+// release can't use. The caller should discard it and let the user start over.
+var errConversationUnreadable = errors.New("conversation state is unreadable")
+
+// storeConversations keeps conversation state in the shared Store as JSON.
+type storeConversations struct {
+	store Store
+	ttl   time.Duration
+}
+
+// newConversationStore keeps conversation state in store. Idle conversations are expired by the
+// handler's sweeper after ttl; entries carry a TTL of twice that as a backstop, so state can't
+// pile up if no sweeper runs.
+func newConversationStore(store Store, ttl time.Duration) *storeConversations {
+	return &storeConversations{store: store, ttl: ttl}
+}
+
+// Get returns the user's conversation state, if any.
+func (s *storeConversations) Get(userID string) (*ConversationState, bool, error) {
+	data, ok, err := s.store.Get(conversationKeyPrefix + userID)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return decodeConversation(userID, data)
+}
+
+// Take returns the user's conversation state, if any, removing it with GetDel.
+func (s *storeConversations) Take(userID string) (*ConversationState, bool, error) {
+	data, ok, err := s.store.GetDel(conversationKeyPrefix + userID)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return decodeConversation(userID, data)
+}
+
+// decodeConversation decodes userID's stored state, upgrading it from an older version where
+// possible. States that don't decode, come from an unknown version or are at an unknown step
+// fail with errConversationUnreadable.
+func decodeConversation(userID string, data []byte) (*ConversationState, bool, error) {
+	var state ConversationState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, false, fmt.Errorf("%w: decoding state for %s: %v", errConversationUnreadable, userID, err)
+	}
+	if !migrateConversation(&state) {
+		return nil, false, fmt.Errorf("%w: state for %s has unsupported version %d", errConversationUnreadable, userID, state.Version)
+	}
+	if !conversationStepNames[state.Step] {
+		return nil, false, fmt.Errorf("%w: state for %s is at unknown step %q", errConversationUnreadable, userID, state.Step)
+	}
+	return &state, true, nil
+}
+
+// migrateConversation upgrades state to conversationStateVersion, reporting false when it
+// can't, e.g. for a state saved by a newer release.
+func migrateConversation(state *ConversationState) bool {
+	switch state.Version {
+	case 0:
+		// Saved before states were versioned; the fields are the same as in version 1.
+		state.Version = 1
+		return true
+	case conversationStateVersion:
+		return true
+	default:
+		return false
+	}
+}
+
+// Set saves the user's conversation state at the current version and restarts its backstop TTL.
+func (s *storeConversations) Set(userID string, state *ConversationState) error {
+	state.Version = conversationStateVersion
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return s.store.Set(conversationKeyPrefix+userID, data, 2*s.ttl)
+}
+
+// Delete removes the user's conversation state, reporting whether there was one.
+func (s *storeConversations) Delete(userID string) (bool, error) {
+	return s.store.Delete(conversationKeyPrefix + userID)
+}
+
+// IdleUsers returns the IDs of users whose state was last active before cutoff or can't be read.
+func (s *storeConversations) IdleUsers(cutoff time.Time) []string {
+	keys, err := s.store.Keys(conversationKeyPrefix)
+	if err != nil {
+		logger.Error("Error listing conversations to expire", "error", err)
+		return nil
+	}
+	var idle []string
+	for _, key := range keys {
+		userID := strings.TrimPrefix(key, conversationKeyPrefix)
+		state, ok, err := s.Get(userID)
+		if errors.Is(err, errConversationUnreadable) {
+			// Nobody can continue it, so let the sweeper discard it.
+			idle = append(idle, userID)
+			continue
+		}
+		if err != nil {
+			logger.Error("Error loading conversation state while expiring", "user_id", userID, "error", err)
+			continue
+		}
+		if ok && state.LastActivity.Before(cutoff) {
+			idle = append(idle, userID)
+		}
+	}
+	return idle
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestDecodeConversation(t *testing.T) {
+	tests := []struct {
+		name       string
+		blob       string
+		wantErr    bool // whether the state is unreadable
+		wantStep   string
+		wantGame   string
+		wantUserID string
+	}{
+		{
+			name:       "saved before versioning",
+			blob:       `{"Step":"awaiting_game","RecipientUserIDs":["U2"],"LastActivity":"2026-10-14T10:00:00Z"}`,
+			wantStep:   "awaiting_game",
+			wantUserID: "U2",
+		},
+		{
+			name:     "current version",
+			blob:     `{"Version":1,"Step":"confirming_game","PendingGame":"Catan","RecipientUserIDs":["U2"]}`,
+			wantStep: "confirming_game", wantGame: "Catan", wantUserID: "U2",
+		},
+		{name: "newer version", blob: `{"Version":2,"Step":"awaiting_game"}`, wantErr: true},
+		{name: "unknown step", blob: `{"Version":1,"Step":"picking_time"}`, wantErr: true},
+		{name: "field of the wrong type", blob: `{"Version":1,"Step":"awaiting_game","RecipientUserIDs":"U2"}`, wantErr: true},
+		{name: "not JSON", blob: `awaiting_game`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, ok, err := decodeConversation("U1", []byte(tt.blob))
+			if tt.wantErr {
+				if !errors.Is(err, errConversationUnreadable) {
+					t.Fatalf("decodeConversation() error = %v, want errConversationUnreadable", err)
+				}
+				return
+			}
+			if err != nil || !ok {
+				t.Fatalf("decodeConversation() = %v, %v, want a state", ok, err)
+			}
+			if state.Version != conversationStateVersion {
+				t.Errorf("Version = %d, want %d", state.Version, conversationStateVersion)
+			}
+			if state.Step != tt.wantStep || state.PendingGame != tt.wantGame || len(state.RecipientUserIDs) != 1 || state.RecipientUserIDs[0] != tt.wantUserID {
+				t.Errorf("state = %+v, want step %q, game %q and recipient %q", state, tt.wantStep, tt.wantGame, tt.wantUserID)
+			}
+		})
+	}
+}
+
+func TestConversationStoreSavesCurrentVersion(t *testing.T) {
+	store := NewInMemoryStore()
+	conversations := newConversationStore(store, time.Hour)
+	if err := conversations.Set("U1", &ConversationState{Step: "awaiting_names"}); err != nil {
+		t.Fatal(err)
+	}
+	data, _, _ := store.Get(conversationKeyPrefix + "U1")
+	if !strings.Contains(string(data), `"Version":1`) {
+		t.Errorf("saved state %s doesn't record version 1", data)
+	}
+}
+
+func TestUnreadableConversationIsDiscarded(t *testing.T) {
+	tests := []struct {
+		name      string
+		blob      string
+		message   string
+		wantReply string
+	}{
+		{name: "newer version, new message", blob: `{"Version":2,"Step":"awaiting_game"}`, message: "hi", wantReply: "Who do you want to message?"},
+		{name: "corrupt, new message", blob: `{"Step":`, message: "hi", wantReply: "Who do you want to message?"},
+		{name: "newer version, cancel", blob: `{"Version":2,"Step":"awaiting_game"}`, message: "cancel", wantReply: "I've cancelled that invitation"},
+		{name: "corrupt, cancel", blob: `{"Step":`, message: "cancel", wantReply: "I've cancelled that invitation"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			h, store := newTestBotHandler(t, fake, testConfig(), &fakeGenerator{invitation: "Come play!"})
+			if err := store.Set(conversationKeyPrefix+"U1", []byte(tt.blob), 0); err != nil {
+				t.Fatal(err)
+			}
+
+			h.processEvent(directMessage("U1", tt.message))
+
+			replies := fake.postsTo("DU1")
+			if len(replies) == 0 || !strings.Contains(replies[len(replies)-1], tt.wantReply) {
+				t.Fatalf("replies = %q, want the last to contain %q", replies, tt.wantReply)
+			}
+			if _, _, err := h.conversationStates.Get("U1"); err != nil {
+				t.Errorf("the unreadable state is still stored: %v", err)
+			}
+		})
+	}
+}
+
+func TestSweeperDiscardsUnreadableConversation(t *testing.T) {
+	fake := newFakeSlack(t, testUsers...)
+	config := testConfig()
+	config.ConversationTTL = time.Hour
+	h, store := newTestBotHandler(t, fake, config, &fakeGenerator{})
+	if err := store.Set(conversationKeyPrefix+"U1", []byte(`{"Version":2}`), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	conversations := h.conversationStates.(idleConversationStore)
+	idle := conversations.IdleUsers(time.Now().Add(-time.Hour))
+	if len(idle) != 1 || idle[0] != "U1" {
+		t.Fatalf("IdleUsers() = %q, want [U1]", idle)
+	}
+	h.expireConversation("U1")
+	if _, ok, _ := store.Get(conversationKeyPrefix + "U1"); ok {
+		t.Errorf("the unreadable state is still stored after the sweep")
+	}
+}
+
+func TestConversationResumesAfterRestart(t *testing.T) {
+	tests := []struct {
+		name  string
+		state ConversationState // saved by the process before the restart
+		next  string
+	}{
+		{name: "awaiting the game", state: ConversationState{Step: "awaiting_game", RecipientUserIDs: []string{"U2"}, RecipientUserNames: []string{"Bob Baker"}}, next: "Catan"},
+		{name: "confirming the game", state: ConversationState{Step: "confirming_game", RecipientUserIDs: []string{"U2"}, RecipientUserNames: []string{"Bob Baker"}, PendingGame: "Catan"}, next: "yes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := miniredis.RunT(t)
+			before, err := NewRedisStore("redis://" + server.Addr())
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { before.Close() })
+			state := tt.state
+			if err := newConversationStore(before, time.Hour).Set("U1", &state); err != nil {
+				t.Fatal(err)
+			}
+
+			// The restarted process shares nothing with the old one but Redis.
+			after, err := NewRedisStore("redis://" + server.Addr())
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { after.Close() })
+			fake := newFakeSlack(t, testUsers...)
+			config := testConfig()
+			config.ConversationTTL = time.Hour
+			generator := &fakeGenerator{invitation: "Come play!"}
+			h := newTestBotHandlerOn(t, fake, config, generator, after)
+			h.processEvent(directMessage("U1", tt.next))
+
+			if got := fake.postsTo("U2"); len(got) != 1 || !strings.Contains(got[0], "Come play!") {
+				t.Errorf("Bob got %q, want the invitation", got)
+			}
+			if generator.callCount() != 1 {
+				t.Errorf("generator called %d times, want once", generator.callCount())
+			}
+			if _, exists, err := h.conversationStates.Get("U1"); err != nil || exists {
+				t.Errorf("conversation still saved (%v, %v), want it finished", exists, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// deliveryKeyPrefix namespaces, by delivery scope and target, the invitations already
+// delivered in the shared Store.
+const deliveryKeyPrefix = "delivery:"
+
+// deliveryRetention is how long a delivery is remembered, and so how long a client can retry a
+// request with the same idempotency key without anyone getting the invitation twice.
+const deliveryRetention = 24 * time.Hour
+
+// maxIdempotencyKeyLength bounds client-chosen idempotency keys.
+const maxIdempotencyKeyLength = 255
+
+// errAlreadyDelivered is returned when a target already got the invitation sent under the same
+// idempotency key.
+var errAlreadyDelivered = errors.New("already delivered under this idempotency key")
+
+// deliveryScope is what delivery records are kept under for one invitation: the inviter's
+// idempotency key, so two clients picking the same key don't suppress each other's invitations,
+// or else the invite ID, so an invitation sent again under its ID, such as an asynchronous job
+// run a second time, still reaches each target once.
+func deliveryScope(inviterID, idempotencyKey, inviteID string) string {
+	if idempotencyKey == "" {
+		return "invite:" + inviteID
+	}
+	return inviterID + ":" + idempotencyKey
+}
+
+// deliveryLog records which targets got an invitation under its delivery scope, so a retried
+// request, or a recurring occurrence sent again, reaches each target at most once. The record is
+// claimed before sending and dropped again if the send fails, so a crash between the two errs
+// on the side of not sending.
+type deliveryLog struct {
+	store Store
+}
+
+// newDeliveryLog keeps delivery records in store.
+func newDeliveryLog(store Store) *deliveryLog {
+	return &deliveryLog{store: store}
+}
+
+// claim records that target is about to get the invitation sent under scope, failing with
+// errAlreadyDelivered if it already did.
+func (d *deliveryLog) claim(scope, target string) error {
+	stored, err := d.store.SetNX(deliveryKeyPrefix+scope+":"+target, []byte(time.Now().UTC().Format(time.RFC3339)), deliveryRetention)
+	if err != nil {
+		return err
+	}
+	if !stored {
+		return errAlreadyDelivered
+	}
+	return nil
+}
+
+// release forgets a claim whose send failed, so a retry can deliver it.
+func (d *deliveryLog) release(scope, target string) {
+	if _, err := d.store.Delete(deliveryKeyPrefix + scope + ":" + target); err != nil {
+		logger.Error("Error releasing a delivery claim", "event_type", "api_invite", "target", target, "error", err)
+	}
+}
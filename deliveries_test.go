@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestIdempotentInviteDeliversOnce(t *testing.T) {
+	tests := []struct {
+		name          string
+		key           string
+		claimedBy     string   // the inviter whose earlier request delivered to the targets below, if not U1
+		delivered     []string // targets that got it before the retry, e.g. before a crash
+		failFirst     string   // a recipient whose DM fails on the first attempt
+		wantFirst     []string // DM channels posted to by the first attempt
+		wantRetry     []string // DM channels posted to by the retry
+		wantDuplicate string   // already_delivered on the retry
+	}{
+		{
+			name:          "retry after success sends nothing",
+			key:           "req-1",
+			wantFirst:     []string{"U2", "U3"},
+			wantDuplicate: "U2,U3",
+		},
+		{
+			name:          "resume after a crash halfway",
+			key:           "req-1",
+			delivered:     []string{"U2"},
+			wantFirst:     []string{"U3"},
+			wantDuplicate: "U2,U3",
+		},
+		{
+			name:          "another inviter's key doesn't suppress the invitation",
+			key:           "req-1",
+			claimedBy:     "U9",
+			delivered:     []string{"U2"},
+			wantFirst:     []string{"U2", "U3"},
+			wantDuplicate: "U2,U3",
+		},
+		{
+			name:          "failed recipient gets it on the retry",
+			key:           "req-1",
+			failFirst:     "U3",
+			wantFirst:     []string{"U2"},
+			wantRetry:     []string{"U3"},
+			wantDuplicate: "U2",
+		},
+		{
+			name:      "without a key every request sends",
+			wantFirst: []string{"U2", "U3"},
+			wantRetry: []string{"U2", "U3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			h, _ := newTestInviteHandler(t, fake, testConfig())
+			claimedBy := tt.claimedBy
+			if claimedBy == "" {
+				claimedBy = "U1"
+			}
+			for _, target := range tt.delivered {
+				if err := h.deliveries.claim(deliveryScope(claimedBy, tt.key, ""), target); err != nil {
+					t.Fatal(err)
+				}
+			}
+			req := InviteRequest{InviterID: "U1", GameName: "Catan", UserIDs: []string{"U2", "U3"}, IdempotencyKey: tt.key}
+
+			if tt.failFirst != "" {
+				fake.failPosts(tt.failFirst, "channel_not_found")
+			}
+			h.sendInvite(req)
+			first := postedChannels(fake)
+			sort.Strings(first)
+			if strings.Join(first, ",") != strings.Join(tt.wantFirst, ",") {
+				t.Errorf("first attempt posted to %q, want %q", first, tt.wantFirst)
+			}
+
+			if tt.failFirst != "" {
+				fake.failPosts(tt.failFirst, "")
+			}
+			status, response := h.sendInvite(req)
+			if status != http.StatusOK {
+				t.Fatalf("retry answered %d: %v", status, response)
+			}
+			retry := postedChannels(fake)[len(first):]
+			sort.Strings(retry)
+			if strings.Join(retry, ",") != strings.Join(tt.wantRetry, ",") {
+				t.Errorf("retry posted to %q, want %q", retry, tt.wantRetry)
+			}
+			duplicates, _ := response["already_delivered"].([]string)
+			if strings.Join(duplicates, ",") != tt.wantDuplicate {
+				t.Errorf("already_delivered = %q, want %q", duplicates, tt.wantDuplicate)
+			}
+		})
+	}
+}
+
+func TestInviteWithoutKeyDeliversOncePerInviteID(t *testing.T) {
+	fake := newFakeSlack(t, testUsers...)
+	h, _ := newTestInviteHandler(t, fake, testConfig())
+	req := InviteRequest{GameName: "Catan", UserIDs: []string{"U2", "U3"}}
+
+	// An asynchronous job run again after a crash sends under the same invite ID.
+	h.sendInviteWithID(req, "inv-1")
+	status, response := h.sendInviteWithID(req, "inv-1")
+	if status != http.StatusOK {
+		t.Fatalf("second run answered %d: %v", status, response)
+	}
+	if posted := postedChannels(fake); len(posted) != 2 {
+		t.Errorf("posted to %q, want each recipient once", posted)
+	}
+	duplicates, _ := response["already_delivered"].([]string)
+	if strings.Join(duplicates, ",") != "U2,U3" {
+		t.Errorf("already_delivered = %q, want U2,U3", duplicates)
+	}
+}
+
+// postedChannels returns the channels of every recorded post, in the order they were posted.
+func postedChannels(fake *fakeSlack) []string {
+	var channels []string
+	for _, post := range fake.allPosts() {
+		channels = append(channels, post.Channel)
+	}
+	return channels
+}
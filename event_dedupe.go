@@ -0,0 +1,36 @@
+package main
+
+import (
+	"time"
+)
+
+// seenEventKeyPrefix namespaces the IDs of processed Slack events in the shared Store.
+const seenEventKeyPrefix = "event:"
+
+// seenEvents remembers the IDs of recently processed Slack events, so deliveries Slack retries
+// because the first attempt was acknowledged too slowly aren't processed twice. IDs are kept in
+// the shared Store, so a retry routed to another instance using Redis is recognized too.
+type seenEvents struct {
+	store  Store
+	window time.Duration // how long an ID is remembered, 0 to disable deduplication
+}
+
+// newSeenEvents remembers event IDs in store for window.
+func newSeenEvents(store Store, window time.Duration) *seenEvents {
+	return &seenEvents{store: store, window: window}
+}
+
+// markSeen records eventID as processed, reporting whether it had already been seen within the
+// window. Callbacks without an ID, such as URL verification, are never duplicates.
+func (s *seenEvents) markSeen(eventID string) (bool, error) {
+	if s.window <= 0 || eventID == "" {
+		return false, nil
+	}
+	// SetNX makes the check and the record one step, so two instances handed the same retry
+	// can't both see the event as new.
+	stored, err := s.store.SetNX(seenEventKeyPrefix+eventID, []byte(time.Now().UTC().Format(time.RFC3339Nano)), s.window)
+	if err != nil {
+		return false, err
+	}
+	return !stored, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSeenEventsMarkSeen(t *testing.T) {
+	tests := []struct {
+		name          string
+		window        time.Duration
+		events        []string
+		wantDuplicate []bool
+	}{
+		{name: "first delivery", window: time.Minute, events: []string{"Ev1"}, wantDuplicate: []bool{false}},
+		{name: "retried delivery", window: time.Minute, events: []string{"Ev1", "Ev1"}, wantDuplicate: []bool{false, true}},
+		{name: "different events", window: time.Minute, events: []string{"Ev1", "Ev2"}, wantDuplicate: []bool{false, false}},
+		{name: "callbacks without an ID", window: time.Minute, events: []string{"", ""}, wantDuplicate: []bool{false, false}},
+		{name: "deduplication disabled", window: 0, events: []string{"Ev1", "Ev1"}, wantDuplicate: []bool{false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := newSeenEvents(NewInMemoryStore(), tt.window)
+			for i, id := range tt.events {
+				duplicate, err := seen.markSeen(id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if duplicate != tt.wantDuplicate[i] {
+					t.Errorf("delivery %d of %q: duplicate = %v, want %v", i, id, duplicate, tt.wantDuplicate[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSeenEventsAcrossInstances(t *testing.T) {
+	// Two instances sharing a store are each handed the same retry at the same time.
+	store := NewInMemoryStore()
+	instances := []*seenEvents{newSeenEvents(store, time.Minute), newSeenEvents(store, time.Minute)}
+	for round := 0; round < 20; round++ {
+		eventID := "Ev" + string(rune('A'+round))
+		var wg sync.WaitGroup
+		results := make([]bool, len(instances))
+		for i, seen := range instances {
+			wg.Add(1)
+			go func(i int, seen *seenEvents) {
+				defer wg.Done()
+				duplicate, err := seen.markSeen(eventID)
+				if err != nil {
+					t.Error(err)
+				}
+				results[i] = duplicate
+			}(i, seen)
+		}
+		wg.Wait()
+		if results[0] == results[1] {
+			t.Fatalf("event %s: duplicate = %v on both instances, want exactly one to process it", eventID, results)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"sync"
+)
+
+// eventQueue queues work to run in order per key. eventQueues is the implementation; tests wrap
+// it to see what was queued.
+type eventQueue interface {
+	enqueue(key string, run func())
+}
+
+// eventQueues runs work queued for the same key, a Slack user ID, one item at a time and in the
+// order it was queued, while work for different keys runs concurrently. Conversation steps run
+// on their user's queue, so a user's quick successive messages can't race or be handled out of
+// order, and a slow step for one user never holds up anyone else.
+type eventQueues struct {
+	mutex   sync.Mutex
+	pending map[string][]func() // work not yet started, by key; a key is present while its queue is draining
+}
+
+// newEventQueues creates an empty set of queues.
+func newEventQueues() *eventQueues {
+	return &eventQueues{pending: make(map[string][]func())}
+}
+
+// enqueue queues run behind the work already queued for key, starting a goroutine to drain the
+// key's queue if none is running.
+func (q *eventQueues) enqueue(key string, run func()) {
+	q.mutex.Lock()
+	queued, draining := q.pending[key]
+	q.pending[key] = append(queued, run)
+	q.mutex.Unlock()
+	if !draining {
+		go q.drain(key)
+	}
+}
+
+// drain runs key's queued work until the queue is empty, then forgets the key.
+func (q *eventQueues) drain(key string) {
+	for {
+		q.mutex.Lock()
+		queued := q.pending[key]
+		if len(queued) == 0 {
+			delete(q.pending, key)
+			q.mutex.Unlock()
+			return
+		}
+		run := queued[0]
+		q.pending[key] = queued[1:]
+		q.mutex.Unlock()
+		run()
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEventQueuesRunInOrderPerKey(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string // key of each queued item, in queue order
+	}{
+		{name: "one key", keys: []string{"U1", "U1", "U1", "U1"}},
+		{name: "interleaved keys", keys: []string{"U1", "U2", "U1", "U2", "U1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queues := newEventQueues()
+			var mutex sync.Mutex
+			ran := make(map[string][]int)
+			want := make(map[string][]int)
+			var wg sync.WaitGroup
+			for i, key := range tt.keys {
+				i, key := i, key
+				want[key] = append(want[key], i)
+				wg.Add(1)
+				queues.enqueue(key, func() {
+					defer wg.Done()
+					// Early items take longest, so running them concurrently would reorder them.
+					time.Sleep(time.Duration(len(tt.keys)-i) * time.Millisecond)
+					mutex.Lock()
+					ran[key] = append(ran[key], i)
+					mutex.Unlock()
+				})
+			}
+			wg.Wait()
+			if !reflect.DeepEqual(ran, want) {
+				t.Errorf("ran %v, want %v", ran, want)
+			}
+		})
+	}
+}
+
+func TestEventQueuesDontBlockOtherKeys(t *testing.T) {
+	queues := newEventQueues()
+	release := make(chan struct{})
+	defer close(release)
+	queues.enqueue("U1", func() { <-release })
+
+	done := make(chan struct{})
+	queues.enqueue("U2", func() { close(done) })
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("U2's event waited for U1's")
+	}
+}
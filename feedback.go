@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/slack-go/slack"
+)
+
+// Action IDs of the post-game feedback buttons.
+const (
+	actionFeedbackPositive = "feedback_positive"
+	actionFeedbackNegative = "feedback_negative"
+)
+
+// Store key prefixes for post-game feedback.
+const (
+	feedbackPendingKeyPrefix = "feedback_pending:" // a follow-up scheduled for an accepter
+	feedbackVoteKeyPrefix    = "feedback_vote:"    // a recorded answer, so each accepter counts once
+)
+
+// feedbackRetention is how long pending follow-ups and answers are kept after the game ends.
+const feedbackRetention = 30 * 24 * time.Hour
+
+// gameFeedback counts post-game feedback answers as "positive" and "negative". It is served at
+// /metrics.
+var gameFeedback = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "game_feedback_total",
+	Help: "Post-game feedback answers, by rating.",
+}, []string{"rating"})
+
+// pendingFeedback is a follow-up queued with Slack, kept so it can be cancelled if the accepter
+// changes their mind.
+type pendingFeedback struct {
+	ChannelID          string `json:"channel_id"`
+	ScheduledMessageID string `json:"scheduled_message_id,omitempty"` // empty once delivered or when sent right away
+}
+
+// feedbackCollector DMs accepters of a timed invitation when the game ends, asking how it went,
+// and records their answers. A nil collector does neither.
+type feedbackCollector struct {
+	store  Store
+	sender *messageSender
+	secret []byte // signs the feedback button values, like the invitation buttons
+	paused bool   // sends no follow-ups while MAINTENANCE_MODE is on
+}
+
+// newFeedbackCollector keeps pending follow-ups and answers in store and signs the feedback
+// buttons with signingSecret.
+func newFeedbackCollector(store Store, sender *messageSender, signingSecret string, paused bool) *feedbackCollector {
+	return &feedbackCollector{store: store, sender: sender, secret: []byte(signingSecret), paused: paused}
+}
+
+// feedbackKey identifies userID's feedback for one game session.
+func feedbackKey(prefix, userID string, value inviteActionValue) string {
+	return prefix + userID + ":" + strconv.FormatInt(value.GameEnd, 10) + ":" + normalizeGame(value.Game)
+}
+
+// schedule queues the feedback request for userID, who accepted the invitation described by
+// value, at the end of the game. Invitations without a game time get no follow-up, and
+// accepting twice doesn't ask twice.
+func (f *feedbackCollector) schedule(userID string, value inviteActionValue) {
+	if f == nil || value.GameEnd == 0 || f.paused {
+		return
+	}
+	key := feedbackKey(feedbackPendingKeyPrefix, userID, value)
+	if _, ok, err := f.store.Get(key); err != nil || ok {
+		if err != nil {
+			logger.Error("Error checking pending feedback", "user_id", userID, "error", err)
+		}
+		return
+	}
+
+	text := fmt.Sprintf("How was %s?", value.Game)
+	buttonValue := encodeInviteActionValue(value, f.secret)
+	options := []slack.MsgOption{
+		slack.MsgOptionText(text, false),
+		slack.MsgOptionBlocks(
+			slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", text+" Your answer helps make future invitations better.", false, false), nil, nil),
+			slack.NewActionBlock("feedback_actions",
+				slack.NewButtonBlockElement(actionFeedbackPositive, buttonValue, slack.NewTextBlockObject("plain_text", ":thumbsup: Good game", true, false)),
+				slack.NewButtonBlockElement(actionFeedbackNegative, buttonValue, slack.NewTextBlockObject("plain_text", ":thumbsdown: Not great", true, false)),
+			),
+		),
+	}
+
+	var pending pendingFeedback
+	gameEnd := time.Unix(value.GameEnd, 0)
+	if gameEnd.After(time.Now()) {
+		channelID, scheduledID, err := f.sender.schedule(userID, gameEnd, text, options...)
+		if err != nil {
+			logger.Error("Failed to schedule feedback request", "user_id", userID, "error", err)
+			return
+		}
+		pending = pendingFeedback{ChannelID: channelID, ScheduledMessageID: scheduledID}
+	} else {
+		// The game is already over, typically a late click, so ask right away.
+		channelID, _, err := f.sender.post(userID, options...)
+		if err != nil {
+			logger.Error("Failed to send feedback request", "user_id", userID, "error", err)
+			return
+		}
+		pending = pendingFeedback{ChannelID: channelID}
+	}
+	data, err := json.Marshal(pending)
+	if err == nil {
+		err = f.store.Set(key, data, time.Until(gameEnd)+feedbackRetention)
+	}
+	if err != nil {
+		logger.Error("Error saving pending feedback", "user_id", userID, "error", err)
+	}
+	logger.Info("Feedback request queued", "user_id", userID, "game", value.Game, "send_at", gameEnd.Format(time.RFC3339))
+}
+
+// cancel withdraws a feedback request scheduled for userID, who no longer accepts the
+// invitation described by value.
+func (f *feedbackCollector) cancel(userID string, value inviteActionValue) {
+	if f == nil || value.GameEnd == 0 {
+		return
+	}
+	// Taking the pending entry means only one of several concurrent cancels withdraws it.
+	data, ok, err := f.store.GetDel(feedbackKey(feedbackPendingKeyPrefix, userID, value))
+	if err != nil || !ok {
+		if err != nil {
+			logger.Error("Error loading pending feedback", "user_id", userID, "error", err)
+		}
+		return
+	}
+	var pending pendingFeedback
+	if err := json.Unmarshal(data, &pending); err == nil && pending.ScheduledMessageID != "" && time.Unix(value.GameEnd, 0).After(time.Now()) {
+		_, err := f.sender.slackClient.DeleteScheduledMessage(&slack.DeleteScheduledMessageParameters{
+			Channel:            pending.ChannelID,
+			ScheduledMessageID: pending.ScheduledMessageID,
+		})
+		if err != nil {
+			logger.Error("Failed to cancel the feedback request", "user_id", userID, "error", err)
+		}
+	}
+}
+
+// errFeedbackRecorded is returned when a user answers the same feedback request twice.
+var errFeedbackRecorded = errors.New("feedback already recorded")
+
+// record counts userID's answer to a feedback request. Only the first answer for a game
+// session counts.
+func (f *feedbackCollector) record(userID string, value inviteActionValue, rating string) error {
+	stored, err := f.store.SetNX(feedbackKey(feedbackVoteKeyPrefix, userID, value), []byte(rating), feedbackRetention)
+	if err != nil {
+		return err
+	}
+	if !stored {
+		return errFeedbackRecorded
+	}
+	gameFeedback.WithLabelValues(rating).Inc()
+	logger.Info("Game feedback recorded", "event_type", "block_actions", "user_id", userID, "game", value.Game, "rating", rating)
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFeedbackPausedInMaintenance(t *testing.T) {
+	tests := []struct {
+		name     string
+		gameEnd  time.Time
+		paused   bool
+		wantSent bool
+	}{
+		{name: "scheduled for the end of the game", gameEnd: time.Now().Add(2 * time.Hour), wantSent: true},
+		{name: "asked right away after the game", gameEnd: time.Now().Add(-time.Minute), wantSent: true},
+		{name: "nothing scheduled in maintenance mode", gameEnd: time.Now().Add(2 * time.Hour), paused: true},
+		{name: "nothing asked in maintenance mode", gameEnd: time.Now().Add(-time.Minute), paused: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			store := NewInMemoryStore()
+			sender := newMessageSender(fake.client(), nil, newSendPacer(0, 0), 0, 0)
+			feedback := newFeedbackCollector(store, sender, testActionSecret, tt.paused)
+
+			feedback.schedule("U2", inviteActionValue{Game: "Catan", InviterID: "U1", InviteID: "inv1", GameEnd: tt.gameEnd.Unix()})
+
+			sent := len(fake.postsTo("U2")) + len(fake.allScheduled())
+			if want := map[bool]int{true: 1}[tt.wantSent]; sent != want {
+				t.Errorf("feedback requests sent or scheduled = %d, want %d", sent, want)
+			}
+			if keys, err := store.Keys(feedbackPendingKeyPrefix); err != nil || len(keys) != sent {
+				t.Errorf("pending feedback = %q, %v, want %d", keys, err, sent)
+			}
+		})
+	}
+}
+
+func TestPostGameFeedback(t *testing.T) {
+	fake := newFakeSlack(t, testUsers...)
+	store := NewInMemoryStore()
+	client := fake.client()
+	sender := newMessageSender(client, nil, newSendPacer(0, 0), 0, 0)
+	feedback := newFeedbackCollector(store, sender, testActionSecret, false)
+	h := NewInteractionHandler(client, newUserCache(client, time.Minute), sender, testActionSecret, feedback, nil, nil, newRSVPTracker(store), newInviterNotifier(store, sender, 0), newPendingInvites(store, 0, 0))
+	gameEnd := time.Now().Add(3 * time.Hour).Truncate(time.Second)
+	value := inviteActionValue{Game: "Catan", InviterID: "U1", GameEnd: gameEnd.Unix()}
+
+	click(h, "U2", actionAcceptGame, value)
+	click(h, "U3", actionDeclineGame, value)
+	click(h, "U1", actionAcceptGame, inviteActionValue{Game: "Catan", InviterID: "U1"}) // no game time
+	h.wait()
+
+	scheduled := fake.allScheduled()
+	if len(scheduled) != 1 || scheduled[0].Channel != "DU2" || scheduled[0].PostAt != gameEnd.Unix() || scheduled[0].Text != "How was Catan?" {
+		t.Fatalf("scheduled %+v, want Bob asked how Catan was when it ends", scheduled)
+	}
+	for _, channel := range []string{"U2", "DU2", "U3", "DU3"} {
+		if got := fake.postsTo(channel); len(got) != 0 {
+			t.Errorf("posted %q to %s, want feedback requests only scheduled", got, channel)
+		}
+	}
+
+	// Answers are recorded once per accepter.
+	before := testutil.ToFloat64(gameFeedback.WithLabelValues("positive"))
+	click(h, "U2", actionFeedbackPositive, value)
+	click(h, "U2", actionFeedbackNegative, value)
+	if got := fake.ephemeralsFor("U2"); len(got) < 2 || got[len(got)-2] != "Thanks for the feedback!" || got[len(got)-1] != "You've already told us how Catan went, thanks!" {
+		t.Errorf("Bob was told %q, want thanks and then a note that he already answered", got)
+	}
+	vote, ok, err := store.Get(feedbackKey(feedbackVoteKeyPrefix, "U2", value))
+	if err != nil || !ok || string(vote) != "positive" {
+		t.Errorf("recorded vote = %q (%v, %v), want positive", vote, ok, err)
+	}
+	if got := testutil.ToFloat64(gameFeedback.WithLabelValues("positive")) - before; got != 1 {
+		t.Errorf("positive feedback counted %v times, want once", got)
+	}
+
+	// Changing to a decline withdraws the request.
+	click(h, "U2", actionDeclineGame, value)
+	h.wait()
+	if scheduled := fake.allScheduled(); !scheduled[0].Deleted {
+		t.Errorf("scheduled %+v, want Bob's feedback request withdrawn", scheduled)
+	}
+}
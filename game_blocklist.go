@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+)
+
+// Matching modes for the blocked games list.
+const (
+	blockMatchExact     = "exact"     // the game name equals a blocked entry, ignoring case
+	blockMatchSubstring = "substring" // the game name contains a blocked entry, ignoring case
+)
+
+// gameBlocklist refuses invitations for games the workspace doesn't want advertised.
+type gameBlocklist struct {
+	games []string // lower-cased blocked names
+	mode  string
+}
+
+// newGameBlocklist builds a blocklist from a comma separated list of game names.
+func newGameBlocklist(list, mode string) *gameBlocklist {
+	var games []string
+	for _, game := range strings.Split(list, ",") {
+		if game = strings.ToLower(strings.TrimSpace(game)); game != "" {
+			games = append(games, game)
+		}
+	}
+	return &gameBlocklist{games: games, mode: mode}
+}
+
+// blocks reports whether invitations to game should be refused.
+func (b *gameBlocklist) blocks(game string) bool {
+	game = strings.ToLower(strings.TrimSpace(game))
+	for _, blocked := range b.games {
+		if game == blocked || (b.mode == blockMatchSubstring && strings.Contains(game, blocked)) {
+			return true
+		}
+	}
+	return false
+}
+
+// blockedGameReply is the polite refusal sent when someone names a blocked game.
+func blockedGameReply(game string) string {
+	return "Sorry, invitations to \"" + game + "\" aren't allowed in this workspace. Please pick a different game."
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGameBlocklist(t *testing.T) {
+	tests := []struct {
+		name string
+		list string
+		mode string
+		game string
+		want bool
+	}{
+		{name: "exact match", list: "Poker, Blackjack", mode: blockMatchExact, game: "poker", want: true},
+		{name: "exact ignores case and spaces", list: "poker", mode: blockMatchExact, game: "  POKER ", want: true},
+		{name: "exact doesn't match a longer name", list: "poker", mode: blockMatchExact, game: "Strip Poker"},
+		{name: "substring matches a longer name", list: "poker", mode: blockMatchSubstring, game: "Strip Poker", want: true},
+		{name: "substring doesn't match an unrelated game", list: "poker", mode: blockMatchSubstring, game: "Catan"},
+		{name: "blank entries are ignored", list: " , ,", mode: blockMatchSubstring, game: "Catan"},
+		{name: "empty list", mode: blockMatchExact, game: "Catan"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newGameBlocklist(tt.list, tt.mode).blocks(tt.game); got != tt.want {
+				t.Errorf("blocks(%q) with %q in %s mode = %v, want %v", tt.game, tt.list, tt.mode, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlockedGamesAreRefused(t *testing.T) {
+	tests := []struct {
+		name     string
+		game     string
+		wantSent bool
+	}{
+		{name: "blocked game", game: "Poker"},
+		{name: "allowed game", game: "Catan", wantSent: true},
+	}
+	for _, tt := range tests {
+		for _, flow := range []string{"api", "command", "conversation"} {
+			t.Run(tt.name+"/"+flow, func(t *testing.T) {
+				fake := newFakeSlack(t, testUsers...)
+				config := testConfig()
+				config.BlockedGames = newGameBlocklist("poker", blockMatchExact)
+
+				switch flow {
+				case "api":
+					h, _ := newTestInviteHandler(t, fake, config)
+					status, response := h.sendInvite(InviteRequest{GameName: tt.game, UserIDs: []string{"U2"}, Description: "Come play"})
+					wantStatus := http.StatusBadRequest
+					if tt.wantSent {
+						wantStatus = http.StatusOK
+					}
+					if status != wantStatus {
+						t.Errorf("sendInvite = %d %v, want %d", status, response, wantStatus)
+					}
+				case "command":
+					h, _ := newTestBotHandler(t, fake, config, &fakeGenerator{invitation: "Come play!"})
+					h.processEvent(directMessage("U1", `/invite "bob" "`+tt.game+`"`))
+				case "conversation":
+					h, _ := newTestBotHandler(t, fake, config, &fakeGenerator{invitation: "Come play!"})
+					h.processEvent(directMessage("U1", "hi"))
+					h.processEvent(directMessage("U1", "bob"))
+					h.processEvent(directMessage("U1", tt.game))
+					// A refused game leaves the conversation waiting for another one.
+					state, exists, err := h.conversationStates.Get("U1")
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !tt.wantSent && (!exists || state.Step != "awaiting_game") {
+						t.Errorf("conversation = %+v (exists %v), want it still awaiting_game", state, exists)
+					}
+				}
+
+				if got := len(fake.postsTo("U2")); got != map[bool]int{true: 1}[tt.wantSent] {
+					t.Errorf("Bob got %d invitations, want sent: %v", got, tt.wantSent)
+				}
+				if flow == "api" || tt.wantSent {
+					return
+				}
+				replies := fake.postsTo("DU1")
+				if len(replies) == 0 || !strings.Contains(replies[len(replies)-1], "aren't allowed in this workspace") {
+					t.Errorf("replies = %q, want the last to refuse %s", replies, tt.game)
+				}
+			})
+		}
+	}
+}
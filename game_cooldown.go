@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// gameCooldownKeyPrefix namespaces game cooldowns in the shared Store.
+const gameCooldownKeyPrefix = "cooldown:"
+
+// gameCooldowns limits how often each game can be invited to. A game's cooldown starts when an
+// invitation for it is reserved and is kept in the shared Store, so it holds across instances
+// using Redis.
+type gameCooldowns struct {
+	store   Store
+	global  time.Duration            // cooldown for games without their own entry, 0 for none
+	perGame map[string]time.Duration // keyed by lower-cased game name
+}
+
+// newGameCooldowns keeps cooldowns in store. perGame overrides global for the games it lists.
+func newGameCooldowns(store Store, global time.Duration, perGame map[string]time.Duration) *gameCooldowns {
+	return &gameCooldowns{store: store, global: global, perGame: perGame}
+}
+
+// parseGameCooldowns parses GAME_COOLDOWNS entries such as "catan=24h, chess=1h". A zero
+// duration exempts the game from the global cooldown.
+func parseGameCooldowns(list string) (map[string]time.Duration, error) {
+	cooldowns := make(map[string]time.Duration)
+	for _, entry := range strings.Split(list, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		game, value, ok := strings.Cut(entry, "=")
+		game = normalizeGame(game)
+		if !ok || game == "" {
+			return nil, fmt.Errorf("entry %q should look like game=duration", strings.TrimSpace(entry))
+		}
+		duration, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || duration < 0 {
+			return nil, fmt.Errorf("invalid duration for %q: %q", game, strings.TrimSpace(value))
+		}
+		cooldowns[game] = duration
+	}
+	return cooldowns, nil
+}
+
+// normalizeGame folds case and surrounding space so cooldowns apply however a game is typed.
+func normalizeGame(game string) string {
+	return strings.ToLower(strings.TrimSpace(game))
+}
+
+// cooldown returns the cooldown that applies to game.
+func (g *gameCooldowns) cooldown(game string) time.Duration {
+	if duration, ok := g.perGame[normalizeGame(game)]; ok {
+		return duration
+	}
+	return g.global
+}
+
+// reserve starts game's cooldown unless it is already running, in which case it returns the
+// time left. A zero remaining time means the invitation may go ahead.
+//
+// The cooldown is claimed with SetNX, so two instances can't both start it; the entry's TTL
+// decides when it ends, and the end time stored in it only tells the inviter how long is left.
+func (g *gameCooldowns) reserve(game string, now time.Time) (time.Duration, error) {
+	duration := g.cooldown(game)
+	if duration <= 0 {
+		return 0, nil
+	}
+	key := gameCooldownKeyPrefix + normalizeGame(game)
+	until := now.Add(duration)
+	stored, err := g.store.SetNX(key, []byte(until.Format(time.RFC3339Nano)), duration)
+	if err != nil || stored {
+		return 0, err
+	}
+	data, ok, err := g.store.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		// The cooldown ended between the two calls; the next attempt will claim it.
+		return time.Second, nil
+	}
+	running, err := time.Parse(time.RFC3339Nano, string(data))
+	if err != nil || !running.After(now) {
+		// Unreadable, or the instance that started it has a clock ahead of ours.
+		return time.Second, nil
+	}
+	return running.Sub(now), nil
+}
+
+// release ends game's cooldown early, e.g. when the invitation that started it failed to send.
+func (g *gameCooldowns) release(game string) error {
+	if g.cooldown(game) <= 0 {
+		return nil
+	}
+	_, err := g.store.Delete(gameCooldownKeyPrefix + normalizeGame(game))
+	return err
+}
+
+// retryAfterSeconds converts remaining to whole seconds for a Retry-After header, rounding up.
+func retryAfterSeconds(remaining time.Duration) int {
+	return int(math.Ceil(remaining.Seconds()))
+}
+
+// gameCooldownReply tells the inviter how long game is still in cooldown.
+func gameCooldownReply(game string, remaining time.Duration) string {
+	return fmt.Sprintf("%q was invited to recently. You can invite people to it again in %s, or pick a different game.",
+		game, remaining.Round(time.Second))
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGameCooldownsReserve(t *testing.T) {
+	start := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+	perGame := map[string]time.Duration{"catan": 24 * time.Hour, "chess": 0}
+	type step struct {
+		game          string
+		at            time.Duration // offset from start
+		release       bool          // release the game instead of reserving it
+		wantRemaining time.Duration
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "second invite within the per-game cooldown is refused",
+			steps: []step{
+				{game: "Catan", at: 0},
+				{game: "catan ", at: 6 * time.Hour, wantRemaining: 18 * time.Hour},
+			},
+		},
+		{
+			name: "global cooldown applies to games without their own entry",
+			steps: []step{
+				{game: "Go", at: 0},
+				{game: "Go", at: 30 * time.Minute, wantRemaining: 30 * time.Minute},
+			},
+		},
+		{
+			name: "zero per-game cooldown exempts the game",
+			steps: []step{
+				{game: "Chess", at: 0},
+				{game: "Chess", at: time.Second},
+			},
+		},
+		{
+			name: "cooldowns are tracked per game",
+			steps: []step{
+				{game: "Catan", at: 0},
+				{game: "Go", at: time.Minute},
+			},
+		},
+		{
+			name: "release ends the cooldown early",
+			steps: []step{
+				{game: "Catan", at: 0},
+				{game: "Catan", release: true},
+				{game: "Catan", at: time.Minute},
+				{game: "Catan", at: 2 * time.Minute, wantRemaining: 24*time.Hour - time.Minute},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cooldowns := newGameCooldowns(NewInMemoryStore(), time.Hour, perGame)
+			for i, s := range tt.steps {
+				if s.release {
+					if err := cooldowns.release(s.game); err != nil {
+						t.Fatalf("step %d: release(%q) error: %v", i, s.game, err)
+					}
+					continue
+				}
+				remaining, err := cooldowns.reserve(s.game, start.Add(s.at))
+				if err != nil {
+					t.Fatalf("step %d: reserve(%q) error: %v", i, s.game, err)
+				}
+				if remaining != s.wantRemaining {
+					t.Errorf("step %d: reserve(%q) remaining = %v, want %v", i, s.game, remaining, s.wantRemaining)
+				}
+			}
+		})
+	}
+}
+
+func TestGameCooldownsExpire(t *testing.T) {
+	const cooldown = 30 * time.Millisecond
+	cooldowns := newGameCooldowns(NewInMemoryStore(), 0, map[string]time.Duration{"catan": cooldown})
+	if remaining, err := cooldowns.reserve("Catan", time.Now()); err != nil || remaining != 0 {
+		t.Fatalf("first reserve = %v, %v, want 0, nil", remaining, err)
+	}
+	if remaining, err := cooldowns.reserve("Catan", time.Now()); err != nil || remaining <= 0 {
+		t.Fatalf("reserve during the cooldown = %v, %v, want time left", remaining, err)
+	}
+	time.Sleep(cooldown + 10*time.Millisecond)
+	if remaining, err := cooldowns.reserve("Catan", time.Now()); err != nil || remaining != 0 {
+		t.Fatalf("reserve after the cooldown = %v, %v, want 0, nil", remaining, err)
+	}
+}
+
+func TestParseGameCooldowns(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    map[string]time.Duration
+		wantErr bool
+	}{
+		{list: "", want: map[string]time.Duration{}},
+		{list: "Catan=24h, chess = 1h,", want: map[string]time.Duration{"catan": 24 * time.Hour, "chess": time.Hour}},
+		{list: "go=0s", want: map[string]time.Duration{"go": 0}},
+		{list: "catan", wantErr: true},
+		{list: "=1h", wantErr: true},
+		{list: "catan=soon", wantErr: true},
+		{list: "catan=-1h", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseGameCooldowns(tt.list)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseGameCooldowns(%q) error = %v, want error %v", tt.list, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("parseGameCooldowns(%q) = %v, want %v", tt.list, got, tt.want)
+			continue
+		}
+		for game, duration := range tt.want {
+			if got[game] != duration {
+				t.Errorf("parseGameCooldowns(%q)[%q] = %v, want %v", tt.list, game, got[game], duration)
+			}
+		}
+	}
+}
+
+func TestGameCooldownsReserveAcrossInstances(t *testing.T) {
+	store := NewInMemoryStore()
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	granted := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each instance has its own gameCooldowns; only the store is shared.
+			remaining, err := newGameCooldowns(store, time.Hour, nil).reserve("Catan", time.Now())
+			if err != nil {
+				t.Error(err)
+			}
+			if remaining == 0 {
+				mutex.Lock()
+				granted++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if granted != 1 {
+		t.Errorf("%d instances reserved the cooldown, want 1", granted)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// geminiEndpoint is the generateContent endpoint of the Gemini model we use.
+const geminiEndpoint = "https://generativelanguage.googleapis.com/v1beta/models/gemini-1.5-flash:generateContent"
+
+// geminiClient calls the Gemini generateContent API.
+type geminiClient struct {
+	apiKey   string
+	endpoint string // geminiEndpoint outside tests
+	client   *llmClient
+}
+
+// newGeminiClient creates a client whose requests time out after timeout and that makes at most
+// maxAttempts attempts per call.
+func newGeminiClient(apiKey string, timeout time.Duration, maxAttempts int) *geminiClient {
+	return &geminiClient{
+		apiKey:   apiKey,
+		endpoint: geminiEndpoint,
+		client:   newLLMClient("Google Gemini", timeout, maxAttempts),
+	}
+}
+
+// generate returns the text Gemini produces for prompt. Failures are *GeneratorError values
+// once a request has been attempted.
+func (g *geminiClient) generate(ctx context.Context, prompt string) (string, error) {
+	if g.apiKey == "" {
+		return "", fmt.Errorf("GOOGLE_GEMINI_API_KEY not set")
+	}
+
+	requestBody := map[string]interface{}{
+		"contents": []map[string]interface{}{
+			{
+				"parts": []map[string]interface{}{
+					{
+						"text": prompt,
+					},
+				},
+			},
+		},
+	}
+	jsonBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", err
+	}
+
+	// The key goes in a header rather than the URL, so it can't show up in transport errors.
+	text, err := g.parse(g.client.post(ctx, g.endpoint, map[string]string{"x-goog-api-key": g.apiKey}, jsonBody))
+	recordLLMCall(providerGemini, err)
+	return text, err
+}
+
+// parse extracts the generated text from a generateContent response.
+func (g *geminiClient) parse(body []byte, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+
+	// Expected response JSON structure:
+	// {
+	//   "candidates": [
+	//     {
+	//       "content": {
+	//         "parts": [
+	//           {
+	//             "text": "Generated invitation message"
+	//           }
+	//         ]
+	//       }
+	//     }
+	//   ]
+	// }
+	var responseData struct {
+		Candidates []struct {
+			Content struct {
+				Parts []struct {
+					Text string `json:"text"`
+				} `json:"parts"`
+			} `json:"content"`
+		} `json:"candidates"`
+	}
+	if err := json.Unmarshal(body, &responseData); err != nil {
+		return "", &GeneratorError{Provider: g.client.provider, Kind: generatorBadResponse, Err: err}
+	}
+	if len(responseData.Candidates) == 0 || len(responseData.Candidates[0].Content.Parts) == 0 {
+		return "", &GeneratorError{Provider: g.client.provider, Kind: generatorBadResponse, Err: errors.New("no candidates in response")}
+	}
+	return responseData.Candidates[0].Content.Parts[0].Text, nil
+}
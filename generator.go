@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Invitation generator providers selectable with INVITE_GENERATOR.
+const (
+	providerGemini = "gemini"
+	providerOpenAI = "openai"
+)
+
+// newInvitationGenerator builds the generator selected by INVITE_GENERATOR.
+func newInvitationGenerator(config *Config) InvitationGenerator {
+	if config.InvitationProvider == providerOpenAI {
+		return NewOpenAIGenerator(config)
+	}
+	return NewGeminiGenerator(config)
+}
+
+// InvitationGenerator writes the invitation text sent to recipients.
+type InvitationGenerator interface {
+	Generate(ctx context.Context, inviter string, recipients []string, game string, opts GenerateOptions) (string, error)
+}
+
+// GenerateOptions holds the optional knobs for a single invitation. The zero value uses the
+// defaults.
+type GenerateOptions struct {
+	Tone     string // how the invitation should sound, e.g. "formal" or "sarcastic"; defaults to defaultTone
+	Language string // language to write the invitation in, e.g. "French"; empty for the prompt's default
+}
+
+// tone returns the requested tone or defaultTone.
+func (o GenerateOptions) tone() string {
+	if o.Tone == "" {
+		return defaultTone
+	}
+	return o.Tone
+}
+
+// promptCompleter is implemented by generators backed by a language model that can answer an
+// arbitrary prompt, which the "did you mean" name suggestions need.
+type promptCompleter interface {
+	Complete(ctx context.Context, prompt string) (string, error)
+}
+
+// errSuggestionsUnsupported is returned when name suggestions are requested from a generator
+// that can't complete prompts.
+var errSuggestionsUnsupported = errors.New("the invitation generator can't suggest names")
+
+// GeminiGenerator writes invitations with Google Gemini from the configured prompt template.
+type GeminiGenerator struct {
+	client   *geminiClient
+	template *template.Template
+	persona  string
+	extras   string
+}
+
+// NewGeminiGenerator creates a GeminiGenerator from the Gemini and prompt settings in config.
+func NewGeminiGenerator(config *Config) *GeminiGenerator {
+	extras := ""
+	if config.CallToAction {
+		extras = callToActionPrompt
+	}
+	return &GeminiGenerator{
+		client:   newGeminiClient(config.GeminiAPIKey, config.GeneratorTimeout, config.GeneratorMaxAttempts),
+		template: config.PromptTemplate,
+		persona:  config.PromptPersona,
+		extras:   extras,
+	}
+}
+
+// Generate renders the prompt template and asks Gemini for the invitation.
+func (g *GeminiGenerator) Generate(ctx context.Context, inviter string, recipients []string, game string, opts GenerateOptions) (string, error) {
+	prompt, err := renderPrompt(g.template, promptData{
+		Inviter:    inviter,
+		Recipients: strings.Join(recipients, ", "),
+		Game:       game,
+		Tone:       opts.tone(),
+		Persona:    g.persona,
+		Extras:     opts.withLanguage(g.extras),
+	})
+	if err != nil {
+		return "", fmt.Errorf("rendering prompt: %w", err)
+	}
+	return g.Complete(ctx, prompt)
+}
+
+// Complete sends prompt to Gemini as is.
+func (g *GeminiGenerator) Complete(ctx context.Context, prompt string) (string, error) {
+	return g.client.generate(ctx, prompt)
+}
+
+// defaultFallbackTemplate is the invitation sent when the generator fails.
+const defaultFallbackTemplate = "Hey {recipients}, {inviter} wants to play {game} — you in?"
+
+// renderFallbackInvitation fills the {inviter}, {recipients} and {game} placeholders of tmpl.
+func renderFallbackInvitation(tmpl, inviter string, recipients []string, game string) string {
+	return strings.NewReplacer(
+		"{inviter}", inviter,
+		"{recipients}", strings.Join(recipients, ", "),
+		"{game}", game,
+	).Replace(tmpl)
+}
+
+// StaticGenerator returns the same canned message for every invitation, for tests and for
+// running without a model.
+type StaticGenerator struct {
+	Message string
+}
+
+// Generate returns the canned message.
+func (g StaticGenerator) Generate(ctx context.Context, inviter string, recipients []string, game string, opts GenerateOptions) (string, error) {
+	return g.Message, nil
+}
@@ -1,9 +1,17 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/slack-go/slack"
@@ -11,12 +19,113 @@ import (
 
 type GameInviteHandler struct {
 	slackClient *slack.Client
+	config      *Config
+	userCache   *userCache
+	sender      *messageSender
+	channels    *channelResolver
+	cooldowns   *gameCooldowns
+	rsvps       *rsvpTracker
+	jobs        *inviteJobs
+	scheduled   *scheduledInvites
+	deliveries  *deliveryLog
+	pending     *pendingInvites
+	writer      *invitationWriter
+	quietHours  *quietHoursStore
 }
 
 type InviteRequest struct {
 	GameName    string   `json:"game_name" binding:"required"`
-	UserIDs     []string `json:"user_ids" binding:"required"`
+	UserIDs     []string `json:"user_ids"` // users DMed the invitation; user_ids, channel_id or both are required
 	Description string   `json:"description"`
+	InviterID   string   `json:"inviter_id,omitempty"` // Slack user told about responses to the invitation
+	Username    string   `json:"username,omitempty"`   // overrides the configured bot display name
+	IconEmoji   string   `json:"icon_emoji,omitempty"` // overrides the configured bot icon, e.g. ":chess_pawn:"
+	ChannelID   string   `json:"channel_id,omitempty"` // channel to post the invitation in (#name, link or ID), or with thread_ts the channel of the message to reply under
+	ThreadTS    string   `json:"thread_ts,omitempty"`  // timestamp of the parent message, e.g. "1700000000.123456"
+
+	// Generate writes the description with the invitation generator, as the Slack flows do, and
+	// returns it as generated_text. It can't be combined with description.
+	Generate bool `json:"generate,omitempty"`
+
+	Attachment *InviteAttachment `json:"attachment,omitempty"` // optional file shared with the invitation
+
+	// GameTime (RFC3339, e.g. "2024-05-01T19:00:00-05:00") adds the start time to the invite and
+	// attaches a calendar entry lasting DurationMinutes (default 120).
+	GameTime        string `json:"game_time,omitempty"`
+	DurationMinutes int    `json:"duration_minutes,omitempty"`
+
+	// SendAt (RFC3339) queues the invitation with Slack to be delivered then instead of now.
+	SendAt string `json:"send_at,omitempty" binding:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+
+	// DryRun checks the request, and writes the invitation when generate is set, without sending
+	// anything.
+	DryRun bool `json:"dry_run,omitempty"`
+
+	// Async answers 202 right away and sends in the background; poll GET /invite/:id/status.
+	Async bool `json:"async,omitempty"`
+
+	// TimeSlots are candidate play times, e.g. "Fri 7pm", offered in a select so recipients can
+	// say which suits them; the tally surfaces the most popular one.
+	TimeSlots []string `json:"time_slots,omitempty"`
+
+	// AccessCode, shared with the recipients out-of-band, must be entered to accept.
+	AccessCode string `json:"access_code,omitempty"`
+
+	// IdempotencyKey, also accepted as the Idempotency-Key header, makes retries safe: each
+	// recipient gets the invitation an inviter sent under a key at most once.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// invitationTitlePrefix starts the header and fallback text of every invitation the bot posts.
+// Events carrying it are the bot's own invitations echoing back and are never processed.
+const invitationTitlePrefix = "Game Invitation: "
+
+// threadTSPattern matches Slack message timestamps such as "1700000000.123456".
+var threadTSPattern = regexp.MustCompile(`^\d+\.\d+$`)
+
+// dedupeIDs returns ids without repeats, keeping the first occurrence of each.
+func dedupeIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// errNoInviteTarget is returned for invite requests with neither user_ids nor channel_id.
+var errNoInviteTarget = errors.New("at least one of user_ids or channel_id is required")
+
+// bindInviteRequest binds the JSON body into req and checks that it names somewhere to send
+// the invitation.
+func bindInviteRequest(c *gin.Context, req *InviteRequest) error {
+	if err := c.ShouldBindJSON(req); err != nil {
+		return err
+	}
+	if len(req.UserIDs) == 0 && req.ChannelID == "" {
+		return errNoInviteTarget
+	}
+	// A repeated ID would otherwise get the same DM twice.
+	req.UserIDs = dedupeIDs(req.UserIDs)
+	return nil
+}
+
+// validateThreadTarget checks that a threaded reply target is complete and well formed.
+// A channel without a thread_ts is a top-level channel post and needs no checking here.
+func validateThreadTarget(channelID, threadTS string) error {
+	if threadTS == "" {
+		return nil
+	}
+	if channelID == "" {
+		return errors.New("thread_ts requires channel_id")
+	}
+	if !threadTSPattern.MatchString(threadTS) {
+		return fmt.Errorf("invalid thread_ts %q, expected a message timestamp like 1700000000.123456", threadTS)
+	}
+	return nil
 }
 
 type UsageGuide struct {
@@ -38,88 +147,729 @@ type UserInfo struct {
 	RealName string `json:"real_name"`
 }
 
-func NewGameInviteHandler(slackClient *slack.Client) *GameInviteHandler {
+// SkippedRecipient is a recipient the invitation wasn't delivered to for a reason retrying
+// can't fix, such as an account deactivated after the request was made.
+type SkippedRecipient struct {
+	UserID string `json:"user_id"`
+	Reason string `json:"reason"`
+}
+
+// UndeliveredFiles lists the attached files a recipient got their invitation without, such as
+// when it was held for their quiet hours: scheduled messages can't carry files.
+type UndeliveredFiles struct {
+	UserID string   `json:"user_id"`
+	Files  []string `json:"files"`
+	Reason string   `json:"reason"`
+}
+
+func NewGameInviteHandler(slackClient *slack.Client, config *Config, userCache *userCache, sender *messageSender, channels *channelResolver, cooldowns *gameCooldowns, rsvps *rsvpTracker, jobs *inviteJobs, scheduled *scheduledInvites, deliveries *deliveryLog, pending *pendingInvites, writer *invitationWriter, quietHours *quietHoursStore) *GameInviteHandler {
 	return &GameInviteHandler{
 		slackClient: slackClient,
+		config:      config,
+		userCache:   userCache,
+		sender:      sender,
+		channels:    channels,
+		cooldowns:   cooldowns,
+		rsvps:       rsvps,
+		jobs:        jobs,
+		scheduled:   scheduled,
+		deliveries:  deliveries,
+		pending:     pending,
+		writer:      writer,
+		quietHours:  quietHours,
 	}
 }
 
 func (h *GameInviteHandler) SendInvite(c *gin.Context) {
 	var req InviteRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := bindInviteRequest(c, &req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := applyAuthenticatedInviter(c, &req); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if req.IdempotencyKey == "" {
+		req.IdempotencyKey = c.GetHeader("Idempotency-Key")
+	}
+	logger.Info("Invite requested", "event_type", "api_invite", "user_id", req.InviterID, "authenticated", c.GetString(authenticatedInviterKey) != "", "game", req.GameName)
+	if req.Async {
+		h.sendInviteAsync(c, req)
+		return
+	}
+	status, response := h.sendInvite(req)
+	if seconds, ok := response["retry_after_seconds"].(int); ok {
+		c.Header("Retry-After", strconv.Itoa(seconds))
+	}
+	c.JSON(status, response)
+}
 
-	// Create a message with blocks for better formatting
-	blocks := []slack.Block{
-		slack.NewHeaderBlock(
-			slack.NewTextBlockObject("plain_text", "Game Invitation: "+req.GameName, false, false),
-		),
-		slack.NewSectionBlock(
-			slack.NewTextBlockObject("mrkdwn", req.Description, false, false),
-			nil,
-			nil,
-		),
-		slack.NewActionBlock(
-			"game_actions",
-			slack.NewButtonBlockElement(
-				"accept_game",
-				"accept",
-				slack.NewTextBlockObject("plain_text", "Accept", false, false),
-			).WithStyle(slack.StylePrimary),
-			slack.NewButtonBlockElement(
-				"decline_game",
-				"decline",
-				slack.NewTextBlockObject("plain_text", "Decline", false, false),
-			).WithStyle(slack.StyleDanger),
-		),
+// maintenanceReply answers requests to send invitations while MAINTENANCE_MODE is on.
+const maintenanceReply = "Invitations are temporarily unavailable while we do some maintenance. Please try again later."
+
+// sendInvite validates and sends a bound invite request, returning the HTTP status and JSON body
+// to answer with. It is shared by POST /invite and recurring invites.
+func (h *GameInviteHandler) sendInvite(req InviteRequest) (int, gin.H) {
+	return h.sendInviteWithID(req, newInviteID())
+}
+
+// sendInviteWithID is sendInvite for an invitation whose ID was already handed out.
+func (h *GameInviteHandler) sendInviteWithID(req InviteRequest, inviteID string) (int, gin.H) {
+	if h.config.MaintenanceMode {
+		return http.StatusServiceUnavailable, gin.H{"error": maintenanceReply}
+	}
+
+	// Resolve the posting identity, preferring the request over the configured defaults.
+	username := req.Username
+	if username == "" {
+		username = h.config.BotUsername
+	}
+	iconEmoji := req.IconEmoji
+	if iconEmoji == "" {
+		iconEmoji = h.config.BotIconEmoji
+	}
+	if err := validateIdentity(username, iconEmoji); err != nil {
+		return http.StatusBadRequest, gin.H{"error": err.Error()}
+	}
+	if err := validateThreadTarget(req.ChannelID, req.ThreadTS); err != nil {
+		return http.StatusBadRequest, gin.H{"error": err.Error()}
+	}
+	if len(req.IdempotencyKey) > maxIdempotencyKeyLength {
+		return http.StatusBadRequest, gin.H{"error": fmt.Sprintf("idempotency_key can be at most %d characters", maxIdempotencyKeyLength)}
+	}
+	if req.ChannelID != "" {
+		channelID, err := h.channels.resolve(req.ChannelID)
+		if errors.Is(err, errChannelLookup) {
+			return http.StatusInternalServerError, gin.H{"error": err.Error()}
+		}
+		if err != nil {
+			return http.StatusBadRequest, gin.H{"error": "invalid channel_id: " + err.Error()}
+		}
+		req.ChannelID = channelID
+	}
+	if req.Attachment != nil {
+		if err := req.Attachment.validate(); err != nil {
+			return http.StatusBadRequest, gin.H{"error": err.Error()}
+		}
+	}
+	var gameTime time.Time
+	if req.GameTime != "" {
+		var err error
+		gameTime, err = time.Parse(time.RFC3339, req.GameTime)
+		if err != nil {
+			return http.StatusBadRequest, gin.H{"error": "game_time must be an RFC3339 timestamp such as 2024-05-01T19:00:00-05:00"}
+		}
+		if gameTime.Before(time.Now()) {
+			return http.StatusBadRequest, gin.H{"error": "game_time is in the past"}
+		}
+	}
+	if req.Generate && req.Description != "" {
+		return http.StatusBadRequest, gin.H{"error": "description and generate can't be combined"}
+	}
+	if err := validateTimeSlots(req.TimeSlots); err != nil {
+		return http.StatusBadRequest, gin.H{"error": err.Error()}
+	}
+	for i, slot := range req.TimeSlots {
+		req.TimeSlots[i] = strings.TrimSpace(slot)
+	}
+	req.AccessCode = strings.TrimSpace(req.AccessCode)
+	if len(req.AccessCode) > maxAccessCodeLength {
+		return http.StatusBadRequest, gin.H{"error": fmt.Sprintf("access_code can be at most %d characters", maxAccessCodeLength)}
+	}
+	if req.DurationMinutes < 0 {
+		return http.StatusBadRequest, gin.H{"error": "duration_minutes can't be negative"}
+	}
+	var sendAt time.Time
+	if req.SendAt != "" {
+		// The binding tag has already checked the RFC3339 format.
+		sendAt, _ = time.Parse(time.RFC3339, req.SendAt)
+		if err := validateSendAt(sendAt, time.Now()); err != nil {
+			return http.StatusBadRequest, gin.H{"error": err.Error()}
+		}
+		if req.Attachment != nil && req.Attachment.Content != "" {
+			return http.StatusBadRequest, gin.H{"error": "file attachments can't be scheduled; use attachment.url instead"}
+		}
+	}
+
+	if h.config.BlockedGames.blocks(req.GameName) {
+		return http.StatusBadRequest, gin.H{"error": blockedGameReply(req.GameName)}
+	}
+
+	// The inviter doesn't need their own invitation.
+	if !h.config.AllowSelfInvite && req.InviterID != "" {
+		recipients := make([]string, 0, len(req.UserIDs))
+		for _, id := range req.UserIDs {
+			if id != req.InviterID {
+				recipients = append(recipients, id)
+			}
+		}
+		if len(recipients) == 0 && req.ChannelID == "" {
+			return http.StatusBadRequest, gin.H{"error": "user_ids only contains the inviter; you can't invite only yourself"}
+		}
+		req.UserIDs = recipients
+	}
+
+	// Never invite bots: it wastes a message at best and can start a bot-to-bot loop at worst.
+	botIDs, err := h.userCache.botUserIDs(req.UserIDs)
+	if err != nil {
+		return http.StatusInternalServerError, gin.H{"error": "Failed to fetch users: " + err.Error()}
+	}
+	if len(botIDs) > 0 {
+		return http.StatusBadRequest, gin.H{
+			"error":   "Invitations cannot be sent to bot users",
+			"details": botIDs,
+		}
+	}
+
+	recipientIDs := req.UserIDs
+	if h.config.RedirectAllTo != "" && len(req.UserIDs) > 0 {
+		// Test mode: one copy goes to the sink user, labelled with who it was meant for.
+		logger.Info("Redirecting invitation", "event_type", "api_invite", "user_id", req.InviterID, "recipients", req.UserIDs, "redirect_to", h.config.RedirectAllTo)
+		recipientIDs = []string{h.config.RedirectAllTo}
+	}
+
+	// compose writes the description when asked to, in each recipient's language with
+	// PER_RECIPIENT_LANGUAGE on, and builds the messages. Recipients not in a language of their
+	// own, the channel and the redirect sink get the first text. It returns a response only
+	// when the invitation can't be composed.
+	var written []writtenInvitation
+	var blocks []slack.Block
+	var options []slack.MsgOption
+	// Recipients whose language got its own text get their own copy of the message.
+	ownBlocks := make(map[string][]slack.Block)
+	ownOptions := make(map[string][]slack.MsgOption)
+	messageOptions := func(blocks []slack.Block) []slack.MsgOption {
+		options := []slack.MsgOption{
+			slack.MsgOptionBlocks(blocks...),
+			slack.MsgOptionText(invitationTitlePrefix+req.GameName, false),
+		}
+		return append(options, identityOptions(username, iconEmoji)...)
+	}
+	compose := func() (int, gin.H) {
+		if req.Generate {
+			var err error
+			if written, err = h.writeDescriptions(req); err != nil {
+				return http.StatusBadGateway, gin.H{"error": "Failed to write the invitation: " + err.Error()}
+			}
+			req.Description = written[0].Text
+		}
+		// Create a message with blocks for better formatting
+		blocks = h.invitationBlocks(req, inviteID, req.Description, gameTime)
+		if err := validateBlocks(blocks); err != nil {
+			return http.StatusBadRequest, gin.H{"error": "Invalid invitation message: " + err.Error()}
+		}
+		options = messageOptions(blocks)
+		if h.config.RedirectAllTo == "" {
+			for _, invitation := range written[min(1, len(written)):] {
+				groupBlocks := h.invitationBlocks(req, inviteID, invitation.Text, gameTime)
+				if err := validateBlocks(groupBlocks); err != nil {
+					return http.StatusBadRequest, gin.H{"error": "Invalid invitation message: " + err.Error()}
+				}
+				for _, id := range invitation.RecipientIDs {
+					ownBlocks[id] = groupBlocks
+					ownOptions[id] = messageOptions(groupBlocks)
+				}
+			}
+		}
+		return http.StatusOK, nil
+	}
+	withGenerated := func(response gin.H) gin.H {
+		if len(written) > 0 {
+			response["generated_text"] = written[0].Text
+		}
+		if len(written) > 1 {
+			texts := make(map[string]string, len(req.UserIDs))
+			for _, invitation := range written {
+				for _, id := range invitation.RecipientIDs {
+					texts[id] = invitation.Text
+				}
+			}
+			response["generated_texts"] = texts
+		}
+		return response
+	}
+
+	if req.DryRun {
+		if status, response := compose(); response != nil {
+			return status, response
+		}
+		return http.StatusOK, withGenerated(gin.H{"message": "Dry run: the invitation is valid and nothing was sent", "invite_id": inviteID})
+	}
+
+	var tooMany *pendingLimitError
+	reserved, err := h.pending.reserve(inviteID)
+	if errors.As(err, &tooMany) {
+		return http.StatusTooManyRequests, gin.H{
+			"error":               tooMany.Error(),
+			"pending_invites":     tooMany.Pending,
+			"max_pending_invites": tooMany.Limit,
+			"retry_after_seconds": retryAfterSeconds(tooMany.RetryAfter),
+		}
+	} else if err != nil {
+		return http.StatusInternalServerError, gin.H{"error": "Failed to check pending invitations: " + err.Error()}
+	}
+	// The slot is given back unless the invitation ends up recorded as pending.
+	pendingRecorded := false
+	defer func() {
+		if reserved && !pendingRecorded {
+			h.pending.release(inviteID)
+		}
+	}()
+
+	// Start the game's cooldown only once the request is known to be valid.
+	remaining, err := h.cooldowns.reserve(req.GameName, time.Now())
+	if err != nil {
+		return http.StatusInternalServerError, gin.H{"error": "Failed to check the game cooldown: " + err.Error()}
+	}
+	if remaining > 0 {
+		seconds := retryAfterSeconds(remaining)
+		return http.StatusTooManyRequests, gin.H{
+			"error":               gameCooldownReply(req.GameName, remaining),
+			"retry_after_seconds": seconds,
+		}
+	}
+
+	// Write the invitation only once both reservations are held, so a refused request never
+	// spends a generator call.
+	if status, response := compose(); response != nil {
+		if err := h.cooldowns.release(req.GameName); err != nil {
+			logger.Error("Failed to release the cooldown", "event_type", "api_invite", "game", req.GameName, "error", err)
+		}
+		return status, response
+	}
+
+	// Files uploaded into each recipient's DM after the invitation
+	var uploads []*InviteAttachment
+	if req.Attachment != nil && req.Attachment.Content != "" {
+		uploads = append(uploads, req.Attachment)
+	}
+	if !gameTime.IsZero() && sendAt.IsZero() {
+		ics := buildICS(req.GameName, req.Description, gameTime, time.Duration(req.DurationMinutes)*time.Minute, time.Now())
+		uploads = append(uploads, &InviteAttachment{
+			Filename: icsFilename(req.GameName),
+			Title:    req.GameName + " calendar invite",
+			Content:  base64.StdEncoding.EncodeToString([]byte(ics)),
+		})
+	}
+	if err := h.rsvps.start(inviteID, req.GameName, req.InviterID, req.TimeSlots, req.AccessCode); err != nil {
+		// Clicks still record their answers; only the empty tally before the first one is lost.
+		logger.Error("Error creating the RSVP record", "event_type", "api_invite", "invite_id", inviteID, "error", err)
 	}
 
 	// Create channels for error handling
-	errChan := make(chan error, len(req.UserIDs))
+	errChan := make(chan error, len(recipientIDs)+1)
+	uploadErrChan := make(chan error, (len(recipientIDs)+1)*len(uploads))
+	skippedChan := make(chan SkippedRecipient, len(recipientIDs))
+	heldFilesChan := make(chan UndeliveredFiles, len(recipientIDs))
+	duplicateChan := make(chan string, len(recipientIDs)+1)
 	var wg sync.WaitGroup
 
-	// Send messages concurrently
-	for _, userID := range req.UserIDs {
+	// deliver posts the invitation to target now, or queues it for postAt, and returns the
+	// channel it went to. postAt is send_at, or later for recipients in their quiet hours.
+	fallbackText := invitationTitlePrefix + req.GameName
+	var scheduledMutex sync.Mutex
+	var scheduled []ScheduledInvite
+	var posted []inviteMessage
+	var firstDeferred time.Time // the earliest send held back by quiet hours
+	// Each target is claimed first, under the inviter's idempotency key or else the invite ID,
+	// so a retry skips whoever already got it, and released again if the send fails.
+	scope := deliveryScope(req.InviterID, req.IdempotencyKey, inviteID)
+	deliver := func(target string, postAt time.Time, options ...slack.MsgOption) (string, error) {
+		method := deliveryDM
+		if target == req.ChannelID {
+			method = deliveryChannel
+		}
+		if err := h.deliveries.claim(scope, target); err != nil {
+			return "", err
+		}
+		if postAt.IsZero() {
+			channelID, ts, err := h.sender.post(target, options...)
+			recordInvite(method, err)
+			if err != nil {
+				h.deliveries.release(scope, target)
+				return channelID, err
+			}
+			message := inviteMessage{Channel: channelID, TS: ts}
+			if own, ok := ownBlocks[target]; ok && target != req.ChannelID {
+				message.Blocks = &slack.Blocks{BlockSet: own}
+			}
+			scheduledMutex.Lock()
+			posted = append(posted, message)
+			scheduledMutex.Unlock()
+			return channelID, nil
+		}
+		channelID, scheduledID, err := h.sender.schedule(target, postAt, fallbackText, options...)
+		if err != nil && channelID != "" {
+			// It is queued; only looking up its ID failed, so it can't be cancelled through the API.
+			logger.Warn("Scheduled invitation without its message ID", "event_type", "api_invite", "target", target, "channel", channelID, "error", err)
+			err = nil
+		}
+		recordInvite(method, err)
+		if err != nil {
+			h.deliveries.release(scope, target)
+			return "", err
+		}
+		invite := ScheduledInvite{Target: target, ChannelID: channelID, ScheduledMessageID: scheduledID}
+		scheduledMutex.Lock()
+		if !postAt.Equal(sendAt) {
+			invite.DeferredUntil = postAt.UTC().Format(time.RFC3339)
+			if firstDeferred.IsZero() || postAt.Before(firstDeferred) {
+				firstDeferred = postAt
+			}
+		}
+		scheduled = append(scheduled, invite)
+		scheduledMutex.Unlock()
+		return channelID, nil
+	}
+
+	// Send messages concurrently, at most SendConcurrency at a time. All sends still share
+	// the global pacer and the sender's MAX_CONCURRENT_SENDS slots with other invitations, so
+	// this bounds goroutines and open requests rather than throughput.
+	concurrency := h.config.SendConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	for _, userID := range recipientIDs {
 		wg.Add(1)
 		go func(uid string) {
 			defer wg.Done()
-			_, _, err := h.slackClient.PostMessage(
-				uid,
-				slack.MsgOptionBlocks(blocks...),
-				slack.MsgOptionText("Game Invitation: "+req.GameName, false),
-			)
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			dmOptions := options
+			if own, ok := ownOptions[uid]; ok {
+				dmOptions = own
+			}
+			// Recipients in their quiet hours get the invitation queued for when those end.
+			postAt := sendAt
+			intended := sendAt
+			if intended.IsZero() {
+				intended = time.Now()
+			}
+			if at, deferred := h.quietHours.sendTime(uid, intended); deferred {
+				logger.Info("Holding the invitation for the recipient's quiet hours", "event_type", "api_invite", "invite_id", inviteID, "recipient_id", uid, "send_at", at.Format(time.RFC3339))
+				postAt = at
+			}
+			dmChannelID, err := deliver(uid, postAt, dmOptions...)
+			if errors.Is(err, errAlreadyDelivered) {
+				logger.Info("Recipient already got this invitation", "event_type", "api_invite", "invite_id", inviteID, "recipient_id", uid)
+				duplicateChan <- uid
+				return
+			}
+			if isInactiveRecipient(err) {
+				// The account was deactivated after the recipient was matched; no retry would help.
+				logger.Info("Skipping deactivated recipient", "event_type", "api_invite", "invite_id", inviteID, "recipient_id", uid, "error", err)
+				skippedChan <- SkippedRecipient{UserID: uid, Reason: "account deactivated (" + err.Error() + ")"}
+				return
+			}
 			if err != nil {
 				errChan <- fmt.Errorf("failed to send invitation to user %s: %w", uid, err)
+				return
+			}
+			// Upload attached files into the DM the invitation landed in. One queued for later
+			// goes without them, so the response says which files that recipient misses.
+			if !postAt.IsZero() {
+				if len(uploads) > 0 {
+					files := make([]string, 0, len(uploads))
+					for _, upload := range uploads {
+						files = append(files, upload.title())
+					}
+					reason := "invitation held for quiet hours until " + postAt.UTC().Format(time.RFC3339) + ", and scheduled messages can't carry files"
+					heldFilesChan <- UndeliveredFiles{UserID: uid, Files: files, Reason: reason}
+				}
+				return
+			}
+			for _, upload := range uploads {
+				if err := h.uploadAttachment(upload, dmChannelID); err != nil {
+					uploadErrChan <- fmt.Errorf("failed to upload %s for user %s: %w", upload.title(), uid, err)
+				}
 			}
 		}(userID)
 	}
 
+	// Also post in the requested channel, or reply under the requested channel message, if any.
+	// Test mode skips both, since everyone in the channel would see them.
+	if req.ChannelID != "" && h.config.RedirectAllTo != "" {
+		logger.Info("Test mode: not posting invitation to channel", "event_type", "api_invite", "channel", req.ChannelID, "thread_ts", req.ThreadTS)
+	} else if req.ThreadTS == "" && req.ChannelID != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := deliver(req.ChannelID, sendAt, options...)
+			if errors.Is(err, errAlreadyDelivered) {
+				duplicateChan <- req.ChannelID
+				return
+			}
+			if err != nil {
+				errChan <- fmt.Errorf("failed to post invitation to channel %s: %w", req.ChannelID, err)
+				return
+			}
+			for _, upload := range uploads {
+				if err := h.uploadAttachment(upload, req.ChannelID); err != nil {
+					uploadErrChan <- fmt.Errorf("failed to upload %s to channel %s: %w", upload.title(), req.ChannelID, err)
+				}
+			}
+		}()
+	} else if req.ThreadTS != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			threadOptions := append([]slack.MsgOption{slack.MsgOptionTS(req.ThreadTS)}, options...)
+			_, err := deliver(req.ChannelID, sendAt, threadOptions...)
+			if errors.Is(err, errAlreadyDelivered) {
+				duplicateChan <- req.ChannelID
+				return
+			}
+			if err != nil {
+				errChan <- fmt.Errorf("failed to post invitation to thread %s in channel %s: %w", req.ThreadTS, req.ChannelID, err)
+			}
+		}()
+	}
+
 	// Wait for all goroutines to complete
 	wg.Wait()
 	close(errChan)
+	close(uploadErrChan)
+	close(skippedChan)
+	close(heldFilesChan)
+	close(duplicateChan)
 
 	// Check for any errors
-	var errors []string
+	var sendErrors []string
 	for err := range errChan {
-		errors = append(errors, err.Error())
+		sendErrors = append(sendErrors, err.Error())
+	}
+
+	// Upload failures are reported separately: the invitation itself still arrived.
+	var uploadErrors []string
+	for err := range uploadErrChan {
+		uploadErrors = append(uploadErrors, err.Error())
+	}
+
+	// Deactivated recipients are listed in every response rather than counted as failures.
+	var skipped []SkippedRecipient
+	for recipient := range skippedChan {
+		skipped = append(skipped, recipient)
+	}
+	// So are the recipients whose invitation went out without its files.
+	var filesNotDelivered []UndeliveredFiles
+	for held := range heldFilesChan {
+		filesNotDelivered = append(filesNotDelivered, held)
+	}
+	sort.Slice(filesNotDelivered, func(i, j int) bool { return filesNotDelivered[i].UserID < filesNotDelivered[j].UserID })
+	// Targets a retry under the same idempotency key found already delivered are listed too.
+	var alreadyDelivered []string
+	for target := range duplicateChan {
+		alreadyDelivered = append(alreadyDelivered, target)
+	}
+	sort.Strings(alreadyDelivered)
+	withSkipped := func(response gin.H) gin.H {
+		withGenerated(response)
+		if len(skipped) > 0 {
+			response["skipped"] = skipped
+		}
+		if len(alreadyDelivered) > 0 {
+			response["already_delivered"] = alreadyDelivered
+		}
+		if len(filesNotDelivered) > 0 {
+			response["files_not_delivered"] = filesNotDelivered
+		}
+		if len(scheduled) > 0 {
+			response["scheduled"] = scheduled
+		}
+		return response
+	}
+
+	// Keep the copies' timestamps for the live roster.
+	if err := h.rsvps.addMessages(inviteID, blocks, posted); err != nil {
+		logger.Error("Error recording the posted invitations", "event_type", "api_invite", "invite_id", inviteID, "error", err)
+	}
+
+	// Whatever was queued is delivered even if other sends failed, so it is listed either way.
+	if len(scheduled) > 0 {
+		recordAt := sendAt
+		if recordAt.IsZero() {
+			recordAt = firstDeferred
+		}
+		record := ScheduledInviteRecord{InviteID: inviteID, InviterID: req.InviterID, Game: req.GameName, SendAt: recordAt, Messages: scheduled, DeliveredNow: len(posted)}
+		if err := h.scheduled.record(record); err != nil {
+			// Slack still delivers it; only GET /invites/scheduled won't list it.
+			logger.Error("Error recording the scheduled invite", "event_type", "api_invite", "invite_id", inviteID, "error", err)
+		}
+	}
+
+	if len(sendErrors) > 0 {
+		// Let the caller retry without waiting out a cooldown for an invitation that failed.
+		if err := h.cooldowns.release(req.GameName); err != nil {
+			logger.Error("Failed to release the cooldown", "event_type", "api_invite", "game", req.GameName, "error", err)
+		}
+		response := gin.H{
+			"error":     "Failed to send some invitations",
+			"details":   sendErrors,
+			"invite_id": inviteID,
+		}
+		if len(uploadErrors) > 0 {
+			response["attachment_errors"] = uploadErrors
+		}
+		return http.StatusInternalServerError, withSkipped(response)
+	}
+
+	if len(skipped) == len(recipientIDs) && req.ChannelID == "" {
+		// Nobody received anything, so don't hold the game's cooldown either.
+		if err := h.cooldowns.release(req.GameName); err != nil {
+			logger.Error("Failed to release the cooldown", "event_type", "api_invite", "game", req.GameName, "error", err)
+		}
+		return http.StatusUnprocessableEntity, withSkipped(gin.H{
+			"error":     "None of the recipients can receive invitations",
+			"invite_id": inviteID,
+		})
+	}
+
+	// Count the invitation against MAX_PENDING_INVITES unless a retry delivered nothing new.
+	targets := len(recipientIDs)
+	if req.ChannelID != "" {
+		targets++
+	}
+	if len(alreadyDelivered)+len(skipped) < targets {
+		expires := gameTime
+		if expires.IsZero() && !sendAt.IsZero() {
+			expires = sendAt.Add(h.config.PendingInviteTTL)
+		}
+		// Should recording fail, the reserved slot still counts until PENDING_INVITE_TTL.
+		pendingRecorded = true
+		if err := h.pending.add(inviteID, len(recipientIDs)-len(skipped), expires); err != nil {
+			logger.Error("Error recording the pending invitation", "event_type", "api_invite", "invite_id", inviteID, "error", err)
+		}
 	}
 
-	if len(errors) > 0 {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to send some invitations",
-			"details": errors,
+	if !sendAt.IsZero() {
+		return http.StatusOK, withSkipped(gin.H{
+			"message":   "Invitations scheduled for " + sendAt.Format(time.RFC3339),
+			"invite_id": inviteID,
+			"scheduled": scheduled,
 		})
-		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Invitations sent successfully"})
+	if len(uploadErrors) > 0 {
+		return http.StatusOK, withSkipped(gin.H{
+			"message":           "Invitations sent, but some attachments failed to upload",
+			"invite_id":         inviteID,
+			"attachment_errors": uploadErrors,
+		})
+	}
+	if len(filesNotDelivered) > 0 {
+		return http.StatusOK, withSkipped(gin.H{
+			"message":   "Invitations sent, but some recipients in their quiet hours will get them without the attached files",
+			"invite_id": inviteID,
+		})
+	}
+
+	return http.StatusOK, withSkipped(gin.H{"message": "Invitations sent successfully", "invite_id": inviteID})
+}
+
+// invitationBlocks builds the message blocks of the invitation to req's game with the given
+// description, which may be empty.
+func (h *GameInviteHandler) invitationBlocks(req InviteRequest, inviteID, description string, gameTime time.Time) []slack.Block {
+	var blocks []slack.Block
+	if h.config.RedirectAllTo != "" && len(req.UserIDs) > 0 {
+		blocks = append(blocks, redirectNoticeBlock(req.UserIDs))
+	}
+	blocks = append(blocks, slack.NewHeaderBlock(
+		slack.NewTextBlockObject("plain_text", invitationTitlePrefix+req.GameName, false, false),
+	))
+	// The description is optional, and a section without text is rejected by Slack.
+	if description != "" {
+		blocks = append(blocks, slack.NewSectionBlock(
+			slack.NewTextBlockObject("mrkdwn", truncateMessage(description, h.config.MaxMessageLength), false, false),
+			nil,
+			nil,
+		))
+	}
+	if !gameTime.IsZero() {
+		// Slack renders the date in each reader's own timezone.
+		when := fmt.Sprintf("<!date^%d^{date_short_pretty} at {time}|%s>", gameTime.Unix(), gameTime.Format(time.RFC1123))
+		blocks = append(blocks, slack.NewContextBlock("game_time",
+			slack.NewTextBlockObject("mrkdwn", ":calendar: "+when, false, false),
+		))
+	}
+	if req.Attachment != nil && req.Attachment.URL != "" {
+		blocks = append(blocks, req.Attachment.linkBlock())
+	}
+	if req.AccessCode != "" {
+		blocks = append(blocks, slack.NewContextBlock("access_code_notice",
+			slack.NewTextBlockObject("mrkdwn", ":lock: Accepting needs the access code the organizer shared.", false, false),
+		))
+	}
+	// The invite ID ties button clicks back to this invitation's RSVP record.
+	action := inviteActionValue{Game: req.GameName, InviterID: req.InviterID, InviteID: inviteID}
+	if !gameTime.IsZero() {
+		duration := time.Duration(req.DurationMinutes) * time.Minute
+		if duration <= 0 {
+			duration = defaultGameDuration
+		}
+		action.GameStart = gameTime.Unix()
+		action.GameEnd = gameTime.Add(duration).Unix()
+	}
+	actionValue := encodeInviteActionValue(action, []byte(h.config.ActionSigningSecret))
+	if len(req.TimeSlots) > 0 {
+		blocks = append(blocks, timeSlotsBlock(inviteID, req.TimeSlots, []byte(h.config.ActionSigningSecret)))
+	}
+	if h.config.RecipientReminders {
+		blocks = append(blocks, remindMeBlock(inviteID, []byte(h.config.ActionSigningSecret)))
+	}
+	return append(blocks,
+		slack.NewActionBlock(
+			"game_actions",
+			slack.NewButtonBlockElement(
+				actionAcceptGame,
+				actionValue,
+				slack.NewTextBlockObject("plain_text", "Accept", false, false),
+			).WithStyle(slack.StylePrimary),
+			slack.NewButtonBlockElement(
+				actionMaybeGame,
+				actionValue,
+				slack.NewTextBlockObject("plain_text", "Maybe", false, false),
+			),
+			slack.NewButtonBlockElement(
+				actionDeclineGame,
+				actionValue,
+				slack.NewTextBlockObject("plain_text", "Decline", false, false),
+			).WithStyle(slack.StyleDanger),
+		),
+	)
+}
+
+// writeDescriptions writes the description of req's invitation with the invitation generator,
+// from the inviter's name to the recipients' names as the Slack directory knows them.
+func (h *GameInviteHandler) writeDescriptions(req InviteRequest) ([]writtenInvitation, error) {
+	inviter := "Someone"
+	if user, ok := h.userCache.lookup(req.InviterID); req.InviterID != "" && ok && user.RealName != "" {
+		inviter = user.RealName
+	}
+	names := make([]string, len(req.UserIDs))
+	for i, id := range req.UserIDs {
+		names[i] = id
+		if user, ok := h.userCache.lookup(id); ok && user.RealName != "" {
+			names[i] = user.RealName
+		}
+	}
+	return h.writer.write(context.Background(), inviter, req.UserIDs, names, req.GameName, GenerateOptions{})
+}
+
+// uploadAttachment shares the attachment content in the given channel via files.uploadV2.
+func (h *GameInviteHandler) uploadAttachment(attachment *InviteAttachment, channelID string) error {
+	params, err := attachment.uploadParams(channelID)
+	if err != nil {
+		return err
+	}
+	_, err = h.slackClient.UploadFileV2(params)
+	return h.sender.scopes.explain(methodUploadFile, err)
 }
 
 func (h *GameInviteHandler) GetUsageGuide(c *gin.Context) {
 	// Fetch users from Slack
-	users, err := h.slackClient.GetUsers()
+	users, err := h.userCache.getCachedUsers()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users: " + err.Error()})
 		return
@@ -144,11 +894,14 @@ func (h *GameInviteHandler) GetUsageGuide(c *gin.Context) {
 			{
 				Path:        "/invite",
 				Method:      "POST",
-				Description: "Send game invitations to specified users",
+				Description: "Send game invitations to specified users and/or post one in a channel (channel_id), or reply under an existing channel message (channel_id + thread_ts)",
 				Example: InviteRequest{
 					GameName:    "Chess",
 					UserIDs:     []string{"U0123456", "U6543210"},
 					Description: "Want to play a quick game of chess?",
+					InviterID:   "U0000001",
+					ChannelID:   "C0123456",
+					ThreadTS:    "1700000000.123456",
 				},
 			},
 			{
@@ -156,6 +909,32 @@ func (h *GameInviteHandler) GetUsageGuide(c *gin.Context) {
 				Method:      "GET",
 				Description: "Get usage guide and available user IDs",
 			},
+			{
+				Path:        "/invite/scheduled/:id?channel=:channel_id",
+				Method:      "DELETE",
+				Description: "Cancel an invitation scheduled with send_at, using the scheduled_message_id and channel_id POST /invite returned",
+			},
+			{
+				Path:        "/invite/:id/rsvp",
+				Method:      "GET",
+				Description: "Get who accepted, might join or declined the invitation with the invite_id POST /invite returned",
+			},
+			{
+				Path:        "/invite/:id/status",
+				Method:      "GET",
+				Description: "Get the progress of an invitation sent with \"async\": true, and once done the response POST /invite would have given",
+			},
+			{
+				Path:        "/lists/:name",
+				Method:      "PUT",
+				Description: "Save a named recipient list that can be invited by name in the Slack conversation",
+				Example:     RecipientList{MemberIDs: []string{"U0123456", "U6543210"}},
+			},
+			{
+				Path:        "/lists",
+				Method:      "GET",
+				Description: "List saved recipient lists; GET or DELETE /lists/:name for a single list",
+			},
 		},
 		UserIDs: userInfos,
 	}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+func TestDeactivatedRecipientsAreSkipped(t *testing.T) {
+	tests := []struct {
+		name        string
+		postErrors  map[string]string // recipient -> Slack error for their DM
+		wantStatus  int
+		wantSkipped []string
+		wantFailed  bool // the request fails rather than skipping
+	}{
+		{name: "one deactivated", postErrors: map[string]string{"U2": "account_inactive"}, wantStatus: http.StatusOK, wantSkipped: []string{"U2"}},
+		{name: "disabled", postErrors: map[string]string{"U3": "user_disabled"}, wantStatus: http.StatusOK, wantSkipped: []string{"U3"}},
+		{name: "everyone deactivated", postErrors: map[string]string{"U2": "account_inactive", "U3": "account_inactive"}, wantStatus: http.StatusUnprocessableEntity, wantSkipped: []string{"U2", "U3"}},
+		{name: "other errors aren't skipped", postErrors: map[string]string{"U2": "channel_not_found"}, wantStatus: http.StatusInternalServerError, wantFailed: true},
+	}
+	for _, tt := range tests {
+		for _, flow := range []string{"api", "conversation"} {
+			t.Run(tt.name+"/"+flow, func(t *testing.T) {
+				fake := newFakeSlack(t, testUsers...)
+				for recipient, slackError := range tt.postErrors {
+					fake.failPosts(recipient, slackError)
+				}
+
+				var reply string
+				if flow == "api" {
+					h, _ := newTestInviteHandler(t, fake, testConfig())
+					status, response := h.sendInvite(InviteRequest{GameName: "Catan", UserIDs: []string{"U2", "U3"}, Description: "Come play"})
+					if status != tt.wantStatus {
+						t.Fatalf("sendInvite = %d %v, want %d", status, response, tt.wantStatus)
+					}
+					skipped, _ := response["skipped"].([]SkippedRecipient)
+					var got []string
+					for _, recipient := range skipped {
+						got = append(got, recipient.UserID)
+						if !strings.HasPrefix(recipient.Reason, "account deactivated") {
+							t.Errorf("reason for %s = %q, want it to say the account was deactivated", recipient.UserID, recipient.Reason)
+						}
+					}
+					if strings.Join(sortedCopy(got), ",") != strings.Join(tt.wantSkipped, ",") {
+						t.Errorf("skipped = %q, want %q", got, tt.wantSkipped)
+					}
+				} else {
+					h, _ := newTestBotHandler(t, fake, testConfig(), &fakeGenerator{invitation: "Come play!"})
+					h.processEvent(directMessage("U1", "hi"))
+					h.processEvent(directMessage("U1", "bob, carol"))
+					h.processEvent(directMessage("U1", "Catan"))
+					replies := fake.postsTo("DU1")
+					if len(replies) > 0 {
+						reply = replies[len(replies)-1]
+					}
+					switch {
+					case tt.wantFailed:
+						if !strings.Contains(reply, "Failed to send invitation") {
+							t.Errorf("reply = %q, want the send reported as failed", reply)
+						}
+					case len(tt.wantSkipped) == 2:
+						if !strings.Contains(reply, "Nobody got the invitation") {
+							t.Errorf("reply = %q, want it to say nobody got the invitation", reply)
+						}
+					default:
+						want := userMentions(tt.wantSkipped) + " didn't get the invitation"
+						if !strings.Contains(reply, want) {
+							t.Errorf("reply = %q, want it to contain %q", reply, want)
+						}
+					}
+				}
+
+				// Everyone else still gets the invitation.
+				for _, recipient := range []string{"U2", "U3"} {
+					want := 1
+					if tt.postErrors[recipient] != "" {
+						want = 0
+					}
+					if got := len(fake.postsTo(recipient)); got != want {
+						t.Errorf("%s got %d invitations, want %d", recipient, got, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+// sortedCopy returns a sorted copy of ids.
+func sortedCopy(ids []string) []string {
+	sorted := append([]string(nil), ids...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+func TestInvitationsToBotsAreRefused(t *testing.T) {
+	users := append(append([]slack.User(nil), testUsers...),
+		slack.User{ID: "U9", Name: "otherbot", IsBot: true},
+		slack.User{ID: "USLACKBOT", Name: "slackbot"},
+	)
+	tests := []struct {
+		name        string
+		userIDs     []string
+		wantStatus  int
+		wantDetails []string
+	}{
+		{name: "bot user", userIDs: []string{"U2", "U9"}, wantStatus: http.StatusBadRequest, wantDetails: []string{"U9"}},
+		{name: "Slackbot", userIDs: []string{"USLACKBOT"}, wantStatus: http.StatusBadRequest, wantDetails: []string{"USLACKBOT"}},
+		{name: "people only", userIDs: []string{"U2"}, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, users...)
+			h, _ := newTestInviteHandler(t, fake, testConfig())
+			status, response := h.sendInvite(InviteRequest{GameName: "Catan", UserIDs: tt.userIDs, Description: "Come play"})
+			if status != tt.wantStatus {
+				t.Fatalf("sendInvite = %d %v, want %d", status, response, tt.wantStatus)
+			}
+			if details, _ := response["details"].([]string); strings.Join(details, ",") != strings.Join(tt.wantDetails, ",") {
+				t.Errorf("details = %q, want %q", details, tt.wantDetails)
+			}
+			if tt.wantStatus != http.StatusOK && len(fake.allPosts()) != 0 {
+				t.Errorf("posted %+v, want nothing sent", fake.allPosts())
+			}
+		})
+	}
+}
+
+func TestThreadedInvitations(t *testing.T) {
+	games := slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: "C0123456"}, Name: "games"}, IsMember: true}
+	tests := []struct {
+		name         string
+		channelID    string
+		threadTS     string
+		wantStatus   int
+		wantError    string
+		wantThreaded string // thread_ts of the channel post; "" for a top-level post
+	}{
+		{name: "reply under a message", channelID: "#games", threadTS: "1700000000.000100", wantStatus: http.StatusOK, wantThreaded: "1700000000.000100"},
+		{name: "top-level channel post", channelID: "C0123456", wantStatus: http.StatusOK},
+		{name: "thread_ts without a channel", threadTS: "1700000000.000100", wantStatus: http.StatusBadRequest, wantError: "thread_ts requires channel_id"},
+		{name: "malformed thread_ts", channelID: "C0123456", threadTS: "yesterday", wantStatus: http.StatusBadRequest, wantError: `invalid thread_ts "yesterday"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			fake.addChannels(games)
+			h, _ := newTestInviteHandler(t, fake, testConfig())
+			status, response := h.sendInvite(InviteRequest{GameName: "Catan", UserIDs: []string{"U2"}, ChannelID: tt.channelID, ThreadTS: tt.threadTS, Description: "Come play"})
+			if status != tt.wantStatus {
+				t.Fatalf("sendInvite = %d %v, want %d", status, response, tt.wantStatus)
+			}
+			if tt.wantError != "" {
+				if got, _ := response["error"].(string); !strings.Contains(got, tt.wantError) {
+					t.Errorf("error = %q, want it to contain %q", got, tt.wantError)
+				}
+				if posts := fake.allPosts(); len(posts) != 0 {
+					t.Errorf("posted %+v, want nothing", posts)
+				}
+				return
+			}
+
+			var channelPosts, dms []fakePost
+			for _, post := range fake.allPosts() {
+				switch post.Channel {
+				case "C0123456":
+					channelPosts = append(channelPosts, post)
+				case "U2":
+					dms = append(dms, post)
+				}
+			}
+			if len(channelPosts) != 1 || channelPosts[0].ThreadTS != tt.wantThreaded {
+				t.Errorf("channel posts = %+v, want one with thread_ts %q", channelPosts, tt.wantThreaded)
+			}
+			if len(dms) != 1 || dms[0].ThreadTS != "" {
+				t.Errorf("DMs to Bob = %+v, want one outside any thread", dms)
+			}
+		})
+	}
+}
+
+func TestPostingIdentity(t *testing.T) {
+	tests := []struct {
+		name          string
+		flow          string    // "api" or "conversation"
+		configured    [2]string // BOT_USERNAME and BOT_ICON_EMOJI
+		requested     [2]string // the request's username and icon_emoji
+		wantStatus    int
+		wantUsername  string
+		wantIconEmoji string
+	}{
+		{name: "app default", flow: "api", wantStatus: http.StatusOK},
+		{name: "configured", flow: "api", configured: [2]string{"Game Night", ":game_die:"}, wantStatus: http.StatusOK, wantUsername: "Game Night", wantIconEmoji: ":game_die:"},
+		{name: "request overrides config", flow: "api", configured: [2]string{"Game Night", ":game_die:"}, requested: [2]string{"Chess Club", ":chess_pawn:"}, wantStatus: http.StatusOK, wantUsername: "Chess Club", wantIconEmoji: ":chess_pawn:"},
+		{name: "invalid icon", flow: "api", requested: [2]string{"", "chess_pawn"}, wantStatus: http.StatusBadRequest},
+		{name: "username too long", flow: "api", requested: [2]string{strings.Repeat("x", maxUsernameLength+1), ""}, wantStatus: http.StatusBadRequest},
+		{name: "configured for the bot", flow: "conversation", configured: [2]string{"Game Night", ":game_die:"}, wantUsername: "Game Night", wantIconEmoji: ":game_die:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			config := testConfig()
+			config.BotUsername, config.BotIconEmoji = tt.configured[0], tt.configured[1]
+			if tt.flow == "api" {
+				h, _ := newTestInviteHandler(t, fake, config)
+				status, response := h.sendInvite(InviteRequest{GameName: "Catan", UserIDs: []string{"U2"}, Username: tt.requested[0], IconEmoji: tt.requested[1], Description: "Come play"})
+				if status != tt.wantStatus {
+					t.Fatalf("sendInvite = %d %v, want %d", status, response, tt.wantStatus)
+				}
+			} else {
+				h, _ := newTestBotHandler(t, fake, config, &fakeGenerator{invitation: "Come play!"})
+				h.processEvent(directMessage("U1", "hi"))
+				h.processEvent(directMessage("U1", "bob"))
+				h.processEvent(directMessage("U1", "Catan"))
+			}
+
+			var invitations []fakePost
+			for _, post := range fake.allPosts() {
+				if post.Channel == "U2" {
+					invitations = append(invitations, post)
+				}
+			}
+			if tt.wantStatus == http.StatusBadRequest {
+				if len(invitations) != 0 {
+					t.Errorf("posted %+v, want nothing sent", invitations)
+				}
+				return
+			}
+			if len(invitations) != 1 {
+				t.Fatalf("Bob got %+v, want one invitation", invitations)
+			}
+			if got := invitations[0]; got.Username != tt.wantUsername || got.IconEmoji != tt.wantIconEmoji {
+				t.Errorf("posted as %q %q, want %q %q", got.Username, got.IconEmoji, tt.wantUsername, tt.wantIconEmoji)
+			}
+		})
+	}
+}
+
+func TestSendConcurrencyIsBounded(t *testing.T) {
+	users := append([]slack.User(nil), testUsers...)
+	var recipients []string
+	for i := 4; i <= 9; i++ {
+		id := fmt.Sprintf("U%d", i)
+		users = append(users, slack.User{ID: id, Name: fmt.Sprintf("player%d", i), RealName: fmt.Sprintf("Player %d", i)})
+		recipients = append(recipients, id)
+	}
+	tests := []struct {
+		name        string
+		concurrency int
+		wantPeak    int
+	}{
+		{name: "one at a time", concurrency: 1, wantPeak: 1},
+		{name: "a few at a time", concurrency: 3, wantPeak: 3},
+		{name: "unset sends one at a time", concurrency: 0, wantPeak: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, users...)
+			fake.slowPosts(20 * time.Millisecond)
+			config := testConfig()
+			config.SendConcurrency = tt.concurrency
+			h, _ := newTestInviteHandler(t, fake, config)
+			status, response := h.sendInvite(InviteRequest{GameName: "Catan", UserIDs: recipients, Description: "Come play"})
+			if status != http.StatusOK {
+				t.Fatalf("sendInvite = %d %v, want %d", status, response, http.StatusOK)
+			}
+			for _, recipient := range recipients {
+				if got := len(fake.postsTo(recipient)); got != 1 {
+					t.Errorf("%s got %d invitations, want 1", recipient, got)
+				}
+			}
+			// Six slow sends give every allowed worker time to overlap.
+			if got := fake.peakPosts(); got != tt.wantPeak {
+				t.Errorf("%d sends in flight at once, want %d", got, tt.wantPeak)
+			}
+		})
+	}
+}
+
+func TestConcurrentSendsAreBoundedAcrossInvites(t *testing.T) {
+	users := append([]slack.User(nil), testUsers...)
+	var recipients []string
+	for i := 4; i <= 15; i++ {
+		id := fmt.Sprintf("U%d", i)
+		users = append(users, slack.User{ID: id, Name: fmt.Sprintf("player%d", i), RealName: fmt.Sprintf("Player %d", i)})
+		recipients = append(recipients, id)
+	}
+	tests := []struct {
+		name     string
+		maxSends int
+		wantPeak int
+	}{
+		{name: "shared limit below the invites' total", maxSends: 4, wantPeak: 4},
+		{name: "shared limit above it", maxSends: 10, wantPeak: 6},
+		{name: "no shared limit", maxSends: 0, wantPeak: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, users...)
+			fake.slowPosts(20 * time.Millisecond)
+			config := testConfig()
+			config.SendConcurrency = 3
+			h, _ := newTestInviteHandler(t, fake, config)
+			h.sender = newMessageSender(fake.client(), nil, newSendPacer(0, 0), 0, tt.maxSends)
+
+			// Two invitations of six recipients each go out at once.
+			var wg sync.WaitGroup
+			for i, game := range []string{"Catan", "Chess"} {
+				wg.Add(1)
+				go func(game string, recipients []string) {
+					defer wg.Done()
+					if status, response := h.sendInvite(InviteRequest{GameName: game, UserIDs: recipients, Description: "Come play"}); status != http.StatusOK {
+						t.Errorf("sendInvite(%s) = %d %v, want %d", game, status, response, http.StatusOK)
+					}
+				}(game, recipients[i*6:(i+1)*6])
+			}
+			wg.Wait()
+			if got := len(fake.allPosts()); got != len(recipients) {
+				t.Errorf("posted %d invitations, want %d", got, len(recipients))
+			}
+			if got := fake.peakPosts(); got != tt.wantPeak {
+				t.Errorf("%d sends in flight at once, want %d", got, tt.wantPeak)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/slack-go/slack"
+)
+
+// HealthHandler serves liveness and readiness checks for load balancers.
+type HealthHandler struct {
+	slackClient *slack.Client
+}
+
+// NewHealthHandler creates a new HealthHandler.
+func NewHealthHandler(slackClient *slack.Client) *HealthHandler {
+	return &HealthHandler{
+		slackClient: slackClient,
+	}
+}
+
+// Health reports that the process is up. With ?deep=true it also confirms the Slack token is
+// still valid via auth.test, answering 503 if it isn't.
+func (h *HealthHandler) Health(c *gin.Context) {
+	if c.Query("deep") != "true" {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+		return
+	}
+	if _, err := h.slackClient.AuthTest(); err != nil {
+		logger.Error("Deep health check failed", "error", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": "Slack auth check failed: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "slack": "ok"})
+}
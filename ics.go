@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultGameDuration is used for calendar entries when the request doesn't give a duration.
+const defaultGameDuration = 2 * time.Hour
+
+// icsTimeFormat is the UTC date-time form used in iCalendar files.
+const icsTimeFormat = "20060102T150405Z"
+
+// buildICS renders a single-event iCalendar file for a game. Times are written in UTC so
+// calendar clients convert them to each recipient's own timezone.
+func buildICS(gameName, description string, start time.Time, duration time.Duration, now time.Time) string {
+	if duration <= 0 {
+		duration = defaultGameDuration
+	}
+	start = start.UTC()
+	end := start.Add(duration)
+
+	// A stable UID lets calendar clients recognise re-sent invitations for the same game.
+	sum := sha1.Sum([]byte(gameName + "|" + start.Format(icsTimeFormat)))
+	uid := hex.EncodeToString(sum[:]) + "@slack-game-inviter"
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//slack-game-inviter//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"BEGIN:VEVENT",
+		"UID:" + uid,
+		"DTSTAMP:" + now.UTC().Format(icsTimeFormat),
+		"DTSTART:" + start.Format(icsTimeFormat),
+		"DTEND:" + end.Format(icsTimeFormat),
+		"SUMMARY:" + escapeICSText(gameName),
+	}
+	if description != "" {
+		lines = append(lines, "DESCRIPTION:"+escapeICSText(description))
+	}
+	lines = append(lines, "END:VEVENT", "END:VCALENDAR")
+
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(foldICSLine(line))
+		b.WriteString("\r\n")
+	}
+	return b.String()
+}
+
+// escapeICSText escapes a value for an iCalendar TEXT property (RFC 5545 section 3.3.11).
+func escapeICSText(text string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return replacer.Replace(text)
+}
+
+// foldICSLine splits content lines longer than 75 octets, continuing them with a leading space
+// as RFC 5545 requires, without breaking multi-byte characters.
+func foldICSLine(line string) string {
+	const limit = 75
+	if len(line) <= limit {
+		return line
+	}
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > limit {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
+
+// icsFilename names the calendar file attached to an invitation.
+func icsFilename(gameName string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '-'
+	}, gameName)
+	name = strings.Trim(name, "-")
+	if name == "" {
+		name = "game"
+	}
+	return fmt.Sprintf("%s.ics", strings.ToLower(name))
+}
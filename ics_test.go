@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildICS(t *testing.T) {
+	chicago := time.FixedZone("CST", -6*60*60)
+	start := time.Date(2026, 3, 6, 19, 30, 0, 0, chicago)
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	ics := buildICS("Catan; Seafarers", "Bring snacks, drinks\nand a friend", start, 0, now)
+
+	if !strings.HasSuffix(ics, "\r\n") || strings.Contains(strings.ReplaceAll(ics, "\r\n", ""), "\n") {
+		t.Fatalf("lines must end in CRLF:\n%q", ics)
+	}
+	lines := strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n")
+	want := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//slack-game-inviter//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"BEGIN:VEVENT",
+		"", // UID, checked below
+		"DTSTAMP:20260301T090000Z",
+		"DTSTART:20260307T013000Z",
+		"DTEND:20260307T033000Z",
+		`SUMMARY:Catan\; Seafarers`,
+		`DESCRIPTION:Bring snacks\, drinks\nand a friend`,
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(want), ics)
+	}
+	for i, line := range lines {
+		if want[i] != "" && line != want[i] {
+			t.Errorf("line %d = %q, want %q", i, line, want[i])
+		}
+	}
+	if uid := lines[6]; !strings.HasPrefix(uid, "UID:") || !strings.HasSuffix(uid, "@slack-game-inviter") {
+		t.Errorf("UID line = %q", uid)
+	}
+	if again := buildICS("Catan; Seafarers", "", start, time.Hour, now.Add(time.Hour)); !strings.Contains(again, lines[6]+"\r\n") {
+		t.Errorf("re-sending the same game changed the UID:\n%s", again)
+	}
+	if other := buildICS("Chess", "", start, 0, now); strings.Contains(other, lines[6]+"\r\n") {
+		t.Errorf("a different game reused the UID %q", lines[6])
+	}
+}
+
+func TestBuildICSDurationAndFolding(t *testing.T) {
+	start := time.Date(2026, 3, 6, 19, 0, 0, 0, time.UTC)
+	ics := buildICS("Chess", strings.Repeat("Zoë plays ", 20), start, 90*time.Minute, start)
+	if !strings.Contains(ics, "DTEND:20260306T203000Z\r\n") {
+		t.Errorf("want the event to end after 90 minutes:\n%s", ics)
+	}
+	var description string
+	for _, line := range strings.Split(ics, "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line is %d octets, want at most 75: %q", len(line), line)
+		}
+		switch {
+		case strings.HasPrefix(line, "DESCRIPTION:"):
+			description = line
+		case strings.HasPrefix(line, " ") && description != "":
+			description += line[1:]
+		}
+	}
+	if want := "DESCRIPTION:" + strings.Repeat("Zoë plays ", 20); description != want {
+		t.Errorf("unfolded description = %q, want %q", description, want)
+	}
+}
+
+func TestICSFilename(t *testing.T) {
+	tests := map[string]string{"Catan": "catan.ics", "Ticket to Ride: Europe": "ticket-to-ride--europe.ics", "囲碁": "game.ics"}
+	for game, want := range tests {
+		if got := icsFilename(game); got != want {
+			t.Errorf("icsFilename(%q) = %q, want %q", game, got, want)
+		}
+	}
+}
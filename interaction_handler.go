@@ -0,0 +1,378 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/slack-go/slack"
+)
+
+// Action IDs of the invitation buttons.
+const (
+	actionAcceptGame  = "accept_game"
+	actionMaybeGame   = "maybe_game"
+	actionDeclineGame = "decline_game"
+)
+
+// inviteActionValue is carried in the value of every invitation button, so a click can be routed
+// back to the inviter without any server-side state.
+type inviteActionValue struct {
+	Game      string `json:"game"`
+	InviterID string `json:"inviter_id,omitempty"`
+	GameStart int64  `json:"game_start,omitempty"` // Unix time the game starts, for invitations with a game_time
+	GameEnd   int64  `json:"game_end,omitempty"`   // Unix time the game ends, for invitations with a game_time
+	InviteID  string `json:"invite_id,omitempty"`  // keys the invitation's RSVP record
+}
+
+// errActionValueSignature is returned for button values whose signature is missing or wrong,
+// which means the payload was crafted or altered rather than produced by us.
+var errActionValueSignature = errors.New("invitation button value has an invalid signature")
+
+// encodeInviteActionValue serializes the button value for an invitation. When secret is set the
+// JSON is followed by "." and a hex HMAC-SHA256 of it, so clicks can be checked for tampering.
+func encodeInviteActionValue(action inviteActionValue, secret []byte) string {
+	value, err := json.Marshal(action)
+	if err != nil {
+		// Marshalling strings and an integer can't fail.
+		panic(err)
+	}
+	if len(secret) == 0 {
+		return string(value)
+	}
+	return string(value) + "." + signActionValue(value, secret)
+}
+
+// decodeInviteActionValue parses a button value produced by encodeInviteActionValue, verifying
+// its signature when secret is set. Unsigned values are only accepted without a secret.
+func decodeInviteActionValue(value string, secret []byte) (inviteActionValue, error) {
+	payload := value
+	if len(secret) > 0 {
+		// Hex has no dots, so the last one separates the signature from the JSON.
+		i := strings.LastIndex(value, ".")
+		if i < 0 || !hmac.Equal([]byte(value[i+1:]), []byte(signActionValue([]byte(value[:i]), secret))) {
+			return inviteActionValue{}, errActionValueSignature
+		}
+		payload = value[:i]
+	}
+	var decoded inviteActionValue
+	if err := json.Unmarshal([]byte(payload), &decoded); err != nil {
+		return inviteActionValue{}, fmt.Errorf("invalid invitation button value: %w", err)
+	}
+	return decoded, nil
+}
+
+// signActionValue returns the hex HMAC-SHA256 of payload under secret.
+func signActionValue(payload, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// encodeInviteBlockID builds the ID of a block tied to inviteID, such as the time slot select,
+// signed like the button values when secret is set. Selects carry it in their block ID because
+// option values are too short to hold a signed button value.
+func encodeInviteBlockID(prefix, inviteID string, secret []byte) string {
+	if len(secret) == 0 {
+		return prefix + inviteID
+	}
+	return prefix + inviteID + "." + signActionValue([]byte(inviteID), secret)
+}
+
+// decodeInviteBlockID returns the invite ID of a block ID made by encodeInviteBlockID with prefix.
+func decodeInviteBlockID(prefix, blockID string, secret []byte) (string, error) {
+	value, ok := strings.CutPrefix(blockID, prefix)
+	if !ok {
+		return "", fmt.Errorf("invalid block ID %q", blockID)
+	}
+	if len(secret) == 0 {
+		return value, nil
+	}
+	inviteID, signature, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(signActionValue([]byte(inviteID), secret))) {
+		return "", errActionValueSignature
+	}
+	return inviteID, nil
+}
+
+// InteractionHandler processes Slack interaction payloads, such as clicks on the invitation buttons.
+type InteractionHandler struct {
+	slackClient   *slack.Client
+	userCache     *userCache
+	sender        *messageSender
+	router        *actionRouter
+	secret        []byte              // verifies button values; empty accepts unsigned values
+	feedback      *feedbackCollector  // asks accepters how the game went; nil disables it
+	confirmations *dayOfConfirmations // asks accepters whether they're still on; nil disables it
+	reminders     *inviteReminders    // delivers invitations again when asked; nil disables it
+	rsvps         *rsvpTracker
+	notices       *inviterNotifier // tells inviters about answers
+	pending       *pendingInvites  // resolved once everyone has answered
+	rosters       *eventQueues     // roster updates, queued per invite ID so the latest tally lands last
+	noticeQueue   *eventQueues     // inviter notices, queued per invite ID so they go out in order
+	updating      sync.WaitGroup   // roster updates and inviter notices not yet finished
+
+	submissions map[string]viewSubmissionFunc // modal submission handlers by view callback ID
+}
+
+// NewInteractionHandler creates a new InteractionHandler with the invitation buttons registered.
+// signingSecret must match the one the invitations were signed with. feedback, confirmations and
+// reminders may be nil.
+func NewInteractionHandler(slackClient *slack.Client, userCache *userCache, sender *messageSender, signingSecret string, feedback *feedbackCollector, confirmations *dayOfConfirmations, reminders *inviteReminders, rsvps *rsvpTracker, notices *inviterNotifier, pending *pendingInvites) *InteractionHandler {
+	h := &InteractionHandler{
+		slackClient:   slackClient,
+		userCache:     userCache,
+		sender:        sender,
+		router:        newActionRouter(),
+		submissions:   make(map[string]viewSubmissionFunc),
+		secret:        []byte(signingSecret),
+		feedback:      feedback,
+		confirmations: confirmations,
+		reminders:     reminders,
+		rsvps:         rsvps,
+		notices:       notices,
+		pending:       pending,
+		rosters:       newEventQueues(),
+		noticeQueue:   newEventQueues(),
+	}
+	h.router.handle(actionAcceptGame, h.respondToInvite(rsvpAccepted, "accepted"))
+	h.router.handle(actionMaybeGame, h.respondToInvite(rsvpInterested, "might join"))
+	h.router.handle(actionDeclineGame, h.respondToInvite(rsvpDeclined, "declined"))
+	h.router.handle(actionPickTimeSlot, h.pickTimeSlot)
+	h.submissions[accessCodeCallbackID] = h.submitAccessCode
+	if reminders != nil {
+		h.router.handle(actionRemindMe, h.remindMe)
+	}
+	if confirmations != nil {
+		h.router.handle(actionConfirmYes, h.respondToConfirmation(true))
+		h.router.handle(actionConfirmNo, h.respondToConfirmation(false))
+	}
+	if feedback != nil {
+		h.router.handle(actionFeedbackPositive, h.respondToFeedback("positive"))
+		h.router.handle(actionFeedbackNegative, h.respondToFeedback("negative"))
+	}
+	return h
+}
+
+// handle routes actions whose action_id starts with prefix to handler, for buttons posted by
+// other handlers, such as the conversation's "Edit recipients".
+func (h *InteractionHandler) handle(prefix string, handler actionHandlerFunc) {
+	h.router.handle(prefix, handler)
+}
+
+// handleSubmission routes submissions of modals with callbackID to submit.
+func (h *InteractionHandler) handleSubmission(callbackID string, submit viewSubmissionFunc) {
+	h.submissions[callbackID] = submit
+}
+
+// HandleInteraction is our Gin handler for Slack interaction payloads. Slack posts them form-encoded
+// with the JSON in a "payload" field.
+func (h *InteractionHandler) HandleInteraction(c *gin.Context) {
+	payload := c.PostForm("payload")
+	if payload == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing payload"})
+		return
+	}
+	var callback slack.InteractionCallback
+	if err := json.Unmarshal([]byte(payload), &callback); err != nil {
+		logger.Warn("Error decoding interaction payload", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload: " + err.Error()})
+		return
+	}
+
+	logger.Info("Received Slack interaction", "event_type", callback.Type, "user_id", callback.User.ID, "channel", callback.Channel.ID)
+	if callback.Type == slack.InteractionTypeViewSubmission {
+		submit, ok := h.submissions[callback.View.CallbackID]
+		if !ok {
+			logger.Info("Ignoring unknown view submission", "event_type", callback.Type, "callback_id", callback.View.CallbackID)
+			c.Status(http.StatusOK)
+			return
+		}
+		// An empty response closes the modal; errors keep it open with them shown inline.
+		if response := submit(&callback); response != nil {
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		c.Status(http.StatusOK)
+		return
+	}
+	if callback.Type != slack.InteractionTypeBlockActions {
+		logger.Info("Ignoring unhandled interaction", "event_type", callback.Type)
+		c.Status(http.StatusOK)
+		return
+	}
+	for _, action := range callback.ActionCallback.BlockActions {
+		h.router.dispatch(&callback, action)
+	}
+	c.Status(http.StatusOK)
+}
+
+// updateRoster re-renders inviteID's invitation messages with the live roster in the
+// background, so the click is acknowledged without waiting on Slack. Updates for one
+// invitation run in order, and each renders the tally as it is when it runs. clicked is the
+// message answered from, if it was a copy of the invitation.
+func (h *InteractionHandler) updateRoster(inviteID string, clicked inviteMessage, clickedBlocks []slack.Block) {
+	h.updating.Add(1)
+	h.rosters.enqueue(inviteID, func() {
+		defer h.updating.Done()
+		h.refreshRoster(inviteID, clicked, clickedBlocks)
+	})
+}
+
+// notifyInviter tells inviterID about an answer in the background, like updateRoster, since a
+// batched notice can take several paced Slack calls. Notices for one invitation run in order.
+func (h *InteractionHandler) notifyInviter(inviterID, inviteID, notice string, tally *RSVPTally) {
+	key := inviteID
+	if key == "" {
+		// Invitations sent before RSVP tracking carry no invite ID.
+		key = inviterID
+	}
+	h.updating.Add(1)
+	h.noticeQueue.enqueue(key, func() {
+		defer h.updating.Done()
+		h.notices.notify(inviterID, inviteID, notice, tally)
+	})
+}
+
+// wait blocks until every queued roster update and inviter notice has finished.
+func (h *InteractionHandler) wait() {
+	h.updating.Wait()
+}
+
+// respondToInvite returns an action handler that confirms the choice to the clicking user and
+// tells the inviter about it. status is logged, verb is used in the messages.
+func (h *InteractionHandler) respondToInvite(status, verb string) actionHandlerFunc {
+	return func(callback *slack.InteractionCallback, action *slack.BlockAction) {
+		value, err := decodeInviteActionValue(action.Value, h.secret)
+		if errors.Is(err, errActionValueSignature) {
+			logger.Warn("Rejecting click with a tampered button value", "event_type", callback.Type, "action_id", action.ActionID, "user_id", callback.User.ID, "value", action.Value)
+			return
+		}
+		if err != nil {
+			logger.Info("Ignoring click with an unusable button value", "event_type", callback.Type, "action_id", action.ActionID, "user_id", callback.User.ID, "error", err)
+			return
+		}
+		logger.Info("Invitation answered", "event_type", callback.Type, "user_id", callback.User.ID, "status", status, "game", value.Game, "inviter_id", value.InviterID)
+
+		channelID := callback.Channel.ID
+		if channelID == "" {
+			channelID = callback.Container.ChannelID
+		}
+		// Invitations with an access code only take an accept once it has been entered.
+		if status == rsvpAccepted && h.promptForAccessCode(callback, action, value, channelID) {
+			return
+		}
+		confirmation := fmt.Sprintf("You %s the %s invite.", verb, value.Game)
+		if _, err := h.slackClient.PostEphemeral(channelID, callback.User.ID, slack.MsgOptionText(confirmation, false)); err != nil {
+			logger.Error("Failed to confirm the answer", "event_type", callback.Type, "user_id", callback.User.ID, "status", status, "error", h.sender.scopes.explain(methodPostEphemeral, err))
+		}
+
+		clicked := inviteMessage{Channel: callback.Container.ChannelID, TS: callback.Container.MessageTs}
+		if clicked.Channel == "" {
+			clicked.Channel = callback.Channel.ID
+		}
+		h.recordAnswer(callback, value, status, verb, clicked, callback.Message.Blocks.BlockSet)
+	}
+}
+
+// recordAnswer applies the clicking user's answer to the invitation value describes: it
+// schedules or cancels the follow-ups only accepters get, records the RSVP, updates the
+// roster and tells the inviter. clicked is the invitation message answered from, if any, which
+// the roster update then covers too, rendered from clickedBlocks if the record has none.
+func (h *InteractionHandler) recordAnswer(callback *slack.InteractionCallback, value inviteActionValue, status, verb string, clicked inviteMessage, clickedBlocks []slack.Block) {
+	// Only accepters are asked whether they're still on and how the game went.
+	if status == rsvpAccepted {
+		h.feedback.schedule(callback.User.ID, value)
+		h.confirmations.schedule(callback.User.ID, value)
+	} else {
+		h.feedback.cancel(callback.User.ID, value)
+		h.confirmations.cancel(callback.User.ID, value)
+	}
+
+	// Invitations sent before RSVP tracking carry no invite ID.
+	var tally *RSVPTally
+	if value.InviteID != "" {
+		updated, err := h.rsvps.record(value.InviteID, value.Game, callback.User.ID, h.displayName(callback.User), status)
+		if err != nil {
+			logger.Error("Error recording RSVP", "event_type", callback.Type, "user_id", callback.User.ID, "invite_id", value.InviteID, "error", err)
+		} else {
+			tally = &updated
+			h.pending.answered(value.InviteID, updated)
+			h.updateRoster(value.InviteID, clicked, clickedBlocks)
+		}
+	}
+
+	if value.InviterID == "" || value.InviterID == callback.User.ID {
+		return
+	}
+	h.notifyInviter(value.InviterID, value.InviteID, fmt.Sprintf("%s %s your %s invite.", h.displayName(callback.User), verb, value.Game), tally)
+}
+
+// respondToConfirmation returns an action handler for the day-of confirmation buttons. Saying
+// no counts as declining the invitation; either way the buttons are replaced by the answer.
+func (h *InteractionHandler) respondToConfirmation(stillOn bool) actionHandlerFunc {
+	return func(callback *slack.InteractionCallback, action *slack.BlockAction) {
+		value, err := decodeInviteActionValue(action.Value, h.secret)
+		if err != nil {
+			logger.Info("Ignoring click with an unusable button value", "event_type", callback.Type, "action_id", action.ActionID, "user_id", callback.User.ID, "error", err)
+			return
+		}
+		logger.Info("Day-of confirmation answered", "event_type", callback.Type, "user_id", callback.User.ID, "still_on", stillOn, "game", value.Game, "invite_id", value.InviteID)
+		reply := fmt.Sprintf("Great, you're still on for %s. See you there!", value.Game)
+		if !stillOn {
+			h.recordAnswer(callback, value, rsvpDeclined, "can no longer make", inviteMessage{}, nil)
+			reply = fmt.Sprintf("Okay, you're out of %s. I'll let the organizer know.", value.Game)
+		}
+		channelID := callback.Container.ChannelID
+		if channelID == "" {
+			channelID = callback.Channel.ID
+		}
+		if _, _, _, err := h.slackClient.UpdateMessage(channelID, callback.Container.MessageTs, slack.MsgOptionText(reply, false), slack.MsgOptionBlocks()); err != nil {
+			logger.Warn("Failed to update the day-of confirmation", "event_type", callback.Type, "user_id", callback.User.ID, "error", err)
+		}
+	}
+}
+
+// respondToFeedback returns an action handler that records a post-game feedback answer and
+// thanks the user for it.
+func (h *InteractionHandler) respondToFeedback(rating string) actionHandlerFunc {
+	return func(callback *slack.InteractionCallback, action *slack.BlockAction) {
+		value, err := decodeInviteActionValue(action.Value, h.secret)
+		if err != nil {
+			logger.Info("Ignoring click with an unusable button value", "event_type", callback.Type, "action_id", action.ActionID, "user_id", callback.User.ID, "error", err)
+			return
+		}
+		reply := "Thanks for the feedback!"
+		if err := h.feedback.record(callback.User.ID, value, rating); errors.Is(err, errFeedbackRecorded) {
+			reply = "You've already told us how " + value.Game + " went, thanks!"
+		} else if err != nil {
+			logger.Error("Error recording feedback", "event_type", callback.Type, "user_id", callback.User.ID, "error", err)
+			reply = "Sorry, I couldn't record that. Please try again shortly."
+		}
+		channelID := callback.Channel.ID
+		if channelID == "" {
+			channelID = callback.Container.ChannelID
+		}
+		if _, err := h.slackClient.PostEphemeral(channelID, callback.User.ID, slack.MsgOptionText(reply, false)); err != nil {
+			logger.Error("Failed to confirm feedback", "event_type", callback.Type, "user_id", callback.User.ID, "error", h.sender.scopes.explain(methodPostEphemeral, err))
+		}
+	}
+}
+
+// displayName returns the user's real name from the directory, falling back to their handle.
+func (h *InteractionHandler) displayName(user slack.User) string {
+	if cached, ok := h.userCache.lookup(user.ID); ok && cached.RealName != "" {
+		return cached.RealName
+	}
+	if user.Name != "" {
+		return user.Name
+	}
+	return "<@" + user.ID + ">"
+}
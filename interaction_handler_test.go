@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/slack-go/slack"
+)
+
+// testActionSecret signs the button values in the interaction tests.
+const testActionSecret = "action-secret"
+
+// newTestInteractionHandler builds an InteractionHandler against the fake Slack with in-memory
+// state, telling inviters about answers at most once per notifyWindow.
+func newTestInteractionHandler(t *testing.T, fake *fakeSlack, notifyWindow time.Duration) *InteractionHandler {
+	t.Helper()
+	store := NewInMemoryStore()
+	client := fake.client()
+	sender := newMessageSender(client, nil, newSendPacer(0, 0), 0, 0)
+	return NewInteractionHandler(client, newUserCache(client, time.Minute), sender, testActionSecret, nil, nil, nil, newRSVPTracker(store), newInviterNotifier(store, sender, notifyWindow), newPendingInvites(store, 0, 0))
+}
+
+// click has userID press the invitation button actionID on the invitation value describes.
+func click(h *InteractionHandler, userID, actionID string, value inviteActionValue) {
+	callback := &slack.InteractionCallback{Type: slack.InteractionTypeBlockActions, User: slack.User{ID: userID}, Channel: slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: "C1"}}}}
+	h.router.dispatch(callback, &slack.BlockAction{ActionID: actionID, Value: encodeInviteActionValue(value, []byte(testActionSecret))})
+}
+
+// submitView posts a submission of the modal view with the input values given, by block and
+// action ID, as userID, and returns the response Slack would get: nil when the modal closes.
+func submitView(t *testing.T, h *InteractionHandler, userID string, view slack.ModalViewRequest, values map[string]map[string]slack.BlockAction) *slack.ViewSubmissionResponse {
+	t.Helper()
+	callback := slack.InteractionCallback{
+		Type: slack.InteractionTypeViewSubmission,
+		User: slack.User{ID: userID},
+		View: slack.View{
+			CallbackID:      view.CallbackID,
+			PrivateMetadata: view.PrivateMetadata,
+			State:           &slack.ViewState{Values: values},
+		},
+	}
+	payload, err := json.Marshal(callback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/slack/interactions", strings.NewReader(url.Values{"payload": {string(payload)}}.Encode()))
+	c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	h.HandleInteraction(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("submission answered %d: %s", w.Code, w.Body.String())
+	}
+	if w.Body.Len() == 0 {
+		return nil
+	}
+	var response slack.ViewSubmissionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decoding the submission response %q: %v", w.Body.String(), err)
+	}
+	return &response
+}
+
+func TestInviterNotificationsAreBatched(t *testing.T) {
+	type answer struct{ userID, actionID string }
+	tests := []struct {
+		name          string
+		window        time.Duration
+		inviteID      string
+		answers       []answer
+		wantDMs       []string      // posted to the inviter right away
+		wantScheduled []string      // updates still queued for the inviter
+		wantWithdrawn int           // updates replaced by a later one
+		wantDelay     time.Duration // how far ahead the last update is queued, window when zero
+	}{
+		{
+			name:     "no window notifies every answer",
+			inviteID: "inv1",
+			answers:  []answer{{"U2", actionAcceptGame}, {"U3", actionDeclineGame}},
+			wantDMs: []string{
+				"Bob Baker accepted your Catan invite. So far: 1 accepted, 0 maybe, 0 declined.",
+				"Carol Cooper declined your Catan invite. So far: 1 accepted, 0 maybe, 1 declined.",
+			},
+		},
+		{
+			name:     "first answer right away, the next one batched",
+			window:   10 * time.Minute,
+			inviteID: "inv1",
+			answers:  []answer{{"U2", actionAcceptGame}, {"U3", actionDeclineGame}},
+			wantDMs:  []string{"Bob Baker accepted your Catan invite. So far: 1 accepted, 0 maybe, 0 declined."},
+			wantScheduled: []string{
+				"1 more answer to your Catan invite. So far: 1 accepted, 0 maybe, 1 declined.",
+			},
+		},
+		{
+			name:     "later answers replace the queued update",
+			window:   10 * time.Minute,
+			inviteID: "inv1",
+			answers:  []answer{{"U2", actionAcceptGame}, {"U3", actionDeclineGame}, {"U2", actionMaybeGame}},
+			wantDMs:  []string{"Bob Baker accepted your Catan invite. So far: 1 accepted, 0 maybe, 0 declined."},
+			wantScheduled: []string{
+				"2 more answers to your Catan invite. So far: 0 accepted, 1 maybe, 1 declined.",
+			},
+			wantWithdrawn: 1,
+		},
+		{
+			name:     "an update due within a minute is left alone",
+			window:   40 * time.Second,
+			inviteID: "inv1",
+			answers:  []answer{{"U2", actionAcceptGame}, {"U3", actionDeclineGame}, {"U2", actionMaybeGame}},
+			wantDMs:  []string{"Bob Baker accepted your Catan invite. So far: 1 accepted, 0 maybe, 0 declined."},
+			wantScheduled: []string{
+				"1 more answer to your Catan invite. So far: 1 accepted, 0 maybe, 1 declined.",
+				"1 more answer to your Catan invite. So far: 0 accepted, 1 maybe, 1 declined.",
+			},
+			wantDelay: 80 * time.Second,
+		},
+		{
+			name:    "invitations without an invite ID aren't batched",
+			window:  10 * time.Minute,
+			answers: []answer{{"U2", actionAcceptGame}, {"U3", actionDeclineGame}},
+			wantDMs: []string{"Bob Baker accepted your Catan invite.", "Carol Cooper declined your Catan invite."},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			h := newTestInteractionHandler(t, fake, tt.window)
+			value := inviteActionValue{Game: "Catan", InviterID: "U1", InviteID: tt.inviteID}
+			for _, a := range tt.answers {
+				click(h, a.userID, a.actionID, value)
+			}
+			h.wait()
+
+			if got := fake.postsTo("U1"); strings.Join(got, "\n") != strings.Join(tt.wantDMs, "\n") {
+				t.Errorf("DMs to the inviter = %q, want %q", got, tt.wantDMs)
+			}
+			var queued []string
+			withdrawn := 0
+			var postAt int64
+			for _, scheduled := range fake.allScheduled() {
+				if scheduled.Deleted {
+					withdrawn++
+					continue
+				}
+				queued = append(queued, scheduled.Text)
+				postAt = scheduled.PostAt
+			}
+			if strings.Join(queued, "\n") != strings.Join(tt.wantScheduled, "\n") {
+				t.Errorf("queued updates = %q, want %q", queued, tt.wantScheduled)
+			}
+			if withdrawn != tt.wantWithdrawn {
+				t.Errorf("%d queued updates were withdrawn, want %d", withdrawn, tt.wantWithdrawn)
+			}
+			if len(queued) > 0 {
+				delay := tt.wantDelay
+				if delay == 0 {
+					delay = tt.window
+				}
+				if until := time.Until(time.Unix(postAt, 0)); until < delay-time.Minute || until > delay {
+					t.Errorf("update queued %s ahead, want about %s", until, delay)
+				}
+			}
+		})
+	}
+}
+
+func TestInviteActionValueRejectsTampering(t *testing.T) {
+	value := inviteActionValue{Game: "Catan", InviterID: "U1", InviteID: "inv1"}
+	signed := encodeInviteActionValue(value, []byte(testActionSecret))
+	payload, _, _ := strings.Cut(signed, ".")
+	tests := []struct {
+		name         string
+		value        string
+		wantErr      error // nil when the click is accepted
+		wantAccepted bool
+	}{
+		{name: "signed", value: signed, wantAccepted: true},
+		{name: "other game", value: strings.Replace(signed, "Catan", "Poker", 1), wantErr: errActionValueSignature},
+		{name: "other invite", value: strings.Replace(signed, "inv1", "inv2", 1), wantErr: errActionValueSignature},
+		{name: "unsigned", value: payload, wantErr: errActionValueSignature},
+		{name: "another secret", value: encodeInviteActionValue(value, []byte("other-secret")), wantErr: errActionValueSignature},
+		{name: "garbled signature", value: payload + ".deadbeef", wantErr: errActionValueSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := decodeInviteActionValue(tt.value, []byte(testActionSecret))
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && decoded != value) {
+				t.Errorf("decodeInviteActionValue = %+v, %v; want %+v, %v", decoded, err, value, tt.wantErr)
+			}
+
+			fake := newFakeSlack(t, testUsers...)
+			h := newTestInteractionHandler(t, fake, 0)
+			if err := h.rsvps.start("inv1", "Catan", "U1", nil, ""); err != nil {
+				t.Fatal(err)
+			}
+			callback := &slack.InteractionCallback{Type: slack.InteractionTypeBlockActions, User: slack.User{ID: "U2"}, Channel: slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: "DU2"}}}}
+			h.router.dispatch(callback, &slack.BlockAction{ActionID: actionAcceptGame, Value: tt.value})
+			h.wait()
+
+			tally, _, err := h.rsvps.get("inv1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if accepted := len(tally.Accepted.Names) == 1; accepted != tt.wantAccepted {
+				t.Errorf("accepted = %q, want the click recorded: %v", tally.Accepted.Names, tt.wantAccepted)
+			}
+			if replies := fake.ephemeralsFor("U2"); tt.wantAccepted != (len(replies) > 0) {
+				t.Errorf("replies = %q, want a reply only to accepted clicks", replies)
+			}
+		})
+	}
+}
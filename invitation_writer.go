@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+)
+
+// invitationWriter writes invitation texts with the configured generator, shared by the Slack
+// flows and POST /invite so they share one circuit breaker too.
+type invitationWriter struct {
+	config    *Config
+	users     *userCache // looks up recipients' locales for PER_RECIPIENT_LANGUAGE
+	generator InvitationGenerator
+	breaker   *circuitBreaker
+}
+
+// newInvitationWriter writes invitations with generator.
+func newInvitationWriter(config *Config, users *userCache, generator InvitationGenerator) *invitationWriter {
+	return &invitationWriter{
+		config:    config,
+		users:     users,
+		generator: generator,
+		breaker:   newCircuitBreaker(config.InvitationProvider, config.GeneratorBreakerThreshold, config.GeneratorBreakerCooldown),
+	}
+}
+
+// writtenInvitation is an invitation text written for some of the recipients.
+type writtenInvitation struct {
+	languageGroup
+	Text string
+}
+
+// write writes the invitation for the recipients. With PER_RECIPIENT_LANGUAGE on, the
+// recipients are grouped by the language of their Slack locale and each group's invitation is
+// generated in its language; otherwise everyone shares one. Nothing is returned unless every
+// invitation could be written.
+func (w *invitationWriter) write(ctx context.Context, invitingUser string, recipientIDs, recipientNames []string, gameName string, opts GenerateOptions) ([]writtenInvitation, error) {
+	groups := []languageGroup{{RecipientIDs: recipientIDs, RecipientNames: recipientNames}}
+	if w.config.PerRecipientLanguage && len(recipientIDs) > 0 {
+		groups = groupByLanguage(w.users, recipientIDs, recipientNames, w.config.MaxInviteLanguages)
+	}
+	invitations := make([]writtenInvitation, 0, len(groups))
+	for _, group := range groups {
+		groupOpts := opts
+		groupOpts.Language = group.Language
+		// Each group's prompt names only its own recipients, so the greeting fits who reads it.
+		text, err := w.generate(ctx, invitingUser, group.RecipientNames, gameName, groupOpts)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, writtenInvitation{languageGroup: group, Text: text})
+	}
+	return invitations, nil
+}
+
+// generate produces the invitation text, followed by the game's closing line if one is
+// configured, and enforces the configured maximum message length.
+// Calls fail fast while the generator's circuit breaker is open. When generation fails and the
+// fallback is enabled, the fallback template is used instead so the invite still goes out.
+func (w *invitationWriter) generate(ctx context.Context, invitingUser string, invitedUsers []string, gameName string, opts GenerateOptions) (string, error) {
+	invitation, err := w.call(ctx, invitingUser, invitedUsers, gameName, opts)
+	if err != nil {
+		if !w.config.InvitationFallback {
+			return "", err
+		}
+		logger.Warn("Using the fallback invitation template after generation failed", "error", err)
+		invitation = renderFallbackInvitation(w.config.InvitationFallbackTemplate, invitingUser, invitedUsers, gameName)
+	}
+	return withClosing(invitation, w.config.closingFor(gameName), w.config.MaxMessageLength), nil
+}
+
+// call asks the generator for an invitation through the circuit breaker.
+func (w *invitationWriter) call(ctx context.Context, invitingUser string, invitedUsers []string, gameName string, opts GenerateOptions) (string, error) {
+	if !w.breaker.allow() {
+		return "", errCircuitOpen
+	}
+	invitation, err := w.generator.Generate(ctx, invitingUser, invitedUsers, gameName, opts)
+	w.breaker.record(err)
+	if err != nil {
+		logGeneratorError("invitation", err)
+		return "", err
+	}
+	return invitation, nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+func TestSendInviteReturnsGeneratedText(t *testing.T) {
+	users := []slack.User{
+		{ID: "U1", Name: "alice", RealName: "Alice Archer"},
+		{ID: "U2", Name: "bob", RealName: "Bob Baker", Locale: "fr-FR"},
+		{ID: "U3", Name: "carol", RealName: "Carol Cooper", Locale: "en-US"},
+	}
+	tests := []struct {
+		name          string
+		req           InviteRequest
+		perLanguage   bool
+		generator     InvitationGenerator
+		wantCode      int
+		wantText      string            // generated_text
+		wantTexts     map[string]string // generated_texts
+		wantDelivered map[string]string // recipient -> text in their copy
+	}{
+		{
+			name:          "shared text",
+			req:           InviteRequest{GameName: "Catan", UserIDs: []string{"U2", "U3"}, InviterID: "U1", Generate: true},
+			generator:     &languageGenerator{},
+			wantCode:      http.StatusOK,
+			wantText:      "English: Bob Baker, Carol Cooper",
+			wantDelivered: map[string]string{"U2": "English: Bob Baker, Carol Cooper", "U3": "English: Bob Baker, Carol Cooper"},
+		},
+		{
+			name:          "text per language",
+			req:           InviteRequest{GameName: "Catan", UserIDs: []string{"U2", "U3"}, InviterID: "U1", Generate: true},
+			perLanguage:   true,
+			generator:     &languageGenerator{},
+			wantCode:      http.StatusOK,
+			wantText:      "English: Carol Cooper",
+			wantTexts:     map[string]string{"U2": "French: Bob Baker", "U3": "English: Carol Cooper"},
+			wantDelivered: map[string]string{"U2": "French: Bob Baker", "U3": "English: Carol Cooper"},
+		},
+		{
+			name:      "dry run sends nothing",
+			req:       InviteRequest{GameName: "Catan", UserIDs: []string{"U2"}, Generate: true, DryRun: true},
+			generator: &languageGenerator{},
+			wantCode:  http.StatusOK,
+			wantText:  "English: Bob Baker",
+		},
+		{
+			name:      "description and generate",
+			req:       InviteRequest{GameName: "Catan", UserIDs: []string{"U2"}, Description: "Come play", Generate: true},
+			generator: &languageGenerator{},
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "generation fails",
+			req:       InviteRequest{GameName: "Catan", UserIDs: []string{"U2"}, Generate: true},
+			generator: &fakeGenerator{err: errors.New("model unavailable")},
+			wantCode:  http.StatusBadGateway,
+		},
+		{
+			name:          "without generate",
+			req:           InviteRequest{GameName: "Catan", UserIDs: []string{"U2"}, Description: "Come play"},
+			generator:     &languageGenerator{},
+			wantCode:      http.StatusOK,
+			wantDelivered: map[string]string{"U2": "Come play"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, users...)
+			config := testConfig()
+			config.PerRecipientLanguage = tt.perLanguage
+			config.MaxInviteLanguages = 3
+			h, _ := newTestInviteHandler(t, fake, config)
+			h.writer = newInvitationWriter(config, h.userCache, tt.generator)
+
+			status, response := h.sendInvite(tt.req)
+			if status != tt.wantCode {
+				t.Fatalf("sendInvite = %d %v, want %d", status, response, tt.wantCode)
+			}
+			if got, _ := response["generated_text"].(string); got != tt.wantText {
+				t.Errorf("generated_text = %q, want %q", got, tt.wantText)
+			}
+			gotTexts, _ := response["generated_texts"].(map[string]string)
+			if len(gotTexts) != len(tt.wantTexts) {
+				t.Errorf("generated_texts = %q, want %q", gotTexts, tt.wantTexts)
+			}
+			for id, want := range tt.wantTexts {
+				if gotTexts[id] != want {
+					t.Errorf("generated_texts[%s] = %q, want %q", id, gotTexts[id], want)
+				}
+			}
+
+			posts := fake.allPosts()
+			if len(posts) != len(tt.wantDelivered) {
+				t.Fatalf("posted %d messages, want %d", len(posts), len(tt.wantDelivered))
+			}
+			for _, post := range posts {
+				want := tt.wantDelivered[post.Channel]
+				if want == "" || !strings.Contains(post.Blocks, want) {
+					t.Errorf("copy for %s = %s, want it to contain %q", post.Channel, post.Blocks, want)
+				}
+				for id, other := range tt.wantDelivered {
+					if id != post.Channel && other != want && strings.Contains(post.Blocks, other) {
+						t.Errorf("copy for %s also contains %s's text %q", post.Channel, id, other)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestOpenBreakerSkipsTheGenerator(t *testing.T) {
+	tests := []struct {
+		name     string
+		fallback bool
+		wantText string // "" when the write should fail
+	}{
+		{name: "falls back to the template", fallback: true, wantText: "Hey Bob Baker, Alice Archer wants to play Catan — you in?"},
+		{name: "fails fast without the fallback"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig()
+			config.GeneratorBreakerThreshold = 2
+			config.GeneratorBreakerCooldown = time.Hour
+			config.InvitationFallback = tt.fallback
+			config.InvitationFallbackTemplate = defaultFallbackTemplate
+			generator := &fakeGenerator{err: errors.New("model unavailable")}
+			writer := newInvitationWriter(config, nil, generator)
+			write := func() ([]writtenInvitation, error) {
+				return writer.write(context.Background(), "Alice Archer", []string{"U2"}, []string{"Bob Baker"}, "Catan", GenerateOptions{})
+			}
+
+			// Two failures in a row open the breaker.
+			for i := 0; i < 2; i++ {
+				_, _ = write()
+			}
+			if got := generator.callCount(); got != 2 {
+				t.Fatalf("generator called %d times before the breaker opened, want 2", got)
+			}
+
+			invitations, err := write()
+			if got := generator.callCount(); got != 2 {
+				t.Errorf("generator called %d times, want the open breaker to skip it", got)
+			}
+			if tt.wantText == "" {
+				if !errors.Is(err, errCircuitOpen) {
+					t.Errorf("write() error = %v, want errCircuitOpen", err)
+				}
+				return
+			}
+			if err != nil || len(invitations) != 1 || invitations[0].Text != tt.wantText {
+				t.Errorf("write() = %+v, %v, want %q", invitations, err, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestRefusedInviteSkipsTheGenerator(t *testing.T) {
+	tests := []struct {
+		name       string
+		cooldown   time.Duration
+		maxPending int
+		wantCode   int // of the second request
+		wantCalls  int // generator calls over both requests
+	}{
+		{name: "game on cooldown", cooldown: time.Hour, wantCode: http.StatusTooManyRequests, wantCalls: 1},
+		{name: "too many pending", maxPending: 1, wantCode: http.StatusTooManyRequests, wantCalls: 1},
+		{name: "both allowed", wantCode: http.StatusOK, wantCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			config := testConfig()
+			config.GameCooldown = tt.cooldown
+			config.MaxPendingInvites = tt.maxPending
+			h, _ := newTestInviteHandler(t, fake, config)
+			generator := &fakeGenerator{invitation: "Come play!"}
+			h.writer = newInvitationWriter(config, h.userCache, generator)
+
+			req := InviteRequest{GameName: "Catan", UserIDs: []string{"U2"}, InviterID: "U1", Generate: true}
+			if status, response := h.sendInvite(req); status != http.StatusOK {
+				t.Fatalf("first sendInvite = %d %v, want 200", status, response)
+			}
+			if status, response := h.sendInvite(req); status != tt.wantCode {
+				t.Fatalf("second sendInvite = %d %v, want %d", status, response, tt.wantCode)
+			}
+			if got := generator.callCount(); got != tt.wantCalls {
+				t.Errorf("generator called %d times, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestFailedGenerationReleasesTheReservations(t *testing.T) {
+	fake := newFakeSlack(t, testUsers...)
+	config := testConfig()
+	config.GameCooldown = time.Hour
+	config.MaxPendingInvites = 1
+	h, _ := newTestInviteHandler(t, fake, config)
+	generator := &fakeGenerator{err: errors.New("model unavailable")}
+	h.writer = newInvitationWriter(config, h.userCache, generator)
+
+	req := InviteRequest{GameName: "Catan", UserIDs: []string{"U2"}, InviterID: "U1", Generate: true}
+	if status, response := h.sendInvite(req); status != http.StatusBadGateway {
+		t.Fatalf("sendInvite = %d %v, want 502", status, response)
+	}
+
+	// Neither the cooldown nor the pending slot may hold back the retry.
+	h.writer = newInvitationWriter(config, h.userCache, &fakeGenerator{invitation: "Come play!"})
+	if status, response := h.sendInvite(req); status != http.StatusOK {
+		t.Errorf("retry after the failure = %d %v, want 200", status, response)
+	}
+}
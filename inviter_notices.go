@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// scheduledDeleteCutoff is how close to its send time Slack refuses to withdraw a scheduled
+// message.
+const scheduledDeleteCutoff = time.Minute
+
+// inviterNoticeKeyPrefix namespaces, by invite ID, when the inviter was last told about answers.
+const inviterNoticeKeyPrefix = "inviter_notice:"
+
+// inviterNotice records the latest DM telling an inviter about answers to one invitation.
+type inviterNotice struct {
+	SentAt             int64  `json:"sent_at"` // when the DM went out or is scheduled to, unix seconds
+	ChannelID          string `json:"channel_id,omitempty"`
+	ScheduledMessageID string `json:"scheduled_message_id,omitempty"` // set while a batched update is queued with Slack
+	Batched            int    `json:"batched,omitempty"`              // answers the queued update covers
+}
+
+// inviterNotifier tells inviters about answers to their invitations, at most one DM per
+// invitation per window. The first answer is passed on right away; answers arriving within the
+// window after it are batched into one update queued with Slack for the end of the window, so a
+// large group answering at once doesn't flood the inviter. A zero window DMs every answer.
+type inviterNotifier struct {
+	store  Store
+	sender *messageSender
+	window time.Duration
+	mutex  sync.Mutex // serializes updates to a notice on this instance
+}
+
+// newInviterNotifier keeps notice state in store and DMs at most once per window.
+func newInviterNotifier(store Store, sender *messageSender, window time.Duration) *inviterNotifier {
+	return &inviterNotifier{store: store, sender: sender, window: window}
+}
+
+// notify tells inviterID that an answer came in. notice describes the answer, and tally is the
+// invitation's state after it, if it is known. Invitations without a tally can't be batched,
+// so every answer to them is passed on.
+func (n *inviterNotifier) notify(inviterID, inviteID, notice string, tally *RSVPTally) {
+	text := notice
+	if tally != nil {
+		text += " " + tally.summary()
+	}
+	if n.window <= 0 || tally == nil {
+		n.post(inviterID, inviteID, text)
+		return
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	key := inviterNoticeKeyPrefix + inviteID
+	now := time.Now()
+	var last inviterNotice
+	data, ok, err := n.store.Get(key)
+	if err == nil && ok {
+		err = json.Unmarshal(data, &last)
+	}
+	if err != nil {
+		logger.Error("Error loading inviter notice state, notifying right away", "user_id", inviterID, "invite_id", inviteID, "error", err)
+		n.post(inviterID, inviteID, text)
+		return
+	}
+
+	sentAt := time.Unix(last.SentAt, 0)
+	var next inviterNotice
+	switch {
+	case !ok || !now.Before(sentAt.Add(n.window)):
+		// Nothing went out within the window, so this answer can be passed on now.
+		n.post(inviterID, inviteID, text)
+		next = inviterNotice{SentAt: now.Unix()}
+	case last.ScheduledMessageID != "" && now.Before(sentAt.Add(-scheduledDeleteCutoff)):
+		// An update is already queued; replace it with one that covers this answer too.
+		n.unschedule(inviterID, inviteID, last)
+		next = n.scheduleUpdate(inviterID, inviteID, sentAt, last.Batched+1, *tally)
+	default:
+		// Either nothing is queued, or the queued update is too close to its send time for
+		// Slack to withdraw it, so this answer goes into the next window's update.
+		next = n.scheduleUpdate(inviterID, inviteID, sentAt.Add(n.window), 1, *tally)
+	}
+	if data, err = json.Marshal(next); err == nil {
+		err = n.store.Set(key, data, time.Until(time.Unix(next.SentAt, 0).Add(n.window)))
+	}
+	if err != nil {
+		logger.Error("Error saving inviter notice state", "user_id", inviterID, "invite_id", inviteID, "error", err)
+	}
+}
+
+// scheduleUpdate queues a DM for postAt telling inviterID about batched answers as of tally,
+// posting it right away if Slack won't schedule it.
+func (n *inviterNotifier) scheduleUpdate(inviterID, inviteID string, postAt time.Time, batched int, tally RSVPTally) inviterNotice {
+	answers := "answers"
+	if batched == 1 {
+		answers = "answer"
+	}
+	text := fmt.Sprintf("%d more %s to your %s invite. %s", batched, answers, tally.Game, tally.summary())
+	channelID, scheduledID, err := n.sender.schedule(inviterID, postAt, text, slack.MsgOptionText(text, false))
+	if err != nil && channelID != "" {
+		// Queued, but it can't be withdrawn; later answers go into the next window's update.
+		logger.Warn("Queued the inviter update without its ID", "user_id", inviterID, "invite_id", inviteID, "error", err)
+		return inviterNotice{SentAt: postAt.Unix(), ChannelID: channelID, Batched: batched}
+	}
+	if err != nil {
+		logger.Error("Failed to schedule the inviter update, notifying right away", "user_id", inviterID, "invite_id", inviteID, "error", err)
+		n.post(inviterID, inviteID, text)
+		return inviterNotice{SentAt: time.Now().Unix()}
+	}
+	logger.Info("Inviter update queued", "user_id", inviterID, "invite_id", inviteID, "answers", batched, "send_at", postAt.Format(time.RFC3339))
+	return inviterNotice{SentAt: postAt.Unix(), ChannelID: channelID, ScheduledMessageID: scheduledID, Batched: batched}
+}
+
+// unschedule withdraws the queued update last describes.
+func (n *inviterNotifier) unschedule(inviterID, inviteID string, last inviterNotice) {
+	_, err := n.sender.slackClient.DeleteScheduledMessage(&slack.DeleteScheduledMessageParameters{
+		Channel:            last.ChannelID,
+		ScheduledMessageID: last.ScheduledMessageID,
+	})
+	if err != nil {
+		logger.Error("Failed to withdraw the queued inviter update", "user_id", inviterID, "invite_id", inviteID, "error", err)
+	}
+}
+
+// post DMs text to inviterID now.
+func (n *inviterNotifier) post(inviterID, inviteID, text string) {
+	if _, _, err := n.sender.post(inviterID, slack.MsgOptionText(text, false)); err != nil {
+		logger.Error("Failed to notify inviter", "user_id", inviterID, "invite_id", inviteID, "error", err)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// localeLanguages names the language of each locale Slack lets users pick, as the generator is
+// asked to write in it. Locales missing here, and English ones, get the default prompt.
+var localeLanguages = map[string]string{
+	"de-DE": "German",
+	"es-ES": "Spanish",
+	"es-LA": "Latin American Spanish",
+	"fr-FR": "French",
+	"it-IT": "Italian",
+	"ja-JP": "Japanese",
+	"ko-KR": "Korean",
+	"pt-BR": "Brazilian Portuguese",
+	"zh-CN": "Simplified Chinese",
+	"zh-TW": "Traditional Chinese",
+}
+
+// languageForLocale returns the language to write invitations in for a Slack locale such as
+// "fr-FR", or "" for the default.
+func languageForLocale(locale string) string {
+	return localeLanguages[locale]
+}
+
+// languagePrompt asks the generator to write in a recipient's language. It is formatted with the
+// language name.
+const languagePrompt = "Write it in %s."
+
+// languageGroup is the recipients of an invitation who get it written in one language.
+type languageGroup struct {
+	Language       string // "" for the default language
+	RecipientIDs   []string
+	RecipientNames []string
+}
+
+// groupByLanguage splits the recipients by the language of their Slack locale, so each group's
+// invitation can be generated once. Only the maxLanguages languages with the most recipients get
+// their own group, which bounds the generator calls; everyone else, including recipients whose
+// locale is unknown, shares the default-language group, which comes first.
+func groupByLanguage(users *userCache, recipientIDs, recipientNames []string, maxLanguages int) []languageGroup {
+	byLanguage := make(map[string]*languageGroup)
+	var languages []string
+	for i, id := range recipientIDs {
+		language := ""
+		if user, ok := users.lookup(id); ok {
+			language = languageForLocale(user.Locale)
+		}
+		group, ok := byLanguage[language]
+		if !ok {
+			group = &languageGroup{Language: language}
+			byLanguage[language] = group
+			if language != "" {
+				languages = append(languages, language)
+			}
+		}
+		group.RecipientIDs = append(group.RecipientIDs, id)
+		if i < len(recipientNames) {
+			group.RecipientNames = append(group.RecipientNames, recipientNames[i])
+		}
+	}
+	sort.SliceStable(languages, func(i, j int) bool {
+		return len(byLanguage[languages[i]].RecipientIDs) > len(byLanguage[languages[j]].RecipientIDs)
+	})
+
+	fallback := byLanguage[""]
+	if fallback == nil {
+		fallback = &languageGroup{}
+	}
+	var groups []languageGroup
+	for i, language := range languages {
+		group := byLanguage[language]
+		if i >= maxLanguages {
+			fallback.RecipientIDs = append(fallback.RecipientIDs, group.RecipientIDs...)
+			fallback.RecipientNames = append(fallback.RecipientNames, group.RecipientNames...)
+			continue
+		}
+		groups = append(groups, *group)
+	}
+	if len(fallback.RecipientIDs) > 0 {
+		groups = append([]languageGroup{*fallback}, groups...)
+	}
+	return groups
+}
+
+// withLanguage adds the instruction to write in opts.Language, if any, to a prompt's extras.
+func (o GenerateOptions) withLanguage(extras string) string {
+	if o.Language == "" {
+		return extras
+	}
+	return strings.TrimSpace(extras + " " + fmt.Sprintf(languagePrompt, o.Language))
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+// languageGenerator writes each invitation as "<language>: <recipients>", counting its calls.
+type languageGenerator struct {
+	mutex sync.Mutex
+	calls int
+}
+
+func (g *languageGenerator) Generate(ctx context.Context, inviter string, recipients []string, game string, opts GenerateOptions) (string, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.calls++
+	language := opts.Language
+	if language == "" {
+		language = "English"
+	}
+	return language + ": " + strings.Join(recipients, ", "), nil
+}
+
+func TestInvitationsUseRecipientLanguages(t *testing.T) {
+	users := []slack.User{
+		{ID: "U1", Name: "alice", RealName: "Alice Archer", Locale: "en-US"},
+		{ID: "U2", Name: "bob", RealName: "Bob Baker", Locale: "fr-FR"},
+		{ID: "U3", Name: "carol", RealName: "Carol Cooper", Locale: "de-DE"},
+		{ID: "U4", Name: "dan", RealName: "Dan Dawson", Locale: "fr-FR"},
+		{ID: "U5", Name: "erin", RealName: "Erin Evans", Locale: "en-GB"},
+	}
+	tests := []struct {
+		name         string
+		enabled      bool
+		maxLanguages int
+		want         map[string]string // recipient -> invitation received
+		wantCalls    int
+	}{
+		{
+			name: "disabled",
+			want: map[string]string{
+				"U2": "English: Bob Baker, Carol Cooper, Dan Dawson, Erin Evans",
+				"U3": "English: Bob Baker, Carol Cooper, Dan Dawson, Erin Evans",
+				"U4": "English: Bob Baker, Carol Cooper, Dan Dawson, Erin Evans",
+				"U5": "English: Bob Baker, Carol Cooper, Dan Dawson, Erin Evans",
+			},
+			wantCalls: 1,
+		},
+		{
+			name:         "one invitation per language",
+			enabled:      true,
+			maxLanguages: 3,
+			want: map[string]string{
+				"U2": "French: Bob Baker, Dan Dawson",
+				"U3": "German: Carol Cooper",
+				"U4": "French: Bob Baker, Dan Dawson",
+				"U5": "English: Erin Evans",
+			},
+			wantCalls: 3,
+		},
+		{
+			name:         "languages beyond the cap use the default",
+			enabled:      true,
+			maxLanguages: 1,
+			want: map[string]string{
+				"U2": "French: Bob Baker, Dan Dawson",
+				"U3": "English: Erin Evans, Carol Cooper",
+				"U4": "French: Bob Baker, Dan Dawson",
+				"U5": "English: Erin Evans, Carol Cooper",
+			},
+			wantCalls: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, users...)
+			config := testConfig()
+			config.PerRecipientLanguage = tt.enabled
+			config.MaxInviteLanguages = tt.maxLanguages
+			generator := &languageGenerator{}
+			h, _ := newTestBotHandler(t, fake, config, generator)
+
+			h.processEvent(directMessage("U1", "hi"))
+			h.processEvent(directMessage("U1", "Bob Baker, Carol Cooper, Dan Dawson, Erin Evans"))
+			h.processEvent(directMessage("U1", "Catan"))
+
+			for recipient, want := range tt.want {
+				if got := fake.postsTo(recipient); len(got) != 1 || got[0] != want {
+					t.Errorf("%s got %q, want [%q]", recipient, got, want)
+				}
+			}
+			if generator.calls != tt.wantCalls {
+				t.Errorf("generator called %d times, want %d", generator.calls, tt.wantCalls)
+			}
+			replies := fake.postsTo("DU1")
+			if summary := replies[len(replies)-1]; !strings.HasPrefix(summary, "You invited") {
+				t.Errorf("last reply = %q, want the inviter summary", summary)
+			}
+		})
+	}
+}
+
+func TestGenerateOptionsWithLanguage(t *testing.T) {
+	tests := []struct {
+		name     string
+		language string
+		extras   string
+		want     string
+	}{
+		{name: "no language", extras: callToActionPrompt, want: callToActionPrompt},
+		{name: "language only", language: "French", want: "Write it in French."},
+		{name: "language after extras", language: "German", extras: callToActionPrompt, want: callToActionPrompt + " Write it in German."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (GenerateOptions{Language: tt.language}).withLanguage(tt.extras); got != tt.want {
+				t.Errorf("withLanguage(%q) = %q, want %q", tt.extras, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// llmBaseBackoff is the wait before the first retry; it doubles on each further attempt.
+	llmBaseBackoff = 500 * time.Millisecond
+	// llmMaxRetryAfter caps how long we honor a Retry-After header. Longer waits fail the call
+	// instead, since someone is waiting on the conversation.
+	llmMaxRetryAfter = 30 * time.Second
+	// llmMaxErrorBody limits how much of an error response is kept for the logs.
+	llmMaxErrorBody = 2048
+)
+
+// generatorErrorKind classifies generator failures so callers can log and react to them differently.
+type generatorErrorKind string
+
+const (
+	generatorTimedOut    generatorErrorKind = "timed out"
+	generatorRateLimited generatorErrorKind = "rate limited"
+	generatorBadResponse generatorErrorKind = "bad response"
+)
+
+// GeneratorError reports a failed call to a language model API. StatusCode is zero when no
+// response arrived. Err may quote the provider's response, so it belongs in logs rather than
+// in messages to users; see generationErrorReply.
+type GeneratorError struct {
+	Provider   string
+	Kind       generatorErrorKind
+	StatusCode int
+	Err        error
+}
+
+func (e *GeneratorError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s API %s (HTTP %d): %v", e.Provider, e.Kind, e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("%s API %s: %v", e.Provider, e.Kind, e.Err)
+}
+
+func (e *GeneratorError) Unwrap() error {
+	return e.Err
+}
+
+// llmClient posts JSON requests to a language model API with a per-request timeout, retrying
+// rate-limited and server-error responses with exponential backoff.
+type llmClient struct {
+	provider    string
+	httpClient  *http.Client
+	maxAttempts int
+	backoff     time.Duration // wait before the first retry, llmBaseBackoff outside tests
+}
+
+// newLLMClient creates a client whose requests time out after timeout and that makes at most
+// maxAttempts attempts per call.
+func newLLMClient(provider string, timeout time.Duration, maxAttempts int) *llmClient {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &llmClient{
+		provider:    provider,
+		httpClient:  &http.Client{Timeout: timeout},
+		maxAttempts: maxAttempts,
+		backoff:     llmBaseBackoff,
+	}
+}
+
+// post sends body to url with the given headers and returns the body of a 200 response.
+// Failures are *GeneratorError values.
+func (c *llmClient) post(ctx context.Context, url string, headers map[string]string, body []byte) ([]byte, error) {
+	for attempt := 1; ; attempt++ {
+		response, retryAfter, err := c.attempt(ctx, url, headers, body)
+		if err == nil {
+			return response, nil
+		}
+		var generatorErr *GeneratorError
+		retryable := errors.As(err, &generatorErr) && isRetryableStatus(generatorErr.StatusCode)
+		if !retryable || attempt >= c.maxAttempts {
+			return nil, err
+		}
+		wait := c.backoff << (attempt - 1)
+		if retryAfter > 0 {
+			if retryAfter > llmMaxRetryAfter {
+				return nil, err
+			}
+			wait = retryAfter
+		}
+		logger.Warn("Generator attempt failed, retrying", "provider", c.provider, "attempt", attempt, "max_attempts", c.maxAttempts, "retry_in", wait.String(), "error", err)
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// attempt makes a single request, returning the server's Retry-After delay when it sent one.
+func (c *llmClient) attempt(ctx context.Context, url string, headers map[string]string, body []byte) ([]byte, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		var netErr interface{ Timeout() bool }
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nil, 0, &GeneratorError{Provider: c.provider, Kind: generatorTimedOut, Err: err}
+		}
+		return nil, 0, &GeneratorError{Provider: c.provider, Kind: generatorBadResponse, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, llmMaxErrorBody))
+		kind := generatorBadResponse
+		if resp.StatusCode == http.StatusTooManyRequests {
+			kind = generatorRateLimited
+		}
+		return nil, parseRetryAfter(resp.Header.Get("Retry-After")), &GeneratorError{
+			Provider:   c.provider,
+			Kind:       kind,
+			StatusCode: resp.StatusCode,
+			Err:        errors.New(string(bodyBytes)),
+		}
+	}
+	response, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, &GeneratorError{Provider: c.provider, Kind: generatorBadResponse, StatusCode: resp.StatusCode, Err: err}
+	}
+	return response, 0, nil
+}
+
+// isRetryableStatus reports whether a response status is worth retrying: rate limiting and
+// server errors.
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as an HTTP date.
+// It returns zero when the header is absent or unparseable.
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if when, err := http.ParseTime(header); err == nil {
+		if wait := time.Until(when); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// logGeneratorError logs a generation failure according to its kind.
+func logGeneratorError(purpose string, err error) {
+	var generatorErr *GeneratorError
+	if !errors.As(err, &generatorErr) {
+		logger.Error("Error generating text", "purpose", purpose, "error", err)
+		return
+	}
+	switch generatorErr.Kind {
+	case generatorTimedOut:
+		logger.Error("Generator timed out", "provider", generatorErr.Provider, "purpose", purpose, "error", err)
+	case generatorRateLimited:
+		logger.Error("Generator rate limited, consider lowering traffic or raising quota", "provider", generatorErr.Provider, "purpose", purpose, "error", err)
+	default:
+		logger.Error("Generator returned a bad response", "provider", generatorErr.Provider, "purpose", purpose, "error", err)
+	}
+}
+
+// generationErrorReply describes a generation failure to the inviter without quoting provider
+// payloads or anything else that could carry credentials.
+func generationErrorReply(err error) string {
+	var generatorErr *GeneratorError
+	switch {
+	case errors.Is(err, errCircuitOpen):
+		return "Error generating invitation: the invitation service is temporarily unavailable, please try again shortly."
+	case errors.As(err, &generatorErr) && generatorErr.Kind == generatorTimedOut:
+		return "Error generating invitation: the invitation service took too long to respond, please try again."
+	case errors.As(err, &generatorErr) && generatorErr.Kind == generatorRateLimited:
+		return "Error generating invitation: the invitation service is busy, please try again in a minute."
+	default:
+		return "Error generating invitation: the invitation service returned an error, please try again later."
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeGemini is an httptest server standing in for the Gemini API. It answers each request
+// with the next of statuses, repeating the last one, and 200 responses with text.
+type fakeGemini struct {
+	server     *httptest.Server
+	statuses   []int
+	retryAfter string // Retry-After header sent with each 429
+	text       string
+
+	mutex sync.Mutex
+	calls int
+}
+
+func newFakeGemini(t *testing.T, text, retryAfter string, statuses ...int) *fakeGemini {
+	t.Helper()
+	f := &fakeGemini{statuses: statuses, retryAfter: retryAfter, text: text}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mutex.Lock()
+		status := f.statuses[min(f.calls, len(f.statuses)-1)]
+		f.calls++
+		f.mutex.Unlock()
+		if r.Header.Get("x-goog-api-key") != "gemini-key" {
+			status = http.StatusUnauthorized
+		}
+		if status == http.StatusTooManyRequests && f.retryAfter != "" {
+			w.Header().Set("Retry-After", f.retryAfter)
+		}
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			writeFakeJSON(w, map[string]any{"candidates": []any{map[string]any{"content": map[string]any{"parts": []any{map[string]any{"text": f.text}}}}}})
+			return
+		}
+		writeFakeJSON(w, map[string]any{"error": map[string]any{"code": status, "message": "Resource has been exhausted"}})
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// callCount returns how many requests reached the fake.
+func (f *fakeGemini) callCount() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.calls
+}
+
+func TestGeminiRateLimitRetries(t *testing.T) {
+	tests := []struct {
+		name        string
+		statuses    []int
+		retryAfter  string
+		maxAttempts int
+		wantCalls   int
+		wantText    string // what invitationWriter sends
+		wantKind    generatorErrorKind
+	}{
+		{
+			name:        "429 is retried and then succeeds",
+			statuses:    []int{http.StatusTooManyRequests, http.StatusOK},
+			maxAttempts: 3,
+			wantCalls:   2,
+			wantText:    "Come play Catan!",
+		},
+		{
+			name:        "Retry-After is honored",
+			statuses:    []int{http.StatusTooManyRequests, http.StatusOK},
+			retryAfter:  "0",
+			maxAttempts: 3,
+			wantCalls:   2,
+			wantText:    "Come play Catan!",
+		},
+		{
+			name:        "429 until the attempts run out falls back to the template",
+			statuses:    []int{http.StatusTooManyRequests},
+			maxAttempts: 3,
+			wantCalls:   3,
+			wantText:    "Hey Bob Baker, Alice Archer wants to play Catan — you in?",
+			wantKind:    generatorRateLimited,
+		},
+		{
+			name:        "a Retry-After too long to wait isn't retried",
+			statuses:    []int{http.StatusTooManyRequests},
+			retryAfter:  "120",
+			maxAttempts: 3,
+			wantCalls:   1,
+			wantText:    "Hey Bob Baker, Alice Archer wants to play Catan — you in?",
+			wantKind:    generatorRateLimited,
+		},
+		{
+			name:        "other client errors aren't retried",
+			statuses:    []int{http.StatusBadRequest},
+			maxAttempts: 3,
+			wantCalls:   1,
+			wantText:    "Hey Bob Baker, Alice Archer wants to play Catan — you in?",
+			wantKind:    generatorBadResponse,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeGemini(t, "Come play Catan!", tt.retryAfter, tt.statuses...)
+			var err error
+			config := testConfig()
+			config.GeminiAPIKey = "gemini-key"
+			config.GeneratorTimeout = time.Second
+			config.GeneratorMaxAttempts = tt.maxAttempts
+			config.InvitationFallback = true
+			config.InvitationFallbackTemplate = defaultFallbackTemplate
+			if config.PromptTemplate, err = parsePromptTemplate(defaultPromptTemplate); err != nil {
+				t.Fatal(err)
+			}
+			generator := NewGeminiGenerator(config)
+			generator.client.endpoint = fake.server.URL
+			generator.client.client.backoff = time.Millisecond
+
+			_, err = generator.Generate(context.Background(), "Alice Archer", []string{"Bob Baker"}, "Catan", GenerateOptions{})
+			var generatorErr *GeneratorError
+			switch {
+			case tt.wantKind == "" && err != nil:
+				t.Fatalf("Generate() error = %v", err)
+			case tt.wantKind != "" && (!errors.As(err, &generatorErr) || generatorErr.Kind != tt.wantKind):
+				t.Fatalf("Generate() error = %v, want a %s error", err, tt.wantKind)
+			}
+			if got := fake.callCount(); got != tt.wantCalls {
+				t.Errorf("Gemini got %d requests, want %d", got, tt.wantCalls)
+			}
+
+			invitations, err := newInvitationWriter(config, nil, generator).write(context.Background(), "Alice Archer", []string{"U2"}, []string{"Bob Baker"}, "Catan", GenerateOptions{})
+			if err != nil {
+				t.Fatalf("write() error = %v", err)
+			}
+			if len(invitations) != 1 || invitations[0].Text != tt.wantText {
+				t.Errorf("write() = %+v, want %q", invitations, tt.wantText)
+			}
+		})
+	}
+}
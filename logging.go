@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// logger is the structured logger shared by the whole service. It writes JSON to stderr and is
+// replaced in main with one at the configured LOG_LEVEL. Events carry event_type, user_id,
+// channel and step fields where they apply; text users typed is only logged at debug level.
+var logger = newLogger(slog.LevelInfo)
+
+// newLogger returns a JSON logger that drops records below level.
+func newLogger(level slog.Level) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+}
+
+// parseLogLevel parses LOG_LEVEL, one of debug, info, warn or error. An empty value means info.
+func parseLogLevel(value string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "":
+		return slog.LevelInfo, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("%q, expected debug, info, warn or error", value)
+}
+
+// requestLogger logs every request once it has been answered, in place of gin's plain-text
+// logger. Only the path is logged, since query strings can carry tokens.
+func requestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		level := slog.LevelInfo
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			level = slog.LevelWarn
+		}
+		logger.Log(c.Request.Context(), level, "HTTP request", "event_type", "http_request", "method", c.Request.Method, "path", c.Request.URL.Path,
+			"route", c.FullPath(), "status", c.Writer.Status(), "duration_ms", time.Since(start).Milliseconds(), "client_ip", c.ClientIP())
+	}
+}
+
+// fatal logs msg with err at error level and exits, for startup failures in main.
+func fatal(msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}
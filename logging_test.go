@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name      string
+		target    string
+		wantCode  int
+		wantLevel string
+		wantRoute string
+	}{
+		{name: "ok", target: "/invite/scheduled/Q1?channel=D1&token=secret", wantCode: http.StatusOK, wantLevel: "INFO", wantRoute: "/invite/scheduled/:id"},
+		{name: "panic", target: "/panic", wantCode: http.StatusInternalServerError, wantLevel: "WARN", wantRoute: "/panic"},
+		{name: "no route", target: "/nowhere", wantCode: http.StatusNotFound, wantLevel: "INFO"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			previous := logger
+			logger = slog.New(slog.NewJSONHandler(&logs, nil))
+			t.Cleanup(func() { logger = previous })
+
+			r := gin.New()
+			r.Use(requestLogger(), gin.RecoveryWithWriter(&bytes.Buffer{}))
+			r.GET("/invite/scheduled/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+			r.GET("/panic", func(c *gin.Context) { panic("boom") })
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+
+			var record map[string]any
+			if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+				t.Fatalf("log %q: %v", logs.String(), err)
+			}
+			if record["level"] != tt.wantLevel || record["route"] != tt.wantRoute || record["status"] != float64(tt.wantCode) {
+				t.Errorf("log = %v, want level %s, route %q and status %d", record, tt.wantLevel, tt.wantRoute, tt.wantCode)
+			}
+			if path := record["path"].(string); bytes.Contains([]byte(path), []byte("secret")) {
+				t.Errorf("logged path %q includes the query string", path)
+			}
+		})
+	}
+}
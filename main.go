@@ -1,46 +1,197 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/slack-go/slack"
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/slack-go/slack"
 )
 
 func main() {
-	// Get Slack token from environment variable
+	// Settings come from the environment, optionally seeded from a .env file
 	err := godotenv.Load(".env")
+	if errors.Is(err, fs.ErrNotExist) {
+		logger.Info("No .env file, reading configuration from the environment only", "event_type", "startup")
+	} else if err != nil {
+		fatal("Error loading .env file", err)
+	}
+
+	config, err := loadConfig()
 	if err != nil {
-		log.Fatal("Error loading .env file:", err)
+		fatal("Invalid configuration", err)
 	}
+	logger = newLogger(config.LogLevel)
+	// Libraries logging through the standard log package end up in the same JSON stream.
+	slog.SetDefault(logger)
+	config.logBanner()
 
-	slackToken := os.Getenv("SLACK_BOT_TOKEN")
-	if slackToken == "" {
-		log.Fatal("SLACK_BOT_TOKEN environment variable is required")
+	// Initialize Slack client; its HTTP client picks up the scope details of missing_scope errors
+	scopes := newScopeTracker(&http.Client{Timeout: config.SlackHTTPTimeout})
+	slackClient := slack.New(config.SlackBotToken, slack.OptionHTTPClient(scopes))
+
+	// Shared cache of the workspace directory used for matching and the usage guide
+	users := newUserCache(slackClient, config.UserCacheTTL)
+	// Both the REST and Slack flows write invitations through one writer and its circuit breaker
+	writer := newInvitationWriter(config, users, newInvitationGenerator(config))
+
+	// All messages go through one pacer so the app stays under its Slack rate tier, and at most
+	// MAX_CONCURRENT_SENDS are in flight across invitations
+	sender := newMessageSender(slackClient, scopes, newSendPacer(config.SlackSendsPerMinute, config.SlackSendBurst), config.SlackSendMaxRetries, config.MaxConcurrentSends)
+
+	// Storage backend shared by every stateful feature
+	store, err := newStore(config)
+	if err != nil {
+		fatal("Failed to set up store", err)
 	}
 
-	// Initialize Slack client
-	slackClient := slack.New(slackToken)
+	// Saved recipient lists, shared by the REST endpoints and the DM flow
+	recipientLists := newRecipientListStore(store, config.Regulars)
+	if len(config.Regulars) > 0 {
+		directory, err := users.getCachedUsers()
+		if err != nil {
+			fatal("Failed to fetch users to check REGULARS", err)
+		}
+		if err := validateRegulars(config.Regulars, directory); err != nil {
+			fatal("Invalid REGULARS", err)
+		}
+	}
+
+	// Per-game invitation cooldowns, shared by the REST endpoint and the Slack flows
+	cooldowns := newGameCooldowns(store, config.GameCooldown, config.GameCooldowns)
+
+	// RSVPs to invitations sent through the API, updated by the invitation buttons
+	rsvps := newRSVPTracker(store)
+
+	// Invitations still awaiting answers, capped by MAX_PENDING_INVITES
+	pending := newPendingInvites(store, config.MaxPendingInvites, config.PendingInviteTTL)
+
+	// Progress of invites sent with "async": true
+	jobs := newInviteJobs(store)
+
+	// Initialize Gin router. Debug mode prints every route at startup, so it is only for
+	// development.
+	if config.AppEnv != "development" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	r := gin.New()
+	// The logger goes first so requests that panicked are logged with the 500 Recovery answers.
+	r.Use(requestLogger(), gin.Recovery())
 
-	// Initialize Gin router
-	r := gin.Default()
+	// Setup route for load balancer health checks
+	healthHandler := NewHealthHandler(slackClient)
+	r.GET("/health", healthHandler.Health)
+
+	// Setup route for Prometheus scrapes
+	r.GET("/metrics", gin.WrapH(promhttp.HandlerFor(newMetricsRegistry(), promhttp.HandlerOpts{})))
+
+	// Quiet hours recipients set for themselves hold back invitations from both the invite API
+	// and the bot
+	quietHours := newQuietHoursStore(store, users)
 
 	// Initialize handler for sending invitations via the invite API
-	inviteHandler := NewGameInviteHandler(slackClient)
+	inviteHandler := NewGameInviteHandler(slackClient, config, users, sender, newChannelResolver(slackClient, config.UserCacheTTL), cooldowns, rsvps, jobs, newScheduledInvites(store), newDeliveryLog(store), pending, writer, quietHours)
 
-	// Setup routes for game invitations
-	r.POST("/invite", inviteHandler.SendInvite)
+	// Setup routes for game invitations. Only the usage guide is public; everything that sends,
+	// cancels, lists or edits goes through the INVITE_API_KEYS check.
 	r.GET("/invite", inviteHandler.GetUsageGuide)
+	api := r.Group("", authenticateInviter(config.InviteAPIKeys))
+	api.POST("/invite", inviteHandler.SendInvite)
+	api.GET("/invites/scheduled", inviteHandler.ListScheduledInvites)
+	api.DELETE("/invite/scheduled/:id", inviteHandler.CancelScheduledInvite)
+	api.GET("/invite/:id/rsvp", inviteHandler.GetRSVPs)
+	api.GET("/invite/:id/status", inviteHandler.GetInviteStatus)
+	api.GET("/invites/:id/export", inviteHandler.ExportRSVPs)
+
+	// Setup routes for recurring invites, sent through the invite handler as they come due
+	recurring := newRecurringInvites(store, inviteHandler, time.Minute)
+	api.POST("/invite/recurring", recurring.CreateRecurring)
+	api.GET("/invite/recurring", recurring.ListRecurring)
+	api.DELETE("/invite/recurring/:id", recurring.DeleteRecurring)
+
+	// Setup routes for managing saved recipient lists
+	listHandler := NewRecipientListHandler(recipientLists, users)
+	api.GET("/lists", listHandler.ListLists)
+	api.GET("/lists/:name", listHandler.GetList)
+	api.PUT("/lists/:name", listHandler.PutList)
+	api.DELETE("/lists/:name", listHandler.DeleteList)
 
 	// Initialize Slack Bot Handler for interactive DM flows
-	slackBotHandler := NewSlackBotHandler(slackClient)
-	// Setup route for receiving Slack Event callbacks
-	r.POST("/slack/events", slackBotHandler.HandleEvent)
+	slackBotHandler := NewSlackBotHandler(slackClient, config, users, sender, recipientLists, newConversationStore(store, config.ConversationTTL), writer, cooldowns, newSeenEvents(store, config.EventDedupeWindow), quietHours)
+	// Setup route for receiving Slack Event callbacks. With SLACK_SIGNING_SECRET set, both Slack
+	// routes only accept requests signed with it.
+	if config.SlackSigningSecret == "" {
+		logger.Warn("SLACK_SIGNING_SECRET is unset, so requests to the Slack endpoints aren't verified", "event_type", "startup")
+	}
+	requireSlackSignature := verifySlackRequest(config.SlackSigningSecret)
+	r.POST("/slack/events", requireSlackSignature, slackBotHandler.HandleEvent)
+
+	// Setup route for receiving interaction payloads (button clicks)
+	var feedback *feedbackCollector
+	if config.PostGameFeedback {
+		feedback = newFeedbackCollector(store, sender, config.ActionSigningSecret, config.MaintenanceMode)
+	}
+	var confirmations *dayOfConfirmations
+	if config.DayOfConfirmationLead > 0 {
+		confirmations = newDayOfConfirmations(store, sender, config.ActionSigningSecret, config.DayOfConfirmationLead, config.MaintenanceMode, time.Minute)
+	}
+	var reminders *inviteReminders
+	if config.RecipientReminders {
+		reminders = newInviteReminders(store, sender, rsvps, config.MaintenanceMode, time.Minute)
+	}
+	notices := newInviterNotifier(store, sender, config.InviterNotifyWindow)
+	interactionHandler := NewInteractionHandler(slackClient, users, sender, config.ActionSigningSecret, feedback, confirmations, reminders, rsvps, notices, pending)
+	interactionHandler.handle(actionEditRecipients, slackBotHandler.editRecipients)
+	interactionHandler.handleSubmission(editRecipientsCallbackID, slackBotHandler.submitRecipients)
+	r.POST("/slack/interactions", requireSlackSignature, interactionHandler.HandleInteraction)
 
-	// Start server
-	if err := r.Run(":8080"); err != nil {
-		log.Fatal("Failed to start server:", err)
+	// Setup admin routes, guarded by ADMIN_API_KEY
+	adminHandler := NewAdminHandler(users)
+	admin := r.Group("/admin", requireAdmin(config.AdminAPIKey))
+	admin.POST("/refresh-users", adminHandler.RefreshUsers)
+
+	// Start server, stopping it gracefully on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	srv := newHTTPServer(config, r)
+	listener, err := listen(config)
+	if err != nil {
+		fatal("Failed to listen", err)
+	}
+	go func() {
+		logger.Info("Listening", "event_type", "startup", "network", config.ListenNetwork, "addr", config.ListenAddr)
+		if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("Failed to start server", err)
+		}
+	}()
+	<-ctx.Done()
+	stop()
+
+	// Drain in-flight requests, then stop the background workers and release the store.
+	logger.Info("Shutting down", "event_type", "shutdown", "timeout", config.ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Error draining in-flight requests", "event_type", "shutdown", "error", err)
+	}
+	recurring.Close()
+	confirmations.Close()
+	reminders.Close()
+	// Let invites already accepted with "async": true finish sending.
+	jobs.wait()
+	interactionHandler.wait()
+	slackBotHandler.Close()
+	if err := closeStore(store); err != nil {
+		logger.Error("Error closing store", "event_type", "shutdown", "error", err)
 	}
-} 
\ No newline at end of file
+	logger.Info("Shutdown complete", "event_type", "shutdown")
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// The handlers log every step; keep test output to the failures.
+	logger = slog.New(slog.NewJSONHandler(io.Discard, nil))
+	os.Exit(m.Run())
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/slack-go/slack"
+)
+
+// parseNames splits a comma separated list of names, refusing input longer than maxLength
+// characters or with more than maxNames entries before any matching work is done. Zero or a
+// negative limit is not enforced. Empty entries, as in "alice,,bob" or a trailing comma, are
+// dropped, since an empty name would match every user.
+func parseNames(input string, maxLength, maxNames int) ([]string, error) {
+	if maxLength > 0 && utf8.RuneCountInString(input) > maxLength {
+		return nil, fmt.Errorf("that list is too long (over %d characters)", maxLength)
+	}
+	var names []string
+	for _, name := range strings.Split(input, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if maxNames > 0 && len(names) > maxNames {
+		return nil, fmt.Errorf("that's %d names, but I can only match up to %d at a time", len(names), maxNames)
+	}
+	return names, nil
+}
+
+// oversizedNamesReply explains a parseNames failure and points at approaches that scale better.
+func oversizedNamesReply(err error) string {
+	return "Sorry, " + err.Error() + ". For large groups, save them as a recipient list with `PUT /lists/:name` " +
+		"and send me the list name, or look up user IDs with `GET /invite` and send the invite with `POST /invite`."
+}
+
+// nameMatchResult is the outcome of matching the names a user typed against the workspace directory.
+type nameMatchResult struct {
+	MatchedIDs   []string     // IDs of the invitable users that were matched
+	MatchedNames []string     // real names of the matched users, in the same order
+	Unmatched    []string     // inputs that matched nobody
+	Uninvitable  []string     // explanations for inputs that only matched bots or deactivated accounts
+	Ambiguous    []inputMatch // inputs that matched more than one invitable user
+	ValidNames   []string     // real names of every invitable user, for suggestions
+	Notes        []string     // informational notes for the inviter, e.g. skipped list members
+}
+
+// inputMatch is the set of invitable users a single typed name matched.
+type inputMatch struct {
+	Input      string
+	Candidates []slack.User
+}
+
+// candidateList describes the candidates as "Real Name (@handle)", comma separated.
+func (m inputMatch) candidateList() string {
+	names := make([]string, 0, len(m.Candidates))
+	for _, user := range m.Candidates {
+		names = append(names, fmt.Sprintf("%s (@%s)", user.RealName, user.Name))
+	}
+	return strings.Join(names, ", ")
+}
+
+// addUsers adds already resolved users (such as saved list members) to the matches, skipping
+// users that are already matched.
+func (r *nameMatchResult) addUsers(users []slack.User) {
+	for _, user := range users {
+		duplicate := false
+		for _, id := range r.MatchedIDs {
+			if id == user.ID {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			r.MatchedIDs = append(r.MatchedIDs, user.ID)
+			r.MatchedNames = append(r.MatchedNames, user.RealName)
+		}
+	}
+}
+
+// resolved reports whether every input matched an invitable user.
+func (r nameMatchResult) resolved() bool {
+	return len(r.Unmatched) == 0 && len(r.Uninvitable) == 0 && len(r.Ambiguous) == 0
+}
+
+// ambiguities asks the inviter to narrow down each ambiguous input, one line per input.
+func (r nameMatchResult) ambiguities() string {
+	var reply string
+	for _, m := range r.Ambiguous {
+		reply += fmt.Sprintf("%q matches more than one person: %s. Please be more specific, e.g. their full name or @handle.\n", m.Input, m.candidateList())
+	}
+	return reply
+}
+
+// problems describes why the match did not resolve, one sentence per kind of problem.
+func (r nameMatchResult) problems() string {
+	var reply string
+	if len(r.Uninvitable) > 0 {
+		reply += strings.Join(r.Uninvitable, "\n") + "\n"
+	}
+	reply += r.ambiguities()
+	if len(r.Unmatched) > 0 {
+		reply += "Could not match the following names: " + strings.Join(r.Unmatched, ", ") + ".\n"
+		reply += "Valid user names include: " + strings.Join(r.ValidNames, ", ") + ".\n"
+	}
+	return reply
+}
+
+// removeUser drops a matched user, reporting whether it was present.
+func (r *nameMatchResult) removeUser(userID string) bool {
+	for i, id := range r.MatchedIDs {
+		if id == userID {
+			r.MatchedIDs = append(r.MatchedIDs[:i:i], r.MatchedIDs[i+1:]...)
+			r.MatchedNames = append(r.MatchedNames[:i:i], r.MatchedNames[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// isInvitable reports whether a user can receive invitations.
+func isInvitable(user slack.User) bool {
+	return !user.IsBot && !user.Deleted
+}
+
+// userMatchesExactly reports whether the input is the user's handle or real name, ignoring case
+// and a leading "@".
+func userMatchesExactly(user slack.User, input string) bool {
+	input = strings.TrimPrefix(input, "@")
+	return strings.EqualFold(user.Name, input) || strings.EqualFold(user.RealName, input)
+}
+
+// userMatchesInput reports whether the input is a case-insensitive substring of the user's handle or real name.
+func userMatchesInput(user slack.User, input string) bool {
+	input = strings.ToLower(input)
+	return strings.Contains(strings.ToLower(user.Name), input) ||
+		strings.Contains(strings.ToLower(user.RealName), input)
+}
+
+// nameMatcher matches typed names against the workspace directory.
+type nameMatcher struct {
+	// maxEditDistance is the most Levenshtein edits a misspelled name may be from a handle, real
+	// name or word of a real name and still match. Zero disables misspelling tolerance.
+	maxEditDistance int
+}
+
+// matchUser returns the users that input refers to. Substring matches on the handle or real name
+// come first, narrowed to a single exact match when there is one; failing that, the users at the
+// smallest edit distance within maxEditDistance.
+func (m nameMatcher) matchUser(input string, users []slack.User) []slack.User {
+	input = strings.TrimPrefix(input, "@")
+	var candidates, exact []slack.User
+	for _, user := range users {
+		if userMatchesInput(user, input) {
+			candidates = append(candidates, user)
+			if userMatchesExactly(user, input) {
+				exact = append(exact, user)
+			}
+		}
+	}
+	if len(exact) == 1 {
+		return exact
+	}
+	if len(candidates) > 0 || m.maxEditDistance <= 0 {
+		return candidates
+	}
+
+	best := m.maxEditDistance + 1
+	for _, user := range users {
+		distance, ok := userEditDistance(user, input)
+		if !ok || distance > m.maxEditDistance || distance > best {
+			continue
+		}
+		if distance < best {
+			best = distance
+			candidates = candidates[:0]
+		}
+		candidates = append(candidates, user)
+	}
+	return candidates
+}
+
+// userEditDistance is the smallest Levenshtein distance between input and the user's handle,
+// real name or any word of the real name, ignoring case. To keep short names from matching
+// unrelated ones, a comparison only counts when the two differ in at most half the characters
+// of the shorter string; ok is false when no comparison counts.
+func userEditDistance(user slack.User, input string) (distance int, ok bool) {
+	input = strings.ToLower(input)
+	inputLength := utf8.RuneCountInString(input)
+	targets := append([]string{user.Name, user.RealName}, strings.Fields(user.RealName)...)
+	for _, target := range targets {
+		target = strings.ToLower(target)
+		shorter := utf8.RuneCountInString(target)
+		if inputLength < shorter {
+			shorter = inputLength
+		}
+		d := levenshtein(input, target)
+		if d > shorter/2 {
+			continue
+		}
+		if !ok || d < distance {
+			distance, ok = d, true
+		}
+	}
+	return distance, ok
+}
+
+// levenshtein returns the number of single-character insertions, deletions and substitutions
+// needed to turn a into b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j] + 1 // deletion
+			if v := current[j-1] + 1; v < current[j] {
+				current[j] = v // insertion
+			}
+			if v := previous[j-1] + cost; v < current[j] {
+				current[j] = v // substitution
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+// matchNames matches each input name against the directory. An input resolves when matchUser
+// finds exactly one invitable user; inputs matching several users are reported as ambiguous.
+// Inputs that only match a bot or deactivated account are reported separately from inputs that
+// match nobody at all, and misspellings are only tried once both substring checks fail.
+func (m nameMatcher) matchNames(inputs []string, users []slack.User) nameMatchResult {
+	var result nameMatchResult
+	var validUsers, filteredUsers []slack.User
+	for _, u := range users {
+		if isInvitable(u) {
+			validUsers = append(validUsers, u)
+			result.ValidNames = append(result.ValidNames, u.RealName)
+		} else {
+			filteredUsers = append(filteredUsers, u)
+		}
+	}
+	exactOnly := nameMatcher{}
+
+	for _, input := range inputs {
+		candidates := exactOnly.matchUser(input, validUsers)
+		if len(candidates) == 0 {
+			if filtered := exactOnly.matchUser(input, filteredUsers); len(filtered) > 0 {
+				user := filtered[0]
+				logger.Debug("Input only matched a filtered-out user", "input", input, "match_user_id", user.ID)
+				result.Uninvitable = append(result.Uninvitable, uninvitableReason(user))
+				continue
+			}
+			candidates = m.matchUser(input, validUsers)
+			if len(candidates) == 1 {
+				result.Notes = append(result.Notes, fmt.Sprintf("Assuming %q means %s.", input, candidates[0].RealName))
+			}
+		}
+
+		switch {
+		case len(candidates) == 1:
+			user := candidates[0]
+			logger.Debug("Matched input to user", "input", input, "match_user_id", user.ID)
+			// Two inputs can resolve to the same person, e.g. "chris" and "Chris Smith".
+			result.addUsers([]slack.User{user})
+		case len(candidates) > 1:
+			logger.Debug("Input is ambiguous", "input", input, "candidates", len(candidates))
+			result.Ambiguous = append(result.Ambiguous, inputMatch{Input: input, Candidates: candidates})
+		default:
+			logger.Debug("No match for input", "input", input)
+			result.Unmatched = append(result.Unmatched, input)
+		}
+	}
+	return result
+}
+
+// uninvitableReason explains why a matched user can't be invited.
+func uninvitableReason(user slack.User) string {
+	name := user.RealName
+	if name == "" {
+		name = user.Name
+	}
+	kind := "deactivated account"
+	if user.IsBot {
+		kind = "bot"
+	}
+	return fmt.Sprintf("%s is a %s and can't be invited.", name, kind)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+func TestParseNames(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		maxLength int
+		maxNames  int
+		want      []string
+		wantErr   string
+	}{
+		{name: "trims names", input: " alice , bob ", want: []string{"alice", "bob"}},
+		{name: "trailing comma", input: "alice,", want: []string{"alice"}},
+		{name: "empty entry", input: "alice,,bob", want: []string{"alice", "bob"}},
+		{name: "blank entry", input: "alice, ,bob", want: []string{"alice", "bob"}},
+		{name: "only commas", input: " , ,", want: nil},
+		{name: "empty entries don't count towards the limit", input: "alice,,,bob,", maxNames: 2, want: []string{"alice", "bob"}},
+		{name: "too many names", input: "a,b,c", maxNames: 2, wantErr: "that's 3 names, but I can only match up to 2 at a time"},
+		{name: "too long", input: strings.Repeat("a", 11), maxLength: 10, wantErr: "that list is too long (over 10 characters)"},
+		{name: "length counts characters", input: "Zoë,Łukasz", maxLength: 10, want: []string{"Zoë", "Łukasz"}},
+		{name: "oversized input with limits disabled", input: strings.Repeat("a,", 500) + "a", want: strings.Split(strings.Repeat("a,", 500)+"a", ",")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseNames(tt.input, tt.maxLength, tt.maxNames)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("parseNames(%q) error = %v, want %q", tt.input, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseNames(%q) unexpected error: %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseNames(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchNamesUninvitable(t *testing.T) {
+	users := []slack.User{
+		{ID: "U1", Name: "alice", RealName: "Alice Archer"},
+		{ID: "U2", Name: "bob", RealName: "Bob Baker"},
+		{ID: "B1", Name: "deploybot", RealName: "Deploy Bot", IsBot: true},
+		{ID: "U4", Name: "dormant", RealName: "Dan Dormant", Deleted: true},
+		{ID: "U5", Name: "gone", Deleted: true},
+		{ID: "U6", Name: "dana", RealName: "Dana Day"},
+	}
+	tests := []struct {
+		name            string
+		inputs          []string
+		wantMatched     []string
+		wantUninvitable []string
+		wantUnmatched   []string
+	}{
+		{name: "bot", inputs: []string{"Deploy Bot"}, wantUninvitable: []string{"Deploy Bot is a bot and can't be invited."}},
+		{name: "deactivated account", inputs: []string{"dormant"}, wantUninvitable: []string{"Dan Dormant is a deactivated account and can't be invited."}},
+		{name: "deactivated account without a real name", inputs: []string{"@gone"}, wantUninvitable: []string{"gone is a deactivated account and can't be invited."}},
+		{name: "nobody", inputs: []string{"zed"}, wantUnmatched: []string{"zed"}},
+		{
+			name:            "alongside a match",
+			inputs:          []string{"bob", "deploybot"},
+			wantMatched:     []string{"U2"},
+			wantUninvitable: []string{"Deploy Bot is a bot and can't be invited."},
+		},
+		{name: "an invitable match wins", inputs: []string{"Da"}, wantMatched: []string{"U6"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := nameMatcher{}.matchNames(tt.inputs, users)
+			if !reflect.DeepEqual(result.MatchedIDs, tt.wantMatched) {
+				t.Errorf("matched %q, want %q", result.MatchedIDs, tt.wantMatched)
+			}
+			if !reflect.DeepEqual(result.Uninvitable, tt.wantUninvitable) {
+				t.Errorf("uninvitable = %q, want %q", result.Uninvitable, tt.wantUninvitable)
+			}
+			if !reflect.DeepEqual(result.Unmatched, tt.wantUnmatched) {
+				t.Errorf("unmatched = %q, want %q", result.Unmatched, tt.wantUnmatched)
+			}
+			for _, reason := range tt.wantUninvitable {
+				if !strings.Contains(result.problems(), reason) {
+					t.Errorf("problems() = %q, want it to explain %q", result.problems(), reason)
+				}
+			}
+			if want := []string{"Alice Archer", "Bob Baker", "Dana Day"}; !reflect.DeepEqual(result.ValidNames, want) {
+				t.Errorf("valid names = %q, want only the invitable users %q", result.ValidNames, want)
+			}
+		})
+	}
+}
+
+func TestMatchNamesAmbiguous(t *testing.T) {
+	users := []slack.User{
+		{ID: "U1", Name: "csmith", RealName: "Chris Smith"},
+		{ID: "U2", Name: "cjones", RealName: "Chris Jones"},
+		{ID: "U3", Name: "christine", RealName: "Christine Lee"},
+		{ID: "U4", Name: "bob", RealName: "Bob Baker"},
+	}
+	tests := []struct {
+		name          string
+		inputs        []string
+		wantMatched   []string
+		wantAmbiguous map[string][]string // input -> candidate IDs, in directory order
+		wantReply     string
+	}{
+		{
+			name:          "several people",
+			inputs:        []string{"chris"},
+			wantAmbiguous: map[string][]string{"chris": {"U1", "U2", "U3"}},
+			wantReply:     `"chris" matches more than one person: Chris Smith (@csmith), Chris Jones (@cjones), Christine Lee (@christine). Please be more specific`,
+		},
+		{name: "full name", inputs: []string{"Chris Jones"}, wantMatched: []string{"U2"}},
+		{name: "handle", inputs: []string{"@christine"}, wantMatched: []string{"U3"}},
+		{name: "exact match among substrings", inputs: []string{"Christine"}, wantMatched: []string{"U3"}},
+		{
+			name:          "only the ambiguous input is held back",
+			inputs:        []string{"bob", "jones", "smith", "chri"},
+			wantMatched:   []string{"U4", "U2", "U1"},
+			wantAmbiguous: map[string][]string{"chri": {"U1", "U2", "U3"}},
+			wantReply:     `"chri" matches more than one person`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := nameMatcher{}.matchNames(tt.inputs, users)
+			if !reflect.DeepEqual(result.MatchedIDs, tt.wantMatched) {
+				t.Errorf("matched %q, want %q", result.MatchedIDs, tt.wantMatched)
+			}
+			got := make(map[string][]string)
+			for _, m := range result.Ambiguous {
+				for _, user := range m.Candidates {
+					got[m.Input] = append(got[m.Input], user.ID)
+				}
+			}
+			if len(got) != len(tt.wantAmbiguous) || (len(got) > 0 && !reflect.DeepEqual(got, tt.wantAmbiguous)) {
+				t.Errorf("ambiguous = %v, want %v", got, tt.wantAmbiguous)
+			}
+			if result.resolved() != (len(tt.wantAmbiguous) == 0) {
+				t.Errorf("resolved() = %v with ambiguous inputs %v", result.resolved(), got)
+			}
+			if !strings.Contains(result.ambiguities(), tt.wantReply) || (tt.wantReply == "" && result.ambiguities() != "") {
+				t.Errorf("ambiguities() = %q, want it to contain %q", result.ambiguities(), tt.wantReply)
+			}
+		})
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+		{"alice", "alcie", 2},
+		{"zoë", "zoe", 1},
+		{"same", "same", 0},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestMatchUserMisspellings(t *testing.T) {
+	users := []slack.User{
+		{ID: "U1", Name: "alice", RealName: "Alice Archer"},
+		{ID: "U2", Name: "bob", RealName: "Bob Baker"},
+		{ID: "U3", Name: "rob", RealName: "Rob Reed"},
+		{ID: "U4", Name: "jonathan", RealName: "Jonathan Pryce"},
+	}
+	tests := []struct {
+		name        string
+		input       string
+		maxDistance int
+		want        []string
+	}{
+		{name: "one typo", input: "alcie", maxDistance: 2, want: []string{"U1"}},
+		{name: "a word of the real name", input: "Pryse", maxDistance: 2, want: []string{"U4"}},
+		{name: "too many typos", input: "jnthn", maxDistance: 2},
+		{name: "disabled", input: "alcie", maxDistance: 0},
+		{name: "substring matches come first", input: "ali", maxDistance: 2, want: []string{"U1"}},
+		{name: "ties are all returned", input: "zob", maxDistance: 1, want: []string{"U2", "U3"}},
+		{name: "the closest wins", input: "Jonathon", maxDistance: 2, want: []string{"U4"}},
+		{name: "short names need most characters right", input: "xy", maxDistance: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, user := range (nameMatcher{maxEditDistance: tt.maxDistance}).matchUser(tt.input, users) {
+				got = append(got, user.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matchUser(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("the inviter is told about the guess", func(t *testing.T) {
+		result := nameMatcher{maxEditDistance: 2}.matchNames([]string{"alcie"}, users)
+		if !reflect.DeepEqual(result.MatchedIDs, []string{"U1"}) || !reflect.DeepEqual(result.Notes, []string{`Assuming "alcie" means Alice Archer.`}) {
+			t.Errorf("matchNames = %q with notes %q, want U1 with a note about the guess", result.MatchedIDs, result.Notes)
+		}
+	})
+}
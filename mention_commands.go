@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// mentionCommand answers a command given after the bot's mention, e.g. "@bot help", for userID.
+type mentionCommand func(h *SlackBotHandler, userID string) string
+
+// mentionCommands maps command names, compared case-insensitively, to their handlers. A mention
+// whose text is not exactly one of these starts (or continues) the invite flow as before.
+var mentionCommands = map[string]mentionCommand{
+	"help":   (*SlackBotHandler).helpCommand,
+	"status": (*SlackBotHandler).statusCommand,
+	"stats":  (*SlackBotHandler).statsCommand,
+}
+
+// lookupMentionCommand returns the command named by text, if text is a single command word.
+func lookupMentionCommand(text string) (mentionCommand, bool) {
+	command, ok := mentionCommands[strings.ToLower(strings.TrimSpace(text))]
+	return command, ok
+}
+
+// helpCommand explains how to use the bot.
+func (h *SlackBotHandler) helpCommand(userID string) string {
+	return "Here's what I can do:\n" +
+		"• Mention me or send me a message to start an invitation; I'll ask who to invite and what to play.\n" +
+		"• `/invite \"user1,user2\" \"game\"` sends an invitation in one go.\n" +
+		"• Say \"cancel\" at any time to stop an invitation in progress.\n" +
+		"• `@me status` shows your invitation in progress, `@me stats` shows how invitations are going overall."
+}
+
+// statusCommand describes userID's conversation in progress, if any.
+func (h *SlackBotHandler) statusCommand(userID string) string {
+	state, exists, err := h.conversationStates.Get(userID)
+	if err != nil {
+		logger.Error("Error loading conversation state", "event_type", "app_mention", "user_id", userID, "error", err)
+		return "Sorry, I couldn't load your invitation. Please try again shortly."
+	}
+	if !exists || h.conversationExpired(state) {
+		return "You don't have an invitation in progress. Mention me or send me a message to start one."
+	}
+	var status string
+	switch state.Step {
+	case "awaiting_names":
+		status = "I'm waiting for the names of the people you want to invite."
+	case "awaiting_game":
+		status = fmt.Sprintf("You're inviting %s, and I'm waiting for the game.", strings.Join(state.RecipientUserNames, ", "))
+	case "confirming_game":
+		status = fmt.Sprintf("You're inviting %s, and I'm waiting for you to confirm %s as the game.", strings.Join(state.RecipientUserNames, ", "), state.PendingGame)
+	default:
+		status = fmt.Sprintf("Your invitation is at step %q.", state.Step)
+	}
+	if !state.LastActivity.IsZero() {
+		status += fmt.Sprintf(" Last update %s ago.", time.Since(state.LastActivity).Round(time.Second))
+	}
+	return status + " Say \"cancel\" to stop."
+}
+
+// statsCommand summarizes the conversation step counters since the bot started.
+func (h *SlackBotHandler) statsCommand(userID string) string {
+	lines := []string{"Conversation steps since I started:"}
+	for _, step := range conversationFunnel {
+		lines = append(lines, fmt.Sprintf("• %s: %d", step, stepCount(step)))
+	}
+	return strings.Join(lines, "\n")
+}
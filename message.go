@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// ellipsis is appended to messages that were shortened by truncateMessage.
+const ellipsis = "…"
+
+// truncateMessage shortens text to at most maxLen characters, preferring to cut at the end of a sentence.
+// When no sentence boundary is available it cuts at the last word boundary, and an ellipsis is appended.
+// A maxLen of zero or less leaves the text untouched.
+func truncateMessage(text string, maxLen int) string {
+	runes := []rune(text)
+	if maxLen <= 0 || len(runes) <= maxLen {
+		return text
+	}
+
+	// Leave room for the ellipsis.
+	limit := maxLen - len([]rune(ellipsis))
+	if limit <= 0 {
+		return string(runes[:maxLen])
+	}
+	cut := string(runes[:limit])
+
+	// Prefer the last sentence-ending punctuation mark.
+	if end := strings.LastIndexAny(cut, ".!?"); end > 0 {
+		cut = cut[:end+1]
+	} else if space := strings.LastIndexAny(cut, " \n\t"); space > 0 {
+		cut = strings.TrimRight(cut[:space], " \n\t")
+	}
+
+	truncated := cut + ellipsis
+	logger.Info("Truncated message", "from_length", len(runes), "to_length", len([]rune(truncated)), "limit", maxLen)
+	return truncated
+}
+
+// closingSeparator puts the closing line in its own paragraph below the invitation.
+const closingSeparator = "\n\n"
+
+// withClosing appends closing to invitation, shortening the invitation first where needed so
+// the whole message still fits in maxLen characters. With an empty closing it only truncates.
+func withClosing(invitation, closing string, maxLen int) string {
+	if closing == "" {
+		return truncateMessage(invitation, maxLen)
+	}
+	if maxLen > 0 {
+		room := maxLen - len([]rune(closingSeparator+closing))
+		if room <= 0 {
+			// validateClosings rules this out; keep the invitation rather than only the sign-off.
+			return truncateMessage(invitation, maxLen)
+		}
+		invitation = truncateMessage(invitation, room)
+	}
+	return invitation + closingSeparator + closing
+}
+
+// parseGameClosings parses INVITATION_CLOSINGS entries such as "catan=— The Catan Club; chess=Good
+// luck!". Entries are separated by semicolons since sign-offs often contain commas. An empty
+// closing turns INVITATION_CLOSING off for that game.
+func parseGameClosings(list string) (map[string]string, error) {
+	closings := make(map[string]string)
+	for _, entry := range strings.Split(list, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		game, closing, ok := strings.Cut(entry, "=")
+		game = normalizeGame(game)
+		if !ok || game == "" {
+			return nil, fmt.Errorf("entry %q should look like game=closing", strings.TrimSpace(entry))
+		}
+		closings[game] = strings.TrimSpace(closing)
+	}
+	return closings, nil
+}
+
+// validateClosings checks that every closing leaves room for an invitation within maxLen.
+func validateClosings(closing string, perGame map[string]string, maxLen int) error {
+	if maxLen <= 0 {
+		return nil
+	}
+	tooLong := func(closing string) bool {
+		return len([]rune(closingSeparator+closing)) >= maxLen
+	}
+	if tooLong(closing) {
+		return fmt.Errorf("closing leaves no room for the invitation within MAX_MESSAGE_LENGTH (%d)", maxLen)
+	}
+	for game, closing := range perGame {
+		if tooLong(closing) {
+			return fmt.Errorf("closing for %q leaves no room for the invitation within MAX_MESSAGE_LENGTH (%d)", game, maxLen)
+		}
+	}
+	return nil
+}
+
+// inviterSummary builds the confirmation shown to the inviter. It is written from the inviter's
+// point of view and quotes the message the recipients received, rather than echoing it verbatim.
+func inviterSummary(recipientNames []string, gameName, invitation string) string {
+	quoted := "> " + strings.ReplaceAll(strings.TrimSpace(invitation), "\n", "\n> ")
+	return fmt.Sprintf("You invited %s to %s — here's the message they got:\n%s", strings.Join(recipientNames, ", "), gameName, quoted)
+}
+
+// redirectNotice labels an invitation rerouted by REDIRECT_ALL_TO with the recipients it was meant for.
+func redirectNotice(recipientIDs []string) string {
+	return ":test_tube: Test mode: this invitation was meant for " + userMentions(recipientIDs)
+}
+
+// userMentions formats user IDs as a comma separated list of Slack mentions.
+func userMentions(userIDs []string) string {
+	mentions := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		mentions[i] = "<@" + id + ">"
+	}
+	return strings.Join(mentions, ", ")
+}
+
+// redirectNoticeBlock is redirectNotice as a context block, for invitations built from blocks.
+func redirectNoticeBlock(recipientIDs []string) slack.Block {
+	return slack.NewContextBlock("redirect_notice",
+		slack.NewTextBlockObject("mrkdwn", redirectNotice(recipientIDs), false, false),
+	)
+}
+
+// maxUsernameLength is the longest custom display name Slack accepts for a message.
+const maxUsernameLength = 80
+
+// iconEmojiPattern matches Slack emoji codes such as ":game_die:".
+var iconEmojiPattern = regexp.MustCompile(`^:[a-z0-9_+'-]+:$`)
+
+// validateIdentity checks a custom display name and icon emoji before they are sent to Slack.
+func validateIdentity(username, iconEmoji string) error {
+	if len([]rune(username)) > maxUsernameLength {
+		return fmt.Errorf("username must be at most %d characters", maxUsernameLength)
+	}
+	if iconEmoji != "" && !iconEmojiPattern.MatchString(iconEmoji) {
+		return fmt.Errorf("icon_emoji must look like :emoji_name:, got %q", iconEmoji)
+	}
+	return nil
+}
+
+// identityOptions returns the message options that post as a custom display name and icon.
+// Empty values are skipped so the app's default identity is used.
+func identityOptions(username, iconEmoji string) []slack.MsgOption {
+	var options []slack.MsgOption
+	if username != "" {
+		options = append(options, slack.MsgOptionUsername(username))
+	}
+	if iconEmoji != "" {
+		options = append(options, slack.MsgOptionIconEmoji(iconEmoji))
+	}
+	return options
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateMessage(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		maxLen int
+		want   string
+	}{
+		{name: "fits", text: "Come play Catan!", maxLen: 16, want: "Come play Catan!"},
+		{name: "no limit", text: "Come play Catan!", maxLen: 0, want: "Come play Catan!"},
+		{name: "cuts at a sentence", text: "Come play Catan. Bring snacks and friends.", maxLen: 25, want: "Come play Catan.…"},
+		{name: "cuts at a word", text: "Come play Catan tonight", maxLen: 15, want: "Come play…"},
+		{name: "cuts mid-word without a boundary", text: "abcdefghij", maxLen: 5, want: "abcd…"},
+		{name: "counts characters, not bytes", text: "Zoë Zoë Zoë", maxLen: 8, want: "Zoë…"},
+		{name: "no room for the ellipsis", text: "abcdef", maxLen: 1, want: "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateMessage(tt.text, tt.maxLen)
+			if got != tt.want {
+				t.Errorf("truncateMessage(%q, %d) = %q, want %q", tt.text, tt.maxLen, got, tt.want)
+			}
+			if tt.maxLen > 0 && utf8.RuneCountInString(got) > tt.maxLen {
+				t.Errorf("truncateMessage(%q, %d) is %d characters long", tt.text, tt.maxLen, utf8.RuneCountInString(got))
+			}
+		})
+	}
+}
+
+func TestWithClosing(t *testing.T) {
+	tests := []struct {
+		name       string
+		invitation string
+		closing    string
+		maxLen     int
+		want       string
+	}{
+		{name: "appended in its own paragraph", invitation: "Come play Catan!", closing: "— The Catan Club", maxLen: 100, want: "Come play Catan!\n\n— The Catan Club"},
+		{name: "no closing", invitation: "Come play Catan!", maxLen: 100, want: "Come play Catan!"},
+		{name: "no limit", invitation: "Come play Catan!", closing: "Cheers", want: "Come play Catan!\n\nCheers"},
+		{name: "the invitation makes room", invitation: "Come play Catan tonight. Bring snacks.", closing: "Cheers", maxLen: 34, want: "Come play Catan tonight.…\n\nCheers"},
+		{name: "no room keeps the invitation", invitation: "Come play Catan!", closing: "A very long sign-off", maxLen: 10, want: "Come…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := withClosing(tt.invitation, tt.closing, tt.maxLen)
+			if got != tt.want {
+				t.Errorf("withClosing(%q, %q, %d) = %q, want %q", tt.invitation, tt.closing, tt.maxLen, got, tt.want)
+			}
+			if tt.maxLen > 0 && utf8.RuneCountInString(got) > tt.maxLen {
+				t.Errorf("withClosing(%q, %q, %d) is %d characters long", tt.invitation, tt.closing, tt.maxLen, utf8.RuneCountInString(got))
+			}
+		})
+	}
+}
+
+func TestInvitationClosings(t *testing.T) {
+	tests := []struct {
+		name     string
+		closing  string // INVITATION_CLOSING
+		closings string // INVITATION_CLOSINGS
+		maxLen   int
+		game     string
+		want     string
+		wantErr  string
+	}{
+		{name: "everyone gets the default", closing: "Cheers", game: "Chess", want: "Cheers"},
+		{name: "a game's own closing wins", closing: "Cheers", closings: "catan=— The Catan Club, est. 2019; chess=Good luck!", game: " CATAN ", want: "— The Catan Club, est. 2019"},
+		{name: "an empty closing turns it off for the game", closing: "Cheers", closings: "chess=", game: "Chess", want: ""},
+		{name: "no closing", game: "Catan", want: ""},
+		{name: "entry without a game", closings: "=Cheers", wantErr: `entry "=Cheers" should look like game=closing`},
+		{name: "entry without a closing", closings: "catan", wantErr: `entry "catan" should look like game=closing`},
+		{name: "default too long", closing: "Cheers", maxLen: 8, wantErr: "closing leaves no room for the invitation"},
+		{name: "game closing too long", closings: "catan=Cheers", maxLen: 8, wantErr: `closing for "catan" leaves no room for the invitation`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			closings, err := parseGameClosings(tt.closings)
+			if err == nil {
+				err = validateClosings(tt.closing, closings, tt.maxLen)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			config := &Config{InvitationClosing: tt.closing, InvitationClosings: closings}
+			if got := config.closingFor(tt.game); got != tt.want {
+				t.Errorf("closingFor(%q) = %q, want %q", tt.game, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInviterAndRecipientMessagesDiffer(t *testing.T) {
+	invitation := "Hey Bob Baker and Carol Cooper, Alice Archer invites you to Catan!\nBring snacks."
+	if got, want := inviterSummary([]string{"Bob Baker", "Carol Cooper"}, "Catan", invitation),
+		"You invited Bob Baker, Carol Cooper to Catan — here's the message they got:\n> Hey Bob Baker and Carol Cooper, Alice Archer invites you to Catan!\n> Bring snacks."; got != want {
+		t.Errorf("inviterSummary() = %q, want %q", got, want)
+	}
+
+	fake := newFakeSlack(t, testUsers...)
+	h, _ := newTestBotHandler(t, fake, testConfig(), &fakeGenerator{invitation: invitation})
+	h.processEvent(directMessage("U1", "hi"))
+	h.processEvent(directMessage("U1", "bob, carol"))
+	h.processEvent(directMessage("U1", "Catan"))
+
+	for _, recipient := range []string{"U2", "U3"} {
+		if got := fake.postsTo(recipient); len(got) != 1 || got[0] != invitation {
+			t.Errorf("%s got %q, want the invitation itself", recipient, got)
+		}
+	}
+	replies := fake.postsTo("DU1")
+	if len(replies) == 0 {
+		t.Fatal("the inviter got no confirmation")
+	}
+	summary := replies[len(replies)-1]
+	if !strings.HasPrefix(summary, "You invited Bob Baker, Carol Cooper to Catan — here's the message they got:\n> Hey Bob Baker") {
+		t.Errorf("inviter's confirmation = %q, want it written to them and quoting the invitation", summary)
+	}
+	if summary == invitation || strings.HasPrefix(summary, "Hey") {
+		t.Errorf("inviter's confirmation = %q, want it to differ from the recipients' message", summary)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Delivery methods used to label the invite counters.
+const (
+	deliveryDM      = "dm"      // the invitation was sent to a user's DM
+	deliveryChannel = "channel" // the invitation was posted in a channel or thread
+)
+
+// Prometheus collectors served at /metrics.
+var (
+	invitesSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "invites_sent_total",
+		Help: "Invitations delivered to Slack, by delivery method.",
+	}, []string{"method"})
+	invitesFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "invites_failed_total",
+		Help: "Invitations Slack failed to deliver, by delivery method.",
+	}, []string{"method"})
+	invitesSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "invites_skipped_total",
+		Help: "Invitations not delivered because the recipient's account was deactivated, by delivery method.",
+	}, []string{"method"})
+	// The generator counters keep the names they had when Gemini was the only provider, so
+	// existing dashboards keep working; the provider label tells the providers apart.
+	generatorCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gemini_calls_total",
+		Help: "Calls to the invitation generator's language model API, including failed ones, by provider.",
+	}, []string{"provider"})
+	generatorErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gemini_errors_total",
+		Help: "Calls to the invitation generator's language model API that failed, by provider.",
+	}, []string{"provider"})
+	circuitBreakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "circuit_breaker_state",
+		Help: "State of the invitation generator's circuit breaker, by provider: 0 closed, 1 half-open, 2 open.",
+	}, []string{"provider"})
+	activeConversations = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "active_conversations",
+		Help: "DM conversations in progress, counting those this instance started minus those it ended; sum across instances sharing a store.",
+	})
+)
+
+// recordInvite counts one invitation delivery attempt by method.
+func recordInvite(method string, err error) {
+	if isInactiveRecipient(err) {
+		invitesSkipped.WithLabelValues(method).Inc()
+		return
+	}
+	if err != nil {
+		invitesFailed.WithLabelValues(method).Inc()
+		return
+	}
+	invitesSent.WithLabelValues(method).Inc()
+}
+
+// recordLLMCall counts one call to provider's language model API.
+func recordLLMCall(provider string, err error) {
+	generatorCalls.WithLabelValues(provider).Inc()
+	if err != nil {
+		generatorErrors.WithLabelValues(provider).Inc()
+	}
+}
+
+// newMetricsRegistry returns a registry with the bot's collectors and the Go runtime and
+// process metrics.
+func newMetricsRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		invitesSent,
+		invitesFailed,
+		invitesSkipped,
+		generatorCalls,
+		generatorErrors,
+		circuitBreakerState,
+		activeConversations,
+		conversationSteps,
+		gameFeedback,
+	)
+	return registry
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecordLLMCall(t *testing.T) {
+	tests := []struct {
+		provider   string
+		err        error
+		wantCalls  float64
+		wantErrors float64
+	}{
+		{provider: providerGemini, wantCalls: 1},
+		{provider: providerGemini, err: errors.New("timeout"), wantCalls: 1, wantErrors: 1},
+		{provider: providerOpenAI, wantCalls: 1},
+		{provider: providerOpenAI, err: errors.New("bad response"), wantCalls: 1, wantErrors: 1},
+	}
+	for _, tt := range tests {
+		calls := testutil.ToFloat64(generatorCalls.WithLabelValues(tt.provider))
+		failures := testutil.ToFloat64(generatorErrors.WithLabelValues(tt.provider))
+		recordLLMCall(tt.provider, tt.err)
+		if got := testutil.ToFloat64(generatorCalls.WithLabelValues(tt.provider)) - calls; got != tt.wantCalls {
+			t.Errorf("recordLLMCall(%s, %v): gemini_calls_total grew by %v, want %v", tt.provider, tt.err, got, tt.wantCalls)
+		}
+		if got := testutil.ToFloat64(generatorErrors.WithLabelValues(tt.provider)) - failures; got != tt.wantErrors {
+			t.Errorf("recordLLMCall(%s, %v): gemini_errors_total grew by %v, want %v", tt.provider, tt.err, got, tt.wantErrors)
+		}
+	}
+}
+
+func TestActiveConversationsGauge(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []string
+		want     float64 // change in the gauge after the messages
+	}{
+		{name: "started", messages: []string{"hi"}, want: 1},
+		{name: "still in progress after matching names", messages: []string{"hi", "bob"}, want: 1},
+		{name: "cancelled", messages: []string{"hi", "cancel"}, want: 0},
+		{name: "sent", messages: []string{"hi", "bob", "Catan"}, want: 0},
+		{name: "cancel without a conversation", messages: []string{"cancel"}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			h, _ := newTestBotHandler(t, fake, testConfig(), &fakeGenerator{invitation: "Come play!"})
+			before := testutil.ToFloat64(activeConversations)
+			for _, text := range tt.messages {
+				h.processEvent(directMessage("U1", text))
+			}
+			if got := testutil.ToFloat64(activeConversations) - before; got != tt.want {
+				t.Errorf("active_conversations changed by %v, want %v", got, tt.want)
+			}
+			// Leave the gauge where it was for the other tests.
+			h.deleteConversation("U1")
+		})
+	}
+}
+
+func TestMetricsRegistryServesAppMetrics(t *testing.T) {
+	recordStep(stepStarted, "U1")
+	recordLLMCall(providerGemini, nil)
+	gameFeedback.WithLabelValues("positive").Add(0)
+	newCircuitBreaker(providerGemini, 0, 0)
+
+	families, err := newMetricsRegistry().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(map[string]bool)
+	for _, family := range families {
+		served[family.GetName()] = true
+	}
+	for _, name := range []string{"conversation_steps_total", "gemini_calls_total", "game_feedback_total", "circuit_breaker_state", "active_conversations"} {
+		if !served[name] {
+			t.Errorf("/metrics doesn't serve %s", name)
+		}
+	}
+}
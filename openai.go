@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// openAIEndpoint is the chat completions endpoint.
+const openAIEndpoint = "https://api.openai.com/v1/chat/completions"
+
+// OpenAIGenerator writes invitations with OpenAI chat completions from the configured prompt
+// template.
+type OpenAIGenerator struct {
+	apiKey   string
+	model    string
+	client   *llmClient
+	template *template.Template
+	persona  string
+	extras   string
+}
+
+// NewOpenAIGenerator creates an OpenAIGenerator from the OpenAI and prompt settings in config.
+func NewOpenAIGenerator(config *Config) *OpenAIGenerator {
+	extras := ""
+	if config.CallToAction {
+		extras = callToActionPrompt
+	}
+	return &OpenAIGenerator{
+		apiKey:   config.OpenAIAPIKey,
+		model:    config.OpenAIModel,
+		client:   newLLMClient("OpenAI", config.GeneratorTimeout, config.GeneratorMaxAttempts),
+		template: config.PromptTemplate,
+		persona:  config.PromptPersona,
+		extras:   extras,
+	}
+}
+
+// Generate renders the prompt template and asks OpenAI for the invitation.
+func (g *OpenAIGenerator) Generate(ctx context.Context, inviter string, recipients []string, game string, opts GenerateOptions) (string, error) {
+	prompt, err := renderPrompt(g.template, promptData{
+		Inviter:    inviter,
+		Recipients: strings.Join(recipients, ", "),
+		Game:       game,
+		Tone:       opts.tone(),
+		Persona:    g.persona,
+		Extras:     opts.withLanguage(g.extras),
+	})
+	if err != nil {
+		return "", fmt.Errorf("rendering prompt: %w", err)
+	}
+	return g.Complete(ctx, prompt)
+}
+
+// Complete sends prompt to OpenAI as a single user message and returns the reply.
+func (g *OpenAIGenerator) Complete(ctx context.Context, prompt string) (string, error) {
+	if g.apiKey == "" {
+		return "", fmt.Errorf("OPENAI_API_KEY not set")
+	}
+	requestBody := map[string]interface{}{
+		"model": g.model,
+		"messages": []map[string]string{
+			{"role": "user", "content": prompt},
+		},
+	}
+	jsonBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", err
+	}
+
+	text, err := g.parse(g.client.post(ctx, openAIEndpoint, map[string]string{"Authorization": "Bearer " + g.apiKey}, jsonBody))
+	recordLLMCall(providerOpenAI, err)
+	return text, err
+}
+
+// parse extracts the reply from a chat completions response.
+func (g *OpenAIGenerator) parse(body []byte, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	var responseData struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(body, &responseData); err != nil {
+		return "", &GeneratorError{Provider: g.client.provider, Kind: generatorBadResponse, Err: err}
+	}
+	if len(responseData.Choices) == 0 || strings.TrimSpace(responseData.Choices[0].Message.Content) == "" {
+		return "", &GeneratorError{Provider: g.client.provider, Kind: generatorBadResponse, Err: errors.New("no choices in response")}
+	}
+	return strings.TrimSpace(responseData.Choices[0].Message.Content), nil
+}
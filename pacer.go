@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// sendPacer is a token bucket that spaces out chat.postMessage calls so large batches stay under
+// the app's Slack rate tier instead of tripping 429s.
+type sendPacer struct {
+	mutex    sync.Mutex
+	interval time.Duration // time to earn one token
+	burst    float64
+	tokens   float64
+	last     time.Time
+}
+
+// newSendPacer allows perMinute sends per minute with bursts of up to burst sends.
+// It returns nil, which never blocks, when perMinute is zero or less.
+func newSendPacer(perMinute, burst int) *sendPacer {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &sendPacer{
+		interval: time.Minute / time.Duration(perMinute),
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		last:     time.Now(),
+	}
+}
+
+// wait blocks until the caller may send. Tokens are reserved up front, so concurrent callers
+// queue up behind each other instead of all waking at once.
+func (p *sendPacer) wait() {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	now := time.Now()
+	p.tokens += float64(now.Sub(p.last)) / float64(p.interval)
+	if p.tokens > p.burst {
+		p.tokens = p.burst
+	}
+	p.last = now
+	p.tokens--
+	var delay time.Duration
+	if p.tokens < 0 {
+		delay = time.Duration(-p.tokens * float64(p.interval))
+	}
+	p.mutex.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// messageSender posts Slack messages through the shared pacer, retrying when Slack still
+// answers with a rate limit error. Missing scope errors are explained through scopes.
+type messageSender struct {
+	slackClient *slack.Client
+	scopes      *scopeTracker
+	pacer       *sendPacer
+	maxRetries  int
+	inFlight    chan struct{} // one slot per send in progress; nil for no limit
+}
+
+// newMessageSender creates a sender that paces all posts through pacer and has at most
+// maxInFlight of them in progress at once, or any number when maxInFlight is zero or less.
+func newMessageSender(slackClient *slack.Client, scopes *scopeTracker, pacer *sendPacer, maxRetries, maxInFlight int) *messageSender {
+	s := &messageSender{
+		slackClient: slackClient,
+		scopes:      scopes,
+		pacer:       pacer,
+		maxRetries:  maxRetries,
+	}
+	if maxInFlight > 0 {
+		s.inFlight = make(chan struct{}, maxInFlight)
+	}
+	return s
+}
+
+// acquire blocks until a send may start and returns the function that ends it.
+func (s *messageSender) acquire() func() {
+	if s.inFlight == nil {
+		return func() {}
+	}
+	s.inFlight <- struct{}{}
+	return func() { <-s.inFlight }
+}
+
+// inactiveAccountErrors are the Slack errors returned when posting to a user whose account was
+// deactivated after they were matched.
+var inactiveAccountErrors = map[string]bool{"account_inactive": true, "user_disabled": true}
+
+// isInactiveRecipient reports whether a post failed because the recipient's account has been
+// deactivated, so retrying can't reach them.
+func isInactiveRecipient(err error) bool {
+	var slackErr slack.SlackErrorResponse
+	return errors.As(err, &slackErr) && inactiveAccountErrors[slackErr.Err]
+}
+
+// post sends a message like slack.Client.PostMessage, returning the channel ID and timestamp.
+func (s *messageSender) post(channelID string, options ...slack.MsgOption) (string, string, error) {
+	defer s.acquire()()
+	for attempt := 0; ; attempt++ {
+		s.pacer.wait()
+		respChannel, respTimestamp, err := s.slackClient.PostMessage(channelID, options...)
+		var rateLimited *slack.RateLimitedError
+		if err == nil || !errors.As(err, &rateLimited) || attempt >= s.maxRetries {
+			return respChannel, respTimestamp, s.scopes.explain(methodPostMessage, err)
+		}
+		logger.Warn("Rate limited posting, retrying", "channel", channelID, "retry_in", rateLimited.RetryAfter.String(), "attempt", attempt+1, "max_retries", s.maxRetries)
+		time.Sleep(rateLimited.RetryAfter)
+	}
+}
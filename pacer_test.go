@@ -0,0 +1,65 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSendPacerSpacesSends(t *testing.T) {
+	tests := []struct {
+		name      string
+		perMinute int
+		burst     int
+		sends     int
+		wantMin   time.Duration // how long the sends take at least
+		wantMax   time.Duration
+	}{
+		{name: "off", perMinute: 0, sends: 20, wantMax: 10 * time.Millisecond},
+		{name: "one at a time", perMinute: 3000, burst: 1, sends: 6, wantMin: 100 * time.Millisecond, wantMax: 200 * time.Millisecond},
+		{name: "burst goes out at once", perMinute: 3000, burst: 4, sends: 4, wantMax: 10 * time.Millisecond},
+		{name: "then the rate applies", perMinute: 3000, burst: 4, sends: 7, wantMin: 60 * time.Millisecond, wantMax: 150 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pacer := newSendPacer(tt.perMinute, tt.burst)
+			start := time.Now()
+			for i := 0; i < tt.sends; i++ {
+				pacer.wait()
+			}
+			if elapsed := time.Since(start); elapsed < tt.wantMin || elapsed > tt.wantMax {
+				t.Errorf("%d sends took %s, want %s to %s", tt.sends, elapsed, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestSendPacerQueuesConcurrentSenders(t *testing.T) {
+	pacer := newSendPacer(3000, 1) // one send every 20ms
+	start := time.Now()
+	var mutex sync.Mutex
+	var sent []time.Duration
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pacer.wait()
+			mutex.Lock()
+			sent = append(sent, time.Since(start))
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(sent, func(i, j int) bool { return sent[i] < sent[j] })
+	for i, at := range sent {
+		if want := time.Duration(i) * 20 * time.Millisecond; at < want-2*time.Millisecond {
+			t.Errorf("send %d went out after %s, want no sooner than %s: %v", i, at, want, sent)
+		}
+	}
+	if last := sent[len(sent)-1]; last > 200*time.Millisecond {
+		t.Errorf("the last send waited %s, want about 80ms", last)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// pendingInviteKeyPrefix namespaces, by invite ID, the invitations still awaiting answers.
+const pendingInviteKeyPrefix = "pending_invite:"
+
+// pendingInvite is an invitation that not every recipient has answered yet.
+type pendingInvite struct {
+	InviteID   string    `json:"invite_id"`
+	Recipients int       `json:"recipients"` // DM recipients it was delivered to; 0 for channel-only posts
+	ExpiresAt  time.Time `json:"expires_at"` // when it stops being pending even if unanswered
+}
+
+// pendingInvites tracks how many invitations sent through the API are still pending across the
+// workspace, so MAX_PENDING_INVITES can hold off new ones. An invitation stops being pending
+// once every recipient has answered, when its game starts, after PENDING_INVITE_TTL, or when
+// everything queued of it is cancelled; the Store's TTL takes care of the second and third.
+type pendingInvites struct {
+	store Store
+	limit int           // most pending invitations allowed, 0 for no limit
+	ttl   time.Duration // how long an invitation without a game time stays pending
+}
+
+// newPendingInvites tracks pending invitations in store, allowing at most limit at a time.
+func newPendingInvites(store Store, limit int, ttl time.Duration) *pendingInvites {
+	return &pendingInvites{store: store, limit: limit, ttl: ttl}
+}
+
+// pendingLimitError is returned when the workspace already has the most pending
+// invitations MAX_PENDING_INVITES allows. RetryAfter is how long until the first of them
+// expires, at most PENDING_INVITE_TTL.
+type pendingLimitError struct {
+	Pending, Limit int
+	RetryAfter     time.Duration
+}
+
+func (e *pendingLimitError) Error() string {
+	return fmt.Sprintf("There are already %d pending invitations in this workspace, and at most %d are allowed at a time. Try again once some have been answered or have expired.", e.Pending, e.Limit)
+}
+
+// reserve holds a slot for inviteID before it is sent, returning pendingLimitError if the
+// limit has been reached. The slot is a placeholder record, written before the pending
+// invitations are counted, so concurrent requests see each other's slots and can't overshoot
+// the limit; at worst they all back off. It reports whether it wrote the placeholder, which the
+// caller gives back with release unless the invitation is then recorded with add. An invitation
+// already pending under inviteID, such as an asynchronous one sent again, keeps its record.
+func (p *pendingInvites) reserve(inviteID string) (bool, error) {
+	if p.limit <= 0 {
+		return false, nil
+	}
+	data, err := json.Marshal(pendingInvite{InviteID: inviteID, ExpiresAt: time.Now().Add(p.ttl)})
+	if err != nil {
+		return false, err
+	}
+	reserved, err := p.store.SetNX(pendingInviteKeyPrefix+inviteID, data, p.ttl)
+	if err != nil {
+		return false, fmt.Errorf("reserving a pending invitation: %w", err)
+	}
+	if !reserved {
+		return false, nil
+	}
+	keys, err := p.store.Keys(pendingInviteKeyPrefix)
+	if err != nil {
+		p.release(inviteID)
+		return false, fmt.Errorf("counting pending invitations: %w", err)
+	}
+	if len(keys) > p.limit {
+		p.release(inviteID)
+		others := make([]string, 0, len(keys))
+		for _, key := range keys {
+			if key != pendingInviteKeyPrefix+inviteID {
+				others = append(others, key)
+			}
+		}
+		return false, &pendingLimitError{Pending: len(others), Limit: p.limit, RetryAfter: p.untilFirstExpiry(others)}
+	}
+	return true, nil
+}
+
+// release gives back the slot reserve held for an invitation that didn't end up pending.
+func (p *pendingInvites) release(inviteID string) {
+	if _, err := p.store.Delete(pendingInviteKeyPrefix + inviteID); err != nil {
+		logger.Error("Error releasing the pending invitation slot", "invite_id", inviteID, "error", err)
+	}
+}
+
+// untilFirstExpiry returns how long until the earliest of the pending invitations under keys
+// expires. Invitations answered since they were listed, or that can't be read, are skipped, and
+// PENDING_INVITE_TTL is the most it returns.
+func (p *pendingInvites) untilFirstExpiry(keys []string) time.Duration {
+	earliest := p.ttl
+	for _, key := range keys {
+		data, ok, err := p.store.Get(key)
+		if err != nil || !ok {
+			continue
+		}
+		var pending pendingInvite
+		if err := json.Unmarshal(data, &pending); err != nil || pending.ExpiresAt.IsZero() {
+			continue
+		}
+		if remaining := time.Until(pending.ExpiresAt); remaining < earliest {
+			earliest = remaining
+		}
+	}
+	if earliest < time.Second {
+		// Don't tell clients to retry right away; the expiry is at most a second out.
+		earliest = time.Second
+	}
+	return earliest
+}
+
+// add records a delivered invitation as pending until every one of recipients has answered,
+// or until expires if nobody has by then. A zero expires uses the TTL from now.
+func (p *pendingInvites) add(inviteID string, recipients int, expires time.Time) error {
+	if p.limit <= 0 {
+		return nil
+	}
+	if expires.IsZero() {
+		expires = time.Now().Add(p.ttl)
+	}
+	data, err := json.Marshal(pendingInvite{InviteID: inviteID, Recipients: recipients, ExpiresAt: expires})
+	if err != nil {
+		return err
+	}
+	return p.store.Set(pendingInviteKeyPrefix+inviteID, data, time.Until(expires))
+}
+
+// withdraw accounts for a queued message of inviteID that was cancelled before Slack delivered
+// it. The invitation stops being pending once nothing of it is left to deliver; otherwise it
+// waits for one answer fewer if the message was a recipient's DM.
+func (p *pendingInvites) withdraw(inviteID string, dm, nothingLeft bool) error {
+	if p.limit <= 0 {
+		return nil
+	}
+	key := pendingInviteKeyPrefix + inviteID
+	if nothingLeft {
+		_, err := p.store.Delete(key)
+		return err
+	}
+	if !dm {
+		return nil
+	}
+	data, ok, err := p.store.Get(key)
+	if err != nil || !ok {
+		return err
+	}
+	var pending pendingInvite
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return fmt.Errorf("decoding pending invitation %s: %w", inviteID, err)
+	}
+	if pending.Recipients > 0 {
+		pending.Recipients--
+	}
+	if data, err = json.Marshal(pending); err != nil {
+		return err
+	}
+	return p.store.Set(key, data, time.Until(pending.ExpiresAt))
+}
+
+// answered resolves inviteID once tally shows an answer from every recipient.
+func (p *pendingInvites) answered(inviteID string, tally RSVPTally) {
+	if p.limit <= 0 {
+		return
+	}
+	data, ok, err := p.store.Get(pendingInviteKeyPrefix + inviteID)
+	if err != nil || !ok {
+		if err != nil {
+			logger.Error("Error loading the pending invitation", "invite_id", inviteID, "error", err)
+		}
+		return
+	}
+	var pending pendingInvite
+	if err := json.Unmarshal(data, &pending); err != nil {
+		logger.Error("Error decoding the pending invitation", "invite_id", inviteID, "error", err)
+		return
+	}
+	if pending.Recipients == 0 || tally.Accepted.Count+tally.Maybe.Count+tally.Declined.Count < pending.Recipients {
+		return
+	}
+	if _, err := p.store.Delete(pendingInviteKeyPrefix + inviteID); err != nil {
+		logger.Error("Error resolving the pending invitation", "invite_id", inviteID, "error", err)
+		return
+	}
+	logger.Info("Every recipient answered the invitation", "invite_id", inviteID)
+}
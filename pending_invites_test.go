@@ -0,0 +1,224 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPendingInviteCap(t *testing.T) {
+	tests := []struct {
+		name       string
+		ttl        time.Duration // PENDING_INVITE_TTL
+		resolve    func(t *testing.T, fake *fakeSlack, h *GameInviteHandler, inviteID string)
+		wantStatus int // of the request after the cap was hit and the first invitation resolved
+	}{
+		{name: "still capped", ttl: time.Hour, resolve: func(*testing.T, *fakeSlack, *GameInviteHandler, string) {}, wantStatus: http.StatusTooManyRequests},
+		{
+			name: "resolved once every recipient answered",
+			ttl:  time.Hour,
+			resolve: func(t *testing.T, fake *fakeSlack, h *GameInviteHandler, inviteID string) {
+				client := fake.client()
+				interactions := NewInteractionHandler(client, h.userCache, h.sender, testActionSecret, nil, nil, nil, h.rsvps, newInviterNotifier(NewInMemoryStore(), h.sender, 0), h.pending)
+				value := inviteActionValue{Game: "Catan", InviteID: inviteID}
+				click(interactions, "U2", actionAcceptGame, value)
+				click(interactions, "U3", actionDeclineGame, value)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "a maybe counts as an answer",
+			ttl:  time.Hour,
+			resolve: func(t *testing.T, fake *fakeSlack, h *GameInviteHandler, inviteID string) {
+				interactions := NewInteractionHandler(fake.client(), h.userCache, h.sender, testActionSecret, nil, nil, nil, h.rsvps, newInviterNotifier(NewInMemoryStore(), h.sender, 0), h.pending)
+				value := inviteActionValue{Game: "Catan", InviteID: inviteID}
+				click(interactions, "U2", actionDeclineGame, value)
+				click(interactions, "U3", actionMaybeGame, value)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "expired",
+			ttl:  50 * time.Millisecond,
+			resolve: func(*testing.T, *fakeSlack, *GameInviteHandler, string) {
+				time.Sleep(60 * time.Millisecond)
+			},
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			config := testConfig()
+			config.ActionSigningSecret = testActionSecret
+			config.MaxPendingInvites = 2
+			config.PendingInviteTTL = tt.ttl
+			h, _ := newTestInviteHandler(t, fake, config)
+			invite := InviteRequest{GameName: "Catan", UserIDs: []string{"U2", "U3"}}
+
+			var first string
+			for i := 0; i < 2; i++ {
+				status, response := h.sendInvite(invite)
+				if status != http.StatusOK {
+					t.Fatalf("invitation %d answered %d: %v", i+1, status, response)
+				}
+				if i == 0 {
+					first = response["invite_id"].(string)
+				}
+			}
+			status, response := h.sendInvite(invite)
+			if status != http.StatusTooManyRequests || response["pending_invites"] != 2 || response["max_pending_invites"] != 2 {
+				t.Fatalf("third invitation answered %d: %v, want 429 with 2 of 2 pending", status, response)
+			}
+
+			tt.resolve(t, fake, h, first)
+			if status, response := h.sendInvite(invite); status != tt.wantStatus {
+				t.Errorf("invitation after resolving answered %d: %v, want %d", status, response, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestPendingInviteCapRetryAfter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name     string
+		expiries []time.Duration // of the pending invitations, 0 for a record without expires_at
+		want     int             // Retry-After, in seconds
+	}{
+		{name: "the earliest expiry", expiries: []time.Duration{30 * time.Minute, 10 * time.Minute}, want: 600},
+		{name: "records without an expiry are skipped", expiries: []time.Duration{0, 30 * time.Minute}, want: 1800},
+		{name: "at most the TTL", expiries: []time.Duration{0, 0}, want: 3600},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			config := testConfig()
+			config.MaxPendingInvites = len(tt.expiries)
+			config.PendingInviteTTL = time.Hour
+			h, store := newTestInviteHandler(t, fake, config)
+			for i, expiry := range tt.expiries {
+				inviteID := "inv" + strconv.Itoa(i)
+				if expiry == 0 {
+					// Recorded before invitations carried their expiry.
+					if err := store.Set(pendingInviteKeyPrefix+inviteID, []byte(`{"invite_id":"`+inviteID+`","recipients":1}`), time.Hour); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				if err := h.pending.add(inviteID, 1, time.Now().Add(expiry)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/invite", strings.NewReader(`{"game_name":"Catan","user_ids":["U2"],"description":"Come play"}`))
+			c.Request.Header.Set("Content-Type", "application/json")
+			h.SendInvite(c)
+
+			if w.Code != http.StatusTooManyRequests {
+				t.Fatalf("status = %d, want 429: %s", w.Code, w.Body)
+			}
+			got, err := strconv.Atoi(w.Header().Get("Retry-After"))
+			if err != nil || got > tt.want || got < tt.want-5 {
+				t.Errorf("Retry-After = %q, want about %d", w.Header().Get("Retry-After"), tt.want)
+			}
+			if posts := fake.allPosts(); len(posts) != 0 {
+				t.Errorf("posted %d messages, want none", len(posts))
+			}
+		})
+	}
+}
+
+func TestPendingInviteCapHoldsUnderConcurrency(t *testing.T) {
+	fake := newFakeSlack(t, testUsers...)
+	config := testConfig()
+	config.MaxPendingInvites = 2
+	config.PendingInviteTTL = time.Hour
+	h, store := newTestInviteHandler(t, fake, config)
+
+	var wg sync.WaitGroup
+	statuses := make(chan int, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, _ := h.sendInvite(InviteRequest{GameName: "Catan", UserIDs: []string{"U2"}, Description: "Come play"})
+			statuses <- status
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	sent := 0
+	for status := range statuses {
+		if status == http.StatusOK {
+			sent++
+		} else if status != http.StatusTooManyRequests {
+			t.Errorf("invitation answered %d, want 200 or 429", status)
+		}
+	}
+	if sent > config.MaxPendingInvites {
+		t.Errorf("%d invitations sent, want at most %d", sent, config.MaxPendingInvites)
+	}
+	if keys, err := store.Keys(pendingInviteKeyPrefix); err != nil || len(keys) != sent {
+		t.Errorf("pending invitations = %d (%v), want the %d sent", len(keys), err, sent)
+	}
+}
+
+func TestPendingInviteSlotIsReleased(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sendAt := time.Now().Add(time.Hour).Truncate(time.Second).Format(time.RFC3339)
+	tests := []struct {
+		name       string
+		invite     InviteRequest
+		failPost   bool // the DM fails, so nothing is sent
+		cancel     int  // scheduled messages then cancelled through DELETE /invite/scheduled/:id
+		wantStatus int  // of the next invitation
+	}{
+		{name: "failed send", invite: InviteRequest{UserIDs: []string{"U2"}}, failPost: true, wantStatus: http.StatusOK},
+		{name: "scheduled invitation cancelled", invite: InviteRequest{UserIDs: []string{"U2", "U3"}, SendAt: sendAt}, cancel: 2, wantStatus: http.StatusOK},
+		{name: "part of a scheduled invitation cancelled", invite: InviteRequest{UserIDs: []string{"U2", "U3"}, SendAt: sendAt}, cancel: 1, wantStatus: http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			config := testConfig()
+			config.MaxPendingInvites = 1
+			config.PendingInviteTTL = time.Hour
+			h, _ := newTestInviteHandler(t, fake, config)
+			invite := tt.invite
+			invite.GameName, invite.Description = "Catan", "Come play"
+
+			if tt.failPost {
+				fake.failPosts("U2", "channel_not_found")
+			}
+			_, response := h.sendInvite(invite)
+			fake.failPosts("U2", "")
+			scheduled, _ := response["scheduled"].([]ScheduledInvite)
+			if len(scheduled) < tt.cancel {
+				t.Fatalf("scheduled = %+v, want at least %d messages", scheduled, tt.cancel)
+			}
+			r := gin.New()
+			r.DELETE("/invite/scheduled/:id", h.CancelScheduledInvite)
+			for _, message := range scheduled[:tt.cancel] {
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/invite/scheduled/"+message.ScheduledMessageID+"?channel="+message.ChannelID, nil))
+				if w.Code != http.StatusOK {
+					t.Fatalf("cancelling %s answered %d: %s", message.ScheduledMessageID, w.Code, w.Body)
+				}
+			}
+
+			if status, response := h.sendInvite(InviteRequest{GameName: "Chess", UserIDs: []string{"U2"}, Description: "Come play"}); status != tt.wantStatus {
+				t.Errorf("next invitation answered %d: %v, want %d", status, response, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// defaultPromptTemplate is the prompt sent to the generator unless PROMPT_TEMPLATE overrides it.
+const defaultPromptTemplate = "Generate a friendly invitation message from {{.Inviter}} inviting {{.Recipients}} to play a game of {{.Game}}. " +
+	"Make it {{.Tone}}.{{if .Persona}} Write it in the voice of {{.Persona}}.{{end}}{{if .Extras}} {{.Extras}}{{end}}"
+
+// defaultTone is the invitation tone used when the user doesn't ask for one.
+const defaultTone = "friendly and informal"
+
+// maxToneLength bounds a user-supplied tone so it can't take over the prompt.
+const maxToneLength = 60
+
+// toneDirective matches an inline "tone: sarcastic" at the end of a message, with an optional
+// separating comma or semicolon.
+var toneDirective = regexp.MustCompile(`(?i)[,;]?\s*\btone:\s*(.*)$`)
+
+// extractTone splits an inline tone directive off text, returning the remaining text and the
+// tone, which is empty when none was given.
+func extractTone(text string) (string, string) {
+	loc := toneDirective.FindStringSubmatchIndex(text)
+	if loc == nil {
+		return text, ""
+	}
+	tone := strings.TrimSpace(text[loc[2]:loc[3]])
+	if len(tone) > maxToneLength {
+		tone = strings.TrimSpace(tone[:maxToneLength])
+	}
+	return strings.TrimSpace(text[:loc[0]]), tone
+}
+
+// callToActionPrompt asks the generator to close with a prompt for a reply.
+const callToActionPrompt = "End with a short call to action asking them to reply or react to say whether they're in."
+
+// suggestedRepliesText is shown under generated invitations when calls to action are enabled.
+const suggestedRepliesText = "React with :thumbsup: if you're in or :thumbsdown: if you can't make it."
+
+// nameSuggestionPrompt asks the generator to suggest likely intended users for unmatched names.
+// It is formatted with the unmatched names and the candidate names.
+const nameSuggestionPrompt = "A Slack user tried to invite people named %s, but no workspace member matched. " +
+	"The workspace members are: %s. Write a short, friendly reply (at most two sentences) suggesting who they might have meant, " +
+	"using only names from that list. If nothing is close, say so and ask them to check the spelling."
+
+// gameExtractionPrompt asks the generator for the game named in a free-form awaiting_game reply.
+const gameExtractionPrompt = "A Slack user was asked which game they want to invite people to and replied: %q. " +
+	"Answer with only the name of the game in its usual spelling and capitalization, without any other words or punctuation. " +
+	"If the reply doesn't mention a game, answer with the reply unchanged."
+
+// maxExtractedGameLength bounds the length of an extracted game name; longer answers are ignored.
+const maxExtractedGameLength = 100
+
+// maxSuggestionCandidates bounds how many directory names are included in a suggestion prompt.
+const maxSuggestionCandidates = 200
+
+// promptData is the data available to the prompt template.
+type promptData struct {
+	Inviter    string // the inviting user's real name
+	Recipients string // comma separated names of the invited users
+	Game       string
+	Tone       string // how the invitation should sound, defaultTone unless the user chose one
+	Extras     string // additional instructions appended by optional features
+	Persona    string // optional voice to write the invitation in
+}
+
+// parsePromptTemplate parses a prompt template, failing on syntax errors and unknown fields.
+func parsePromptTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("prompt").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	// Render once with sample data so references to unknown fields are caught at startup.
+	if _, err := renderPrompt(tmpl, promptData{Inviter: "Alice", Recipients: "Bob", Game: "Chess", Tone: defaultTone}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// renderPrompt executes the prompt template with the given data.
+func renderPrompt(tmpl *template.Template, data promptData) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
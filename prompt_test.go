@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPromptTemplates(t *testing.T) {
+	data := promptData{Inviter: "Alice Archer", Recipients: "Bob Baker, Carol Cooper", Game: "Catan", Tone: "formal", Extras: "Mention snacks.", Persona: "a pirate"}
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  string
+	}{
+		{
+			name:     "default",
+			template: defaultPromptTemplate,
+			want:     "Generate a friendly invitation message from Alice Archer inviting Bob Baker, Carol Cooper to play a game of Catan. Make it formal. Write it in the voice of a pirate. Mention snacks.",
+		},
+		{
+			name:     "custom",
+			template: "Write {{.Recipients}} a {{.Tone}} note: {{.Inviter}} is playing {{.Game}}.{{with .Persona}} Sound like {{.}}.{{end}}",
+			want:     "Write Bob Baker, Carol Cooper a formal note: Alice Archer is playing Catan. Sound like a pirate.",
+		},
+		{name: "unknown field", template: "Invite {{.Recipients}} to {{.Game}} at {{.Venue}}", wantErr: "can't evaluate field Venue"},
+		{name: "syntax error", template: "Invite {{.Recipients}} to {{.Game}", wantErr: "bad character"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parsePromptTemplate(tt.template)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parsePromptTemplate() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := renderPrompt(tmpl, data)
+			if err != nil || got != tt.want {
+				t.Errorf("renderPrompt() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidPromptTemplateStopsStartup(t *testing.T) {
+	for name, value := range map[string]string{"APP_ENV": "", "INVITE_GENERATOR": "", "SLACK_BOT_TOKEN": "xoxb-1", "GOOGLE_GEMINI_API_KEY": "g-1"} {
+		t.Setenv(name, value)
+	}
+	t.Setenv("PROMPT_TEMPLATE", "Invite {{.Recipients}} at {{.Venue}}")
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "invalid PROMPT_TEMPLATE") {
+		t.Errorf("loadConfig() error = %v, want the template rejected", err)
+	}
+}
+
+func TestExtractTone(t *testing.T) {
+	long := strings.Repeat("very ", 20) + "formal"
+	tests := []struct {
+		text     string
+		wantText string
+		wantTone string
+	}{
+		{text: "Catan", wantText: "Catan"},
+		{text: "Catan, tone: sarcastic", wantText: "Catan", wantTone: "sarcastic"},
+		{text: "Chess; Tone:  formal ", wantText: "Chess", wantTone: "formal"},
+		{text: "tone: like a pirate", wantTone: "like a pirate"},
+		{text: "Catan tone: " + long, wantText: "Catan", wantTone: strings.TrimSpace(long[:maxToneLength])},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			text, tone := extractTone(tt.text)
+			if text != tt.wantText || tone != tt.wantTone {
+				t.Errorf("extractTone(%q) = %q, %q, want %q, %q", tt.text, text, tone, tt.wantText, tt.wantTone)
+			}
+			if len(tone) > maxToneLength {
+				t.Errorf("tone is %d bytes, want at most %d", len(tone), maxToneLength)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// quietHoursKeyPrefix namespaces each user's quiet hours in the shared Store.
+const quietHoursKeyPrefix = "quiet_hours:"
+
+// quietHours is the daily window, in the user's own timezone, during which invitations to them
+// are held back. Start and End are minutes after midnight; End before Start spans midnight.
+type quietHours struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// quietHoursPattern matches a quiet hours range such as "22:00-08:00" or "22:00 - 7:30".
+var quietHoursPattern = regexp.MustCompile(`^(\d{1,2}):(\d{2})\s*-\s*(\d{1,2}):(\d{2})$`)
+
+// parseQuietHours parses a range such as "22:00-08:00" in 24-hour time.
+func parseQuietHours(text string) (quietHours, error) {
+	matches := quietHoursPattern.FindStringSubmatch(strings.TrimSpace(text))
+	if matches == nil {
+		return quietHours{}, errors.New("use 24-hour times like 22:00-08:00")
+	}
+	var minutes [2]int
+	for i := range minutes {
+		hour, _ := strconv.Atoi(matches[1+2*i])
+		minute, _ := strconv.Atoi(matches[2+2*i])
+		if hour > 23 || minute > 59 {
+			return quietHours{}, fmt.Errorf("%s:%s isn't a time of day", matches[1+2*i], matches[2+2*i])
+		}
+		minutes[i] = hour*60 + minute
+	}
+	if minutes[0] == minutes[1] {
+		return quietHours{}, errors.New("they can't start and end at the same time")
+	}
+	return quietHours{Start: minutes[0], End: minutes[1]}, nil
+}
+
+// String formats the quiet hours like parseQuietHours accepts them.
+func (q quietHours) String() string {
+	return formatClock(q.Start) + "-" + formatClock(q.End)
+}
+
+// formatClock formats minutes after midnight as a 24-hour time, such as "08:00".
+func formatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// allowedAt returns t if it falls outside the quiet hours in location, or otherwise when the
+// quiet hours end.
+func (q quietHours) allowedAt(t time.Time, location *time.Location) time.Time {
+	local := t.In(location)
+	minute := local.Hour()*60 + local.Minute()
+	var quiet, endsTomorrow bool
+	if q.Start < q.End {
+		quiet = minute >= q.Start && minute < q.End
+	} else {
+		quiet = minute >= q.Start || minute < q.End
+		endsTomorrow = minute >= q.Start
+	}
+	if !quiet {
+		return t
+	}
+	day := local.Day()
+	if endsTomorrow {
+		day++
+	}
+	return time.Date(local.Year(), local.Month(), day, q.End/60, q.End%60, 0, 0, location)
+}
+
+// quietHoursStore keeps the quiet hours recipients set for themselves, with no expiry. A nil
+// quietHoursStore holds nothing back.
+type quietHoursStore struct {
+	store Store
+	users *userCache // looks up each recipient's Slack timezone
+}
+
+// newQuietHoursStore keeps quiet hours in store.
+func newQuietHoursStore(store Store, users *userCache) *quietHoursStore {
+	return &quietHoursStore{store: store, users: users}
+}
+
+// get returns userID's quiet hours, reporting whether they set any.
+func (s *quietHoursStore) get(userID string) (quietHours, bool, error) {
+	data, ok, err := s.store.Get(quietHoursKeyPrefix + userID)
+	if err != nil || !ok {
+		return quietHours{}, false, err
+	}
+	var hours quietHours
+	if err := json.Unmarshal(data, &hours); err != nil {
+		return quietHours{}, false, fmt.Errorf("decoding the quiet hours of %s: %w", userID, err)
+	}
+	return hours, true, nil
+}
+
+// set replaces userID's quiet hours.
+func (s *quietHoursStore) set(userID string, hours quietHours) error {
+	data, err := json.Marshal(hours)
+	if err != nil {
+		return err
+	}
+	return s.store.Set(quietHoursKeyPrefix+userID, data, 0)
+}
+
+// clear removes userID's quiet hours, reporting whether they had any.
+func (s *quietHoursStore) clear(userID string) (bool, error) {
+	return s.store.Delete(quietHoursKeyPrefix + userID)
+}
+
+// location returns userID's Slack timezone, UTC if it isn't known.
+func (s *quietHoursStore) location(userID string) *time.Location {
+	if user, ok := s.users.lookup(userID); ok && user.TZ != "" {
+		if location, err := time.LoadLocation(user.TZ); err == nil {
+			return location
+		}
+	}
+	return time.UTC
+}
+
+// sendTime returns when an invitation meant to reach userID at at should go out instead,
+// reporting whether it is held back by their quiet hours. Errors loading the quiet hours don't
+// hold anything back.
+func (s *quietHoursStore) sendTime(userID string, at time.Time) (time.Time, bool) {
+	if s == nil {
+		return at, false
+	}
+	hours, ok, err := s.get(userID)
+	if err != nil {
+		logger.Error("Error loading quiet hours", "user_id", userID, "error", err)
+		return at, false
+	}
+	if !ok {
+		return at, false
+	}
+	allowed := hours.allowedAt(at, s.location(userID))
+	return allowed, allowed.After(at)
+}
+
+// quietCommandPattern matches the DM command setting, showing or clearing quiet hours. It is
+// checked before the conversation is, so only the exact forms match, and a game answer such
+// as "quiet place" still reaches the conversation.
+var quietCommandPattern = regexp.MustCompile(`(?i)^quiet(?:\s+(off|\d{1,2}:\d{2}\s*-\s*\d{1,2}:\d{2}))?$`)
+
+// quietHoursCommand answers a "quiet" DM from userID, reporting whether text was one:
+// "quiet 22:00-08:00" sets their quiet hours, "quiet off" clears them and "quiet" shows them.
+func (h *SlackBotHandler) quietHoursCommand(userID, text string) (string, bool) {
+	matches := quietCommandPattern.FindStringSubmatch(strings.TrimSpace(text))
+	if matches == nil {
+		return "", false
+	}
+	argument := strings.TrimSpace(matches[1])
+	switch strings.ToLower(argument) {
+	case "":
+		hours, ok, err := h.quietHours.get(userID)
+		if err != nil {
+			logger.Error("Error loading quiet hours", "event_type", "message", "user_id", userID, "error", err)
+			return "Sorry, I couldn't load your quiet hours. Please try again shortly.", true
+		}
+		if !ok {
+			return "You haven't set quiet hours. Say something like \"quiet 22:00-08:00\" to have invitations held until they end.", true
+		}
+		return fmt.Sprintf("Your quiet hours are %s (%s). Say \"quiet off\" to turn them off.", hours, h.quietHours.location(userID)), true
+	case "off":
+		if _, err := h.quietHours.clear(userID); err != nil {
+			logger.Error("Error clearing quiet hours", "event_type", "message", "user_id", userID, "error", err)
+			return "Sorry, I couldn't turn off your quiet hours. Please try again shortly.", true
+		}
+		logger.Info("Quiet hours cleared", "event_type", "message", "user_id", userID)
+		return "Okay, your quiet hours are off. Invitations will reach you right away.", true
+	}
+	hours, err := parseQuietHours(argument)
+	if err != nil {
+		return fmt.Sprintf("Sorry, I couldn't set those quiet hours: %s. Say something like \"quiet 22:00-08:00\".", err), true
+	}
+	if err := h.quietHours.set(userID, hours); err != nil {
+		logger.Error("Error saving quiet hours", "event_type", "message", "user_id", userID, "error", err)
+		return "Sorry, I couldn't save your quiet hours. Please try again shortly.", true
+	}
+	logger.Info("Quiet hours set", "event_type", "message", "user_id", userID, "quiet_hours", hours.String())
+	end := formatClock(hours.End)
+	return fmt.Sprintf("Got it. Invitations that would reach you between %s and %s (%s) will wait until %s. Say \"quiet off\" to turn this off.",
+		formatClock(hours.Start), end, h.quietHours.location(userID), end), true
+}
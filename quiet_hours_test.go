@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    quietHours
+		wantErr string
+	}{
+		{text: "22:00-08:00", want: quietHours{Start: 22 * 60, End: 8 * 60}},
+		{text: " 9:30 - 17:45 ", want: quietHours{Start: 9*60 + 30, End: 17*60 + 45}},
+		{text: "10pm-8am", wantErr: "use 24-hour times"},
+		{text: "22:00-24:00", wantErr: "24:00 isn't a time of day"},
+		{text: "08:00-08:00", wantErr: "can't start and end at the same time"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := parseQuietHours(tt.text)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseQuietHours(%q) = %v, %v, want an error containing %q", tt.text, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("parseQuietHours(%q) = %v, %v, want %v", tt.text, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuietHoursAllowedAt(t *testing.T) {
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Skip("no timezone data:", err)
+	}
+	overnight := quietHours{Start: 22 * 60, End: 8 * 60}
+	tests := []struct {
+		name  string
+		hours quietHours
+		at    time.Time
+		want  time.Time
+	}{
+		{
+			name:  "outside quiet hours",
+			hours: overnight,
+			at:    time.Date(2026, 3, 2, 12, 0, 0, 0, chicago),
+			want:  time.Date(2026, 3, 2, 12, 0, 0, 0, chicago),
+		},
+		{
+			name:  "before midnight waits for the next morning",
+			hours: overnight,
+			at:    time.Date(2026, 3, 2, 23, 15, 0, 0, chicago),
+			want:  time.Date(2026, 3, 3, 8, 0, 0, 0, chicago),
+		},
+		{
+			name:  "after midnight waits for the same morning",
+			hours: overnight,
+			at:    time.Date(2026, 3, 3, 6, 0, 0, 0, chicago),
+			want:  time.Date(2026, 3, 3, 8, 0, 0, 0, chicago),
+		},
+		{
+			name:  "end of the month",
+			hours: overnight,
+			at:    time.Date(2026, 3, 31, 22, 0, 0, 0, chicago),
+			want:  time.Date(2026, 4, 1, 8, 0, 0, 0, chicago),
+		},
+		{
+			name:  "within a day",
+			hours: quietHours{Start: 13 * 60, End: 14*60 + 30},
+			at:    time.Date(2026, 3, 2, 13, 5, 0, 0, chicago),
+			want:  time.Date(2026, 3, 2, 14, 30, 0, 0, chicago),
+		},
+		{
+			name:  "the end itself is allowed",
+			hours: overnight,
+			at:    time.Date(2026, 3, 3, 8, 0, 0, 0, chicago),
+			want:  time.Date(2026, 3, 3, 8, 0, 0, 0, chicago),
+		},
+		{
+			name:  "in the recipient's timezone",
+			hours: overnight,
+			at:    time.Date(2026, 3, 3, 5, 0, 0, 0, time.UTC), // 23:00 in Chicago
+			want:  time.Date(2026, 3, 3, 8, 0, 0, 0, chicago),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hours.allowedAt(tt.at, chicago); !got.Equal(tt.want) {
+				t.Errorf("allowedAt(%s) = %s, want %s", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuietHoursCommand(t *testing.T) {
+	tests := []struct {
+		name      string
+		messages  []string
+		wantReply string // the bot's last reply
+		wantHours string // the quiet hours saved afterwards, "" for none
+	}{
+		{name: "none set", messages: []string{"quiet"}, wantReply: "You haven't set quiet hours."},
+		{name: "set", messages: []string{"Quiet 22:00-08:00"}, wantReply: "will wait until 08:00", wantHours: "22:00-08:00"},
+		{name: "show", messages: []string{"quiet 22:00-7:30", "quiet"}, wantReply: "Your quiet hours are 22:00-07:30 (UTC).", wantHours: "22:00-07:30"},
+		{name: "bad time", messages: []string{"quiet 22:00-25:00"}, wantReply: "25:00 isn't a time of day"},
+		{name: "off", messages: []string{"quiet 22:00-08:00", "quiet off"}, wantReply: "your quiet hours are off"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			h, _ := newTestBotHandler(t, fake, testConfig(), &fakeGenerator{invitation: "Come play!"})
+			for _, message := range tt.messages {
+				h.processEvent(directMessage("U2", message))
+			}
+
+			replies := fake.postsTo("DU2")
+			if len(replies) != len(tt.messages) || !strings.Contains(replies[len(replies)-1], tt.wantReply) {
+				t.Fatalf("replies = %q, want the last to contain %q", replies, tt.wantReply)
+			}
+			hours, ok, err := h.quietHours.get("U2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := map[bool]string{true: hours.String()}[ok]; got != tt.wantHours {
+				t.Errorf("saved quiet hours = %q, want %q", got, tt.wantHours)
+			}
+		})
+	}
+}
+
+func TestGameNamesStartingWithQuiet(t *testing.T) {
+	fake := newFakeSlack(t, testUsers...)
+	h, _ := newTestBotHandler(t, fake, testConfig(), &fakeGenerator{invitation: "Come play!"})
+	for _, message := range []string{"hi", "bob", "Quiet Place"} {
+		h.processEvent(directMessage("U1", message))
+	}
+
+	if got := fake.postsTo("U2"); len(got) != 1 {
+		t.Errorf("Bob got %q, want the invitation", got)
+	}
+	if replies := fake.postsTo("DU1"); len(replies) == 0 || !strings.Contains(replies[len(replies)-1], "Quiet Place") {
+		t.Errorf("replies = %q, want the last to sum up the Quiet Place invitation", replies)
+	}
+	if _, ok, err := h.quietHours.get("U1"); err != nil || ok {
+		t.Errorf("quiet hours saved for the inviter (%v, %v), want none", ok, err)
+	}
+}
+
+func TestQuietHoursHoldInvitations(t *testing.T) {
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Skip("no timezone data:", err)
+	}
+	users := append([]slack.User(nil), testUsers...)
+	users[1].TZ = "America/Chicago"
+	// Quiet hours from an hour ago to an hour from now hold Bob's invitation; ones starting in
+	// an hour don't.
+	now := time.Now().In(chicago)
+	minute := now.Hour()*60 + now.Minute()
+	quietNow := quietHours{Start: (minute + 24*60 - 60) % (24 * 60), End: (minute + 60) % (24 * 60)}
+	quietLater := quietHours{Start: (minute + 60) % (24 * 60), End: (minute + 120) % (24 * 60)}
+
+	tests := []struct {
+		name      string
+		hours     *quietHours // Bob's quiet hours, nil for none
+		wantHeld  bool
+		wantReply string // for the bot: what the inviter is told
+	}{
+		{name: "in quiet hours", hours: &quietNow, wantHeld: true, wantReply: "<@U2> will get the invitation when their quiet hours end."},
+		{name: "outside quiet hours", hours: &quietLater},
+		{name: "no quiet hours"},
+	}
+	for _, tt := range tests {
+		for _, flow := range []string{"api", "bot"} {
+			t.Run(tt.name+"/"+flow, func(t *testing.T) {
+				fake := newFakeSlack(t, users...)
+				var quiet *quietHoursStore
+				var replies func() []string
+				var send func()
+				if flow == "api" {
+					h, _ := newTestInviteHandler(t, fake, testConfig())
+					quiet = h.quietHours
+					send = func() {
+						status, response := h.sendInvite(InviteRequest{GameName: "Catan", UserIDs: []string{"U2", "U3"}, InviterID: "U1", Description: "Come play"})
+						if status != 200 {
+							t.Fatalf("sendInvite = %d %v", status, response)
+						}
+						scheduled, _ := response["scheduled"].([]ScheduledInvite)
+						if tt.wantHeld != (len(scheduled) == 1 && scheduled[0].Target == "U2" && scheduled[0].DeferredUntil != "") {
+							t.Errorf("scheduled = %+v, want Bob's held: %v", scheduled, tt.wantHeld)
+						}
+					}
+					replies = func() []string { return nil }
+				} else {
+					h, _ := newTestBotHandler(t, fake, testConfig(), &fakeGenerator{invitation: "Come play!"})
+					quiet = h.quietHours
+					send = func() {
+						h.processEvent(directMessage("U1", "hi"))
+						h.processEvent(directMessage("U1", "bob, carol"))
+						h.processEvent(directMessage("U1", "Catan"))
+					}
+					replies = func() []string { return fake.postsTo("DU1") }
+				}
+				if tt.hours != nil {
+					if err := quiet.set("U2", *tt.hours); err != nil {
+						t.Fatal(err)
+					}
+				}
+				send()
+
+				if got := len(fake.postsTo("U3")); got != 1 {
+					t.Errorf("Carol got %d invitations right away, want 1", got)
+				}
+				wantPosted := 1
+				if tt.wantHeld {
+					wantPosted = 0
+				}
+				if got := len(fake.postsTo("U2")); got != wantPosted {
+					t.Errorf("Bob got %d invitations right away, want %d", got, wantPosted)
+				}
+				scheduled := fake.allScheduled()
+				if !tt.wantHeld {
+					if len(scheduled) != 0 {
+						t.Errorf("scheduled %+v, want nothing", scheduled)
+					}
+					return
+				}
+				want := quietNow.allowedAt(time.Now(), chicago).Unix()
+				if len(scheduled) != 1 || scheduled[0].Channel != "DU2" || scheduled[0].PostAt != want {
+					t.Errorf("scheduled %+v, want Bob's invitation at %d", scheduled, want)
+				}
+				if got := replies(); tt.wantReply != "" && flow == "bot" && (len(got) == 0 || !strings.Contains(got[len(got)-1], tt.wantReply)) {
+					t.Errorf("replies = %q, want the last to contain %q", got, tt.wantReply)
+				}
+			})
+		}
+	}
+}
+
+func TestQuietHoursInvitationsListTheirMissingFiles(t *testing.T) {
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Skip("no timezone data:", err)
+	}
+	users := append([]slack.User(nil), testUsers...)
+	users[1].TZ = "America/Chicago"
+	now := time.Now().In(chicago)
+	minute := now.Hour()*60 + now.Minute()
+	quietNow := quietHours{Start: (minute + 24*60 - 60) % (24 * 60), End: (minute + 60) % (24 * 60)}
+
+	fake := newFakeSlack(t, users...)
+	h, _ := newTestInviteHandler(t, fake, testConfig())
+	if err := h.quietHours.set("U2", quietNow); err != nil {
+		t.Fatal(err)
+	}
+	rules := base64.StdEncoding.EncodeToString([]byte("Build roads. Trade sheep."))
+	status, response := h.sendInvite(InviteRequest{
+		GameName:    "Catan",
+		UserIDs:     []string{"U2", "U3"},
+		Description: "Come play",
+		GameTime:    time.Now().Add(48 * time.Hour).Format(time.RFC3339),
+		Attachment:  &InviteAttachment{Filename: "rules.txt", Title: "Catan rules", Content: rules},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("sendInvite = %d %v, want 200", status, response)
+	}
+
+	// Carol gets both files; Bob's held invitation can't carry them, and the response says so.
+	var channels []string
+	for _, upload := range fake.allUploads() {
+		channels = append(channels, upload.Channel)
+	}
+	if got := strings.Join(channels, ","); got != "U3,U3" {
+		t.Errorf("files shared in %q, want both in Carol's DM only", got)
+	}
+	missing, _ := response["files_not_delivered"].([]UndeliveredFiles)
+	want := []string{"Catan rules", "Catan calendar invite"}
+	if len(missing) != 1 || missing[0].UserID != "U2" || strings.Join(missing[0].Files, ",") != strings.Join(want, ",") || !strings.Contains(missing[0].Reason, "quiet hours") {
+		t.Errorf("files_not_delivered = %+v, want Bob missing %q", missing, want)
+	}
+}
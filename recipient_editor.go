@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// IDs of the "Edit recipients" button and the modal it opens.
+const (
+	actionEditRecipients     = "edit_recipients"
+	editRecipientsCallbackID = "edit_recipients"
+	editRecipientsBlockID    = "recipients"
+	editRecipientsActionID   = "recipients_input"
+)
+
+// editRecipientsPrompt is the private metadata of the edit recipients modal: where the
+// conversation it edits is answered.
+type editRecipientsPrompt struct {
+	Channel  string `json:"channel"`
+	ThreadTS string `json:"thread_ts,omitempty"`
+}
+
+// editingRecipients reports whether the conversation is past matching the recipients and still
+// choosing the game, where the recipients can be edited.
+func editingRecipients(state *ConversationState) bool {
+	return state.Step == "awaiting_game" || state.Step == "confirming_game"
+}
+
+// sendRecipientsMessage posts text, which lists the matched recipients, with an "Edit
+// recipients" button. The button carries the inviter's user ID, so only they can use it.
+func (h *SlackBotHandler) sendRecipientsMessage(channel, threadTS, inviterID, text string) {
+	options := []slack.MsgOption{
+		slack.MsgOptionText(text, false),
+		slack.MsgOptionBlocks(
+			slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", text, false, false), nil, nil),
+			slack.NewActionBlock("recipient_actions",
+				slack.NewButtonBlockElement(actionEditRecipients, inviterID, slack.NewTextBlockObject("plain_text", "Edit recipients", false, false)),
+			),
+		),
+	}
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	if _, _, err := h.sender.post(channel, options...); err != nil {
+		logger.Error("Failed to send message", "channel", channel, "error", err)
+	}
+}
+
+// editRecipients handles the "Edit recipients" button by opening a modal with the matched
+// recipients pre-selected.
+func (h *SlackBotHandler) editRecipients(callback *slack.InteractionCallback, action *slack.BlockAction) {
+	userID := callback.User.ID
+	channelID := callback.Channel.ID
+	if channelID == "" {
+		channelID = callback.Container.ChannelID
+	}
+	notice := ""
+	state, exists, err := h.conversationStates.Get(userID)
+	switch {
+	case action.Value != userID:
+		notice = "Only the person sending this invitation can edit its recipients."
+	case err != nil:
+		logger.Error("Error loading conversation state", "event_type", callback.Type, "user_id", userID, "error", err)
+		notice = h.reply("conversation.load_failed", replyData{})
+	case !exists || h.conversationExpired(state) || !editingRecipients(state):
+		notice = h.reply("names.edit_expired", replyData{})
+	}
+	if notice != "" {
+		if _, err := h.slackClient.PostEphemeral(channelID, userID, slack.MsgOptionText(notice, false)); err != nil {
+			logger.Error("Failed to reply about editing recipients", "event_type", callback.Type, "user_id", userID, "error", h.sender.scopes.explain(methodPostEphemeral, err))
+		}
+		return
+	}
+
+	metadata, err := json.Marshal(editRecipientsPrompt{Channel: channelID, ThreadTS: callback.Container.ThreadTs})
+	if err != nil {
+		// Marshalling strings can't fail.
+		panic(err)
+	}
+	selectUsers := slack.NewOptionsMultiSelectBlockElement(slack.MultiOptTypeUser, slack.NewTextBlockObject("plain_text", "Choose people", false, false), editRecipientsActionID)
+	selectUsers.InitialUsers = state.RecipientUserIDs
+	if h.config.MaxNamesPerInvite > 0 {
+		selectUsers.MaxSelectedItems = &h.config.MaxNamesPerInvite
+	}
+	modal := slack.ModalViewRequest{
+		Type:            slack.VTModal,
+		CallbackID:      editRecipientsCallbackID,
+		Title:           slack.NewTextBlockObject("plain_text", "Edit recipients", false, false),
+		Submit:          slack.NewTextBlockObject("plain_text", "Save", false, false),
+		Close:           slack.NewTextBlockObject("plain_text", "Cancel", false, false),
+		PrivateMetadata: string(metadata),
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			slack.NewInputBlock(editRecipientsBlockID, slack.NewTextBlockObject("plain_text", "Who do you want to invite?", false, false), nil, selectUsers),
+		}},
+	}
+	if _, err := h.slackClient.OpenView(callback.TriggerID, modal); err != nil {
+		logger.Error("Failed to open the recipients editor", "event_type", callback.Type, "user_id", userID, "error", err)
+	}
+}
+
+// submitRecipients handles the edit recipients modal. The choice is checked right away, so
+// problems are shown in the modal; the conversation is then updated on the user's event queue,
+// after any message they sent before submitting.
+func (h *SlackBotHandler) submitRecipients(callback *slack.InteractionCallback) *slack.ViewSubmissionResponse {
+	userID := callback.User.ID
+	var prompt editRecipientsPrompt
+	if err := json.Unmarshal([]byte(callback.View.PrivateMetadata), &prompt); err != nil {
+		logger.Info("Ignoring recipients with unusable metadata", "event_type", callback.Type, "user_id", userID, "error", err)
+		return nil
+	}
+	selected := callback.View.State.Values[editRecipientsBlockID][editRecipientsActionID].SelectedUsers
+
+	var ids, names, problems []string
+	seen := make(map[string]bool, len(selected))
+	for _, id := range selected {
+		if (id == userID && !h.config.AllowSelfInvite) || seen[id] {
+			continue
+		}
+		seen[id] = true
+		user, ok := h.userCache.lookup(id)
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("I couldn't find <@%s>.", id))
+		case !isInvitable(user):
+			problems = append(problems, uninvitableReason(user))
+		default:
+			ids = append(ids, user.ID)
+			names = append(names, user.RealName)
+		}
+	}
+	switch {
+	case len(problems) > 0:
+		return slack.NewErrorsViewSubmissionResponse(map[string]string{editRecipientsBlockID: strings.Join(problems, " ")})
+	case len(ids) == 0:
+		return slack.NewErrorsViewSubmissionResponse(map[string]string{editRecipientsBlockID: "Choose at least one person other than yourself."})
+	case h.config.MaxNamesPerInvite > 0 && len(ids) > h.config.MaxNamesPerInvite:
+		return slack.NewErrorsViewSubmissionResponse(map[string]string{editRecipientsBlockID: fmt.Sprintf("You can invite at most %d people at once.", h.config.MaxNamesPerInvite)})
+	}
+
+	h.processing.Add(1)
+	h.queues.enqueue(userID, func() {
+		defer h.processing.Done()
+		h.applyRecipients(userID, prompt, ids, names)
+	})
+	return nil
+}
+
+// applyRecipients replaces the recipients of userID's conversation with the ones chosen in the
+// edit recipients modal and tells the user.
+func (h *SlackBotHandler) applyRecipients(userID string, prompt editRecipientsPrompt, ids, names []string) {
+	eventLog := logger.With("event_type", "view_submission", "user_id", userID, "channel", prompt.Channel)
+	state, exists, err := h.conversationStates.Get(userID)
+	if err != nil {
+		eventLog.Error("Error loading conversation state", "error", err)
+		h.sendMessage(prompt.Channel, prompt.ThreadTS, h.reply("conversation.load_failed", replyData{}))
+		return
+	}
+	if !exists || h.conversationExpired(state) || !editingRecipients(state) {
+		eventLog.Info("Ignoring edited recipients for a conversation that has moved on")
+		h.sendMessage(prompt.Channel, prompt.ThreadTS, h.reply("names.edit_expired", replyData{}))
+		return
+	}
+	state.RecipientUserIDs = ids
+	state.RecipientUserNames = names
+	if err := h.setConversation(userID, state); err != nil {
+		eventLog.Error("Error saving conversation state", "step", state.Step, "error", err)
+		h.sendMessage(prompt.Channel, prompt.ThreadTS, h.reply("names.save_failed", replyData{}))
+		return
+	}
+	eventLog.Info("Recipients edited", "step", state.Step, "recipients", len(ids))
+	replyKey := "names.edited"
+	if state.Step == "confirming_game" {
+		replyKey = "names.edited_confirm"
+	}
+	reply := h.reply(replyKey, replyData{Recipients: strings.Join(names, ", "), Game: state.PendingGame})
+	h.sendRecipientsMessage(prompt.Channel, prompt.ThreadTS, userID, reply)
+}
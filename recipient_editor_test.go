@@ -0,0 +1,130 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/slack-go/slack"
+)
+
+func TestEditRecipients(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	users := append(append([]slack.User(nil), testUsers...), slack.User{ID: "U4", Name: "dave", RealName: "Dave Dunn", Deleted: true})
+	tests := []struct {
+		name        string
+		clickerID   string   // who clicks Edit recipients
+		selected    []string // submitted in the modal
+		cancelFirst bool     // the conversation is cancelled before submitting
+		wantViews   int
+		wantError   string // inline error in the modal
+		wantReply   string // the last reply in the conversation
+		wantInvited []string
+	}{
+		{
+			name:        "replacing a recipient",
+			clickerID:   "U1",
+			selected:    []string{"U3"},
+			wantViews:   1,
+			wantReply:   "Updated recipients: Carol Cooper.\nWhat game do you want to invite them to?",
+			wantInvited: []string{"U3"},
+		},
+		{
+			name:        "adding a recipient, ignoring the inviter",
+			clickerID:   "U1",
+			selected:    []string{"U2", "U1", "U3"},
+			wantViews:   1,
+			wantReply:   "Updated recipients: Bob Baker, Carol Cooper.\nWhat game do you want to invite them to?",
+			wantInvited: []string{"U2", "U3"},
+		},
+		{
+			name:        "a deactivated account is rejected in the modal",
+			clickerID:   "U1",
+			selected:    []string{"U2", "U4"},
+			wantViews:   1,
+			wantError:   "Dave Dunn is a deactivated account and can't be invited.",
+			wantInvited: []string{"U2"},
+		},
+		{
+			name:        "nobody but the inviter",
+			clickerID:   "U1",
+			selected:    []string{"U1"},
+			wantViews:   1,
+			wantError:   "Choose at least one person other than yourself.",
+			wantInvited: []string{"U2"},
+		},
+		{
+			name:        "the conversation ended meanwhile",
+			clickerID:   "U1",
+			selected:    []string{"U3"},
+			cancelFirst: true,
+			wantViews:   1,
+			wantReply:   "That invitation has already been sent or cancelled. Message me whenever you want to invite people.",
+		},
+		{
+			name:        "only the inviter can edit",
+			clickerID:   "U3",
+			wantInvited: []string{"U2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, users...)
+			bot, _ := newTestBotHandler(t, fake, testConfig(), &fakeGenerator{invitation: "Come play!"})
+			interactions := newTestInteractionHandler(t, fake, 0)
+			interactions.handle(actionEditRecipients, bot.editRecipients)
+			interactions.handleSubmission(editRecipientsCallbackID, bot.submitRecipients)
+
+			bot.processEvent(directMessage("U1", "hi"))
+			bot.processEvent(directMessage("U1", "bob"))
+			posts := fake.allPosts()
+			if matched := posts[len(posts)-1]; !strings.Contains(matched.Blocks, actionEditRecipients) {
+				t.Fatalf("matched recipients message lacks the edit button: %s", matched.Blocks)
+			}
+
+			callback := &slack.InteractionCallback{Type: slack.InteractionTypeBlockActions, User: slack.User{ID: tt.clickerID}, TriggerID: "trigger", Container: slack.Container{ChannelID: "DU1"}}
+			interactions.router.dispatch(callback, &slack.BlockAction{ActionID: actionEditRecipients, Value: "U1"})
+			views := fake.allViews()
+			if len(views) != tt.wantViews {
+				t.Fatalf("opened %d modals, want %d", len(views), tt.wantViews)
+			}
+			if tt.wantViews == 0 {
+				if replies := fake.ephemeralsFor(tt.clickerID); len(replies) != 1 || !strings.Contains(replies[0], "Only the person sending") {
+					t.Errorf("replies to %s = %q, want a refusal", tt.clickerID, replies)
+				}
+			} else {
+				selectUsers := views[0].Blocks.BlockSet[0].(*slack.InputBlock).Element.(*slack.MultiSelectBlockElement)
+				if strings.Join(selectUsers.InitialUsers, ",") != "U2" {
+					t.Errorf("modal pre-selects %q, want the matched U2", selectUsers.InitialUsers)
+				}
+				if tt.cancelFirst {
+					bot.processEvent(directMessage("U1", "cancel"))
+				}
+				response := submitView(t, interactions, "U1", views[0], map[string]map[string]slack.BlockAction{
+					editRecipientsBlockID: {editRecipientsActionID: {SelectedUsers: tt.selected}},
+				})
+				bot.processing.Wait()
+				gotError := ""
+				if response != nil {
+					gotError = response.Errors[editRecipientsBlockID]
+				}
+				if gotError != tt.wantError {
+					t.Errorf("modal error = %q, want %q", gotError, tt.wantError)
+				}
+				if tt.wantReply != "" {
+					if replies := fake.postsTo("DU1"); replies[len(replies)-1] != tt.wantReply {
+						t.Errorf("last reply = %q, want %q", replies[len(replies)-1], tt.wantReply)
+					}
+				}
+			}
+
+			bot.processEvent(directMessage("U1", "Catan"))
+			for _, user := range users[1:] {
+				invited := len(fake.postsTo(user.ID)) > 0
+				if want := strings.Contains(strings.Join(tt.wantInvited, ","), user.ID); invited != want {
+					t.Errorf("%s invited = %v, want %v", user.ID, invited, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/slack-go/slack"
+)
+
+// RecipientList is a named group of users that can be invited together, e.g. "D&D crew".
+type RecipientList struct {
+	Name      string   `json:"name"`
+	MemberIDs []string `json:"member_ids" binding:"required"`
+}
+
+// recipientListKeyPrefix namespaces saved lists in the shared Store.
+const recipientListKeyPrefix = "list:"
+
+// regularsListName names the default recipient list configured with REGULARS.
+const regularsListName = "regulars"
+
+// errReservedListName is returned when changing the configured regulars list through the API.
+var errReservedListName = errors.New("the regulars list is configured with REGULARS and can't be changed here")
+
+// recipientListStore keeps saved recipient lists in the shared Store as JSON, keyed by
+// lower-cased name. When regulars are configured they form a read-only list named "regulars".
+type recipientListStore struct {
+	store    Store
+	regulars []string
+}
+
+// newRecipientListStore keeps saved lists in store, alongside the configured regulars.
+func newRecipientListStore(store Store, regulars []string) *recipientListStore {
+	return &recipientListStore{store: store, regulars: regulars}
+}
+
+// isRegulars reports whether name refers to the configured regulars list.
+func (s *recipientListStore) isRegulars(name string) bool {
+	return len(s.regulars) > 0 && listKey(name) == listKey(regularsListName)
+}
+
+// validateRegulars checks that every configured regular is an invitable workspace user.
+func validateRegulars(regulars []string, users []slack.User) error {
+	invitable := make(map[string]bool, len(users))
+	for _, u := range users {
+		invitable[u.ID] = isInvitable(u)
+	}
+	var invalid []string
+	for _, id := range regulars {
+		if !invitable[id] {
+			invalid = append(invalid, id)
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("not invitable workspace users: %s", strings.Join(invalid, ", "))
+	}
+	return nil
+}
+
+// listKey returns the store key for a list name, ignoring case and surrounding space.
+func listKey(name string) string {
+	return recipientListKeyPrefix + strings.ToLower(strings.TrimSpace(name))
+}
+
+// get returns the list with the given name, ignoring case.
+func (s *recipientListStore) get(name string) (RecipientList, bool, error) {
+	if s.isRegulars(name) {
+		return RecipientList{Name: regularsListName, MemberIDs: s.regulars}, true, nil
+	}
+	data, ok, err := s.store.Get(listKey(name))
+	if err != nil || !ok {
+		return RecipientList{}, false, err
+	}
+	var list RecipientList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return RecipientList{}, false, fmt.Errorf("decoding recipient list %q: %w", name, err)
+	}
+	return list, true, nil
+}
+
+// put creates or replaces a list.
+func (s *recipientListStore) put(list RecipientList) error {
+	if s.isRegulars(list.Name) {
+		return errReservedListName
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	return s.store.Set(listKey(list.Name), data, 0)
+}
+
+// delete removes a list, reporting whether it existed.
+func (s *recipientListStore) delete(name string) (bool, error) {
+	if s.isRegulars(name) {
+		return false, errReservedListName
+	}
+	return s.store.Delete(listKey(name))
+}
+
+// all returns every list sorted by name.
+func (s *recipientListStore) all() ([]RecipientList, error) {
+	keys, err := s.store.Keys(recipientListKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	lists := make([]RecipientList, 0, len(keys)+1)
+	if len(s.regulars) > 0 {
+		lists = append(lists, RecipientList{Name: regularsListName, MemberIDs: s.regulars})
+	}
+	for _, key := range keys {
+		name := strings.TrimPrefix(key, recipientListKeyPrefix)
+		if s.isRegulars(name) {
+			// Shadowed by the configured regulars.
+			continue
+		}
+		list, ok, err := s.get(name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			lists = append(lists, list)
+		}
+	}
+	sort.Slice(lists, func(i, j int) bool { return lists[i].Name < lists[j].Name })
+	return lists, nil
+}
+
+// expandRecipientLists replaces inputs naming a saved list with the list's members. It returns the
+// inputs that are not list names, the invitable members of the named lists, and notes about
+// members that were skipped because they have left the workspace.
+func expandRecipientLists(inputs []string, lists *recipientListStore, users []slack.User) ([]string, []slack.User, []string) {
+	byID := make(map[string]slack.User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+
+	var remaining []string
+	var members []slack.User
+	var notes []string
+	for _, input := range inputs {
+		list, ok, err := lists.get(strings.TrimPrefix(strings.ToLower(input), "the "))
+		if err != nil {
+			// Fall back to matching the input as a name rather than failing the whole invite.
+			logger.Error("Error looking up recipient list", "error", err)
+			logger.Debug("Recipient list lookup failed for input", "input", input)
+		}
+		if !ok {
+			remaining = append(remaining, input)
+			continue
+		}
+		logger.Info("Expanding recipient list", "list", list.Name, "members", len(list.MemberIDs))
+		skipped := 0
+		for _, id := range list.MemberIDs {
+			user, found := byID[id]
+			if !found || !isInvitable(user) {
+				skipped++
+				continue
+			}
+			members = append(members, user)
+		}
+		if skipped > 0 {
+			notes = append(notes, fmt.Sprintf("Skipped %d member(s) of %s who are no longer in the workspace.", skipped, list.Name))
+		}
+	}
+	return remaining, members, notes
+}
+
+// RecipientListHandler serves the CRUD endpoints for saved recipient lists.
+type RecipientListHandler struct {
+	lists     *recipientListStore
+	userCache *userCache
+}
+
+// NewRecipientListHandler creates a new RecipientListHandler.
+func NewRecipientListHandler(lists *recipientListStore, userCache *userCache) *RecipientListHandler {
+	return &RecipientListHandler{
+		lists:     lists,
+		userCache: userCache,
+	}
+}
+
+// ListLists returns every saved list.
+func (h *RecipientListHandler) ListLists(c *gin.Context) {
+	lists, err := h.lists.all()
+	if err != nil {
+		logger.Error("Error listing recipient lists", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load recipient lists: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"lists": lists})
+}
+
+// GetList returns a single saved list.
+func (h *RecipientListHandler) GetList(c *gin.Context) {
+	list, ok, err := h.lists.get(c.Param("name"))
+	if err != nil {
+		logger.Error("Error loading recipient list", "list", c.Param("name"), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load recipient list: " + err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No recipient list named " + c.Param("name")})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// PutList creates or replaces a saved list. Every member must be an invitable workspace user.
+func (h *RecipientListHandler) PutList(c *gin.Context) {
+	var list RecipientList
+	if err := c.ShouldBindJSON(&list); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	list.Name = strings.TrimSpace(c.Param("name"))
+	if list.Name == "" || strings.Contains(list.Name, ",") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "List names must be non-empty and can't contain commas"})
+		return
+	}
+	list.MemberIDs = dedupeIDs(list.MemberIDs)
+	if len(list.MemberIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A recipient list needs at least one member"})
+		return
+	}
+
+	users, err := h.userCache.getCachedUsers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users: " + err.Error()})
+		return
+	}
+	invitable := make(map[string]bool, len(users))
+	for _, u := range users {
+		invitable[u.ID] = isInvitable(u)
+	}
+	var invalid []string
+	for _, id := range list.MemberIDs {
+		if !invitable[id] {
+			invalid = append(invalid, id)
+		}
+	}
+	if len(invalid) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Some members are not invitable workspace users",
+			"details": invalid,
+		})
+		return
+	}
+
+	if err := h.lists.put(list); errors.Is(err, errReservedListName) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		logger.Error("Error saving recipient list", "list", list.Name, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save recipient list: " + err.Error()})
+		return
+	}
+	logger.Info("Saved recipient list", "list", list.Name, "members", len(list.MemberIDs))
+	c.JSON(http.StatusOK, list)
+}
+
+// DeleteList removes a saved list.
+func (h *RecipientListHandler) DeleteList(c *gin.Context) {
+	deleted, err := h.lists.delete(c.Param("name"))
+	if errors.Is(err, errReservedListName) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		logger.Error("Error deleting recipient list", "list", c.Param("name"), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete recipient list: " + err.Error()})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No recipient list named " + c.Param("name")})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Recipient list deleted"})
+}
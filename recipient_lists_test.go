@@ -0,0 +1,168 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/slack-go/slack"
+)
+
+func TestPutRecipientList(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	users := append(append([]slack.User(nil), testUsers...),
+		slack.User{ID: "U8", Name: "gone", Deleted: true},
+		slack.User{ID: "U9", Name: "otherbot", IsBot: true},
+	)
+	tests := []struct {
+		name     string
+		list     string
+		body     string
+		wantCode int
+		wantIDs  []string // the members saved
+	}{
+		{name: "saved without duplicates", list: "D&D crew", body: `{"member_ids":["U2","U3","U2"]}`, wantCode: http.StatusOK, wantIDs: []string{"U2", "U3"}},
+		{name: "name with a comma", list: "bob,carol", body: `{"member_ids":["U2"]}`, wantCode: http.StatusBadRequest},
+		{name: "no members", list: "empty", body: `{"member_ids":[]}`, wantCode: http.StatusBadRequest},
+		{name: "deactivated member", list: "D&D crew", body: `{"member_ids":["U2","U8"]}`, wantCode: http.StatusBadRequest},
+		{name: "bot member", list: "D&D crew", body: `{"member_ids":["U9"]}`, wantCode: http.StatusBadRequest},
+		{name: "the configured regulars", list: "Regulars", body: `{"member_ids":["U2"]}`, wantCode: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, users...)
+			lists := newRecipientListStore(NewInMemoryStore(), []string{"U3"})
+			r := gin.New()
+			h := NewRecipientListHandler(lists, newUserCache(fake.client(), time.Minute))
+			r.PUT("/lists/:name", h.PutList)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/lists/"+strings.ReplaceAll(tt.list, " ", "%20"), strings.NewReader(tt.body)))
+			if w.Code != tt.wantCode {
+				t.Fatalf("PUT /lists/%s = %d %s, want %d", tt.list, w.Code, w.Body, tt.wantCode)
+			}
+			list, ok, err := lists.get(tt.list)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantIDs == nil {
+				if ok && !lists.isRegulars(tt.list) {
+					t.Errorf("saved %+v, want nothing saved", list)
+				}
+				return
+			}
+			if !ok || list.Name != tt.list || strings.Join(list.MemberIDs, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Errorf("saved %+v (found %v), want %s with %q", list, ok, tt.list, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestInviteByListName(t *testing.T) {
+	fake := newFakeSlack(t, append(append([]slack.User(nil), testUsers...), slack.User{ID: "U8", Name: "gone", Deleted: true})...)
+	h, _ := newTestBotHandler(t, fake, testConfig(), &fakeGenerator{invitation: "Come play!"})
+	// U8 has left the workspace since the list was saved.
+	if err := h.recipientLists.put(RecipientList{Name: "D&D crew", MemberIDs: []string{"U2", "U3", "U8"}}); err != nil {
+		t.Fatal(err)
+	}
+	h.processEvent(directMessage("U1", "hi"))
+	h.processEvent(directMessage("U1", "the D&D Crew"))
+	h.processEvent(directMessage("U1", "Catan"))
+
+	for _, recipient := range []string{"U2", "U3"} {
+		if got := fake.postsTo(recipient); len(got) != 1 {
+			t.Errorf("%s got %q, want one invitation", recipient, got)
+		}
+	}
+	if got := fake.postsTo("U8"); len(got) != 0 {
+		t.Errorf("the departed member got %q, want nothing", got)
+	}
+	replies := strings.Join(fake.postsTo("DU1"), "\n")
+	if !strings.Contains(replies, "Skipped 1 member(s) of D&D crew who are no longer in the workspace.") {
+		t.Errorf("replies = %q, want the departed member noted", replies)
+	}
+}
+
+func TestValidateRegulars(t *testing.T) {
+	users := []slack.User{
+		{ID: "U0000002", Name: "bob"},
+		{ID: "U0000003", Name: "carol"},
+		{ID: "U0000008", Name: "gone", Deleted: true},
+		{ID: "U0000009", Name: "otherbot", IsBot: true},
+	}
+	tests := []struct {
+		name     string
+		regulars string // REGULARS
+		want     []string
+		wantErr  string
+	}{
+		{name: "user IDs", regulars: " U0000002, U0000003 ,", want: []string{"U0000002", "U0000003"}},
+		{name: "not a user ID", regulars: "U0000002, bob", wantErr: `"bob" is not a Slack user ID`},
+		{name: "not invitable", regulars: "U0000002,U0000008,U0000009,U0000007", wantErr: "not invitable workspace users: U0000008, U0000009, U0000007"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			regulars, err := parseUserIDs(tt.regulars)
+			if err == nil {
+				err = validateRegulars(regulars, users)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(regulars, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("regulars = %q, want %q", regulars, tt.want)
+			}
+		})
+	}
+}
+
+func TestInviteTheRegulars(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	fake := newFakeSlack(t, testUsers...)
+	config := testConfig()
+	config.Regulars = []string{"U2", "U3"}
+	h, _ := newTestBotHandler(t, fake, config, &fakeGenerator{invitation: "Come play!"})
+	h.processEvent(directMessage("U1", "hi"))
+	if replies := fake.postsTo("DU1"); len(replies) != 1 || !strings.Contains(replies[0], `(or just say "regulars")`) {
+		t.Errorf("greeting = %q, want it to offer the regulars", replies)
+	}
+	h.processEvent(directMessage("U1", "The Regulars"))
+	h.processEvent(directMessage("U1", "Catan"))
+	for _, recipient := range []string{"U2", "U3"} {
+		if got := fake.postsTo(recipient); len(got) != 1 {
+			t.Errorf("%s got %q, want one invitation", recipient, got)
+		}
+	}
+
+	// The list can be read through /lists but not changed there.
+	r := gin.New()
+	lists := NewRecipientListHandler(h.recipientLists, h.userCache)
+	r.GET("/lists", lists.ListLists)
+	r.PUT("/lists/:name", lists.PutList)
+	r.DELETE("/lists/:name", lists.DeleteList)
+	requests := []struct {
+		method, path, body string
+		wantCode           int
+		wantBody           string
+	}{
+		{method: http.MethodGet, path: "/lists", wantCode: http.StatusOK, wantBody: `{"name":"regulars","member_ids":["U2","U3"]}`},
+		{method: http.MethodPut, path: "/lists/regulars", body: `{"member_ids":["U1"]}`, wantCode: http.StatusConflict},
+		{method: http.MethodDelete, path: "/lists/REGULARS", wantCode: http.StatusConflict},
+	}
+	for _, req := range requests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(req.method, req.path, strings.NewReader(req.body)))
+		if w.Code != req.wantCode || !strings.Contains(w.Body.String(), req.wantBody) {
+			t.Errorf("%s %s = %d %s, want %d with %s", req.method, req.path, w.Code, w.Body, req.wantCode, req.wantBody)
+		}
+	}
+}
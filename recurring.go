@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // rule timezones must load even on hosts without a zoneinfo database
+
+	"github.com/gin-gonic/gin"
+)
+
+// Store key prefixes for recurring invites.
+const (
+	recurringKeyPrefix      = "recurring:"       // the invites themselves
+	recurringClaimKeyPrefix = "recurring_claim:" // occurrences an instance has claimed to send
+)
+
+// recurringClaimTTL is how long an occurrence's claim is kept. It only has to outlive the
+// moment the claiming instance saves the advanced NextAt.
+const recurringClaimTTL = 24 * time.Hour
+
+// RecurringRule is a weekly schedule: every listed weekday at the given wall-clock time in
+// Timezone. Occurrences keep their local time across daylight saving changes.
+type RecurringRule struct {
+	Weekdays []string `json:"weekdays" binding:"required"` // e.g. ["tuesday", "thursday"]
+	Time     string   `json:"time" binding:"required"`     // 24-hour "HH:MM", e.g. "19:00"
+	Timezone string   `json:"timezone"`                    // IANA name, e.g. "America/Chicago"; defaults to UTC
+}
+
+// RecurringInvite is an invitation sent on a RecurringRule. Invite is sent as POST /invite
+// would send it at each occurrence.
+type RecurringInvite struct {
+	ID     string        `json:"id"`
+	Rule   RecurringRule `json:"rule"`
+	Invite InviteRequest `json:"invite"`
+	NextAt time.Time     `json:"next_at"`
+}
+
+// weekdayNames maps lower-cased weekday names and their three-letter abbreviations to weekdays.
+var weekdayNames = func() map[string]time.Weekday {
+	names := make(map[string]time.Weekday, 14)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		name := strings.ToLower(day.String())
+		names[name] = day
+		names[name[:3]] = day
+	}
+	return names
+}()
+
+// schedule is a parsed RecurringRule.
+type schedule struct {
+	weekdays map[time.Weekday]bool
+	hour     int
+	minute   int
+	location *time.Location
+}
+
+// parse checks the rule and returns its schedule.
+func (r RecurringRule) parse() (schedule, error) {
+	s := schedule{weekdays: make(map[time.Weekday]bool), location: time.UTC}
+	for _, name := range r.Weekdays {
+		day, ok := weekdayNames[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return schedule{}, fmt.Errorf("unknown weekday %q", name)
+		}
+		s.weekdays[day] = true
+	}
+	if len(s.weekdays) == 0 {
+		return schedule{}, errors.New("at least one weekday is required")
+	}
+	clock, err := time.Parse("15:04", r.Time)
+	if err != nil {
+		return schedule{}, fmt.Errorf("time must look like 19:00, got %q", r.Time)
+	}
+	s.hour, s.minute = clock.Hour(), clock.Minute()
+	if r.Timezone != "" {
+		if s.location, err = time.LoadLocation(r.Timezone); err != nil {
+			return schedule{}, fmt.Errorf("unknown timezone %q", r.Timezone)
+		}
+	}
+	return s, nil
+}
+
+// next returns the first occurrence strictly after after. Each candidate is built from the
+// local date and clock time, so a DST change moves the UTC instant rather than the local time.
+func (s schedule) next(after time.Time) time.Time {
+	local := after.In(s.location)
+	for days := 0; days <= 7; days++ {
+		candidate := time.Date(local.Year(), local.Month(), local.Day()+days, s.hour, s.minute, 0, 0, s.location)
+		if s.weekdays[candidate.Weekday()] && candidate.After(after) {
+			return candidate
+		}
+	}
+	// Unreachable with at least one weekday: some day in the next week always qualifies.
+	return time.Time{}
+}
+
+// recurringInvites stores recurring invites and sends each occurrence when it comes due.
+// Each occurrence is claimed with SetNX before NextAt is advanced and it is sent, so neither a
+// slow send nor a second instance sharing the store can send it twice.
+type recurringInvites struct {
+	store     Store
+	invites   *GameInviteHandler
+	mutex     sync.Mutex // keeps advance from saving an invite DeleteRecurring just removed
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// newRecurringInvites keeps recurring invites in store, sends them through invites and checks
+// for due occurrences every interval until Close is called.
+func newRecurringInvites(store Store, invites *GameInviteHandler, interval time.Duration) *recurringInvites {
+	r := &recurringInvites{store: store, invites: invites, stop: make(chan struct{})}
+	go r.run(interval)
+	return r
+}
+
+// Close stops sending occurrences. It is safe to call more than once.
+func (r *recurringInvites) Close() {
+	r.closeOnce.Do(func() { close(r.stop) })
+}
+
+func (r *recurringInvites) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case now := <-ticker.C:
+			r.sendDue(now)
+		}
+	}
+}
+
+// sendDue sends every occurrence due at now and schedules the next one. An occurrence missed
+// while the bot was down or in maintenance is sent once, not once per missed week.
+func (r *recurringInvites) sendDue(now time.Time) {
+	// Occurrences that come due during maintenance are sent once it ends.
+	if r.invites.config.MaintenanceMode {
+		return
+	}
+	all, err := r.all()
+	if err != nil {
+		logger.Error("Error loading recurring invites", "event_type", "recurring_invite", "error", err)
+		return
+	}
+	for _, invite := range all {
+		if invite.NextAt.After(now) {
+			continue
+		}
+		due, ok := r.advance(invite.ID, now)
+		if !ok {
+			continue
+		}
+		// The occurrence's key makes sending it again, e.g. after a crash mid-batch, skip whoever
+		// already got it.
+		occurrence := due.Invite
+		occurrence.IdempotencyKey = fmt.Sprintf("recurring:%s:%d", due.ID, invite.NextAt.Unix())
+		status, response := r.invites.sendInvite(occurrence)
+		if status != http.StatusOK {
+			logger.Error("Recurring invite failed", "event_type", "recurring_invite", "recurring_id", due.ID, "game", due.Invite.GameName, "status", status, "response", response)
+			continue
+		}
+		logger.Info("Sent recurring invite", "event_type", "recurring_invite", "recurring_id", due.ID, "game", due.Invite.GameName, "next_at", due.NextAt.Format(time.RFC3339))
+	}
+}
+
+// advance claims the invite's due occurrence, moves its NextAt past now and returns the
+// invite, so the caller can send the occurrence. It reports false if the invite was cancelled,
+// or if the occurrence was already claimed here or by another instance.
+func (r *recurringInvites) advance(id string, now time.Time) (RecurringInvite, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	invite, ok, err := r.get(id)
+	if err != nil || !ok || invite.NextAt.After(now) {
+		if err != nil {
+			logger.Error("Error loading recurring invite", "event_type", "recurring_invite", "recurring_id", id, "error", err)
+		}
+		return RecurringInvite{}, false
+	}
+	schedule, err := invite.Rule.parse()
+	if err != nil {
+		logger.Warn("Skipping recurring invite with an invalid rule", "event_type", "recurring_invite", "recurring_id", id, "error", err)
+		return RecurringInvite{}, false
+	}
+	claimKey := recurringClaimKeyPrefix + id + ":" + strconv.FormatInt(invite.NextAt.Unix(), 10)
+	claimed, err := r.store.SetNX(claimKey, []byte(now.UTC().Format(time.RFC3339)), recurringClaimTTL)
+	if err != nil || !claimed {
+		if err != nil {
+			logger.Error("Error claiming recurring invite occurrence", "event_type", "recurring_invite", "recurring_id", id, "error", err)
+		}
+		return RecurringInvite{}, false
+	}
+	invite.NextAt = schedule.next(now)
+	if err := r.put(invite); err != nil {
+		logger.Error("Error scheduling the next occurrence of recurring invite", "event_type", "recurring_invite", "recurring_id", id, "error", err)
+		// Give up the claim, so the occurrence is retried on the next check.
+		if _, err := r.store.Delete(claimKey); err != nil {
+			logger.Error("Error releasing recurring invite claim", "event_type", "recurring_invite", "recurring_id", id, "error", err)
+		}
+		return RecurringInvite{}, false
+	}
+	return invite, true
+}
+
+func (r *recurringInvites) get(id string) (RecurringInvite, bool, error) {
+	data, ok, err := r.store.Get(recurringKeyPrefix + id)
+	if err != nil || !ok {
+		return RecurringInvite{}, false, err
+	}
+	var invite RecurringInvite
+	if err := json.Unmarshal(data, &invite); err != nil {
+		return RecurringInvite{}, false, fmt.Errorf("decoding recurring invite %s: %w", id, err)
+	}
+	return invite, true, nil
+}
+
+func (r *recurringInvites) put(invite RecurringInvite) error {
+	data, err := json.Marshal(invite)
+	if err != nil {
+		return err
+	}
+	return r.store.Set(recurringKeyPrefix+invite.ID, data, 0)
+}
+
+// all returns every recurring invite, soonest first.
+func (r *recurringInvites) all() ([]RecurringInvite, error) {
+	keys, err := r.store.Keys(recurringKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	invites := make([]RecurringInvite, 0, len(keys))
+	for _, key := range keys {
+		invite, ok, err := r.get(strings.TrimPrefix(key, recurringKeyPrefix))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			invites = append(invites, invite)
+		}
+	}
+	sort.Slice(invites, func(i, j int) bool { return invites[i].NextAt.Before(invites[j].NextAt) })
+	return invites, nil
+}
+
+// CreateRecurring saves a recurring invite and returns it with its ID and first occurrence.
+func (r *recurringInvites) CreateRecurring(c *gin.Context) {
+	var invite RecurringInvite
+	if err := c.ShouldBindJSON(&invite); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := applyAuthenticatedInviter(c, &invite.Invite); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	schedule, err := invite.Rule.parse()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rule: " + err.Error()})
+		return
+	}
+	if len(invite.Invite.UserIDs) == 0 && invite.Invite.ChannelID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errNoInviteTarget.Error()})
+		return
+	}
+	if invite.Invite.SendAt != "" || invite.Invite.GameTime != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "recurring invites can't set send_at or game_time; the rule decides when each one is sent"})
+		return
+	}
+	invite.Invite.UserIDs = dedupeIDs(invite.Invite.UserIDs)
+	invite.ID = newInviteID()
+	invite.NextAt = schedule.next(time.Now())
+	if err := r.put(invite); err != nil {
+		logger.Error("Error saving recurring invite", "event_type", "recurring_invite", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save recurring invite: " + err.Error()})
+		return
+	}
+	logger.Info("Created recurring invite", "event_type", "recurring_invite", "recurring_id", invite.ID, "game", invite.Invite.GameName, "next_at", invite.NextAt.Format(time.RFC3339))
+	c.JSON(http.StatusOK, invite)
+}
+
+// ListRecurring returns every recurring invite, soonest first.
+func (r *recurringInvites) ListRecurring(c *gin.Context) {
+	invites, err := r.all()
+	if err != nil {
+		logger.Error("Error listing recurring invites", "event_type", "recurring_invite", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load recurring invites: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recurring": invites})
+}
+
+// DeleteRecurring cancels a recurring invite. Occurrences already sent are unaffected.
+func (r *recurringInvites) DeleteRecurring(c *gin.Context) {
+	r.mutex.Lock()
+	deleted, err := r.store.Delete(recurringKeyPrefix + c.Param("id"))
+	r.mutex.Unlock()
+	if err != nil {
+		logger.Error("Error deleting recurring invite", "event_type", "recurring_invite", "recurring_id", c.Param("id"), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete recurring invite: " + err.Error()})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No recurring invite with ID " + c.Param("id")})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Recurring invite cancelled"})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecurringAdvanceClaimsOccurrenceOnce(t *testing.T) {
+	now := time.Date(2024, 5, 7, 19, 0, 30, 0, time.UTC) // a Tuesday, just after 19:00
+	tests := []struct {
+		name      string
+		nextAt    time.Time
+		instances int
+		wantSends int
+	}{
+		{name: "due occurrence on one instance", nextAt: now.Add(-30 * time.Second), instances: 1, wantSends: 1},
+		{name: "due occurrence on three instances", nextAt: now.Add(-30 * time.Second), instances: 3, wantSends: 1},
+		{name: "occurrence not due yet", nextAt: now.Add(time.Hour), instances: 2, wantSends: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewInMemoryStore()
+			invite := RecurringInvite{
+				ID:     "rec1",
+				Rule:   RecurringRule{Weekdays: []string{"tuesday"}, Time: "19:00"},
+				Invite: InviteRequest{GameName: "Catan"},
+				NextAt: tt.nextAt,
+			}
+			if err := (&recurringInvites{store: store}).put(invite); err != nil {
+				t.Fatal(err)
+			}
+
+			var wg sync.WaitGroup
+			var mutex sync.Mutex
+			sends := 0
+			for i := 0; i < tt.instances; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					// Separate instances share only the store.
+					if _, ok := (&recurringInvites{store: store}).advance("rec1", now); ok {
+						mutex.Lock()
+						sends++
+						mutex.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+			if sends != tt.wantSends {
+				t.Errorf("occurrence claimed %d times, want %d", sends, tt.wantSends)
+			}
+			saved, _, err := (&recurringInvites{store: store}).get("rec1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantSends > 0 && !saved.NextAt.Equal(now.Add(-30*time.Second).AddDate(0, 0, 7)) {
+				t.Errorf("NextAt = %v, want the same time next week", saved.NextAt)
+			}
+		})
+	}
+}
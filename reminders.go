@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// actionRemindMe is the action ID of the "Remind me" select on invitations.
+const actionRemindMe = "remind_me"
+
+// remindMeBlockPrefix starts the block ID of the "Remind me" select, which carries the signed
+// invite ID.
+const remindMeBlockPrefix = "remind_me."
+
+// reminderKeyPrefix namespaces the invitation reminders waiting to be sent.
+const reminderKeyPrefix = "reminder:"
+
+// reminderFiredKeyPrefix namespaces the markers of reminders that went out. It doesn't start
+// with reminderKeyPrefix, so listing the waiting reminders doesn't pick the markers up.
+const reminderFiredKeyPrefix = "reminder_fired:"
+
+// reminderFiredRetention is how long a fired marker is kept, longer than an undelivered
+// reminder is.
+const reminderFiredRetention = 48 * time.Hour
+
+// Reminder choices offered in the "Remind me" select.
+const (
+	remindIn15Minutes = "15m"
+	remindIn1Hour     = "1h"
+	remindTomorrow    = "tomorrow"
+)
+
+// reminderMorningHour is the local hour "tomorrow" reminders are sent at.
+const reminderMorningHour = 9
+
+// remindMeBlock builds the select recipients choose when to be reminded of the invitation from.
+func remindMeBlock(inviteID string, secret []byte) *slack.ActionBlock {
+	option := func(value, text string) *slack.OptionBlockObject {
+		return slack.NewOptionBlockObject(value, slack.NewTextBlockObject("plain_text", text, false, false), nil)
+	}
+	selectMenu := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic,
+		slack.NewTextBlockObject("plain_text", "Remind me…", false, false), actionRemindMe,
+		option(remindIn15Minutes, "In 15 minutes"),
+		option(remindIn1Hour, "In 1 hour"),
+		option(remindTomorrow, "Tomorrow morning"),
+	)
+	return slack.NewActionBlock(encodeInviteBlockID(remindMeBlockPrefix, inviteID, secret), selectMenu)
+}
+
+// errUnknownReminder is returned for reminder choices the select doesn't offer.
+var errUnknownReminder = errors.New("unknown reminder choice")
+
+// reminderTime returns when a reminder chosen at now is due, and how to describe it. "Tomorrow"
+// is the next day at reminderMorningHour in the recipient's timezone, location.
+func reminderTime(choice string, now time.Time, location *time.Location) (time.Time, string, error) {
+	switch choice {
+	case remindIn15Minutes:
+		return now.Add(15 * time.Minute), "in 15 minutes", nil
+	case remindIn1Hour:
+		return now.Add(time.Hour), "in an hour", nil
+	case remindTomorrow:
+		local := now.In(location)
+		at := time.Date(local.Year(), local.Month(), local.Day()+1, reminderMorningHour, 0, 0, 0, location)
+		return at, "tomorrow at " + at.Format("3:04 PM"), nil
+	}
+	return time.Time{}, "", errUnknownReminder
+}
+
+// inviteReminder is a reminder waiting for its send time.
+type inviteReminder struct {
+	ID       string       `json:"id"`
+	UserID   string       `json:"user_id"`
+	InviteID string       `json:"invite_id"`
+	Game     string       `json:"game"`
+	SendAt   time.Time    `json:"send_at"`
+	Blocks   slack.Blocks `json:"blocks"` // the invitation to deliver again
+}
+
+// inviteReminders delivers invitations again to recipients who asked to be reminded. Reminders
+// wait in the shared Store and are sent by a loop checking for due ones every interval. A nil
+// inviteReminders does nothing.
+type inviteReminders struct {
+	store     Store
+	sender    *messageSender
+	rsvps     *rsvpTracker // renders the reminder with the invitation's current roster
+	paused    bool         // holds reminders while MAINTENANCE_MODE is on
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// newInviteReminders keeps reminders in store and checks for due ones every interval until Close
+// is called.
+func newInviteReminders(store Store, sender *messageSender, rsvps *rsvpTracker, paused bool, interval time.Duration) *inviteReminders {
+	r := &inviteReminders{store: store, sender: sender, rsvps: rsvps, paused: paused, stop: make(chan struct{})}
+	go r.run(interval)
+	return r
+}
+
+// Close stops sending reminders. It is safe to call more than once.
+func (r *inviteReminders) Close() {
+	if r == nil {
+		return
+	}
+	r.closeOnce.Do(func() { close(r.stop) })
+}
+
+func (r *inviteReminders) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case now := <-ticker.C:
+			r.sendDue(now)
+		}
+	}
+}
+
+// schedule saves reminder, replacing any earlier one userID asked for on the same invitation.
+func (r *inviteReminders) schedule(reminder inviteReminder) error {
+	reminder.ID = reminder.UserID + ":" + reminder.InviteID
+	data, err := json.Marshal(reminder)
+	if err != nil {
+		return err
+	}
+	// Keep reminders Slack can't deliver from piling up: one a day overdue is dropped.
+	return r.store.Set(reminderKeyPrefix+reminder.ID, data, time.Until(reminder.SendAt)+24*time.Hour)
+}
+
+// firedKey is the Store key marking reminder as sent. It includes the send time, so a reminder
+// asked for again on the same invitation later fires too.
+func firedKey(reminder inviteReminder) string {
+	return fmt.Sprintf("%s%s:%d", reminderFiredKeyPrefix, reminder.ID, reminder.SendAt.Unix())
+}
+
+// sendDue delivers every reminder due at now. Each is marked fired with SetNX before it is
+// sent, so a reminder whose removal was lost to a restart, or that another instance is sending,
+// doesn't go out twice; a failed send clears the mark to be retried.
+func (r *inviteReminders) sendDue(now time.Time) {
+	if r.paused {
+		return
+	}
+	keys, err := r.store.Keys(reminderKeyPrefix)
+	if err != nil {
+		logger.Error("Error loading reminders", "error", err)
+		return
+	}
+	for _, key := range keys {
+		data, ok, err := r.store.Get(key)
+		if err != nil || !ok {
+			continue
+		}
+		var reminder inviteReminder
+		if err := json.Unmarshal(data, &reminder); err != nil {
+			logger.Warn("Dropping an unreadable reminder", "key", key, "error", err)
+			_, _ = r.store.Delete(key)
+			continue
+		}
+		if now.Before(reminder.SendAt) {
+			continue
+		}
+		marked, err := r.store.SetNX(firedKey(reminder), []byte(now.UTC().Format(time.RFC3339)), reminderFiredRetention)
+		if err != nil {
+			logger.Error("Error marking the reminder fired", "user_id", reminder.UserID, "invite_id", reminder.InviteID, "error", err)
+			continue
+		}
+		if !marked {
+			logger.Info("Skipping a reminder that already went out", "user_id", reminder.UserID, "invite_id", reminder.InviteID)
+			_, _ = r.store.Delete(key)
+			continue
+		}
+		if err := r.send(reminder); err != nil {
+			// Left in place and unmarked, so the next check tries again.
+			logger.Error("Failed to send the reminder", "user_id", reminder.UserID, "invite_id", reminder.InviteID, "error", err)
+			if _, err := r.store.Delete(firedKey(reminder)); err != nil {
+				logger.Error("Error clearing the reminder's fired mark", "user_id", reminder.UserID, "invite_id", reminder.InviteID, "error", err)
+			}
+			continue
+		}
+		if _, err := r.store.Delete(key); err != nil {
+			logger.Error("Error removing the sent reminder", "user_id", reminder.UserID, "invite_id", reminder.InviteID, "error", err)
+		}
+	}
+}
+
+// send DMs the invitation again, with its roster brought up to date.
+func (r *inviteReminders) send(reminder inviteReminder) error {
+	blocks := reminder.Blocks.BlockSet
+	if tally, ok, err := r.rsvps.get(reminder.InviteID); err == nil && ok {
+		blocks = withRoster(blocks, tally)
+	}
+	intro := slack.NewContextBlock("reminder_intro",
+		slack.NewTextBlockObject("mrkdwn", ":alarm_clock: Here's the invitation you asked to be reminded about.", false, false))
+	_, _, err := r.sender.post(reminder.UserID,
+		slack.MsgOptionText("Reminder: "+invitationTitlePrefix+reminder.Game, false),
+		slack.MsgOptionBlocks(append([]slack.Block{intro}, blocks...)...),
+	)
+	if err != nil {
+		return err
+	}
+	logger.Info("Reminder sent", "user_id", reminder.UserID, "invite_id", reminder.InviteID, "game", reminder.Game)
+	return nil
+}
+
+// remindMe handles a recipient choosing when to be reminded of an invitation from the select.
+func (h *InteractionHandler) remindMe(callback *slack.InteractionCallback, action *slack.BlockAction) {
+	inviteID, err := decodeInviteBlockID(remindMeBlockPrefix, action.BlockID, h.secret)
+	if err != nil {
+		logger.Info("Ignoring reminder request with an unusable block ID", "event_type", callback.Type, "user_id", callback.User.ID, "error", err)
+		return
+	}
+	location := time.UTC
+	if user, ok := h.userCache.lookup(callback.User.ID); ok && user.TZ != "" {
+		if loaded, err := time.LoadLocation(user.TZ); err == nil {
+			location = loaded
+		}
+	}
+	sendAt, when, err := reminderTime(action.SelectedOption.Value, time.Now(), location)
+	if err != nil {
+		logger.Info("Ignoring reminder request with an unusable value", "event_type", callback.Type, "user_id", callback.User.ID, "invite_id", inviteID, "error", err)
+		return
+	}
+
+	// Deliver the invitation as recorded, or as it was clicked if it wasn't, as for scheduled ones.
+	game := ""
+	blocks := callback.Message.Blocks
+	if record, ok, err := h.rsvps.load(inviteID); err == nil && ok {
+		game = record.Game
+		if record.Blocks != nil && len(record.Blocks.BlockSet) > 0 {
+			blocks = *record.Blocks
+		}
+	}
+	channelID := callback.Container.ChannelID
+	if channelID == "" {
+		channelID = callback.Channel.ID
+	}
+	reply := fmt.Sprintf("Okay, I'll remind you about this invite %s.", when)
+	if err := h.reminders.schedule(inviteReminder{UserID: callback.User.ID, InviteID: inviteID, Game: game, SendAt: sendAt, Blocks: blocks}); err != nil {
+		logger.Error("Error saving the reminder", "event_type", callback.Type, "user_id", callback.User.ID, "invite_id", inviteID, "error", err)
+		reply = "Sorry, I couldn't set that reminder. Please try again."
+	} else {
+		logger.Info("Reminder scheduled", "event_type", callback.Type, "user_id", callback.User.ID, "invite_id", inviteID, "send_at", sendAt.Format(time.RFC3339))
+	}
+	if _, err := h.slackClient.PostEphemeral(channelID, callback.User.ID, slack.MsgOptionText(reply, false)); err != nil {
+		logger.Error("Failed to confirm the reminder", "event_type", callback.Type, "user_id", callback.User.ID, "error", h.sender.scopes.explain(methodPostEphemeral, err))
+	}
+}
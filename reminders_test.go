@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+func TestReminderTime(t *testing.T) {
+	now := time.Date(2024, 5, 1, 22, 30, 0, 0, time.UTC)
+	chicago, _ := time.LoadLocation("America/Chicago")
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	tests := []struct {
+		name     string
+		choice   string
+		location *time.Location
+		want     time.Time
+		wantWhen string
+		wantErr  bool
+	}{
+		{name: "15 minutes", choice: remindIn15Minutes, location: time.UTC, want: now.Add(15 * time.Minute), wantWhen: "in 15 minutes"},
+		{name: "1 hour", choice: remindIn1Hour, location: chicago, want: now.Add(time.Hour), wantWhen: "in an hour"},
+		// 17:30 on May 1 in Chicago, so tomorrow is May 2.
+		{name: "tomorrow behind UTC", choice: remindTomorrow, location: chicago, want: time.Date(2024, 5, 2, 9, 0, 0, 0, chicago), wantWhen: "tomorrow at 9:00 AM"},
+		// Already 07:30 on May 2 in Tokyo, so tomorrow is May 3.
+		{name: "tomorrow ahead of UTC", choice: remindTomorrow, location: tokyo, want: time.Date(2024, 5, 3, 9, 0, 0, 0, tokyo), wantWhen: "tomorrow at 9:00 AM"},
+		{name: "unknown choice", choice: "next_week", location: time.UTC, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, when, err := reminderTime(tt.choice, now, tt.location)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("reminderTime(%q) = %v, want an error", tt.choice, got)
+				}
+				return
+			}
+			if err != nil || !got.Equal(tt.want) || when != tt.wantWhen {
+				t.Errorf("reminderTime(%q) = %v, %q, %v; want %v, %q", tt.choice, got, when, err, tt.want, tt.wantWhen)
+			}
+		})
+	}
+}
+
+func TestRemindMe(t *testing.T) {
+	chicago, _ := time.LoadLocation("America/Chicago")
+	users := append([]slack.User(nil), testUsers...)
+	users[1].TZ = "America/Chicago"
+	tests := []struct {
+		name      string
+		choice    string
+		wantAfter func(now time.Time) time.Time // earliest expected send time
+		wantReply string
+	}{
+		{name: "15 minutes", choice: remindIn15Minutes, wantAfter: func(now time.Time) time.Time { return now.Add(15 * time.Minute) }, wantReply: "Okay, I'll remind you about this invite in 15 minutes."},
+		{name: "1 hour", choice: remindIn1Hour, wantAfter: func(now time.Time) time.Time { return now.Add(time.Hour) }, wantReply: "Okay, I'll remind you about this invite in an hour."},
+		{
+			name:   "tomorrow in the recipient's timezone",
+			choice: remindTomorrow,
+			wantAfter: func(now time.Time) time.Time {
+				local := now.In(chicago)
+				return time.Date(local.Year(), local.Month(), local.Day()+1, reminderMorningHour, 0, 0, 0, chicago)
+			},
+			wantReply: "Okay, I'll remind you about this invite tomorrow at 9:00 AM.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, users...)
+			config := testConfig()
+			config.ActionSigningSecret = testActionSecret
+			config.RecipientReminders = true
+			invites, store := newTestInviteHandler(t, fake, config)
+			status, response := invites.sendInvite(InviteRequest{GameName: "Catan", UserIDs: []string{"U2"}})
+			if status != http.StatusOK {
+				t.Fatalf("sendInvite = %d %v", status, response)
+			}
+			inviteID := response["invite_id"].(string)
+			if posts := fake.postsTo("U2"); len(posts) != 1 || !strings.Contains(fake.allPosts()[0].Blocks, actionRemindMe) {
+				t.Fatalf("invitation lacks the remind me select: %+v", fake.allPosts())
+			}
+
+			client := fake.client()
+			reminders := &inviteReminders{store: store, sender: invites.sender, rsvps: invites.rsvps, stop: make(chan struct{})}
+			h := NewInteractionHandler(client, newUserCache(client, time.Minute), invites.sender, testActionSecret, nil, nil, reminders, invites.rsvps, newInviterNotifier(store, invites.sender, 0), invites.pending)
+			before := time.Now()
+			callback := &slack.InteractionCallback{Type: slack.InteractionTypeBlockActions, User: slack.User{ID: "U2"}, Container: slack.Container{ChannelID: "DU2", MessageTs: fakeTimestamp(1)}}
+			h.router.dispatch(callback, &slack.BlockAction{
+				ActionID:       actionRemindMe,
+				BlockID:        encodeInviteBlockID(remindMeBlockPrefix, inviteID, []byte(testActionSecret)),
+				SelectedOption: slack.OptionBlockObject{Value: tt.choice},
+			})
+
+			data, ok, err := store.Get(reminderKeyPrefix + "U2:" + inviteID)
+			if err != nil || !ok {
+				t.Fatalf("no reminder saved (%v)", err)
+			}
+			var reminder inviteReminder
+			if err := json.Unmarshal(data, &reminder); err != nil {
+				t.Fatal(err)
+			}
+			if want := tt.wantAfter(before); reminder.SendAt.Before(want) || reminder.SendAt.After(tt.wantAfter(time.Now())) {
+				t.Errorf("reminder due at %v, want %v", reminder.SendAt, want)
+			}
+
+			reminders.sendDue(reminder.SendAt.Add(-time.Second))
+			if got := fake.postsTo("U2"); len(got) != 1 {
+				t.Fatalf("reminder sent early: %q", got)
+			}
+			reminders.sendDue(reminder.SendAt)
+			reminders.sendDue(reminder.SendAt.Add(time.Minute))
+			got := fake.postsTo("U2")
+			if len(got) != 2 || got[1] != "Reminder: Game Invitation: Catan" {
+				t.Fatalf("posts to U2 = %q, want the invitation and one reminder", got)
+			}
+			if posts := fake.allPosts(); !strings.Contains(posts[len(posts)-1].Blocks, "accept_game") {
+				t.Errorf("reminder lacks the invitation buttons: %s", posts[len(posts)-1].Blocks)
+			}
+			if replies := fake.ephemeralsFor("U2"); len(replies) != 1 || replies[0] != tt.wantReply {
+				t.Errorf("replies to U2 = %q, want [%q]", replies, tt.wantReply)
+			}
+		})
+	}
+}
+
+func TestRemindersFireOnceAcrossRestarts(t *testing.T) {
+	tests := []struct {
+		name       string
+		markFired  bool   // the reminder was marked fired before the restart
+		failFirst  string // Slack error the first scheduler's send gets
+		wantFirst  int    // reminders the first scheduler posts
+		wantSecond int    // reminders the scheduler started after it posts
+	}{
+		{name: "fired before the restart", markFired: true, wantFirst: 0, wantSecond: 0},
+		{name: "sent once", wantFirst: 1, wantSecond: 0},
+		{name: "failed send is retried after the restart", failFirst: "ratelimited", wantFirst: 0, wantSecond: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			store := NewInMemoryStore()
+			client := fake.client()
+			sender := newMessageSender(client, nil, newSendPacer(0, 0), 0, 0)
+			rsvps := newRSVPTracker(store)
+			now := time.Now()
+			reminder := inviteReminder{UserID: "U2", InviteID: "inv1", Game: "Catan", SendAt: now.Add(-time.Minute)}
+
+			first := &inviteReminders{store: store, sender: sender, rsvps: rsvps, stop: make(chan struct{})}
+			if err := first.schedule(reminder); err != nil {
+				t.Fatal(err)
+			}
+			if tt.markFired {
+				reminder.ID = "U2:inv1"
+				if _, err := store.SetNX(firedKey(reminder), []byte("fired"), reminderFiredRetention); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.failFirst != "" {
+				fake.failPosts("U2", tt.failFirst)
+			}
+			first.sendDue(now)
+			if got := len(fake.postsTo("U2")); got != tt.wantFirst {
+				t.Fatalf("first scheduler sent %d reminders, want %d", got, tt.wantFirst)
+			}
+
+			fake.failPosts("U2", "")
+			// A restart loses the removal of a sent reminder, so the second scheduler finds
+			// it again unless it was dropped as fired.
+			if err := first.schedule(reminder); err != nil {
+				t.Fatal(err)
+			}
+			second := &inviteReminders{store: store, sender: sender, rsvps: rsvps, stop: make(chan struct{})}
+			second.sendDue(now)
+			second.sendDue(now.Add(time.Minute))
+			if got := len(fake.postsTo("U2")) - tt.wantFirst; got != tt.wantSecond {
+				t.Errorf("second scheduler sent %d reminders, want %d", got, tt.wantSecond)
+			}
+			if keys, _ := store.Keys(reminderKeyPrefix); len(keys) != 0 {
+				t.Errorf("reminders left waiting: %q", keys)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// defaultReplies are the texts the bot replies with in Slack conversations, keyed by conversation
+// step and outcome. REPLY_TEMPLATES_FILE can override any of them, for example to translate them.
+var defaultReplies = map[string]string{
+	"greeting.hello":            "Hi!",
+	"greeting.ask_names":        "Who do you want to message? Please provide a comma separated list of names{{if .Regulars}} (or just say \"regulars\"){{end}}, or say \"cancel\" at any time to stop.",
+	"command.usage":             "Invalid command format. Use: /invite \"user1,user2\" \"game\"",
+	"command.unresolved":        "{{.Problems}}",
+	"conversation.load_failed":  "Sorry, I couldn't load our conversation. Please try again shortly.",
+	"conversation.start_failed": "Sorry, I couldn't start a conversation. Please try again shortly.",
+	"conversation.maintenance":  maintenanceReply,
+	"cancel.nothing":            "There's nothing to cancel. Mention me or send me a message whenever you want to invite people.",
+	"cancel.done":               "Okay, I've cancelled that invitation. Message me again whenever you want to start over.",
+	"names.empty":               "I didn't catch any names. Please provide a comma separated list of names.",
+	"names.fetch_failed":        "Error fetching users for matching: {{.Error}}",
+	"names.match_timeout":       "Looking up those names is taking longer than usual. Please send them again in a moment.",
+	"names.only_self":           "You can't invite only yourself. Who else do you want to invite? Please provide a comma separated list of names.",
+	"names.unresolved":          "{{.Problems}}Please provide a correct comma separated list of names.",
+	"names.repeated":            "{{.Problems}}That's the same list as last time, so I'll need something different. Try full names or @handles, look up exact user IDs with `GET /invite` and send the invite with `POST /invite`, or say \"cancel\" to stop.",
+	"names.attempts_exhausted":  "Sorry, I still couldn't resolve those names.\n{{.Problems}}You can look up exact user IDs with `GET /invite` and send the invite with `POST /invite`, or use `/invite \"user1,user2\" \"game\"` with exact names. Message me again to start over.",
+	"names.save_failed":         "Sorry, I couldn't save the recipients. Please send the names again.",
+	"names.matched":             "Matched recipients: {{.Recipients}}.\nWhat game do you want to invite them to? Add something like \"tone: formal\" to change how the invitation sounds.",
+	"names.edited":              "Updated recipients: {{.Recipients}}.\nWhat game do you want to invite them to?",
+	"names.edited_confirm":      "Updated recipients: {{.Recipients}}.\nDid you mean *{{.Game}}*? Say \"yes\" to send the invitation, or type the game name as you want it.",
+	"names.edit_expired":        "That invitation has already been sent or cancelled. Message me whenever you want to invite people.",
+	"game.tone_saved":           "Got it. What game do you want to invite them to?",
+	"game.rejected":             "Okay. What game do you want to invite them to?",
+	"game.confirm":              "Did you mean *{{.Game}}*? Say \"yes\" to send the invitation, or type the game name as you want it.",
+	"game.failed":               "Sorry, something went wrong. Please send the game name again.",
+	"invite.inviter_failed":     "Error fetching your user info: {{.Error}}",
+	"invite.build_failed":       "Error building invitation: {{.Error}}",
+	"invite.skipped":            "{{.Recipients}} didn't get the invitation, their Slack account has been deactivated.",
+	"invite.deferred":           "{{.Recipients}} will get the invitation when their quiet hours end.",
+	"invite.all_skipped":        "Nobody got the invitation: the Slack accounts of {{.Recipients}} have been deactivated. Message me again to invite someone else.",
+	"invite.send_failed":        "Failed to send invitation to some recipients: {{.Error}}",
+}
+
+// replyData is the data available to reply templates. Each reply only fills the fields it uses.
+type replyData struct {
+	Recipients string // comma separated names of the matched users
+	Game       string
+	Problems   string // one line per name that could not be resolved, each ending in a newline
+	Error      string
+	Regulars   bool // whether REGULARS is configured
+}
+
+// sampleReplyData is rendered with every template at startup to catch unknown fields.
+var sampleReplyData = replyData{Recipients: "Bob, Carol", Game: "Chess", Problems: "No match for \"Dave\".\n", Error: "timeout", Regulars: true}
+
+// replyTemplates holds the parsed reply templates by key.
+type replyTemplates map[string]*template.Template
+
+// defaultReplyTemplates are the parsed defaultReplies, used for keys a replyTemplates lacks.
+var defaultReplyTemplates = mustParseReplies(defaultReplies)
+
+// mustParseReplies parses built-in reply texts, panicking if one is broken.
+func mustParseReplies(texts map[string]string) replyTemplates {
+	replies, err := parseReplies(texts)
+	if err != nil {
+		panic(err)
+	}
+	return replies
+}
+
+// parseReplies parses reply texts, failing on unknown keys, syntax errors and unknown fields.
+func parseReplies(texts map[string]string) (replyTemplates, error) {
+	replies := make(replyTemplates, len(texts))
+	for key, text := range texts {
+		if _, ok := defaultReplies[key]; !ok {
+			return nil, fmt.Errorf("unknown reply %q, expected one of %s", key, strings.Join(replyKeys(), ", "))
+		}
+		tmpl, err := template.New(key).Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		if err := tmpl.Execute(&strings.Builder{}, sampleReplyData); err != nil {
+			return nil, err
+		}
+		replies[key] = tmpl
+	}
+	return replies, nil
+}
+
+// loadReplyTemplates reads reply overrides from a JSON file mapping reply keys to templates.
+// Keys the file doesn't mention keep their default text. An empty path means no overrides.
+func loadReplyTemplates(path string) (replyTemplates, error) {
+	if path == "" {
+		return defaultReplyTemplates, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var overrides map[string]string
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, err
+	}
+	replies, err := parseReplies(overrides)
+	if err != nil {
+		return nil, err
+	}
+	for key, tmpl := range defaultReplyTemplates {
+		if _, ok := replies[key]; !ok {
+			replies[key] = tmpl
+		}
+	}
+	return replies, nil
+}
+
+// replyKeys lists the known reply keys in alphabetical order.
+func replyKeys() []string {
+	keys := make([]string, 0, len(defaultReplies))
+	for key := range defaultReplies {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// render executes the reply template for key. Templates are checked at startup, so a failure
+// here is unexpected; it is logged and the default text is used instead.
+func (r replyTemplates) render(key string, data replyData) string {
+	tmpl, ok := r[key]
+	if !ok {
+		tmpl = defaultReplyTemplates[key]
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		logger.Error("Error rendering reply template, using the default", "reply", key, "error", err)
+		b.Reset()
+		if err := defaultReplyTemplates[key].Execute(&b, data); err != nil {
+			return ""
+		}
+	}
+	return b.String()
+}
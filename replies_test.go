@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDefaultRepliesRender(t *testing.T) {
+	for _, key := range replyKeys() {
+		t.Run(key, func(t *testing.T) {
+			got := defaultReplyTemplates.render(key, sampleReplyData)
+			if strings.TrimSpace(got) == "" || strings.Contains(got, "<no value>") {
+				t.Errorf("render(%q) = %q", key, got)
+			}
+		})
+	}
+
+	tests := []struct {
+		key  string
+		data replyData
+		want string
+	}{
+		{key: "greeting.ask_names", data: replyData{Regulars: true}, want: `Who do you want to message? Please provide a comma separated list of names (or just say "regulars"), or say "cancel" at any time to stop.`},
+		{key: "greeting.ask_names", want: `Who do you want to message? Please provide a comma separated list of names, or say "cancel" at any time to stop.`},
+		{key: "names.matched", data: replyData{Recipients: "Bob Baker, Carol Cooper"}, want: "Matched recipients: Bob Baker, Carol Cooper.\nWhat game do you want to invite them to? Add something like \"tone: formal\" to change how the invitation sounds."},
+		{key: "names.unresolved", data: replyData{Problems: "No match for \"Dave\".\n"}, want: "No match for \"Dave\".\nPlease provide a correct comma separated list of names."},
+		{key: "game.confirm", data: replyData{Game: "Catan"}, want: `Did you mean *Catan*? Say "yes" to send the invitation, or type the game name as you want it.`},
+		{key: "invite.send_failed", data: replyData{Error: "channel_not_found"}, want: "Failed to send invitation to some recipients: channel_not_found"},
+	}
+	for _, tt := range tests {
+		if got := defaultReplyTemplates.render(tt.key, tt.data); got != tt.want {
+			t.Errorf("render(%q, %+v) = %q, want %q", tt.key, tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestLoadReplyTemplates(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		want    map[string]string // key -> rendered with sampleReplyData
+		wantErr string
+	}{
+		{
+			name: "overrides keep the other defaults",
+			file: `{"greeting.hello": "¡Hola!", "names.matched": "Destinatarios: {{.Recipients}}. ¿A qué juego?"}`,
+			want: map[string]string{
+				"greeting.hello": "¡Hola!",
+				"names.matched":  "Destinatarios: Bob, Carol. ¿A qué juego?",
+				"game.confirm":   `Did you mean *Chess*? Say "yes" to send the invitation, or type the game name as you want it.`,
+			},
+		},
+		{name: "unknown key", file: `{"greeting.bye": "Bye"}`, wantErr: `unknown reply "greeting.bye"`},
+		{name: "unknown field", file: `{"names.matched": "Sending to {{.Invitees}}"}`, wantErr: "can't evaluate field Invitees"},
+		{name: "syntax error", file: `{"names.matched": "Sending to {{.Recipients"}`, wantErr: "unclosed action"},
+		{name: "not JSON", file: `greeting.hello=Hola`, wantErr: "invalid character"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "replies.json")
+			if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			replies, err := loadReplyTemplates(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadReplyTemplates() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(replies) != len(defaultReplies) {
+				t.Errorf("got %d replies, want all %d", len(replies), len(defaultReplies))
+			}
+			for key, want := range tt.want {
+				if got := replies.render(key, sampleReplyData); got != want {
+					t.Errorf("render(%q) = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestConversationUsesReplyOverrides(t *testing.T) {
+	replies, err := parseReplies(map[string]string{"greeting.hello": "¡Hola!", "names.matched": "Destinatarios: {{.Recipients}}. ¿A qué juego?"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, tmpl := range defaultReplyTemplates {
+		if _, ok := replies[key]; !ok {
+			replies[key] = tmpl
+		}
+	}
+	fake := newFakeSlack(t, testUsers...)
+	config := testConfig()
+	config.Replies = replies
+	h, _ := newTestBotHandler(t, fake, config, &fakeGenerator{invitation: "Come play!"})
+	h.processEvent(directMessage("U1", "hi"))
+	h.processEvent(directMessage("U1", "bob"))
+
+	got := fake.postsTo("DU1")
+	want := []string{"¡Hola! " + defaultReplyTemplates.render("greeting.ask_names", replyData{}), "Destinatarios: Bob Baker. ¿A qué juego?"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("replies = %q, want %q", got, want)
+	}
+}
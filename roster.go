@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// rosterBlockID identifies the live roster block in an invitation message.
+const rosterBlockID = "rsvp_roster"
+
+// inviteMessage is one posted copy of an invitation, which the live roster keeps up to date.
+type inviteMessage struct {
+	Channel string        `json:"channel"`
+	TS      string        `json:"ts"`
+	Blocks  *slack.Blocks `json:"blocks,omitempty"` // the copy's own blocks, when its text differs from the invitation's
+}
+
+// rosterMaxNames is the most names the roster lists per status; the rest are counted, so a large
+// invitation's roster stays within Slack's text limit.
+const rosterMaxNames = 10
+
+// rosterText describes who is coming in one line, such as "Going: Alice, Bob · Maybe: Carol".
+func rosterText(tally RSVPTally) string {
+	going := "nobody yet"
+	if tally.Accepted.Count > 0 {
+		going = rosterNames(tally.Accepted.Names)
+	}
+	text := ":busts_in_silhouette: *Going:* " + going
+	if tally.Maybe.Count > 0 {
+		text += " · *Maybe:* " + rosterNames(tally.Maybe.Names)
+	}
+	return text
+}
+
+// rosterNames lists names, shortening long lists to the first rosterMaxNames and a count of the
+// others, such as "Alice, Bob and 40 others".
+func rosterNames(names []string) string {
+	if len(names) <= rosterMaxNames {
+		return strings.Join(names, ", ")
+	}
+	others := len(names) - rosterMaxNames
+	if others == 1 {
+		return strings.Join(names[:rosterMaxNames], ", ") + " and 1 other"
+	}
+	return strings.Join(names[:rosterMaxNames], ", ") + " and " + strconv.Itoa(others) + " others"
+}
+
+// withRoster returns blocks with the roster for tally above the invitation buttons, replacing
+// any earlier roster.
+func withRoster(blocks []slack.Block, tally RSVPTally) []slack.Block {
+	roster := slack.NewContextBlock(rosterBlockID, slack.NewTextBlockObject("mrkdwn", rosterText(tally), false, false))
+	updated := make([]slack.Block, 0, len(blocks)+1)
+	placed := false
+	for _, block := range blocks {
+		if context, ok := block.(*slack.ContextBlock); ok && context.BlockID == rosterBlockID {
+			continue
+		}
+		if actions, ok := block.(*slack.ActionBlock); ok && actions.BlockID == "game_actions" && !placed {
+			updated = append(updated, roster)
+			placed = true
+		}
+		updated = append(updated, block)
+	}
+	if !placed {
+		updated = append(updated, roster)
+	}
+	return updated
+}
+
+// refreshRoster re-renders every copy of inviteID's invitation with the current roster. The
+// copies and blocks come from the RSVP record; clicked, the message the answer came from, is
+// updated too in case it isn't recorded, as for scheduled invitations, using clickedBlocks if
+// the record has none. Failures are logged and don't affect the answer itself.
+func (h *InteractionHandler) refreshRoster(inviteID string, clicked inviteMessage, clickedBlocks []slack.Block) {
+	record, ok, err := h.rsvps.load(inviteID)
+	if err != nil || !ok {
+		if err != nil {
+			logger.Error("Error loading RSVPs for the roster", "invite_id", inviteID, "error", err)
+		}
+		return
+	}
+	blocks := clickedBlocks
+	if record.Blocks != nil && len(record.Blocks.BlockSet) > 0 {
+		blocks = record.Blocks.BlockSet
+	}
+	tally := record.tally()
+
+	messages := record.Messages
+	if clicked.Channel != "" && clicked.TS != "" {
+		known := false
+		for _, message := range messages {
+			known = known || (message.Channel == clicked.Channel && message.TS == clicked.TS)
+		}
+		if !known {
+			messages = append(messages, clicked)
+		}
+	}
+	for _, message := range messages {
+		messageBlocks := blocks
+		if message.Blocks != nil && len(message.Blocks.BlockSet) > 0 {
+			messageBlocks = message.Blocks.BlockSet
+		}
+		if len(messageBlocks) == 0 {
+			continue
+		}
+		updated := withRoster(messageBlocks, tally)
+		if err := validateBlocks(updated); err != nil {
+			logger.Warn("Skipping an invalid invitation roster", "invite_id", inviteID, "channel", message.Channel, "error", err)
+			continue
+		}
+		h.sender.pacer.wait()
+		options := []slack.MsgOption{
+			slack.MsgOptionText(invitationTitlePrefix+record.Game, false),
+			slack.MsgOptionBlocks(updated...),
+		}
+		if _, _, _, err := h.slackClient.UpdateMessage(message.Channel, message.TS, options...); err != nil {
+			logger.Warn("Failed to update the invitation roster", "invite_id", inviteID, "channel", message.Channel, "error", err)
+		}
+	}
+}
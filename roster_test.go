@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+func TestRosterUpdatesOnAnswers(t *testing.T) {
+	tests := []struct {
+		name        string
+		answers     [][2]string // user ID and action ID, in order
+		failChannel string      // a DM whose updates fail
+		wantRoster  string
+	}{
+		{
+			name:       "two accepts",
+			answers:    [][2]string{{"U2", actionAcceptGame}, {"U3", actionAcceptGame}},
+			wantRoster: "*Going:* Bob Baker, Carol Cooper",
+		},
+		{
+			name:       "maybe and a changed mind",
+			answers:    [][2]string{{"U2", actionAcceptGame}, {"U3", actionMaybeGame}, {"U2", actionDeclineGame}},
+			wantRoster: "*Going:* nobody yet · *Maybe:* Carol Cooper",
+		},
+		{
+			name:        "one copy can't be updated",
+			answers:     [][2]string{{"U2", actionAcceptGame}, {"U3", actionAcceptGame}},
+			failChannel: "U3",
+			wantRoster:  "*Going:* Bob Baker, Carol Cooper",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			config := testConfig()
+			config.ActionSigningSecret = testActionSecret
+			h, _ := newTestInviteHandler(t, fake, config)
+			status, response := h.sendInvite(InviteRequest{GameName: "Catan", UserIDs: []string{"U2", "U3"}})
+			if status != 200 {
+				t.Fatalf("sending answered %d: %v", status, response)
+			}
+			if tt.failChannel != "" {
+				fake.failUpdates(tt.failChannel, "message_not_found")
+			}
+			interactions := NewInteractionHandler(fake.client(), h.userCache, h.sender, testActionSecret, nil, nil, nil, h.rsvps, newInviterNotifier(NewInMemoryStore(), h.sender, 0), h.pending)
+			value := inviteActionValue{Game: "Catan", InviteID: response["invite_id"].(string)}
+			for _, answer := range tt.answers {
+				click(interactions, answer[0], answer[1], value)
+			}
+			interactions.wait()
+
+			latest := make(map[string]fakePost)
+			for _, update := range fake.allUpdates() {
+				latest[update.Channel] = update
+			}
+			for _, post := range fake.allPosts() {
+				if post.Channel == tt.failChannel {
+					continue
+				}
+				update, ok := latest[post.Channel]
+				if !ok {
+					t.Errorf("the invitation in %s was never updated", post.Channel)
+					continue
+				}
+				if update.TS != post.TS {
+					t.Errorf("updated message %s in %s, want %s", update.TS, post.Channel, post.TS)
+				}
+				if !strings.Contains(update.Blocks, tt.wantRoster) {
+					t.Errorf("roster in %s = %s, want %q", post.Channel, update.Blocks, tt.wantRoster)
+				}
+				if strings.Count(update.Blocks, rosterBlockID) != 1 || !strings.Contains(update.Blocks, actionAcceptGame) {
+					t.Errorf("updated blocks %s should keep the buttons and hold one roster", update.Blocks)
+				}
+			}
+		})
+	}
+}
+
+func TestWithRosterReplacesEarlierRoster(t *testing.T) {
+	blocks := []slack.Block{
+		slack.NewHeaderBlock(slack.NewTextBlockObject("plain_text", "Game Invitation: Catan", false, false)),
+		slack.NewActionBlock("game_actions"),
+	}
+	once := withRoster(blocks, RSVPTally{Accepted: RSVPGroup{Count: 1, Names: []string{"Bob"}}})
+	twice := withRoster(once, RSVPTally{Accepted: RSVPGroup{Count: 2, Names: []string{"Bob", "Carol"}}})
+	if len(twice) != 3 {
+		t.Fatalf("got %d blocks, want header, roster and buttons", len(twice))
+	}
+	roster, ok := twice[1].(*slack.ContextBlock)
+	if !ok || roster.BlockID != rosterBlockID {
+		t.Fatalf("block 1 = %#v, want the roster above the buttons", twice[1])
+	}
+	if text := roster.ContextElements.Elements[0].(*slack.TextBlockObject).Text; !strings.HasSuffix(text, "*Going:* Bob, Carol") {
+		t.Errorf("roster = %q", text)
+	}
+}
+
+func TestRosterTextShortensLongLists(t *testing.T) {
+	names := func(n int) []string {
+		list := make([]string, n)
+		for i := range list {
+			list[i] = fmt.Sprintf("Player %02d %s", i+1, strings.Repeat("x", 70))
+		}
+		return list
+	}
+	tests := []struct {
+		name     string
+		going    int
+		maybe    int
+		wantTail string // how the Going list ends
+	}{
+		{name: "within the limit", going: rosterMaxNames, wantTail: "Player 10 " + strings.Repeat("x", 70)},
+		{name: "one over", going: rosterMaxNames + 1, wantTail: " and 1 other"},
+		{name: "hundreds answering", going: 300, maybe: 200, wantTail: " and 290 others"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tally := RSVPTally{Accepted: RSVPGroup{Count: tt.going, Names: names(tt.going)}, Maybe: RSVPGroup{Count: tt.maybe, Names: names(tt.maybe)}}
+			text := rosterText(tally)
+			going, _, _ := strings.Cut(text, " · ")
+			if !strings.HasSuffix(going, tt.wantTail) {
+				t.Errorf("rosterText() = %q, want the Going list to end in %q", text, tt.wantTail)
+			}
+			blocks := withRoster([]slack.Block{slack.NewActionBlock("game_actions", slack.NewButtonBlockElement(actionAcceptGame, "v", slack.NewTextBlockObject("plain_text", "Accept", false, false)))}, tally)
+			if err := validateBlocks(blocks); err != nil {
+				t.Errorf("roster blocks are invalid: %v", err)
+			}
+		})
+	}
+}
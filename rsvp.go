@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/slack-go/slack"
+)
+
+// rsvpKeyPrefix namespaces RSVP records in the shared Store.
+const rsvpKeyPrefix = "rsvp:"
+
+// rsvpRetention is how long an invitation's RSVPs are kept.
+const rsvpRetention = 30 * 24 * time.Hour
+
+// RSVP statuses, as recorded by the invitation buttons.
+const (
+	rsvpAccepted   = "accepted"
+	rsvpInterested = "interested"
+	rsvpDeclined   = "declined"
+)
+
+// rsvpResponse is one recipient's latest answer to an invitation.
+type rsvpResponse struct {
+	Name        string    `json:"name"`
+	Status      string    `json:"status"`
+	RespondedAt time.Time `json:"responded_at,omitempty"` // when the answer was given; zero for answers recorded before it was kept
+	TimeSlot    string    `json:"time_slot,omitempty"`    // the preferred time picked, for invitations offering time_slots
+}
+
+// rsvpRecord holds the answers to one invitation, keyed by responder user ID.
+type rsvpRecord struct {
+	InviteID  string                  `json:"invite_id"`
+	Game      string                  `json:"game"`
+	InviterID string                  `json:"inviter_id,omitempty"`
+	TimeSlots []string                `json:"time_slots,omitempty"` // candidate times offered, in order
+	Responses map[string]rsvpResponse `json:"responses"`
+	Blocks    *slack.Blocks           `json:"blocks,omitempty"`   // the invitation as posted, re-rendered with the live roster
+	Messages  []inviteMessage         `json:"messages,omitempty"` // the copies posted right away
+
+	// AccessCode, when set, must be entered to accept; CodeAttempts counts each recipient's
+	// wrong tries.
+	AccessCode   string         `json:"access_code,omitempty"`
+	CodeAttempts map[string]int `json:"code_attempts,omitempty"`
+}
+
+// RSVPGroup lists the responders with one status.
+type RSVPGroup struct {
+	Count int      `json:"count"`
+	Names []string `json:"names"`
+}
+
+// RSVPTimeSlot lists who prefers one of the times an invitation offered.
+type RSVPTimeSlot struct {
+	Time  string   `json:"time"`
+	Count int      `json:"count"`
+	Names []string `json:"names"`
+}
+
+// RSVPTally is the current state of an invitation's responses, as served by
+// GET /invite/:id/rsvp. Time slots only count the picks of recipients who accepted or might join.
+type RSVPTally struct {
+	InviteID  string         `json:"invite_id"`
+	Game      string         `json:"game"`
+	InviterID string         `json:"-"`
+	Accepted  RSVPGroup      `json:"accepted"`
+	Maybe     RSVPGroup      `json:"maybe"`
+	Declined  RSVPGroup      `json:"declined"`
+	TimeSlots []RSVPTimeSlot `json:"time_slots,omitempty"`
+	// PopularTimeSlot is the time picked most, the earliest offered on a tie; empty until
+	// someone picks one.
+	PopularTimeSlot string `json:"popular_time_slot,omitempty"`
+}
+
+// tally groups the record's responses by status, with names sorted for stable output.
+func (r rsvpRecord) tally() RSVPTally {
+	t := RSVPTally{
+		InviteID:  r.InviteID,
+		Game:      r.Game,
+		InviterID: r.InviterID,
+		Accepted:  RSVPGroup{Names: []string{}},
+		Maybe:     RSVPGroup{Names: []string{}},
+		Declined:  RSVPGroup{Names: []string{}},
+	}
+	slots := make(map[string]*RSVPTimeSlot, len(r.TimeSlots))
+	for _, slot := range r.TimeSlots {
+		t.TimeSlots = append(t.TimeSlots, RSVPTimeSlot{Time: slot, Names: []string{}})
+	}
+	for i := range t.TimeSlots {
+		slots[t.TimeSlots[i].Time] = &t.TimeSlots[i]
+	}
+	for _, response := range r.Responses {
+		var group *RSVPGroup
+		switch response.Status {
+		case rsvpAccepted:
+			group = &t.Accepted
+		case rsvpInterested:
+			group = &t.Maybe
+		case rsvpDeclined:
+			group = &t.Declined
+		default:
+			continue
+		}
+		group.Count++
+		group.Names = append(group.Names, response.Name)
+		if slot := slots[response.TimeSlot]; slot != nil && response.Status != rsvpDeclined {
+			slot.Count++
+			slot.Names = append(slot.Names, response.Name)
+		}
+	}
+	for _, group := range []*RSVPGroup{&t.Accepted, &t.Maybe, &t.Declined} {
+		sort.Strings(group.Names)
+	}
+	best := 0
+	for _, slot := range t.TimeSlots {
+		sort.Strings(slot.Names)
+		if slot.Count > best {
+			best = slot.Count
+			t.PopularTimeSlot = slot.Time
+		}
+	}
+	return t
+}
+
+// summary describes the tally in one line for the inviter.
+func (t RSVPTally) summary() string {
+	summary := fmt.Sprintf("So far: %d accepted, %d maybe, %d declined.", t.Accepted.Count, t.Maybe.Count, t.Declined.Count)
+	if t.PopularTimeSlot != "" {
+		for _, slot := range t.TimeSlots {
+			if slot.Time == t.PopularTimeSlot {
+				summary += fmt.Sprintf(" Most popular time: %s (%d).", slot.Time, slot.Count)
+			}
+		}
+	}
+	return summary
+}
+
+// rsvpTracker records who answered each invitation, keyed by the invite ID embedded in the
+// invitation's button values.
+type rsvpTracker struct {
+	store Store
+}
+
+// newRSVPTracker keeps RSVP records in store.
+func newRSVPTracker(store Store) *rsvpTracker {
+	return &rsvpTracker{store: store}
+}
+
+// newInviteID returns a random ID for a new invitation.
+func newInviteID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand doesn't fail on supported platforms.
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// start creates an empty record for a new invitation, so its tally can be fetched before anyone
+// answers. timeSlots are the candidate times offered with it, if any, and accessCode the code
+// accepting it needs, if any.
+func (t *rsvpTracker) start(inviteID, game, inviterID string, timeSlots []string, accessCode string) error {
+	return t.save(rsvpRecord{InviteID: inviteID, Game: game, InviterID: inviterID, TimeSlots: timeSlots, AccessCode: accessCode, Responses: map[string]rsvpResponse{}})
+}
+
+// get returns the tally for inviteID, reporting whether the invitation is known.
+func (t *rsvpTracker) get(inviteID string) (RSVPTally, bool, error) {
+	record, ok, err := t.load(inviteID)
+	if err != nil || !ok {
+		return RSVPTally{}, ok, err
+	}
+	return record.tally(), true, nil
+}
+
+// record stores userID's answer to inviteID, replacing any earlier one, and returns the
+// updated tally.
+func (t *rsvpTracker) record(inviteID, game, userID, name, status string) (RSVPTally, error) {
+	record, err := t.update(inviteID, func(record *rsvpRecord, ok bool) error {
+		if !ok {
+			// The record expired or predates tracking; start over from this answer.
+			record.Game = game
+		}
+		// A preferred time picked earlier stays with the new answer.
+		record.Responses[userID] = rsvpResponse{Name: name, Status: status, RespondedAt: time.Now().UTC(), TimeSlot: record.Responses[userID].TimeSlot}
+		return nil
+	})
+	if err != nil {
+		return RSVPTally{}, err
+	}
+	return record.tally(), nil
+}
+
+// addMessages records the blocks and posted copies of inviteID's invitation, so the roster can
+// be kept up to date on each of them.
+func (t *rsvpTracker) addMessages(inviteID string, blocks []slack.Block, messages []inviteMessage) error {
+	_, err := t.update(inviteID, func(record *rsvpRecord, ok bool) error {
+		if !ok {
+			return fmt.Errorf("no RSVP record for invite %s", inviteID)
+		}
+		record.Blocks = &slack.Blocks{BlockSet: blocks}
+		record.Messages = append(record.Messages, messages...)
+		return nil
+	})
+	return err
+}
+
+// errUnchanged is returned by an update's change function to leave the record as it was.
+var errUnchanged = errors.New("record unchanged")
+
+// update applies change to inviteID's record in one atomic Store update, so answers given at
+// the same moment, on this instance or another, can't overwrite each other. change gets an
+// empty record with ok false when there is none yet, and may be called more than once. An
+// error from it is returned, and the record left as it was; errUnchanged does the same without
+// failing. update returns the record as it now stands.
+func (t *rsvpTracker) update(inviteID string, change func(record *rsvpRecord, ok bool) error) (rsvpRecord, error) {
+	var record rsvpRecord
+	err := t.store.Update(rsvpKeyPrefix+inviteID, rsvpRetention, func(data []byte, ok bool) ([]byte, error) {
+		record = rsvpRecord{InviteID: inviteID, Responses: map[string]rsvpResponse{}}
+		if ok {
+			var err error
+			if record, err = decodeRSVPRecord(inviteID, data); err != nil {
+				return nil, err
+			}
+		}
+		if err := change(&record, ok); err != nil {
+			return nil, err
+		}
+		return json.Marshal(record)
+	})
+	if errors.Is(err, errUnchanged) {
+		err = nil
+	}
+	return record, err
+}
+
+func (t *rsvpTracker) load(inviteID string) (rsvpRecord, bool, error) {
+	data, ok, err := t.store.Get(rsvpKeyPrefix + inviteID)
+	if err != nil || !ok {
+		return rsvpRecord{}, false, err
+	}
+	record, err := decodeRSVPRecord(inviteID, data)
+	return record, err == nil, err
+}
+
+// decodeRSVPRecord decodes the stored record of inviteID.
+func decodeRSVPRecord(inviteID string, data []byte) (rsvpRecord, error) {
+	var record rsvpRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return rsvpRecord{}, fmt.Errorf("decoding RSVPs for invite %s: %w", inviteID, err)
+	}
+	if record.Responses == nil {
+		record.Responses = map[string]rsvpResponse{}
+	}
+	return record, nil
+}
+
+func (t *rsvpTracker) save(record rsvpRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return t.store.Set(rsvpKeyPrefix+record.InviteID, data, rsvpRetention)
+}
+
+// GetRSVPs returns the current RSVP tally of the invitation with the given ID.
+func (h *GameInviteHandler) GetRSVPs(c *gin.Context) {
+	tally, ok, err := h.rsvps.get(c.Param("id"))
+	if err != nil {
+		logger.Error("Error loading RSVPs", "invite_id", c.Param("id"), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load RSVPs: " + err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No invitation with ID " + c.Param("id")})
+		return
+	}
+	c.JSON(http.StatusOK, tally)
+}
+
+// rsvpStatusLabels are the status names used in tallies and exports.
+var rsvpStatusLabels = map[string]string{rsvpAccepted: "accepted", rsvpInterested: "maybe", rsvpDeclined: "declined"}
+
+// spreadsheetSafe prefixes cell with a quote if it starts with a character spreadsheets read as
+// the start of a formula, so a display name such as "=HYPERLINK(...)" stays text when the export
+// is opened.
+func spreadsheetSafe(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// ExportRSVPs serves GET /invites/:id/export: the invitation's answers as a CSV file with one
+// row per responder, ordered by name. An invitation nobody has answered yet exports just the
+// header row.
+func (h *GameInviteHandler) ExportRSVPs(c *gin.Context) {
+	inviteID := c.Param("id")
+	record, ok, err := h.rsvps.load(inviteID)
+	if err != nil {
+		logger.Error("Error loading RSVPs", "invite_id", inviteID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load RSVPs: " + err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No invitation with ID " + inviteID})
+		return
+	}
+
+	userIDs := make([]string, 0, len(record.Responses))
+	for userID := range record.Responses {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Slice(userIDs, func(i, j int) bool {
+		a, b := record.Responses[userIDs[i]], record.Responses[userIDs[j]]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return userIDs[i] < userIDs[j]
+	})
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	_ = w.Write([]string{"user_id", "name", "status", "responded_at"})
+	for _, userID := range userIDs {
+		response := record.Responses[userID]
+		respondedAt := ""
+		if !response.RespondedAt.IsZero() {
+			respondedAt = response.RespondedAt.Format(time.RFC3339)
+		}
+		_ = w.Write([]string{userID, spreadsheetSafe(response.Name), rsvpStatusLabels[response.Status], respondedAt})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write the export: " + err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "rsvps-"+inviteID+".csv"))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", b.Bytes())
+}
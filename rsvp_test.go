@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+)
+
+func TestExportRSVPs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	type answer struct{ userID, name, status string }
+	tests := []struct {
+		name     string
+		started  bool // whether the invitation was sent
+		answers  []answer
+		wantCode int
+		wantRows [][]string // without the responded_at column
+	}{
+		{name: "unknown invitation", wantCode: http.StatusNotFound},
+		{name: "nobody answered yet", started: true, wantCode: http.StatusOK, wantRows: [][]string{}},
+		{
+			name:     "answers ordered by name, latest answer wins",
+			started:  true,
+			answers:  []answer{{"U3", "Carol Cooper", rsvpDeclined}, {"U2", "Bob Baker", rsvpAccepted}, {"U3", "Carol Cooper", rsvpInterested}},
+			wantCode: http.StatusOK,
+			wantRows: [][]string{{"U2", "Bob Baker", "accepted"}, {"U3", "Carol Cooper", "maybe"}},
+		},
+		{
+			name:     "names that would run as formulas are quoted",
+			started:  true,
+			answers:  []answer{{"U2", "=HYPERLINK(\"http://x\")", rsvpAccepted}, {"U3", "@Carol", rsvpDeclined}, {"U4", "-1+1", rsvpInterested}, {"U5", "+Dan", rsvpAccepted}},
+			wantCode: http.StatusOK,
+			wantRows: [][]string{{"U5", "'+Dan", "accepted"}, {"U4", "'-1+1", "maybe"}, {"U2", "'=HYPERLINK(\"http://x\")", "accepted"}, {"U3", "'@Carol", "declined"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			h, _ := newTestInviteHandler(t, fake, testConfig())
+			if tt.started {
+				if err := h.rsvps.start("inv1", "Catan", "", nil, ""); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, a := range tt.answers {
+				if _, err := h.rsvps.record("inv1", "Catan", a.userID, a.name, a.status); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := gin.New()
+			r.GET("/invites/scheduled", h.ListScheduledInvites)
+			r.GET("/invites/:id/export", h.ExportRSVPs)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/invites/inv1/export", nil))
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			if got := w.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+				t.Errorf("Content-Type = %q, want text/csv", got)
+			}
+			if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="rsvps-inv1.csv"` {
+				t.Errorf("Content-Disposition = %q", got)
+			}
+			rows, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(rows[0], ",") != "user_id,name,status,responded_at" {
+				t.Errorf("header = %q", rows[0])
+			}
+			rows = rows[1:]
+			if len(rows) != len(tt.wantRows) {
+				t.Fatalf("rows = %q, want %q", rows, tt.wantRows)
+			}
+			for i, row := range rows {
+				if strings.Join(row[:3], ",") != strings.Join(tt.wantRows[i], ",") {
+					t.Errorf("row %d = %q, want %q", i, row, tt.wantRows[i])
+				}
+				if respondedAt, err := time.Parse(time.RFC3339, row[3]); err != nil || time.Since(respondedAt) > time.Minute {
+					t.Errorf("row %d responded_at = %q, want the time of the answer", i, row[3])
+				}
+			}
+		})
+	}
+}
+
+func TestMaybeIsTalliedSeparately(t *testing.T) {
+	fake := newFakeSlack(t, testUsers...)
+	config := testConfig()
+	config.ActionSigningSecret = testActionSecret
+	h, _ := newTestInviteHandler(t, fake, config)
+	status, response := h.sendInvite(InviteRequest{GameName: "Catan", UserIDs: []string{"U2", "U3"}})
+	if status != http.StatusOK {
+		t.Fatalf("sendInvite = %d %v", status, response)
+	}
+	inviteID := response["invite_id"].(string)
+	interactions := NewInteractionHandler(fake.client(), h.userCache, h.sender, testActionSecret, nil, nil, nil, h.rsvps, newInviterNotifier(NewInMemoryStore(), h.sender, 0), h.pending)
+	value := inviteActionValue{Game: "Catan", InviteID: inviteID}
+	click(interactions, "U2", actionMaybeGame, value)
+	click(interactions, "U3", actionAcceptGame, value)
+	interactions.wait()
+
+	if got := fake.ephemeralsFor("U2"); len(got) != 1 || got[0] != "You might join the Catan invite." {
+		t.Errorf("Bob was told %q, want his maybe confirmed", got)
+	}
+	tally, ok, err := h.rsvps.get(inviteID)
+	if err != nil || !ok {
+		t.Fatalf("get(%q) = %v, %v", inviteID, ok, err)
+	}
+	if tally.Maybe.Count != 1 || strings.Join(tally.Maybe.Names, ",") != "Bob Baker" {
+		t.Errorf("maybe = %+v, want Bob Baker", tally.Maybe)
+	}
+	if tally.Accepted.Count != 1 || strings.Join(tally.Accepted.Names, ",") != "Carol Cooper" {
+		t.Errorf("accepted = %+v, want only Carol Cooper", tally.Accepted)
+	}
+	if tally.Declined.Count != 0 {
+		t.Errorf("declined = %+v, want nobody", tally.Declined)
+	}
+	if got, want := tally.summary(), "So far: 1 accepted, 1 maybe, 0 declined."; got != want {
+		t.Errorf("summary() = %q, want %q", got, want)
+	}
+	if got, want := rosterText(tally), ":busts_in_silhouette: *Going:* Carol Cooper · *Maybe:* Bob Baker"; got != want {
+		t.Errorf("rosterText() = %q, want %q", got, want)
+	}
+}
+
+func TestConcurrentAnswersOnTwoInstances(t *testing.T) {
+	server := miniredis.RunT(t)
+	var trackers [2]*rsvpTracker
+	for i := range trackers {
+		store, err := NewRedisStore("redis://" + server.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		trackers[i] = newRSVPTracker(store)
+	}
+	if err := trackers[0].start("inv1", "Catan", "U1", nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			userID := fmt.Sprintf("U%02d", i)
+			if _, err := trackers[i%2].record("inv1", "Catan", userID, userID, rsvpAccepted); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	tally, ok, err := trackers[0].get("inv1")
+	if err != nil || !ok {
+		t.Fatalf("get = %v, %v", ok, err)
+	}
+	if tally.Accepted.Count != 20 {
+		t.Errorf("accepted = %d, want all 20 answers kept", tally.Accepted.Count)
+	}
+	if keys := server.Keys(); len(keys) != 1 {
+		t.Errorf("keys left = %q, want only the RSVP record", keys)
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/slack-go/slack"
+)
+
+// maxScheduleAhead is how far ahead Slack accepts chat.scheduleMessage post_at times.
+const maxScheduleAhead = 120 * 24 * time.Hour
+
+// ScheduledInvite identifies an invitation queued with Slack. ChannelID and ScheduledMessageID
+// are what DELETE /invite/scheduled/:id needs to cancel it; ScheduledMessageID is empty when
+// Slack queued the invitation but looking up its ID failed.
+type ScheduledInvite struct {
+	Target             string `json:"target"` // the user or channel the invitation was addressed to
+	ChannelID          string `json:"channel_id"`
+	ScheduledMessageID string `json:"scheduled_message_id"`
+	// DeferredUntil (RFC3339) is set when the recipient's quiet hours moved the send to then.
+	DeferredUntil string `json:"deferred_until,omitempty"`
+}
+
+// validateSendAt checks that sendAt is a time Slack can schedule a message for.
+func validateSendAt(sendAt, now time.Time) error {
+	if !sendAt.After(now) {
+		return errors.New("send_at is in the past")
+	}
+	if sendAt.Sub(now) > maxScheduleAhead {
+		return errors.New("send_at can be at most 120 days ahead")
+	}
+	return nil
+}
+
+// schedule queues a message for postAt like slack.Client.ScheduleMessage and returns the channel
+// and scheduled message ID. text must be the message's fallback text. User IDs are resolved to
+// their DM channel first, since scheduled messages need a conversation ID. ScheduleMessage
+// doesn't return the scheduled message ID, so it is looked up afterwards by post time and text.
+func (s *messageSender) schedule(target string, postAt time.Time, text string, options ...slack.MsgOption) (string, string, error) {
+	defer s.acquire()()
+	channelID := target
+	if strings.HasPrefix(target, "U") || strings.HasPrefix(target, "W") {
+		s.pacer.wait()
+		channel, _, _, err := s.slackClient.OpenConversation(&slack.OpenConversationParameters{Users: []string{target}})
+		if err != nil {
+			return "", "", fmt.Errorf("opening DM: %w", s.scopes.explain(methodOpenConversation, err))
+		}
+		channelID = channel.ID
+	}
+
+	s.pacer.wait()
+	postAtUnix := strconv.FormatInt(postAt.Unix(), 10)
+	respChannel, _, err := s.slackClient.ScheduleMessage(channelID, postAtUnix, options...)
+	if err != nil {
+		return "", "", s.scopes.explain(methodScheduleMessage, err)
+	}
+	if respChannel != "" {
+		channelID = respChannel
+	}
+
+	messages, _, err := s.slackClient.GetScheduledMessages(&slack.GetScheduledMessagesParameters{
+		Channel: channelID,
+		Oldest:  postAtUnix,
+		Latest:  postAtUnix,
+	})
+	if err != nil {
+		return channelID, "", fmt.Errorf("scheduled, but looking up the scheduled message ID failed: %w", err)
+	}
+	// Identical invitations for the same time are interchangeable, so the newest match will do.
+	var found *slack.ScheduledMessage
+	for i, message := range messages {
+		if int64(message.PostAt) == postAt.Unix() && message.Text == text && (found == nil || message.DateCreated > found.DateCreated) {
+			found = &messages[i]
+		}
+	}
+	if found == nil {
+		return channelID, "", errors.New("scheduled, but Slack didn't list the scheduled message")
+	}
+	return channelID, found.ID, nil
+}
+
+// CancelScheduledInvite deletes a scheduled invitation before it is delivered. The :id is the
+// scheduled_message_id and the channel query parameter its channel_id, both as returned by
+// POST /invite with send_at.
+func (h *GameInviteHandler) CancelScheduledInvite(c *gin.Context) {
+	id := c.Param("id")
+	channelID := c.Query("channel")
+	if channelID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the channel query parameter is required"})
+		return
+	}
+
+	_, err := h.slackClient.DeleteScheduledMessage(&slack.DeleteScheduledMessageParameters{
+		Channel:            channelID,
+		ScheduledMessageID: id,
+	})
+	var slackErr slack.SlackErrorResponse
+	if errors.As(err, &slackErr) && (slackErr.Err == "invalid_scheduled_message_id" || slackErr.Err == "channel_not_found") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No scheduled invitation " + id + " in channel " + channelID})
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to delete scheduled invitation", "scheduled_message_id", id, "channel", channelID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel scheduled invitation: " + h.sender.scopes.explain(methodDeleteScheduled, err).Error()})
+		return
+	}
+	logger.Info("Cancelled scheduled invitation", "scheduled_message_id", id, "channel", channelID)
+	h.withdrawScheduled(id)
+	c.JSON(http.StatusOK, gin.H{"message": "Scheduled invitation cancelled"})
+}
+
+// withdrawScheduled forgets a cancelled message of a recorded invitation, so it is no longer
+// listed and no longer holds the invitation pending against MAX_PENDING_INVITES. Slack has
+// already dropped the message, so failures are only logged.
+func (h *GameInviteHandler) withdrawScheduled(scheduledMessageID string) {
+	invite, message, ok, err := h.scheduled.remove(scheduledMessageID)
+	if err != nil {
+		logger.Error("Error updating the scheduled invite record", "scheduled_message_id", scheduledMessageID, "error", err)
+	}
+	if !ok {
+		return
+	}
+	dm := strings.HasPrefix(message.Target, "U") || strings.HasPrefix(message.Target, "W")
+	if err := h.pending.withdraw(invite.InviteID, dm, len(invite.Messages) == 0 && invite.DeliveredNow == 0); err != nil {
+		logger.Error("Error updating the pending invitation", "invite_id", invite.InviteID, "error", err)
+		return
+	}
+	// The recipients left may all have answered already.
+	if tally, ok, err := h.rsvps.get(invite.InviteID); err == nil && ok {
+		h.pending.answered(invite.InviteID, tally)
+	}
+}
+
+// scheduledInviteKeyPrefix namespaces, by invite ID, the invitations queued with send_at.
+const scheduledInviteKeyPrefix = "scheduled_invite:"
+
+// scheduledInviteRetention is how long a scheduled invitation's record outlives its send time.
+const scheduledInviteRetention = time.Hour
+
+// ScheduledInviteRecord is an invitation queued with Slack for later delivery, as listed by
+// GET /invites/scheduled. Slack only knows the queued messages, so the invitation's details are
+// kept alongside them.
+type ScheduledInviteRecord struct {
+	InviteID       string            `json:"invite_id"`
+	InviterID      string            `json:"inviter_id,omitempty"`
+	Game           string            `json:"game"`
+	SendAt         time.Time         `json:"send_at"`
+	RecipientCount int               `json:"recipient_count"` // messages still queued
+	Messages       []ScheduledInvite `json:"messages"`
+	// DeliveredNow counts the targets that got the invitation right away, when only quiet hours
+	// held the others back.
+	DeliveredNow int `json:"delivered_now,omitempty"`
+}
+
+// scheduledInvites remembers the invitations queued with send_at, so they can be listed.
+type scheduledInvites struct {
+	store Store
+}
+
+// newScheduledInvites keeps scheduled invitation records in store.
+func newScheduledInvites(store Store) *scheduledInvites {
+	return &scheduledInvites{store: store}
+}
+
+// lastDelivery returns when the invitation's last queued message goes out: SendAt, or later
+// for messages quiet hours deferred.
+func (r ScheduledInviteRecord) lastDelivery() time.Time {
+	last := r.SendAt
+	for _, message := range r.Messages {
+		if deferred, err := time.Parse(time.RFC3339, message.DeferredUntil); err == nil && deferred.After(last) {
+			last = deferred
+		}
+	}
+	return last
+}
+
+// record saves an invitation queued with Slack until a while after its last message is
+// delivered.
+func (s *scheduledInvites) record(invite ScheduledInviteRecord) error {
+	invite.RecipientCount = len(invite.Messages)
+	data, err := json.Marshal(invite)
+	if err != nil {
+		return err
+	}
+	return s.store.Set(scheduledInviteKeyPrefix+invite.InviteID, data, time.Until(invite.lastDelivery())+scheduledInviteRetention)
+}
+
+// remove drops the message with scheduledMessageID from the invitation it was recorded with,
+// once it has been cancelled, returning the updated record and the message. ok is false if no
+// recorded invitation has it. An invitation with nothing left queued is forgotten.
+func (s *scheduledInvites) remove(scheduledMessageID string) (ScheduledInviteRecord, ScheduledInvite, bool, error) {
+	keys, err := s.store.Keys(scheduledInviteKeyPrefix)
+	if err != nil {
+		return ScheduledInviteRecord{}, ScheduledInvite{}, false, err
+	}
+	for _, key := range keys {
+		data, ok, err := s.store.Get(key)
+		if err != nil {
+			return ScheduledInviteRecord{}, ScheduledInvite{}, false, err
+		}
+		var invite ScheduledInviteRecord
+		if !ok || json.Unmarshal(data, &invite) != nil {
+			continue
+		}
+		for i, message := range invite.Messages {
+			if message.ScheduledMessageID != scheduledMessageID {
+				continue
+			}
+			invite.Messages = append(invite.Messages[:i], invite.Messages[i+1:]...)
+			if len(invite.Messages) == 0 {
+				_, err = s.store.Delete(key)
+			} else {
+				err = s.record(invite)
+			}
+			return invite, message, true, err
+		}
+	}
+	return ScheduledInviteRecord{}, ScheduledInvite{}, false, nil
+}
+
+// between returns the recorded invitations sending in [from, to], by send time. A zero bound
+// is open.
+func (s *scheduledInvites) between(from, to time.Time) ([]ScheduledInviteRecord, error) {
+	keys, err := s.store.Keys(scheduledInviteKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var invites []ScheduledInviteRecord
+	for _, key := range keys {
+		data, ok, err := s.store.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		var invite ScheduledInviteRecord
+		if err := json.Unmarshal(data, &invite); err != nil {
+			logger.Warn("Skipping unreadable scheduled invite", "key", key, "error", err)
+			continue
+		}
+		if (!from.IsZero() && invite.SendAt.Before(from)) || (!to.IsZero() && invite.SendAt.After(to)) {
+			continue
+		}
+		invites = append(invites, invite)
+	}
+	sort.Slice(invites, func(i, j int) bool { return invites[i].SendAt.Before(invites[j].SendAt) })
+	return invites, nil
+}
+
+// pendingScheduledMessages returns the IDs of the bot's messages Slack still has queued to post
+// in [oldest, latest], following pagination. Empty bounds are open.
+func (h *GameInviteHandler) pendingScheduledMessages(oldest, latest string) (map[string]bool, error) {
+	pending := make(map[string]bool)
+	params := &slack.GetScheduledMessagesParameters{Oldest: oldest, Latest: latest}
+	for {
+		messages, cursor, err := h.slackClient.GetScheduledMessages(params)
+		if err != nil {
+			return nil, err
+		}
+		for _, message := range messages {
+			pending[message.ID] = true
+		}
+		if cursor == "" {
+			return pending, nil
+		}
+		params.Cursor = cursor
+	}
+}
+
+// ListScheduledInvites serves GET /invites/scheduled: the invitations queued with send_at that
+// Slack hasn't delivered or had cancelled yet, soonest first. The optional from and to query
+// parameters (RFC3339) limit them to that range of send times. Messages cancelled with
+// DELETE /invite/scheduled/:id are left out, and invitations with none left aren't listed.
+func (h *GameInviteHandler) ListScheduledInvites(c *gin.Context) {
+	var bounds [2]time.Time
+	var unix [2]string
+	for i, name := range []string{"from", "to"} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be an RFC3339 timestamp such as 2024-05-01T17:00:00-05:00"})
+			return
+		}
+		bounds[i], unix[i] = parsed, strconv.FormatInt(parsed.Unix(), 10)
+	}
+
+	invites, err := h.scheduled.between(bounds[0], bounds[1])
+	if err != nil {
+		logger.Error("Error loading scheduled invites", "event_type", "api_invite", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load scheduled invites: " + err.Error()})
+		return
+	}
+	pending, err := h.pendingScheduledMessages(unix[0], unix[1])
+	if err != nil {
+		logger.Error("Failed to list scheduled messages", "event_type", "api_invite", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list scheduled messages: " + h.sender.scopes.explain(methodGetScheduled, err).Error()})
+		return
+	}
+
+	listed := []ScheduledInviteRecord{}
+	for _, invite := range invites {
+		var queued []ScheduledInvite
+		for _, message := range invite.Messages {
+			if pending[message.ScheduledMessageID] {
+				queued = append(queued, message)
+			}
+		}
+		if len(queued) == 0 {
+			continue
+		}
+		invite.Messages, invite.RecipientCount = queued, len(queued)
+		listed = append(listed, invite)
+	}
+	c.JSON(http.StatusOK, gin.H{"scheduled_invites": listed})
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/slack-go/slack"
+)
+
+// newTestInviteHandler builds a GameInviteHandler against the fake Slack with in-memory state.
+func newTestInviteHandler(t *testing.T, fake *fakeSlack, config *Config) (*GameInviteHandler, Store) {
+	t.Helper()
+	store := NewInMemoryStore()
+	client := fake.client()
+	users := newUserCache(client, time.Minute)
+	h := NewGameInviteHandler(client, config, users, newMessageSender(client, nil, newSendPacer(0, 0), 0, 0),
+		newChannelResolver(client, time.Minute), newGameCooldowns(store, config.GameCooldown, config.GameCooldowns), newRSVPTracker(store), newInviteJobs(store), newScheduledInvites(store), newDeliveryLog(store), newPendingInvites(store, config.MaxPendingInvites, config.PendingInviteTTL), newInvitationWriter(config, users, StaticGenerator{Message: "Come play!"}), newQuietHoursStore(store, users))
+	return h, store
+}
+
+func TestListScheduledInvites(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	base := time.Now().Add(time.Hour).Truncate(time.Second)
+	tests := []struct {
+		name      string
+		query     url.Values
+		wantGames []string
+		wantCount []int
+		wantCode  int
+	}{
+		{name: "all, soonest first", wantGames: []string{"Chess", "Catan"}, wantCount: []int{1, 2}},
+		{name: "from", query: url.Values{"from": {base.Add(90 * time.Minute).Format(time.RFC3339)}}, wantGames: []string{"Catan"}, wantCount: []int{2}},
+		{name: "to", query: url.Values{"to": {base.Add(time.Hour).Format(time.RFC3339)}}, wantGames: []string{"Chess"}, wantCount: []int{1}},
+		{name: "range matching nothing", query: url.Values{"from": {base.Add(3 * time.Hour).Format(time.RFC3339)}}, wantGames: []string{}},
+		{name: "bad bound", query: url.Values{"to": {"tomorrow"}}, wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			h, _ := newTestInviteHandler(t, fake, testConfig())
+
+			// Chess goes to two people but one of them was cancelled; Catan goes to two; the
+			// Mahjong invitation has already been delivered, so Slack no longer lists it.
+			seed := []struct {
+				game       string
+				sendAt     time.Time
+				recipients []string
+				cancelled  int
+				delivered  bool
+			}{
+				{game: "Catan", sendAt: base.Add(2 * time.Hour), recipients: []string{"U2", "U3"}},
+				{game: "Chess", sendAt: base, recipients: []string{"U2", "U3"}, cancelled: 1},
+				{game: "Mahjong", sendAt: base.Add(30 * time.Minute), recipients: []string{"U2"}, delivered: true},
+			}
+			for i, invite := range seed {
+				record := ScheduledInviteRecord{InviteID: fmt.Sprintf("inv%d", i), InviterID: "U1", Game: invite.game, SendAt: invite.sendAt}
+				for _, userID := range invite.recipients {
+					channelID, scheduledID, err := h.sender.schedule(userID, invite.sendAt, invitationTitlePrefix+invite.game, slack.MsgOptionText(invitationTitlePrefix+invite.game, false))
+					if err != nil {
+						t.Fatal(err)
+					}
+					record.Messages = append(record.Messages, ScheduledInvite{Target: userID, ChannelID: channelID, ScheduledMessageID: scheduledID})
+				}
+				if err := h.scheduled.record(record); err != nil {
+					t.Fatal(err)
+				}
+				withdrawn := record.Messages[:invite.cancelled]
+				if invite.delivered {
+					withdrawn = record.Messages
+				}
+				for _, message := range withdrawn {
+					fake.mutex.Lock()
+					for j := range fake.scheduled {
+						if fake.scheduled[j].ID == message.ScheduledMessageID {
+							fake.scheduled[j].Deleted = true
+						}
+					}
+					fake.mutex.Unlock()
+				}
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/invites/scheduled?"+tt.query.Encode(), nil)
+			h.ListScheduledInvites(c)
+
+			wantCode := tt.wantCode
+			if wantCode == 0 {
+				wantCode = http.StatusOK
+			}
+			if w.Code != wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, wantCode, w.Body)
+			}
+			if wantCode != http.StatusOK {
+				return
+			}
+			var body struct {
+				Invites []ScheduledInviteRecord `json:"scheduled_invites"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if len(body.Invites) != len(tt.wantGames) {
+				t.Fatalf("listed %+v, want games %q", body.Invites, tt.wantGames)
+			}
+			for i, invite := range body.Invites {
+				if invite.Game != tt.wantGames[i] || invite.RecipientCount != tt.wantCount[i] || len(invite.Messages) != tt.wantCount[i] || invite.InviterID != "U1" {
+					t.Errorf("invite %d = %+v, want game %q with %d recipients from U1", i, invite, tt.wantGames[i], tt.wantCount[i])
+				}
+			}
+		})
+	}
+}
+
+func TestScheduledInviteWithoutMessageID(t *testing.T) {
+	fake := newFakeSlack(t, testUsers...)
+	fake.failScheduledLists("internal_error")
+	h, _ := newTestInviteHandler(t, fake, testConfig())
+
+	sendAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	status, response := h.sendInvite(InviteRequest{GameName: "Catan", UserIDs: []string{"U2"}, Description: "Come play", SendAt: sendAt.Format(time.RFC3339)})
+	if status != http.StatusOK {
+		t.Fatalf("sendInvite = %d %v, want 200", status, response)
+	}
+	// Slack queued the invitation; only looking up its ID failed.
+	scheduled, _ := response["scheduled"].([]ScheduledInvite)
+	if len(scheduled) != 1 || scheduled[0].Target != "U2" || scheduled[0].ChannelID != "DU2" || scheduled[0].ScheduledMessageID != "" {
+		t.Errorf("scheduled = %+v, want Bob's invitation in DU2 without a message ID", scheduled)
+	}
+	if queued := fake.allScheduled(); len(queued) != 1 || queued[0].Channel != "DU2" || queued[0].PostAt != sendAt.Unix() {
+		t.Errorf("Slack queued %+v, want one invitation for Bob at %d", queued, sendAt.Unix())
+	}
+}
+
+func TestSendAtReturnsScheduledMessageIDs(t *testing.T) {
+	fake := newFakeSlack(t, testUsers...)
+	h, _ := newTestInviteHandler(t, fake, testConfig())
+
+	// An identical message queued earlier for the same time mustn't be mistaken for ours.
+	sendAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	if _, _, err := h.sender.schedule("U2", sendAt, invitationTitlePrefix+"Catan", slack.MsgOptionText(invitationTitlePrefix+"Catan", false)); err != nil {
+		t.Fatal(err)
+	}
+	status, response := h.sendInvite(InviteRequest{GameName: "Catan", UserIDs: []string{"U2", "U3"}, Description: "Come play", SendAt: sendAt.Format(time.RFC3339)})
+	if status != http.StatusOK {
+		t.Fatalf("sendInvite = %d %v, want 200", status, response)
+	}
+
+	want := map[string]string{} // channel -> ID of the invitation Slack queued there last
+	for _, queued := range fake.allScheduled() {
+		if queued.PostAt != sendAt.Unix() {
+			t.Errorf("Slack queued %+v, want it for %d", queued, sendAt.Unix())
+		}
+		want[queued.Channel] = queued.ID
+	}
+	scheduled, _ := response["scheduled"].([]ScheduledInvite)
+	if len(scheduled) != 2 {
+		t.Fatalf("scheduled = %+v, want Bob's and Carol's invitations", scheduled)
+	}
+	for _, invite := range scheduled {
+		if invite.ChannelID != "D"+invite.Target || invite.ScheduledMessageID == "" || invite.ScheduledMessageID != want[invite.ChannelID] {
+			t.Errorf("scheduled %+v, want the ID Slack lists for D%s, %q", invite, invite.Target, want["D"+invite.Target])
+		}
+	}
+}
+
+func TestScheduledInviteRetention(t *testing.T) {
+	sendAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	deferred := func(d time.Duration) string { return sendAt.Add(d).UTC().Format(time.RFC3339) }
+	tests := []struct {
+		name     string
+		messages []ScheduledInvite
+		wantKept time.Duration // how long past send_at the record is kept
+	}{
+		{name: "kept an hour after send_at", messages: []ScheduledInvite{{Target: "U2"}}, wantKept: time.Hour},
+		{name: "kept an hour after the latest deferred message", messages: []ScheduledInvite{{Target: "U2", DeferredUntil: deferred(3 * time.Hour)}, {Target: "U3", DeferredUntil: deferred(9 * time.Hour)}, {Target: "W4"}}, wantKept: 10 * time.Hour},
+		{name: "deferral earlier than send_at", messages: []ScheduledInvite{{Target: "U2", DeferredUntil: deferred(-30 * time.Minute)}}, wantKept: time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := miniredis.RunT(t)
+			store, err := NewRedisStore("redis://" + server.Addr())
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { store.Close() })
+
+			if err := newScheduledInvites(store).record(ScheduledInviteRecord{InviteID: "inv1", Game: "Catan", SendAt: sendAt, Messages: tt.messages}); err != nil {
+				t.Fatal(err)
+			}
+			want := time.Until(sendAt.Add(tt.wantKept))
+			if got := server.TTL(redisNamespace + scheduledInviteKeyPrefix + "inv1"); got < want-2*time.Second || got > want+time.Second {
+				t.Errorf("record kept for %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultPort is the TCP port the server listens on when PORT is unset.
+const defaultPort = "8080"
+
+// parseListenAddr builds the listen address from the HOST and PORT settings. A port starting
+// with a slash is a Unix socket path, and HOST is ignored then.
+func parseListenAddr(host, port string) (network, addr string, err error) {
+	host, port = strings.TrimSpace(host), strings.TrimSpace(port)
+	if strings.HasPrefix(port, "/") {
+		return "unix", port, nil
+	}
+	if port == "" {
+		port = defaultPort
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", "", fmt.Errorf("invalid PORT %q, expected a number from 1 to 65535 or a Unix socket path", port)
+	}
+	return "tcp", net.JoinHostPort(host, port), nil
+}
+
+// listen opens the configured listener. A socket file left behind by a previous run is removed
+// first, since binding to an existing path fails; any other file at the path is left alone.
+func listen(config *Config) (net.Listener, error) {
+	if config.ListenNetwork == "unix" {
+		if err := removeStaleSocket(config.ListenAddr); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen(config.ListenNetwork, config.ListenAddr)
+}
+
+// removeStaleSocket removes the Unix socket at path, if there is one. It refuses to remove
+// anything that isn't a socket, so a mistyped PORT can't delete an unrelated file.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("PORT %q is an existing file that isn't a Unix socket", path)
+	}
+	return os.Remove(path)
+}
+
+// newHTTPServer wraps handler in an http.Server with the configured timeouts, so slow or hung
+// clients on the public Slack endpoints can't hold connections open indefinitely.
+func newHTTPServer(config *Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              config.ListenAddr,
+		Handler:           handler,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+	}
+}
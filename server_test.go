@@ -0,0 +1,164 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRemoveStaleSocket(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      func(t *testing.T, path string)
+		wantErr    bool
+		wantExists bool
+	}{
+		{
+			name:  "missing path",
+			setup: func(t *testing.T, path string) {},
+		},
+		{
+			name: "stale socket",
+			setup: func(t *testing.T, path string) {
+				l, err := net.Listen("unix", path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// Keep the socket file around after closing, as a crashed run would.
+				l.(*net.UnixListener).SetUnlinkOnClose(false)
+				l.Close()
+			},
+		},
+		{
+			name: "regular file",
+			setup: func(t *testing.T, path string) {
+				if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr:    true,
+			wantExists: true,
+		},
+		{
+			name: "directory",
+			setup: func(t *testing.T, path string) {
+				if err := os.Mkdir(path, 0o700); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr:    true,
+			wantExists: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "bot.sock")
+			tt.setup(t, path)
+			err := removeStaleSocket(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("removeStaleSocket() error = %v, want error %v", err, tt.wantErr)
+			}
+			_, statErr := os.Lstat(path)
+			if exists := statErr == nil; exists != tt.wantExists {
+				t.Errorf("path exists = %v, want %v", exists, tt.wantExists)
+			}
+		})
+	}
+}
+
+func TestParseListenAddr(t *testing.T) {
+	tests := []struct {
+		host, port  string
+		wantNetwork string
+		wantAddr    string
+		wantErr     bool
+	}{
+		{port: "", wantNetwork: "tcp", wantAddr: ":8080"},
+		{host: "127.0.0.1", port: "3000", wantNetwork: "tcp", wantAddr: "127.0.0.1:3000"},
+		{host: "::1", port: "3000", wantNetwork: "tcp", wantAddr: "[::1]:3000"},
+		{host: "ignored", port: "/run/bot.sock", wantNetwork: "unix", wantAddr: "/run/bot.sock"},
+		{port: "0", wantErr: true},
+		{port: "65536", wantErr: true},
+		{port: "http", wantErr: true},
+	}
+	for _, tt := range tests {
+		network, addr, err := parseListenAddr(tt.host, tt.port)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseListenAddr(%q, %q) error = %v, want error %v", tt.host, tt.port, err, tt.wantErr)
+			continue
+		}
+		if network != tt.wantNetwork || addr != tt.wantAddr {
+			t.Errorf("parseListenAddr(%q, %q) = %q, %q, want %q, %q", tt.host, tt.port, network, addr, tt.wantNetwork, tt.wantAddr)
+		}
+	}
+}
+
+func TestHTTPServerTimeouts(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want [4]time.Duration // read header, read, write and idle
+	}{
+		{
+			name: "defaults",
+			want: [4]time.Duration{5 * time.Second, 15 * time.Second, 60 * time.Second, 120 * time.Second},
+		},
+		{
+			name: "configured",
+			env:  map[string]string{"HTTP_READ_HEADER_TIMEOUT": "2s", "HTTP_READ_TIMEOUT": "10s", "HTTP_WRITE_TIMEOUT": "5m", "HTTP_IDLE_TIMEOUT": "30s"},
+			want: [4]time.Duration{2 * time.Second, 10 * time.Second, 5 * time.Minute, 30 * time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range map[string]string{"APP_ENV": "", "INVITE_GENERATOR": "", "SLACK_BOT_TOKEN": "xoxb-1", "GOOGLE_GEMINI_API_KEY": "g-1",
+				"HTTP_READ_HEADER_TIMEOUT": "", "HTTP_READ_TIMEOUT": "", "HTTP_WRITE_TIMEOUT": "", "HTTP_IDLE_TIMEOUT": ""} {
+				t.Setenv(name, value)
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			config, err := loadConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			server := newHTTPServer(config, http.NotFoundHandler())
+			if got := [4]time.Duration{server.ReadHeaderTimeout, server.ReadTimeout, server.WriteTimeout, server.IdleTimeout}; got != tt.want {
+				t.Errorf("read header/read/write/idle timeouts = %v, want %v", got, tt.want)
+			}
+			if server.Addr != config.ListenAddr {
+				t.Errorf("Addr = %q, want %q", server.Addr, config.ListenAddr)
+			}
+		})
+	}
+}
+
+func TestSlowClientsAreDisconnected(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newHTTPServer(&Config{ReadHeaderTimeout: 50 * time.Millisecond}, http.NotFoundHandler())
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// Send part of the headers and stall, as a slow-loris client would.
+	if _, err := io.WriteString(conn, "POST /slack/events HTTP/1.1\r\nHost: localhost\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	start := time.Now()
+	io.ReadAll(conn)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("connection held for %s, want it closed after the read header timeout", elapsed)
+	}
+}
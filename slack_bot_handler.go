@@ -1,16 +1,15 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/slack-go/slack"
@@ -19,45 +18,164 @@ import (
 // SlackBotHandler processes app_mention and direct message events and manages a simple conversation state.
 type SlackBotHandler struct {
 	slackClient        *slack.Client
-	conversationMutex  sync.Mutex
-	conversationStates map[string]*ConversationState // keyed by the user's Slack ID
+	config             *Config
+	userCache          *userCache
+	writer             *invitationWriter
+	sender             *messageSender
+	recipientLists     *recipientListStore
+	cooldowns          *gameCooldowns
+	seenEvents         *seenEvents
+	quietHours         *quietHoursStore
+	queues             eventQueue        // runs each user's conversation steps one at a time, in order
+	conversationStates ConversationStore // keyed by the user's Slack ID
+	stopSweeper        chan struct{}
+	closeOnce          sync.Once
+	processing         sync.WaitGroup // events acknowledged but still being handled
+
+	promptMutex    sync.Mutex
+	pendingPrompts map[string]int // user ID -> the greeting whose names prompt is still to follow, with GREETING_DELAY
+	greetings      int            // greetings sent, numbering pendingPrompts
 }
 
 // ConversationState holds the current conversation step and data for a given user.
 type ConversationState struct {
-	Step                string   // possible values: "awaiting_names", "awaiting_game"
-	RecipientUserIDs    []string // recipients matched from the fuzzy search
-	RecipientUserNames  []string // matched recipients' display names
+	Version            int       // conversationStateVersion when saved; see decodeConversation
+	Step               string    // possible values: "awaiting_names", "awaiting_game", "confirming_game"
+	RecipientUserIDs   []string  // recipients matched from the fuzzy search
+	RecipientUserNames []string  // matched recipients' display names
+	NameAttempts       int       // failed attempts at the awaiting_names step
+	Tone               string    // invitation tone from an inline "tone: ..." directive, empty for the default
+	LastInput          string    // the last unresolved awaiting_names input, normalized, to spot repeats
+	PendingGame        string    // the game name extracted from free-form input, awaiting confirmation
+	LastActivity       time.Time // when the state was last saved; idle states expire after ConversationTTL
 }
 
 // SlackEventCallback is a minimal struct for Slack event callbacks.
 type SlackEventCallback struct {
 	Token     string     `json:"token"`
 	Type      string     `json:"type"`
+	EventID   string     `json:"event_id,omitempty"` // unique per event, repeated when Slack retries a delivery
 	Challenge string     `json:"challenge,omitempty"`
 	Event     SlackEvent `json:"event"`
 }
 
 // SlackEvent holds the relevant parts of the event (we handle both app_mention and direct message events).
 type SlackEvent struct {
-	Type    string `json:"type"`
-	User    string `json:"user"`
-	Text    string `json:"text"`
-	Channel string `json:"channel"`
-	BotID   string `json:"bot_id,omitempty"`
+	Type        string `json:"type"`
+	User        string `json:"user"`
+	Text        string `json:"text"`
+	Channel     string `json:"channel"`
+	BotID       string `json:"bot_id,omitempty"`
+	ThreadTS    string `json:"thread_ts,omitempty"`    // set when the message was posted inside a thread
+	ChannelType string `json:"channel_type,omitempty"` // "im", "mpim", "channel" or "group" on message events
+	Subtype     string `json:"subtype,omitempty"`      // set on edits, deletions, joins and other non-user messages
 }
 
-// NewSlackBotHandler creates a new SlackBotHandler with an empty conversation state.
-func NewSlackBotHandler(slackClient *slack.Client) *SlackBotHandler {
-	return &SlackBotHandler{
+// NewSlackBotHandler creates a new SlackBotHandler whose conversation state lives in store and
+// whose invitations are written by writer.
+func NewSlackBotHandler(slackClient *slack.Client, config *Config, userCache *userCache, sender *messageSender, recipientLists *recipientListStore, store ConversationStore, writer *invitationWriter, cooldowns *gameCooldowns, seenEvents *seenEvents, quietHours *quietHoursStore) *SlackBotHandler {
+	h := &SlackBotHandler{
 		slackClient:        slackClient,
-		conversationStates: make(map[string]*ConversationState),
+		config:             config,
+		userCache:          userCache,
+		writer:             writer,
+		sender:             sender,
+		recipientLists:     recipientLists,
+		cooldowns:          cooldowns,
+		seenEvents:         seenEvents,
+		quietHours:         quietHours,
+		conversationStates: store,
+		queues:             newEventQueues(),
+		pendingPrompts:     make(map[string]int),
+		stopSweeper:        make(chan struct{}),
+	}
+	// Stores that expire entries themselves (Redis) don't need sweeping.
+	if sweepable, ok := store.(idleConversationStore); ok && config.ConversationTTL > 0 {
+		go h.sweepConversations(sweepable, time.Minute)
+	}
+	return h
+}
+
+// Close stops the background conversation sweeper and waits for acknowledged events to finish
+// being handled. It is safe to call more than once.
+func (h *SlackBotHandler) Close() {
+	h.closeOnce.Do(func() { close(h.stopSweeper) })
+	h.processing.Wait()
+}
+
+// sweepConversations expires conversations idle longer than ConversationTTL every interval
+// until Close is called.
+func (h *SlackBotHandler) sweepConversations(store idleConversationStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.stopSweeper:
+			return
+		case now := <-ticker.C:
+			// Expire each conversation on its user's queue, so it can't expire in the middle of a step.
+			for _, userID := range store.IdleUsers(now.Add(-h.config.ConversationTTL)) {
+				userID := userID
+				h.processing.Add(1)
+				h.queues.enqueue(userID, func() {
+					defer h.processing.Done()
+					h.expireConversation(userID)
+				})
+			}
+		}
+	}
+}
+
+// expireConversation deletes userID's conversation if it is still idle. Only a deletion this
+// call made is counted, so instances sharing a store don't double count. Unreadable states are
+// discarded too, without counting them as expired.
+func (h *SlackBotHandler) expireConversation(userID string) {
+	state, exists, err := h.conversationStates.Get(userID)
+	if errors.Is(err, errConversationUnreadable) {
+		logger.Warn("Discarding unreadable conversation state", "user_id", userID, "error", err)
+		h.deleteConversation(userID)
+		return
+	}
+	if err != nil {
+		logger.Error("Error loading conversation state while expiring", "user_id", userID, "error", err)
+		return
+	}
+	if !exists || !h.conversationExpired(state) {
+		return
+	}
+	removed, err := h.conversationStates.Delete(userID)
+	if err != nil {
+		logger.Error("Error expiring conversation state", "user_id", userID, "error", err)
+		return
+	}
+	if removed {
+		activeConversations.Dec()
+		recordStep(stepExpired, userID)
 	}
 }
 
+// conversationExpired reports whether state has been idle longer than ConversationTTL. States
+// saved before LastActivity existed never expire here.
+func (h *SlackBotHandler) conversationExpired(state *ConversationState) bool {
+	return h.config.ConversationTTL > 0 && !state.LastActivity.IsZero() &&
+		time.Since(state.LastActivity) > h.config.ConversationTTL
+}
+
 // HandleEvent is our Gin handler for Slack events.
 // It responds to URL verification and processes both app_mention and direct message events.
 func (h *SlackBotHandler) HandleEvent(c *gin.Context) {
+	// Interaction payloads (button clicks) arrive form-encoded with a "payload" field; explain the
+	// misconfiguration instead of failing on a confusing JSON decode error.
+	if c.ContentType() == "application/x-www-form-urlencoded" {
+		if c.PostForm("payload") != "" {
+			logger.Warn("Received an interaction payload on the events endpoint")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "This endpoint only accepts Slack Events API callbacks; set the app's interactivity request URL to /slack/interactions"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Slack event callbacks must be sent as application/json"})
+		return
+	}
+
 	var eventCallback SlackEventCallback
 	if err := c.BindJSON(&eventCallback); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -65,23 +183,84 @@ func (h *SlackBotHandler) HandleEvent(c *gin.Context) {
 	}
 
 	// Log incoming event details.
-	log.Printf("Received Slack event: Type=%s, User=%s, Channel=%s, Text=%s",
-		eventCallback.Event.Type, eventCallback.Event.User, eventCallback.Event.Channel, eventCallback.Event.Text)
+	logger.Info("Received Slack event", "event_id", eventCallback.EventID, "event_type", eventCallback.Event.Type, "user_id", eventCallback.Event.User, "channel", eventCallback.Event.Channel)
+	logger.Debug("Slack event text", "event_type", eventCallback.Event.Type, "user_id", eventCallback.Event.User, "text", eventCallback.Event.Text)
+
+	// Validate the callback shape; malformed callbacks are only rejected in strict mode.
+	if err := validateEventCallback(&eventCallback); err != nil {
+		logger.Warn("Malformed Slack callback", "event_type", eventCallback.Event.Type, "error", err)
+		if h.config.StrictEventValidation {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	// Handle URL verification challenge.
 	if eventCallback.Type == "url_verification" {
-		log.Println("Handling URL verification challenge")
+		logger.Info("Handling URL verification challenge", "event_type", eventCallback.Type)
 		c.JSON(http.StatusOK, gin.H{"challenge": eventCallback.Challenge})
 		return
 	}
 
+	// Slack retries deliveries it didn't see acknowledged quickly; acknowledge those without
+	// processing the event again. If the seen-set can't be checked, process the event anyway.
+	duplicate, err := h.seenEvents.markSeen(eventCallback.EventID)
+	if err != nil {
+		logger.Warn("Error checking for a duplicate Slack event", "event_id", eventCallback.EventID, "error", err)
+	}
+	if duplicate {
+		logger.Info("Ignoring duplicate Slack event", "event_id", eventCallback.EventID, "retry_num", c.GetHeader("X-Slack-Retry-Num"), "retry_reason", c.GetHeader("X-Slack-Retry-Reason"))
+		c.Status(http.StatusOK)
+		return
+	}
+
+	// Only explicitly allowlisted events are processed; anything else is acknowledged and ignored.
+	if !isHandledEvent(eventCallback) {
+		logger.Info("Ignoring unhandled Slack callback", "callback_type", eventCallback.Type, "event_type", eventCallback.Event.Type, "subtype", eventCallback.Event.Subtype)
+		c.Status(http.StatusOK)
+		return
+	}
+
+	// Slack expects an answer within three seconds, while matching names, generating the invitation
+	// and sending it can take much longer, so acknowledge the event now and handle it in the
+	// background, after the user's earlier events. Failures are reported to the user in a
+	// follow-up message.
+	c.Status(http.StatusOK)
+	h.processing.Add(1)
+	h.queues.enqueue(eventCallback.Event.User, func() {
+		defer h.processing.Done()
+		h.processEvent(eventCallback)
+	})
+}
+
+// processEvent advances the conversation for an acknowledged app mention or direct message. It
+// runs on the user's event queue, so no other step of the same conversation runs meanwhile.
+func (h *SlackBotHandler) processEvent(eventCallback SlackEventCallback) {
+	// gin's recovery middleware doesn't cover this goroutine, so don't let a panic take the
+	// process down.
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Panic while handling a Slack event", "event_id", eventCallback.EventID, "panic", r)
+		}
+	}()
+	ctx := context.Background()
+	// Whatever the user sent, a names prompt still due after their greeting would now be stale.
+	h.dropNamesPrompt(eventCallback.Event.User)
+
 	channelID := eventCallback.Event.Channel
-	isDirectMessage := strings.HasPrefix(channelID, "D")
+	isDirectMessage := isDirectMessageEvent(eventCallback.Event)
 	isAppMention := eventCallback.Event.Type == "app_mention"
 
 	// Process event if it's an app mention or a direct message (ignoring messages from bots)
 	if (isAppMention || isDirectMessage) && eventCallback.Event.BotID == "" {
 		userID := eventCallback.Event.User
+		eventLog := logger.With("event_type", eventCallback.Event.Type, "user_id", userID, "channel", channelID)
+
+		// Mentions inside a thread are answered in that thread; everything else gets a top-level reply.
+		var threadTS string
+		if isAppMention {
+			threadTS = eventCallback.Event.ThreadTS
+		}
 
 		// Use different text processing based on event type.
 		var text string
@@ -90,287 +269,666 @@ func (h *SlackBotHandler) HandleEvent(c *gin.Context) {
 		} else {
 			text = eventCallback.Event.Text
 		}
-		log.Printf("Processed text from user %s: %s", userID, text)
+		eventLog.Debug("Processed text", "text", text)
+
+		// Ignore our own invitations if they are ever routed back to us, so we can't loop.
+		if strings.HasPrefix(text, invitationTitlePrefix) {
+			eventLog.Info("Ignoring an event that looks like one of our own invitations")
+			return
+		}
+
+		// Mentions that name a command ("@bot help") are answered directly instead of starting an invite.
+		if isAppMention {
+			if command, ok := lookupMentionCommand(text); ok {
+				eventLog.Info("Handling mention command", "command", strings.ToLower(strings.TrimSpace(text)))
+				h.sendMessage(channelID, threadTS, command(h, userID))
+				return
+			}
+		}
+
+		// "quiet 22:00-08:00" DMed to the bot sets when the user doesn't want invitations.
+		if isDirectMessage {
+			if reply, ok := h.quietHoursCommand(userID, text); ok {
+				eventLog.Info("Handling quiet hours command")
+				h.sendMessage(channelID, threadTS, reply)
+				return
+			}
+		}
+
+		// Cancelling comes before loading the state, so the user can always get out of a
+		// conversation, even one whose state can't be read or one maintenance mode interrupted.
+		if isCancelCommand(text) {
+			h.sendMessage(channelID, threadTS, h.cancelConversation(eventLog, userID))
+			return
+		}
+
+		// In maintenance mode nothing is sent, so don't start or continue an invitation either.
+		if h.config.MaintenanceMode {
+			eventLog.Info("Maintenance mode, not handling the invitation")
+			h.sendMessage(channelID, threadTS, h.reply("conversation.maintenance", replyData{}))
+			return
+		}
 
 		// ----- Command Branch: Directly process /invite command -----
 		if strings.HasPrefix(text, "/invite") {
-			// Expecting a command of the format: /invite "user1,user2" "game"
+			// Expecting a command of the format: /invite "user1,user2" "game", optionally followed by "tone: ..."
+			command, tone := extractTone(text)
 			re := regexp.MustCompile(`^/invite\s+"([^"]+)"\s+"([^"]+)"\s*$`)
-			matches := re.FindStringSubmatch(text)
+			matches := re.FindStringSubmatch(command)
 			if matches == nil || len(matches) != 3 {
-				h.sendMessage(channelID, "Invalid command format. Use: /invite \"user1,user2\" \"game\"")
-				c.Status(http.StatusOK)
+				h.sendMessage(channelID, threadTS, h.reply("command.usage", replyData{}))
 				return
 			}
 			userNamesInput := matches[1]
 			gameName := matches[2]
-			log.Printf("Parsed /invite command: users: %s, game: %s", userNamesInput, gameName)
-
-			// Parse the comma-separated user names.
-			names := strings.Split(userNamesInput, ",")
-			for i, name := range names {
-				names[i] = strings.TrimSpace(name)
+			eventLog.Debug("Parsed /invite command", "names", userNamesInput, "game", gameName)
+			if h.config.BlockedGames.blocks(gameName) {
+				eventLog.Info("Refusing /invite for a blocked game", "game", gameName)
+				h.sendMessage(channelID, threadTS, blockedGameReply(gameName))
+				return
 			}
 
-			// Fetch all Slack users (filtering out bots and deleted accounts).
-			users, err := h.slackClient.GetUsers()
+			// Parse the comma-separated user names.
+			names, err := parseNames(userNamesInput, h.config.MaxNamesInputLength, h.config.MaxNamesPerInvite)
 			if err != nil {
-				log.Printf("Error fetching users for matching: %v", err)
-				h.sendMessage(channelID, "Error fetching users for matching: "+err.Error())
-				c.Status(http.StatusInternalServerError)
+				eventLog.Info("Rejecting oversized /invite names", "error", err)
+				h.sendMessage(channelID, threadTS, oversizedNamesReply(err))
 				return
 			}
-			var validUsers []slack.User
-			var allValidNames []string
-			for _, u := range users {
-				if !u.IsBot && !u.Deleted {
-					validUsers = append(validUsers, u)
-					allValidNames = append(allValidNames, u.RealName)
-				}
+			if len(names) == 0 {
+				h.sendMessage(channelID, threadTS, h.reply("command.usage", replyData{}))
+				return
 			}
 
-			// Fuzzy match each provided name.
-			var matchedUserIDs []string
-			var matchedNames []string
-			var unmatched []string
-			for _, inputName := range names {
-				found := false
-				for _, user := range validUsers {
-					if strings.Contains(strings.ToLower(user.Name), strings.ToLower(inputName)) ||
-						strings.Contains(strings.ToLower(user.RealName), strings.ToLower(inputName)) {
-						log.Printf("Matched input '%s' to user '%s' (ID: %s)", inputName, user.RealName, user.ID)
-						matchedUserIDs = append(matchedUserIDs, user.ID)
-						matchedNames = append(matchedNames, user.RealName)
-						found = true
-						break
-					}
-				}
-				if !found {
-					log.Printf("No match for input '%s'", inputName)
-					unmatched = append(unmatched, inputName)
-				}
+			// Fuzzy match each provided name against the directory.
+			match, err := h.matchRecipients(ctx, userID, names)
+			if errors.Is(err, context.DeadlineExceeded) {
+				eventLog.Warn("Matching names timed out", "timeout", h.config.MatchTimeout.String())
+				h.sendMessage(channelID, threadTS, h.reply("names.match_timeout", replyData{}))
+				return
+			}
+			if err != nil {
+				eventLog.Error("Error fetching users for matching", "error", err)
+				h.sendMessage(channelID, threadTS, h.reply("names.fetch_failed", replyData{Error: err.Error()}))
+				return
 			}
 
-			// If any names did not match, respond with a list of valid names.
-			if len(unmatched) > 0 {
-				reply := "Could not match the following names: " + strings.Join(unmatched, ", ") + ".\n"
-				reply += "Valid user names include: " + strings.Join(allValidNames, ", ") + ".\n"
-				h.sendMessage(channelID, reply)
-				c.Status(http.StatusOK)
+			// If any names did not resolve, explain why and list the valid names.
+			if !match.resolved() {
+				h.sendMessage(channelID, threadTS, h.reply("command.unresolved", replyData{Problems: h.unresolvedNamesReply(ctx, match)}))
+				return
+			}
+			if len(match.MatchedIDs) == 0 {
+				h.sendMessage(channelID, threadTS, h.reply("names.only_self", replyData{}))
 				return
 			}
+			matchedUserIDs := match.MatchedIDs
+			matchedNames := match.MatchedNames
 
 			// Retrieve the inviting user's info.
 			invitingUserInfo, err := h.slackClient.GetUserInfo(userID)
 			if err != nil {
-				log.Printf("Error fetching user info for %s: %v", userID, err)
-				h.sendMessage(channelID, "Error fetching your user info: "+err.Error())
-				c.Status(http.StatusInternalServerError)
+				eventLog.Error("Error fetching user info", "error", err)
+				h.sendMessage(channelID, threadTS, h.reply("invite.inviter_failed", replyData{Error: err.Error()}))
 				return
 			}
 			invitingUserName := invitingUserInfo.RealName
+			if !h.reserveGame(userID, channelID, threadTS, gameName) {
+				return
+			}
 
-			// Call Google Gemini API to generate the invitation message.
-			invitation, err := callGoogleGemini(invitingUserName, matchedNames, gameName)
+			// Ask the invitation generator to write the message.
+			invitations, err := h.writer.write(ctx, invitingUserName, matchedUserIDs, matchedNames, gameName, GenerateOptions{Tone: tone})
 			if err != nil {
-				log.Printf("Error from Google Gemini API: %v", err)
-				h.sendMessage(channelID, "Error generating invitation: "+err.Error())
-				c.Status(http.StatusInternalServerError)
+				h.releaseGame(gameName)
+				eventLog.Error("Error generating invitation", "error", err)
+				h.sendMessage(channelID, threadTS, generationErrorReply(err))
 				return
 			}
 
 			// Forward the invitation to all matched recipients.
-			log.Printf("Forwarding invitation from user %s to recipients: %v", userID, matchedUserIDs)
-			var sendErrors []string
-			for _, rid := range matchedUserIDs {
-				_, _, err := h.slackClient.PostMessage(
-					rid,
-					slack.MsgOptionText(invitation, false),
-				)
-				if err != nil {
-					log.Printf("Error sending invitation to recipient %s: %v", rid, err)
-					sendErrors = append(sendErrors, err.Error())
-				} else {
-					log.Printf("Successfully sent invitation to recipient %s", rid)
-				}
+			eventLog.Info("Forwarding invitation", "recipients", matchedUserIDs)
+			sendErrors, skipped, deferred, targets, err := h.sendInvitations(eventLog, invitations)
+			if err != nil {
+				h.releaseGame(gameName)
+				eventLog.Error("Invalid invitation message", "error", err)
+				h.sendMessage(channelID, threadTS, h.reply("invite.build_failed", replyData{Error: err.Error()}))
+				return
 			}
-			if len(sendErrors) > 0 {
-				h.sendMessage(channelID, "Failed to send invitation to some recipients: "+strings.Join(sendErrors, "; "))
-			} else {
-				h.sendMessage(channelID, "Your invitation was sent successfully!")
+			switch {
+			case len(sendErrors) > 0:
+				h.releaseGame(gameName)
+				h.sendMessage(channelID, threadTS, h.reply("invite.send_failed", replyData{Error: strings.Join(sendErrors, "; ")}))
+			case len(skipped) == targets:
+				h.releaseGame(gameName)
+				h.sendMessage(channelID, threadTS, h.reply("invite.all_skipped", replyData{Recipients: userMentions(skipped)}))
+			default:
+				h.sendMessage(channelID, threadTS, strings.Join(append(match.Notes, h.withSkippedNote(invitationsSummary(invitations, gameName), skipped, deferred)), "\n"))
 			}
-			c.Status(http.StatusOK)
 			return
 		}
 		// -------------------------------------------------------------------
 
-		h.conversationMutex.Lock()
-		state, exists := h.conversationStates[userID]
+		state, exists, err := h.conversationStates.Get(userID)
+		if errors.Is(err, errConversationUnreadable) {
+			// Saved by an incompatible release or corrupted; drop it and start over rather than
+			// failing every message until it expires.
+			eventLog.Warn("Discarding unreadable conversation state", "error", err)
+			h.deleteConversation(userID)
+			state, exists, err = nil, false, nil
+		}
+		if err != nil {
+			eventLog.Error("Error loading conversation state", "error", err)
+			h.sendMessage(channelID, threadTS, h.reply("conversation.load_failed", replyData{}))
+			return
+		}
+		// A state the sweeper hasn't reached yet is treated as already gone, so the user starts over.
+		if exists && h.conversationExpired(state) {
+			h.deleteConversation(userID)
+			recordStep(stepExpired, userID)
+			state, exists = nil, false
+		}
 		if !exists {
 			// Start a new conversation – ask for the names to send to.
-			log.Printf("No conversation state for user %s, starting new conversation.", userID)
+			eventLog.Info("No conversation state, starting a new conversation")
 			state = &ConversationState{
 				Step: "awaiting_names",
 			}
-			h.conversationStates[userID] = state
-			h.conversationMutex.Unlock()
+			err := h.setConversation(userID, state)
+			if err != nil {
+				eventLog.Error("Error saving conversation state", "step", state.Step, "error", err)
+				h.sendMessage(channelID, threadTS, h.reply("conversation.start_failed", replyData{}))
+				return
+			}
+			recordStep(stepStarted, userID)
 
-			log.Printf("Sent greeting to user %s asking for recipient names.", userID)
-			h.sendMessage(channelID, "Hi! Who do you want to message? Please provide a comma separated list of names.")
-			c.Status(http.StatusOK)
+			eventLog.Info("Sent greeting asking for recipient names", "step", state.Step)
+			h.sendGreeting(userID, channelID, threadTS)
 			return
 		}
 
 		// Process conversation state based on the current step.
 		if state.Step == "awaiting_names" {
-			log.Printf("User %s is in state 'awaiting_names'. Input text: %s", userID, text)
-			// Parse the comma separated input.
-			names := strings.Split(text, ",")
-			var trimmedNames []string
-			for _, name := range names {
-				trimmedNames = append(trimmedNames, strings.TrimSpace(name))
+			eventLog.Info("Received recipient names", "step", state.Step, "input_length", len(text))
+			namesInput, tone := extractTone(text)
+			if tone != "" {
+				state.Tone = tone
 			}
-			log.Printf("Parsed names for user %s: %v", userID, trimmedNames)
-
-			// Fetch all Slack users (filtering out bots and deleted accounts).
-			users, err := h.slackClient.GetUsers()
+			// Parse the comma separated input; oversized input doesn't count against the retry limit.
+			trimmedNames, err := parseNames(namesInput, h.config.MaxNamesInputLength, h.config.MaxNamesPerInvite)
 			if err != nil {
-				log.Printf("Error fetching users for matching: %v", err)
-				h.sendMessage(channelID, "Error fetching users for matching: "+err.Error())
-				h.conversationMutex.Unlock()
-				c.Status(http.StatusInternalServerError)
+				eventLog.Info("Rejecting oversized names", "step", state.Step, "error", err)
+				h.sendMessage(channelID, threadTS, oversizedNamesReply(err))
 				return
 			}
-			var validUsers []slack.User
-			var allValidNames []string
-			for _, u := range users {
-				if !u.IsBot && !u.Deleted {
-					validUsers = append(validUsers, u)
-					allValidNames = append(allValidNames, u.RealName)
-				}
+			if len(trimmedNames) == 0 {
+				eventLog.Info("Received no names", "step", state.Step)
+				h.sendMessage(channelID, threadTS, h.reply("names.empty", replyData{}))
+				return
 			}
+			eventLog.Debug("Parsed names", "step", state.Step, "names", trimmedNames)
 
-			// Fuzzy match (case-insensitive substring match) for each input name.
-			var matchedUserIDs []string
-			var matchedNames []string
-			var unmatched []string
-
-			for _, inputName := range trimmedNames {
-				found := false
-				for _, user := range validUsers {
-					if strings.Contains(strings.ToLower(user.Name), strings.ToLower(inputName)) ||
-						strings.Contains(strings.ToLower(user.RealName), strings.ToLower(inputName)) {
-						log.Printf("Matched input '%s' to user '%s' (ID: %s)", inputName, user.RealName, user.ID)
-						matchedUserIDs = append(matchedUserIDs, user.ID)
-						matchedNames = append(matchedNames, user.RealName)
-						found = true
-						break
-					}
+			// Fuzzy match (case-insensitive substring match) each input name against the directory.
+			// A slow directory doesn't count against the retry limit either.
+			match, err := h.matchRecipients(ctx, userID, trimmedNames)
+			if errors.Is(err, context.DeadlineExceeded) {
+				eventLog.Warn("Matching names timed out", "step", state.Step, "timeout", h.config.MatchTimeout.String())
+				h.sendMessage(channelID, threadTS, h.reply("names.match_timeout", replyData{}))
+				return
+			}
+			if err != nil {
+				eventLog.Error("Error fetching users for matching", "error", err)
+				h.sendMessage(channelID, threadTS, h.reply("names.fetch_failed", replyData{Error: err.Error()}))
+				return
+			}
+
+			// If any names did not resolve, respond with details and list of all possible valid names.
+			if !match.resolved() {
+				state.NameAttempts++
+				if h.config.MaxNameAttempts > 0 && state.NameAttempts >= h.config.MaxNameAttempts {
+					// Give up rather than keeping the user stuck in this step.
+					h.deleteConversation(userID)
+					eventLog.Info("User reached the name matching limit, resetting conversation", "step", state.Step, "attempts", state.NameAttempts)
+					h.sendMessage(channelID, threadTS, h.reply("names.attempts_exhausted", replyData{Problems: match.problems()}))
+					return
 				}
-				if !found {
-					log.Printf("No match found for input '%s'", inputName)
-					unmatched = append(unmatched, inputName)
+
+				input := normalizeConversationInput(namesInput)
+				repeated := state.LastInput == input
+				state.LastInput = input
+				h.saveConversation(userID, state)
+				replyKey := "names.unresolved"
+				if repeated {
+					// Sending the same thing again won't work any better, so offer a way around the matcher.
+					eventLog.Info("User repeated the same unresolved names", "step", state.Step)
+					replyKey = "names.repeated"
 				}
+				reply := h.reply(replyKey, replyData{Problems: h.unresolvedNamesReply(ctx, match)})
+				eventLog.Info("Unresolved names", "step", state.Step, "unmatched", len(match.Unmatched), "uninvitable", len(match.Uninvitable), "ambiguous", len(match.Ambiguous))
+				eventLog.Debug("Unresolved name inputs", "step", state.Step, "unmatched", match.Unmatched)
+				h.sendMessage(channelID, threadTS, reply)
+				return
 			}
 
-			// If any names did not match, respond with details and list of all possible valid names.
-			if len(unmatched) > 0 {
-				reply := "Could not match the following names: " + strings.Join(unmatched, ", ") + ".\n"
-				reply += "Valid user names include: " + strings.Join(allValidNames, ", ") + ".\n"
-				reply += "Please provide a correct comma separated list of names."
-				h.conversationMutex.Unlock()
-				log.Printf("Unmatched names for user %s: %v", userID, unmatched)
-				h.sendMessage(channelID, reply)
-				c.Status(http.StatusOK)
+			// Everyone named was the inviter, so there's nobody left to invite; stay at this step.
+			if len(match.MatchedIDs) == 0 {
+				h.saveConversation(userID, state)
+				eventLog.Info("User only named themselves", "step", state.Step)
+				h.sendMessage(channelID, threadTS, h.reply("names.only_self", replyData{}))
 				return
 			}
 
 			// Update state with matched recipients and advance to requesting the game name.
-			state.RecipientUserIDs = matchedUserIDs
-			state.RecipientUserNames = matchedNames
+			state.RecipientUserIDs = match.MatchedIDs
+			state.RecipientUserNames = match.MatchedNames
 			state.Step = "awaiting_game"
-			h.conversationMutex.Unlock()
+			err = h.setConversation(userID, state)
+			if err != nil {
+				eventLog.Error("Error saving conversation state", "step", state.Step, "error", err)
+				h.sendMessage(channelID, threadTS, h.reply("names.save_failed", replyData{}))
+				return
+			}
+			recordStep(stepNamesMatched, userID)
 
-			reply := "Matched recipients: " + strings.Join(matchedNames, ", ") + ".\n"
-			reply += "What game do you want to invite them to?"
-			log.Printf("Advancing conversation state to 'awaiting_game' for user %s", userID)
-			h.sendMessage(channelID, reply)
-			c.Status(http.StatusOK)
+			reply := strings.Join(append(match.Notes, h.reply("names.matched", replyData{Recipients: strings.Join(match.MatchedNames, ", ")})), "\n")
+			eventLog.Info("Advancing conversation", "step", state.Step)
+			h.sendRecipientsMessage(channelID, threadTS, userID, reply)
 			return
-		} else if state.Step == "awaiting_game" {
-			log.Printf("User %s is in state 'awaiting_game'. Received game name: %s", userID, text)
-			gameName := text
-			h.conversationMutex.Unlock()
+		} else if state.Step == "awaiting_game" || state.Step == "confirming_game" {
+			eventLog.Info("Received game name", "step", state.Step)
+			eventLog.Debug("Game name text", "step", state.Step, "text", text)
+			gameName, tone := extractTone(text)
+			if tone == "" {
+				tone = state.Tone
+			}
+			if state.Step == "confirming_game" {
+				// Anything other than a yes or no is taken as the game name, exactly as typed.
+				if isAnswer(gameName, confirmKeywords) {
+					gameName = state.PendingGame
+				} else if isAnswer(gameName, rejectKeywords) {
+					state.Step = "awaiting_game"
+					state.PendingGame = ""
+					state.Tone = tone
+					h.saveConversation(userID, state)
+					h.sendMessage(channelID, threadTS, h.reply("game.rejected", replyData{}))
+					return
+				}
+			}
+			if gameName == "" {
+				// Only a tone was given; remember it and keep waiting for the game.
+				state.Tone = tone
+				h.saveConversation(userID, state)
+				h.sendMessage(channelID, threadTS, h.reply("game.tone_saved", replyData{}))
+				return
+			}
+			if state.Step == "awaiting_game" && h.config.LLMGameExtraction {
+				if extracted := h.extractGameName(ctx, gameName); extracted != gameName {
+					state.Step = "confirming_game"
+					state.PendingGame = extracted
+					state.Tone = tone
+					h.saveConversation(userID, state)
+					eventLog.Info("Asking the user to confirm the extracted game name", "step", state.Step, "game", extracted)
+					h.sendMessage(channelID, threadTS, h.reply("game.confirm", replyData{Game: extracted}))
+					return
+				}
+			}
+			if h.config.BlockedGames.blocks(gameName) {
+				// Stay in awaiting_game so the user can name another game.
+				eventLog.Info("User named a blocked game", "step", state.Step, "game", gameName)
+				h.sendMessage(channelID, threadTS, blockedGameReply(gameName))
+				return
+			}
+			// A game in cooldown also keeps the user in awaiting_game.
+			if !h.reserveGame(userID, channelID, threadTS, gameName) {
+				return
+			}
+			// Only a game that was accepted counts, so retries after a refusal aren't counted again.
+			recordStep(stepGameProvided, userID)
+			// Copy what we need out of the state and take it from the store before sending, so a
+			// duplicate of this message handled on another instance finds no actionable state and
+			// can't send twice.
+			recipientIDs := append([]string(nil), state.RecipientUserIDs...)
+			recipientNames := append([]string(nil), state.RecipientUserNames...)
+			taken, err := h.takeConversation(userID, state)
+			if err != nil {
+				// Without clearing the state we can't rule out a duplicate send, so stop here.
+				h.releaseGame(gameName)
+				eventLog.Error("Error clearing conversation state", "step", state.Step, "error", err)
+				h.sendMessage(channelID, threadTS, h.reply("game.failed", replyData{}))
+				return
+			}
+			if !taken {
+				// Another delivery of this message, possibly on another instance, got here first.
+				h.releaseGame(gameName)
+				eventLog.Info("Conversation state already taken, not sending", "step", state.Step)
+				return
+			}
+			eventLog.Info("Cleared conversation state before sending", "step", state.Step)
+			recordStep(stepConfirmed, userID)
 
 			// Fetch inviting user's info.
 			invitingUserInfo, err := h.slackClient.GetUserInfo(userID)
 			if err != nil {
-				log.Printf("Error fetching user info for %s: %v", userID, err)
-				h.sendMessage(channelID, "Error fetching your user info: "+err.Error())
-				h.deleteConversation(userID)
-				c.Status(http.StatusInternalServerError)
+				h.releaseGame(gameName)
+				eventLog.Error("Error fetching user info", "error", err)
+				h.sendMessage(channelID, threadTS, h.reply("invite.inviter_failed", replyData{Error: err.Error()}))
 				return
 			}
 			invitingUserName := invitingUserInfo.RealName
 
-			// Call Google Gemini API to generate the invitation message.
-			invitation, err := callGoogleGemini(invitingUserName, state.RecipientUserNames, gameName)
+			// Ask the invitation generator to write the message.
+			invitations, err := h.writer.write(ctx, invitingUserName, recipientIDs, recipientNames, gameName, GenerateOptions{Tone: tone})
 			if err != nil {
-				log.Printf("Error from Google Gemini API: %v", err)
-				h.sendMessage(channelID, "Error generating invitation: "+err.Error())
-				h.deleteConversation(userID)
-				c.Status(http.StatusInternalServerError)
+				h.releaseGame(gameName)
+				eventLog.Error("Error generating invitation", "error", err)
+				h.sendMessage(channelID, threadTS, generationErrorReply(err))
 				return
 			}
 
 			// Forward the invitation to all matched recipients.
-			log.Printf("Forwarding invitation from user %s to recipients: %v", userID, state.RecipientUserIDs)
-			var sendErrors []string
-			for _, rid := range state.RecipientUserIDs {
-				_, _, err := h.slackClient.PostMessage(
-					rid,
-					slack.MsgOptionText(invitation, false),
-				)
-				if err != nil {
-					log.Printf("Error sending invitation to recipient %s: %v", rid, err)
-					sendErrors = append(sendErrors, err.Error())
-				} else {
-					log.Printf("Successfully sent invitation to recipient %s", rid)
-				}
+			eventLog.Info("Forwarding invitation", "step", state.Step, "recipients", recipientIDs)
+			sendErrors, skipped, deferred, targets, err := h.sendInvitations(eventLog, invitations)
+			if err != nil {
+				h.releaseGame(gameName)
+				eventLog.Error("Invalid invitation message", "error", err)
+				h.sendMessage(channelID, threadTS, h.reply("invite.build_failed", replyData{Error: err.Error()}))
+				return
 			}
-			if len(sendErrors) > 0 {
-				h.sendMessage(channelID, "Failed to send invitation to some recipients: "+strings.Join(sendErrors, "; "))
-			} else {
-				h.sendMessage(channelID, "Your invitation was sent successfully!")
+			switch {
+			case len(sendErrors) > 0:
+				h.releaseGame(gameName)
+				recordStep(stepSendFailed, userID)
+				h.sendMessage(channelID, threadTS, h.reply("invite.send_failed", replyData{Error: strings.Join(sendErrors, "; ")}))
+			case len(skipped) == targets:
+				h.releaseGame(gameName)
+				recordStep(stepSendFailed, userID)
+				h.sendMessage(channelID, threadTS, h.reply("invite.all_skipped", replyData{Recipients: userMentions(skipped)}))
+			default:
+				recordStep(stepSent, userID)
+				h.sendMessage(channelID, threadTS, h.withSkippedNote(invitationsSummary(invitations, gameName), skipped, deferred))
 			}
-			h.deleteConversation(userID)
-			c.Status(http.StatusOK)
 			return
 		}
-		h.conversationMutex.Unlock()
 	}
+}
 
-	c.Status(http.StatusOK)
+// sendInvitations posts each written invitation to its recipients. It returns the errors of
+// failed sends, the targets skipped as deactivated, the targets whose invitation waits for their
+// quiet hours to end and how many targets there were.
+func (h *SlackBotHandler) sendInvitations(eventLog *slog.Logger, invitations []writtenInvitation) (sendErrors, skipped, deferred []string, targets int, err error) {
+	type delivery struct {
+		options []slack.MsgOption
+		targets []string
+		text    string
+	}
+	// Every message is built before anything is sent, so a bad one can't leave a partial send.
+	deliveries := make([]delivery, 0, len(invitations))
+	for _, invitation := range invitations {
+		options, groupTargets, text, err := h.invitationOptions(invitation.Text, invitation.RecipientIDs)
+		if err != nil {
+			return nil, nil, nil, 0, err
+		}
+		deliveries = append(deliveries, delivery{options: options, targets: groupTargets, text: text})
+	}
+	for _, d := range deliveries {
+		groupErrors, groupSkipped, groupDeferred := h.postInvitation(eventLog, d.targets, d.text, d.options)
+		sendErrors = append(sendErrors, groupErrors...)
+		skipped = append(skipped, groupSkipped...)
+		deferred = append(deferred, groupDeferred...)
+		targets += len(d.targets)
+	}
+	return sendErrors, skipped, deferred, targets, nil
+}
+
+// invitationsSummary is the inviterSummary of each written invitation, one after the other.
+func invitationsSummary(invitations []writtenInvitation, gameName string) string {
+	summaries := make([]string, len(invitations))
+	for i, invitation := range invitations {
+		summaries[i] = inviterSummary(invitation.RecipientNames, gameName, invitation.Text)
+	}
+	return strings.Join(summaries, "\n")
+}
+
+// postInvitation sends the invitation, whose fallback text is text, to each target in turn;
+// targets in their quiet hours get it queued for when those end. It returns the errors of failed
+// sends, the targets skipped because their account was deactivated after they were matched,
+// which no retry would fix, and the targets whose invitation was queued.
+func (h *SlackBotHandler) postInvitation(eventLog *slog.Logger, targets []string, text string, options []slack.MsgOption) (sendErrors, skipped, deferred []string) {
+	for _, rid := range targets {
+		var err error
+		if at, held := h.quietHours.sendTime(rid, time.Now()); held {
+			var channelID string
+			channelID, _, err = h.sender.schedule(rid, at, text, options...)
+			if err != nil && channelID != "" {
+				// It is queued; only looking up its ID failed, which nothing here needs.
+				err = nil
+			}
+			recordInvite(deliveryDM, err)
+			if err == nil {
+				eventLog.Info("Holding the invitation for the recipient's quiet hours", "recipient_id", rid, "send_at", at.Format(time.RFC3339))
+				deferred = append(deferred, rid)
+				continue
+			}
+		} else {
+			_, _, err = h.sender.post(rid, options...)
+			recordInvite(deliveryDM, err)
+		}
+		switch {
+		case isInactiveRecipient(err):
+			eventLog.Info("Skipping deactivated recipient", "recipient_id", rid, "error", err)
+			skipped = append(skipped, rid)
+		case err != nil:
+			eventLog.Error("Error sending invitation", "recipient_id", rid, "error", err)
+			sendErrors = append(sendErrors, err.Error())
+		default:
+			eventLog.Info("Sent invitation", "recipient_id", rid)
+		}
+	}
+	return sendErrors, skipped, deferred
+}
+
+// withSkippedNote appends to summary which recipients were skipped as deactivated, and which
+// get the invitation once their quiet hours end, if any.
+func (h *SlackBotHandler) withSkippedNote(summary string, skipped, deferred []string) string {
+	if len(skipped) > 0 {
+		summary += "\n" + h.reply("invite.skipped", replyData{Recipients: userMentions(skipped)})
+	}
+	if len(deferred) > 0 {
+		summary += "\n" + h.reply("invite.deferred", replyData{Recipients: userMentions(deferred)})
+	}
+	return summary
+}
+
+// sendGreeting opens a new conversation by asking for the recipient names. With GREETING_DELAY
+// set, the greeting and the names prompt are sent as separate messages that far apart, so the
+// question doesn't follow the hello abruptly; otherwise they are combined into one message.
+func (h *SlackBotHandler) sendGreeting(userID, channelID, threadTS string) {
+	hello := h.reply("greeting.hello", replyData{})
+	prompt := h.reply("greeting.ask_names", replyData{Regulars: len(h.config.Regulars) > 0})
+	if h.config.GreetingDelay <= 0 {
+		h.sendMessage(channelID, threadTS, hello+" "+prompt)
+		return
+	}
+	h.sendMessage(channelID, threadTS, hello)
+
+	// Send the prompt from a timer rather than holding up the rest of the event's handling. It
+	// runs on the user's queue like their messages, Close waits for it, and it is dropped if the
+	// user wrote anything in the meantime.
+	h.promptMutex.Lock()
+	h.greetings++
+	greeting := h.greetings
+	h.pendingPrompts[userID] = greeting
+	h.promptMutex.Unlock()
+	h.processing.Add(1)
+	time.AfterFunc(h.config.GreetingDelay, func() {
+		h.queues.enqueue(userID, func() {
+			defer h.processing.Done()
+			h.promptMutex.Lock()
+			due := h.pendingPrompts[userID] == greeting
+			if due {
+				delete(h.pendingPrompts, userID)
+			}
+			h.promptMutex.Unlock()
+			if due {
+				h.sendMessage(channelID, threadTS, prompt)
+			}
+		})
+	})
+}
+
+// dropNamesPrompt cancels the names prompt still due after userID's greeting, if any.
+func (h *SlackBotHandler) dropNamesPrompt(userID string) {
+	h.promptMutex.Lock()
+	defer h.promptMutex.Unlock()
+	delete(h.pendingPrompts, userID)
+}
+
+// reply renders the configured reply template for key.
+func (h *SlackBotHandler) reply(key string, data replyData) string {
+	return h.config.Replies.render(key, data)
 }
 
 // sendMessage is a helper to send a plain-text message to a given channel.
-func (h *SlackBotHandler) sendMessage(channel, text string) {
-	log.Printf("Sending message to channel %s: %s", channel, text)
-	_, _, err := h.slackClient.PostMessage(
-		channel,
-		slack.MsgOptionText(text, false),
-	)
+// When threadTS is non-empty the message is posted as a reply in that thread.
+func (h *SlackBotHandler) sendMessage(channel, threadTS, text string) {
+	logger.Debug("Sending message", "channel", channel, "thread_ts", threadTS, "text", text)
+	options := []slack.MsgOption{slack.MsgOptionText(text, false)}
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	_, _, err := h.sender.post(channel, options...)
 	if err != nil {
-		log.Println("Failed to send message to channel", channel, ":", err)
+		logger.Error("Failed to send message", "channel", channel, "error", err)
 	}
 }
 
-// deleteConversation removes a user's conversation state.
+// cancelConversation ends userID's conversation on their request and returns the reply. The
+// state is taken from the store whether or not it can be read.
+func (h *SlackBotHandler) cancelConversation(eventLog *slog.Logger, userID string) string {
+	state, exists, err := h.conversationStates.Take(userID)
+	switch {
+	case errors.Is(err, errConversationUnreadable):
+		// Take already removed it.
+		activeConversations.Dec()
+		eventLog.Info("User cancelled an unreadable conversation", "error", err)
+		recordStep(stepCancelled, userID)
+		return h.reply("cancel.done", replyData{})
+	case err != nil:
+		eventLog.Error("Error cancelling the conversation", "error", err)
+		return h.reply("conversation.load_failed", replyData{})
+	case !exists:
+		return h.reply("cancel.nothing", replyData{})
+	}
+	activeConversations.Dec()
+	if h.conversationExpired(state) {
+		recordStep(stepExpired, userID)
+		return h.reply("cancel.nothing", replyData{})
+	}
+	eventLog.Info("User cancelled the conversation", "step", state.Step)
+	recordStep(stepCancelled, userID)
+	return h.reply("cancel.done", replyData{})
+}
+
+// deleteConversation removes a user's conversation state, logging failures.
 func (h *SlackBotHandler) deleteConversation(userID string) {
-	log.Printf("Deleting conversation state for user %s", userID)
-	h.conversationMutex.Lock()
-	delete(h.conversationStates, userID)
-	h.conversationMutex.Unlock()
+	logger.Info("Deleting conversation state", "user_id", userID)
+	if err := h.removeConversation(userID); err != nil {
+		logger.Error("Error deleting conversation state", "user_id", userID, "error", err)
+	}
+}
+
+// removeConversation removes a user's conversation state and counts the conversation as ended
+// if it was still there.
+func (h *SlackBotHandler) removeConversation(userID string) error {
+	removed, err := h.conversationStates.Delete(userID)
+	if removed {
+		activeConversations.Dec()
+	}
+	return err
+}
+
+// takeConversation removes userID's state in one step if it is still the state the caller
+// loaded, reporting whether it was, so only one handler of the same step goes on to send. A state
+// that moved on in the meantime, e.g. on another instance, is put back.
+func (h *SlackBotHandler) takeConversation(userID string, loaded *ConversationState) (bool, error) {
+	taken, ok, err := h.conversationStates.Take(userID)
+	if err != nil || !ok {
+		return false, err
+	}
+	activeConversations.Dec()
+	if taken.Step == loaded.Step && taken.LastActivity.Equal(loaded.LastActivity) {
+		return true, nil
+	}
+	if err := h.conversationStates.Set(userID, taken); err != nil {
+		return false, err
+	}
+	activeConversations.Inc()
+	return false, nil
+}
+
+// setConversation stamps the state's LastActivity and stores it, counting a state saved for the
+// first time as a started conversation.
+func (h *SlackBotHandler) setConversation(userID string, state *ConversationState) error {
+	started := state.LastActivity.IsZero()
+	state.LastActivity = time.Now()
+	if err := h.conversationStates.Set(userID, state); err != nil {
+		return err
+	}
+	if started {
+		activeConversations.Inc()
+	}
+	return nil
+}
+
+// saveConversation stores a user's updated conversation state, logging failures.
+func (h *SlackBotHandler) saveConversation(userID string, state *ConversationState) {
+	if err := h.setConversation(userID, state); err != nil {
+		logger.Error("Error saving conversation state", "user_id", userID, "step", state.Step, "error", err)
+	}
+}
+
+// normalizeConversationInput folds case and whitespace so trivially different retypes of the
+// same input compare equal.
+func normalizeConversationInput(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
+
+// cancelKeywords are the messages that abort an in-progress conversation, compared case-insensitively.
+var cancelKeywords = []string{"cancel", "stop", "nevermind"}
+
+// isCancelCommand reports whether text is one of the cancelKeywords.
+func isCancelCommand(text string) bool {
+	return isAnswer(text, cancelKeywords)
+}
+
+// confirmKeywords and rejectKeywords answer the confirmation of an extracted game name.
+var (
+	confirmKeywords = []string{"yes", "y", "yep", "yeah", "sure", "ok", "okay"}
+	rejectKeywords  = []string{"no", "n", "nope"}
+)
+
+// isAnswer reports whether text is one of keywords, compared case-insensitively.
+func isAnswer(text string, keywords []string) bool {
+	text = strings.TrimSpace(text)
+	for _, keyword := range keywords {
+		if strings.EqualFold(text, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDirectMessageEvent reports whether the event was posted in a direct or group direct message.
+// It relies on channel_type when Slack provides it and falls back to the DM channel ID prefix.
+func isDirectMessageEvent(event SlackEvent) bool {
+	switch event.ChannelType {
+	case "im", "mpim":
+		return true
+	case "":
+		return strings.HasPrefix(event.Channel, "D")
+	default:
+		return false
+	}
 }
 
 // removeBotMention removes the first mention (typically @AppName) from the given text.
@@ -383,84 +941,172 @@ func removeBotMention(text string) string {
 	return text
 }
 
-// callGoogleGemini generates an invitation message using Google Gemini AI.
-// It builds a prompt that includes the inviting user's name, the invited users, and the game name.
-func callGoogleGemini(invitingUser string, invitedUsers []string, gameName string) (string, error) {
-	googleGeminiAPIKey := os.Getenv("GOOGLE_GEMINI_API_KEY")
-	if googleGeminiAPIKey == "" {
-		return "", fmt.Errorf("GOOGLE_GEMINI_API_KEY not set")
-	}
-
-	prompt := fmt.Sprintf("Generate a friendly invitation message from %s inviting %s to play a game of %s. Make it engaging and informal.", invitingUser, strings.Join(invitedUsers, ", "), gameName)
-	// Example endpoint – adjust this to the actual Gemini AI endpoint if available.
-	url := "https://generativelanguage.googleapis.com/v1beta/models/gemini-1.5-flash:generateContent"
-	url += "?key=" + googleGeminiAPIKey
-	
-	// Build the request. In this example, we assume the Gemini API expects a "prompt", a "model", and a token limit.
-	requestBody := map[string]interface{}{
-		"contents": []map[string]interface{}{
-			{
-				"parts": []map[string]interface{}{
-					{
-						"text": prompt,
-					},
-				},
-			},
-		},
-	}
-	jsonBody, err := json.Marshal(requestBody)
+// reserveGame starts gameName's cooldown for userID's invitation. When the game is still in
+// cooldown or the cooldown can't be checked it tells the user and returns false.
+func (h *SlackBotHandler) reserveGame(userID, channelID, threadTS, gameName string) bool {
+	remaining, err := h.cooldowns.reserve(gameName, time.Now())
 	if err != nil {
-		return "", err
+		logger.Error("Error checking the game cooldown", "user_id", userID, "channel", channelID, "game", gameName, "error", err)
+		h.sendMessage(channelID, threadTS, h.reply("game.failed", replyData{}))
+		return false
 	}
+	if remaining > 0 {
+		logger.Info("User named a game in cooldown", "user_id", userID, "channel", channelID, "game", gameName, "remaining", remaining.String())
+		h.sendMessage(channelID, threadTS, gameCooldownReply(gameName, remaining))
+		return false
+	}
+	return true
+}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBody))
+// releaseGame ends gameName's cooldown after its invitation failed, so the user can retry.
+func (h *SlackBotHandler) releaseGame(gameName string) {
+	if err := h.cooldowns.release(gameName); err != nil {
+		logger.Error("Failed to release the cooldown", "game", gameName, "error", err)
+	}
+}
+
+// matchRecipients fetches the user directory and resolves the named recipients for inviterID.
+// With MATCH_TIMEOUT set, it gives up with context.DeadlineExceeded once the timeout passes;
+// a directory fetch still in progress then finishes in the background and fills the cache.
+func (h *SlackBotHandler) matchRecipients(ctx context.Context, inviterID string, names []string) (nameMatchResult, error) {
+	if h.config.MatchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.config.MatchTimeout)
+		defer cancel()
+	}
+	users, err := h.userCache.getCachedUsersContext(ctx)
 	if err != nil {
-		return "", err
+		return nameMatchResult{}, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	// req.Header.Set("Authorization", "Bearer "+googleGeminiAPIKey)
+	match := h.resolveNames(ctx, inviterID, names, users)
+	if err := ctx.Err(); err != nil {
+		// The refresh for unmatched names was cut short, so the result may be wrong.
+		return nameMatchResult{}, err
+	}
+	return match, nil
+}
+
+// resolveNames expands saved recipient lists among the inputs and fuzzy matches the remaining names,
+// refreshing the user directory once if a name is not found. Unless self-invites are allowed, the
+// inviter is removed from the result.
+func (h *SlackBotHandler) resolveNames(ctx context.Context, inviterID string, inputs []string, users []slack.User) nameMatchResult {
+	remaining, listMembers, notes := expandRecipientLists(inputs, h.recipientLists, users)
+	match := h.nameMatcher().matchNames(remaining, users)
+	if len(match.Unmatched) > 0 {
+		// The name may belong to someone who joined since the cache was filled, so look again
+		// with a fresh directory before reporting it as unmatched.
+		refreshed, ok, err := h.userCache.refreshIfOlderThan(ctx, minForcedRefreshAge)
+		if err != nil {
+			logger.Error("Error refreshing users after unmatched names", "user_id", inviterID, "unmatched", len(match.Unmatched), "error", err)
+		} else if ok {
+			users = refreshed
+			remaining, listMembers, notes = expandRecipientLists(inputs, h.recipientLists, users)
+			match = h.nameMatcher().matchNames(remaining, users)
+		}
+	}
+	match.addUsers(listMembers)
+	match.Notes = append(match.Notes, notes...)
+	if !h.config.AllowSelfInvite && match.removeUser(inviterID) {
+		logger.Info("Removed inviter from their own recipient list", "user_id", inviterID)
+		match.Notes = append(match.Notes, "You were removed from the recipients, since you can't invite yourself.")
+	}
+	return match
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// nameMatcher returns the matcher configured by MATCH_MAX_EDIT_DISTANCE.
+func (h *SlackBotHandler) nameMatcher() nameMatcher {
+	return nameMatcher{maxEditDistance: h.config.MatchMaxEditDistance}
+}
+
+// unresolvedNamesReply explains which names could not be resolved. When LLM suggestions are
+// enabled, unmatched names get an AI-written "did you mean" reply instead of the full list of
+// valid names, falling back to the list if generation fails.
+func (h *SlackBotHandler) unresolvedNamesReply(ctx context.Context, match nameMatchResult) string {
+	if !h.config.LLMNameSuggestions || len(match.Unmatched) == 0 {
+		return match.problems()
+	}
+	suggestion, err := h.suggestNames(ctx, match.Unmatched, match.ValidNames)
 	if err != nil {
-		return "", err
+		logger.Warn("Falling back to the plain list of names, suggestion failed", "error", err)
+		return match.problems()
+	}
+	var reply string
+	if len(match.Uninvitable) > 0 {
+		reply += strings.Join(match.Uninvitable, "\n") + "\n"
+	}
+	return reply + match.ambiguities() + suggestion + "\n"
+}
+
+// suggestNames asks the generator for a concise "did you mean" reply for names that matched nobody.
+func (h *SlackBotHandler) suggestNames(ctx context.Context, unmatched, candidates []string) (string, error) {
+	completer, ok := h.writer.generator.(promptCompleter)
+	if !ok {
+		return "", errSuggestionsUnsupported
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("Google Gemini API error: %s", string(bodyBytes))
-	}
-
-	// Updated response parsing:
-	// Expected response JSON structure:
-	// {
-	//   "candidates": [
-	//     {
-	//       "content": {
-	//         "parts": [
-	//           {
-	//             "text": "Generated invitation message"
-	//           }
-	//         ]
-	//       }
-	//     }
-	//   ]
-	// }
-	var responseData struct {
-		Candidates []struct {
-			Content struct {
-				Parts []struct {
-					Text string `json:"text"`
-				} `json:"parts"`
-			} `json:"content"`
-		} `json:"candidates"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&responseData); err != nil {
+	if !h.writer.breaker.allow() {
+		return "", errCircuitOpen
+	}
+	if len(candidates) > maxSuggestionCandidates {
+		candidates = candidates[:maxSuggestionCandidates]
+	}
+	prompt := fmt.Sprintf(nameSuggestionPrompt, strings.Join(unmatched, ", "), strings.Join(candidates, ", "))
+	suggestion, err := completer.Complete(ctx, prompt)
+	h.writer.breaker.record(err)
+	if err != nil {
+		logGeneratorError("name suggestions", err)
 		return "", err
 	}
-	if len(responseData.Candidates) == 0 || len(responseData.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("No response from Google Gemini")
+	return truncateMessage(strings.TrimSpace(suggestion), h.config.MaxMessageLength), nil
+}
+
+// extractGameName asks the generator for the game named in a free-form reply such as "let's do
+// some Mario Kart tonight". The reply is returned unchanged when extraction isn't possible or
+// fails, or when the answer doesn't look like a game name.
+func (h *SlackBotHandler) extractGameName(ctx context.Context, text string) string {
+	completer, ok := h.writer.generator.(promptCompleter)
+	if !ok || !h.writer.breaker.allow() {
+		return text
+	}
+	answer, err := completer.Complete(ctx, fmt.Sprintf(gameExtractionPrompt, text))
+	h.writer.breaker.record(err)
+	if err != nil {
+		logGeneratorError("game name", err)
+		return text
+	}
+	game := strings.TrimSpace(strings.Trim(strings.TrimSpace(answer), "\"'`*."))
+	if game == "" || len(game) > maxExtractedGameLength || strings.Contains(game, "\n") {
+		logger.Warn("Using the game name as typed, the extracted name was unusable", "length", len(game))
+		return text
+	}
+	return game
+}
+
+// invitationOptions builds the message options used to deliver a generated invitation, the
+// users to deliver it to and the message's fallback text, adding a line of suggested reactions
+// when calls to action are enabled. With REDIRECT_ALL_TO set, the only target is the sink user.
+func (h *SlackBotHandler) invitationOptions(invitation string, recipientIDs []string) ([]slack.MsgOption, []string, string, error) {
+	targets := recipientIDs
+	text := invitation
+	var blocks []slack.Block
+	if h.config.RedirectAllTo != "" {
+		// Test mode: one copy goes to the sink user, labelled with who it was meant for.
+		logger.Info("Redirecting invitation", "recipients", recipientIDs, "redirect_to", h.config.RedirectAllTo)
+		targets = []string{h.config.RedirectAllTo}
+		text = redirectNotice(recipientIDs) + "\n" + invitation
+		blocks = append(blocks, redirectNoticeBlock(recipientIDs))
 	}
-	return responseData.Candidates[0].Content.Parts[0].Text, nil
-} 
\ No newline at end of file
+	options := []slack.MsgOption{slack.MsgOptionText(text, false)}
+	if h.config.CallToAction {
+		blocks = append(blocks,
+			slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", invitation, false, false), nil, nil),
+			slack.NewContextBlock("suggested_replies",
+				slack.NewTextBlockObject("mrkdwn", suggestedRepliesText, false, false),
+			),
+		)
+		if err := validateBlocks(blocks); err != nil {
+			return nil, nil, "", err
+		}
+		options = append(options, slack.MsgOptionBlocks(blocks...))
+	}
+	return append(options, identityOptions(h.config.BotUsername, h.config.BotIconEmoji)...), targets, text, nil
+}
@@ -0,0 +1,877 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFailedInvitationReleasesGameCooldown(t *testing.T) {
+	tests := []struct {
+		name       string
+		invitation string
+		postError  string // Slack error for the recipient's DM
+		wantReply  string
+	}{
+		{name: "invitation can't be built", invitation: "   ", wantReply: "Error building invitation"},
+		{name: "send fails", invitation: "Come play!", postError: "channel_not_found", wantReply: "Failed to send invitation"},
+		{name: "recipient deactivated", invitation: "Come play!", postError: "account_inactive", wantReply: "Nobody got the invitation"},
+	}
+	for _, tt := range tests {
+		for _, flow := range []string{"command", "conversation"} {
+			t.Run(tt.name+"/"+flow, func(t *testing.T) {
+				fake := newFakeSlack(t, testUsers...)
+				if tt.postError != "" {
+					fake.failPosts("U2", tt.postError)
+				}
+				config := testConfig()
+				config.CallToAction = true
+				config.GameCooldown = time.Hour
+				h, store := newTestBotHandler(t, fake, config, &fakeGenerator{invitation: tt.invitation})
+
+				if flow == "command" {
+					h.processEvent(directMessage("U1", `/invite "bob" "Catan"`))
+				} else {
+					h.processEvent(directMessage("U1", "hi"))
+					h.processEvent(directMessage("U1", "bob"))
+					h.processEvent(directMessage("U1", "Catan"))
+				}
+
+				replies := fake.postsTo("DU1")
+				if len(replies) == 0 || !strings.Contains(replies[len(replies)-1], tt.wantReply) {
+					t.Fatalf("replies = %q, want the last to contain %q", replies, tt.wantReply)
+				}
+				if _, ok, _ := store.Get(gameCooldownKeyPrefix + "catan"); ok {
+					t.Errorf("the cooldown for Catan is still held after the invitation failed")
+				}
+			})
+		}
+	}
+}
+
+func TestUnmatchedNamesRetryLimit(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxAttempts  int
+		maxNames     int
+		messages     []string // sent after the greeting
+		wantReply    string   // contained in the last reply
+		wantStep     string   // "" when the conversation was reset
+		wantAttempts int
+	}{
+		{
+			name:        "gives up at the limit",
+			maxAttempts: 3,
+			messages:    []string{"zed", "quinn", "xavier"},
+			wantReply:   "Sorry, I still couldn't resolve those names.",
+		},
+		{
+			name:         "keeps asking below the limit",
+			maxAttempts:  3,
+			messages:     []string{"zed", "quinn"},
+			wantReply:    "Please provide a correct comma separated list of names.",
+			wantStep:     "awaiting_names",
+			wantAttempts: 2,
+		},
+		{
+			name:         "no limit",
+			messages:     []string{"zed", "quinn", "xavier", "yuri"},
+			wantReply:    "Please provide a correct comma separated list of names.",
+			wantStep:     "awaiting_names",
+			wantAttempts: 4,
+		},
+		{
+			name:         "the same names again",
+			maxAttempts:  3,
+			messages:     []string{"zed", "Zed"},
+			wantReply:    "That's the same list as last time",
+			wantStep:     "awaiting_names",
+			wantAttempts: 2,
+		},
+		{
+			name:         "oversized lists don't count",
+			maxAttempts:  2,
+			maxNames:     2,
+			messages:     []string{"zed", "bob, carol, dave"},
+			wantReply:    "I can only match up to 2 at a time",
+			wantStep:     "awaiting_names",
+			wantAttempts: 1,
+		},
+		{
+			name:         "a match moves on",
+			maxAttempts:  2,
+			messages:     []string{"zed", "bob"},
+			wantReply:    "Matched recipients: Bob Baker.",
+			wantStep:     "awaiting_game",
+			wantAttempts: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			config := testConfig()
+			config.MaxNameAttempts = tt.maxAttempts
+			config.MaxNamesPerInvite = tt.maxNames
+			h, _ := newTestBotHandler(t, fake, config, &fakeGenerator{invitation: "Come play!"})
+
+			h.processEvent(directMessage("U1", "hi"))
+			for _, message := range tt.messages {
+				h.processEvent(directMessage("U1", message))
+			}
+
+			replies := fake.postsTo("DU1")
+			if len(replies) == 0 || !strings.Contains(replies[len(replies)-1], tt.wantReply) {
+				t.Fatalf("replies = %q, want the last to contain %q", replies, tt.wantReply)
+			}
+			state, exists, err := h.conversationStates.Get("U1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantStep == "" {
+				if exists {
+					t.Errorf("conversation is still at %s, want it reset", state.Step)
+				}
+				return
+			}
+			if !exists || state.Step != tt.wantStep || state.NameAttempts != tt.wantAttempts {
+				t.Errorf("conversation = %+v (exists %v), want step %s after %d attempts", state, exists, tt.wantStep, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestDuplicateGameMessagesSendOnce(t *testing.T) {
+	tests := []struct {
+		name       string
+		instances  int  // bot handlers sharing one store
+		concurrent bool // deliver the duplicates at the same time rather than one after the other
+		duplicates int
+	}{
+		{name: "retried delivery", instances: 1, duplicates: 2},
+		{name: "concurrent deliveries", instances: 1, concurrent: true, duplicates: 5},
+		{name: "deliveries to several instances", instances: 3, concurrent: true, duplicates: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			config := testConfig()
+			generator := &fakeGenerator{invitation: "Come play!"}
+			first, store := newTestBotHandler(t, fake, config, generator)
+			handlers := []*SlackBotHandler{first}
+			for len(handlers) < tt.instances {
+				client := fake.client()
+				users := newUserCache(client, time.Minute)
+				h := NewSlackBotHandler(client, config, users, newMessageSender(client, nil, newSendPacer(0, 0), 0, 0),
+					newRecipientListStore(store, config.Regulars), newConversationStore(store, config.ConversationTTL), newInvitationWriter(config, users, generator),
+					newGameCooldowns(store, config.GameCooldown, config.GameCooldowns), newSeenEvents(store, config.EventDedupeWindow), newQuietHoursStore(store, users))
+				t.Cleanup(h.Close)
+				handlers = append(handlers, h)
+			}
+
+			first.processEvent(directMessage("U1", "hi"))
+			first.processEvent(directMessage("U1", "bob"))
+			var wg sync.WaitGroup
+			for i := 0; i < tt.duplicates; i++ {
+				h := handlers[i%len(handlers)]
+				if !tt.concurrent {
+					h.processEvent(directMessage("U1", "Catan"))
+					continue
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					h.processEvent(directMessage("U1", "Catan"))
+				}()
+			}
+			wg.Wait()
+
+			if got := len(fake.postsTo("U2")); got != 1 {
+				t.Errorf("Bob got %d invitations, want 1", got)
+			}
+			if got := generator.callCount(); got != 1 {
+				t.Errorf("wrote %d invitations, want 1", got)
+			}
+		})
+	}
+}
+
+func TestMalformedEventCallbacks(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		strict    bool
+		wantCode  int
+		wantError string
+	}{
+		{name: "not JSON", body: `{"type": "event_callback",`, wantCode: http.StatusBadRequest},
+		{name: "missing callback type", body: `{"event": {"type": "message", "user": "U1", "channel": "DU1", "channel_type": "im", "text": "hi"}}`, strict: true, wantCode: http.StatusBadRequest, wantError: "missing callback type"},
+		{name: "missing event type", body: `{"type": "event_callback", "event": {"user": "U1", "channel": "DU1", "text": "hi"}}`, strict: true, wantCode: http.StatusBadRequest, wantError: "event_callback without event type"},
+		{name: "missing channel", body: `{"type": "event_callback", "event": {"type": "message", "user": "U1", "channel_type": "im", "text": "hi"}}`, strict: true, wantCode: http.StatusBadRequest, wantError: "message event without channel"},
+		{name: "url_verification without challenge", body: `{"type": "url_verification"}`, strict: true, wantCode: http.StatusBadRequest, wantError: "url_verification callback without challenge"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			config := testConfig()
+			config.StrictEventValidation = tt.strict
+			h, _ := newTestBotHandler(t, fake, config, &fakeGenerator{invitation: "Come play!"})
+			queue := countQueued(h)
+
+			w := postEvent(h, "application/json", tt.body)
+			if w.Code != tt.wantCode || !strings.Contains(w.Body.String(), tt.wantError) {
+				t.Errorf("HandleEvent = %d %s, want %d with %q", w.Code, w.Body.String(), tt.wantCode, tt.wantError)
+			}
+			h.Close()
+			if got := queue.queued(); len(got) != 0 {
+				t.Errorf("queued steps for %q, want none", got)
+			}
+			if posts := fake.allPosts(); len(posts) != 0 {
+				t.Errorf("posted %+v, want nothing", posts)
+			}
+		})
+	}
+}
+
+func TestFormEncodedEventsAreRefused(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantError string
+	}{
+		{name: "interaction payload", body: url.Values{"payload": {`{"type":"block_actions"}`}}.Encode(), wantError: "set the app's interactivity request URL to /slack/interactions"},
+		{name: "other form", body: url.Values{"type": {"event_callback"}}.Encode(), wantError: "Slack event callbacks must be sent as application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			h, _ := newTestBotHandler(t, fake, testConfig(), &fakeGenerator{invitation: "Come play!"})
+			queue := countQueued(h)
+
+			w := postEvent(h, "application/x-www-form-urlencoded", tt.body)
+			// BindJSON would have answered with a JSON decoding error instead.
+			var response map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != http.StatusBadRequest || !strings.Contains(response["error"], tt.wantError) {
+				t.Errorf("HandleEvent = %d %q, want 400 with %q", w.Code, response["error"], tt.wantError)
+			}
+			if got := queue.queued(); len(got) != 0 {
+				t.Errorf("queued steps for %q, want none", got)
+			}
+		})
+	}
+}
+
+func TestUnhandledEventsAreAckedAndIgnored(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantQueued []string
+	}{
+		{name: "direct message", body: `{"type": "event_callback", "event_id": "Ev1", "event": {"type": "message", "user": "U1", "channel": "DU1", "channel_type": "im", "text": "hi"}}`, wantQueued: []string{"U1"}},
+		{name: "reaction", body: `{"type": "event_callback", "event_id": "Ev2", "event": {"type": "reaction_added", "user": "U1", "channel": "DU1"}}`},
+		{name: "edited message", body: `{"type": "event_callback", "event_id": "Ev3", "event": {"type": "message", "subtype": "message_changed", "user": "U1", "channel": "DU1", "channel_type": "im"}}`},
+		{name: "channel message", body: `{"type": "event_callback", "event_id": "Ev4", "event": {"type": "message", "user": "U1", "channel": "C0123456", "channel_type": "channel", "text": "hi"}}`},
+		{name: "other callback type", body: `{"type": "app_rate_limited", "minute_rate_limited": 1518467820}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			h, _ := newTestBotHandler(t, fake, testConfig(), &fakeGenerator{invitation: "Come play!"})
+			queue := countQueued(h)
+
+			if w := postEvent(h, "application/json", tt.body); w.Code != http.StatusOK {
+				t.Errorf("HandleEvent = %d %s, want 200", w.Code, w.Body.String())
+			}
+			h.Close()
+			if got := queue.queued(); strings.Join(got, ",") != strings.Join(tt.wantQueued, ",") {
+				t.Errorf("queued steps for %q, want %q", got, tt.wantQueued)
+			}
+		})
+	}
+}
+
+func TestBotMessagesAreIgnored(t *testing.T) {
+	botMessage := directMessage("U9", "hi")
+	botMessage.Event.BotID = "B9"
+	tests := []struct {
+		name  string
+		event SlackEventCallback
+	}{
+		{name: "message from a bot", event: botMessage},
+		{name: "one of our own invitations", event: directMessage("U2", invitationTitlePrefix+"Catan")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			generator := &fakeGenerator{invitation: "Come play!"}
+			h, _ := newTestBotHandler(t, fake, testConfig(), generator)
+			h.processEvent(tt.event)
+
+			if posts := fake.allPosts(); len(posts) != 0 {
+				t.Errorf("posted %+v, want nothing", posts)
+			}
+			if _, exists, err := h.conversationStates.Get(tt.event.Event.User); err != nil || exists {
+				t.Errorf("conversation started (%v, %v), want none", exists, err)
+			}
+			if got := generator.callCount(); got != 0 {
+				t.Errorf("generator called %d times, want 0", got)
+			}
+		})
+	}
+}
+
+func TestMessageChannelTypes(t *testing.T) {
+	tests := []struct {
+		channelType string
+		channel     string
+		wantHandled bool
+	}{
+		{channelType: "im", channel: "D0123456", wantHandled: true},
+		{channelType: "mpim", channel: "G0123456", wantHandled: true},
+		{channelType: "channel", channel: "C0123456"},
+		{channelType: "group", channel: "G0123456"},
+		{channelType: "app_home", channel: "D0123456"},
+		// Older payloads without channel_type go by the channel ID.
+		{channel: "D0123456", wantHandled: true},
+		{channel: "C0123456"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.channelType+"/"+tt.channel, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			h, _ := newTestBotHandler(t, fake, testConfig(), &fakeGenerator{invitation: "Come play!"})
+			queue := countQueued(h)
+
+			body := fmt.Sprintf(`{"type": "event_callback", "event_id": "Ev1", "event": {"type": "message", "user": "U1", "channel": %q, "channel_type": %q, "text": "hi"}}`, tt.channel, tt.channelType)
+			if w := postEvent(h, "application/json", body); w.Code != http.StatusOK {
+				t.Fatalf("HandleEvent = %d %s, want 200", w.Code, w.Body.String())
+			}
+			h.Close()
+			if handled := len(queue.queued()) == 1; handled != tt.wantHandled {
+				t.Errorf("queued %q, want handled: %v", queue.queued(), tt.wantHandled)
+			}
+			if replied := len(fake.postsTo(tt.channel)) > 0; replied != tt.wantHandled {
+				t.Errorf("replies in %s = %q, want a reply: %v", tt.channel, fake.postsTo(tt.channel), tt.wantHandled)
+			}
+		})
+	}
+}
+
+// mention builds the callback for userID mentioning the bot in channel, inside the thread of
+// threadTS unless it is empty.
+func mention(userID, channel, threadTS, text string) SlackEventCallback {
+	return SlackEventCallback{
+		Type: "event_callback",
+		Event: SlackEvent{
+			Type:     "app_mention",
+			User:     userID,
+			Text:     "<@UBOT> " + text,
+			Channel:  channel,
+			ThreadTS: threadTS,
+		},
+	}
+}
+
+func TestMentionRepliesInThread(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    SlackEventCallback
+		wantText string
+	}{
+		{name: "command in a thread", event: mention("U1", "C0123456", "1700000000.000100", "help"), wantText: "Here's what I can do"},
+		{name: "command at the top level", event: mention("U1", "C0123456", "", "help"), wantText: "Here's what I can do"},
+		{name: "invitation started in a thread", event: mention("U1", "C0123456", "1700000000.000100", "hi"), wantText: "Who do you want to message?"},
+		{name: "invitation started at the top level", event: mention("U1", "C0123456", "", "hi"), wantText: "Who do you want to message?"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			h, _ := newTestBotHandler(t, fake, testConfig(), &fakeGenerator{invitation: "Come play!"})
+			h.processEvent(tt.event)
+
+			posts := fake.allPosts()
+			if len(posts) != 1 || posts[0].Channel != "C0123456" || !strings.Contains(posts[0].Text, tt.wantText) {
+				t.Fatalf("posted %+v, want one reply in C0123456 containing %q", posts, tt.wantText)
+			}
+			if posts[0].ThreadTS != tt.event.Event.ThreadTS {
+				t.Errorf("reply thread_ts = %q, want %q", posts[0].ThreadTS, tt.event.Event.ThreadTS)
+			}
+		})
+	}
+}
+
+func TestMentionCommands(t *testing.T) {
+	tests := []struct {
+		name      string
+		before    []string // DMs from U1 before the mention
+		text      string   // after the mention
+		wantReply string
+	}{
+		{name: "help", text: "help", wantReply: "Here's what I can do:"},
+		{name: "any case and spacing", text: "  HeLp ", wantReply: "Here's what I can do:"},
+		{name: "status without an invitation", text: "status", wantReply: "You don't have an invitation in progress."},
+		{name: "status waiting for names", before: []string{"hi"}, text: "status", wantReply: "I'm waiting for the names of the people you want to invite."},
+		{name: "status waiting for the game", before: []string{"hi", "bob"}, text: "status", wantReply: "You're inviting Bob Baker, and I'm waiting for the game."},
+		{name: "stats", text: "stats", wantReply: "Conversation steps since I started:\n• " + conversationFunnel[0] + ": "},
+		{name: "more than the command starts an invitation", text: "help me invite bob", wantReply: "Who do you want to message?"},
+		{name: "unknown word starts an invitation", text: "dance", wantReply: "Who do you want to message?"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			h, _ := newTestBotHandler(t, fake, testConfig(), &fakeGenerator{invitation: "Come play!"})
+			for _, text := range tt.before {
+				h.processEvent(directMessage("U1", text))
+			}
+			_, existedBefore, _ := h.conversationStates.Get("U1")
+
+			h.processEvent(mention("U1", "C0123456", "", tt.text))
+			replies := fake.postsTo("C0123456")
+			if len(replies) != 1 || !strings.Contains(replies[0], tt.wantReply) {
+				t.Fatalf("replies = %q, want one containing %q", replies, tt.wantReply)
+			}
+			// Commands only answer; they don't start or change the conversation.
+			if _, isCommand := lookupMentionCommand(tt.text); isCommand {
+				if _, exists, _ := h.conversationStates.Get("U1"); exists != existedBefore {
+					t.Errorf("conversation exists = %v after %q, want %v", exists, tt.text, existedBefore)
+				}
+			}
+		})
+	}
+}
+
+func TestSlowUserDirectoryTimesOut(t *testing.T) {
+	for _, flow := range []string{"conversation", "command"} {
+		t.Run(flow, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			fake.slowUsers(300 * time.Millisecond)
+			config := testConfig()
+			config.MatchTimeout = 50 * time.Millisecond
+			h, _ := newTestBotHandler(t, fake, config, &fakeGenerator{invitation: "Come play!"})
+			send := func(text string) {
+				if flow == "conversation" {
+					h.processEvent(directMessage("U1", text))
+				} else {
+					h.processEvent(directMessage("U1", `/invite "`+text+`" "Catan"`))
+				}
+			}
+			if flow == "conversation" {
+				h.processEvent(directMessage("U1", "hi"))
+			}
+
+			start := time.Now()
+			send("bob")
+			if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+				t.Errorf("matching took %s, want it cut off near MATCH_TIMEOUT", elapsed)
+			}
+			replies := fake.postsTo("DU1")
+			if len(replies) == 0 || replies[len(replies)-1] != defaultReplies["names.match_timeout"] {
+				t.Fatalf("replies = %q, want the last to ask to try again", replies)
+			}
+			if got := len(fake.postsTo("U2")); got != 0 {
+				t.Fatalf("Bob got %d invitations, want none yet", got)
+			}
+			if flow == "conversation" {
+				state, exists, err := h.conversationStates.Get("U1")
+				if err != nil || !exists || state.Step != "awaiting_names" {
+					t.Errorf("conversation = %+v (exists %v, err %v), want it still awaiting_names", state, exists, err)
+				}
+			}
+
+			// The fetch finishes in the background, so trying again matches from the cache.
+			time.Sleep(400 * time.Millisecond)
+			send("bob")
+			if flow == "conversation" {
+				send("Catan")
+			}
+			if got := len(fake.postsTo("U2")); got != 1 {
+				t.Errorf("Bob got %d invitations after trying again, want 1", got)
+			}
+			if got := fake.usersListCalls(); got != 1 {
+				t.Errorf("users.list called %d times, want the cut-off fetch reused", got)
+			}
+		})
+	}
+}
+
+func TestGreetingDelay(t *testing.T) {
+	askNames := defaultReplyTemplates.render("greeting.ask_names", replyData{})
+	tests := []struct {
+		name       string
+		delay      time.Duration
+		replyFirst string   // what the user says before the prompt is due, if anything
+		wantFirst  []string // replies right after the greeting
+		wantPrompt bool     // the names prompt follows on its own
+	}{
+		{name: "combined", wantFirst: []string{"Hi! " + askNames}},
+		{name: "split", delay: 30 * time.Millisecond, wantFirst: []string{"Hi!"}, wantPrompt: true},
+		{name: "user answers before the prompt", delay: 30 * time.Millisecond, replyFirst: "bob", wantFirst: []string{"Hi!"}},
+		{name: "user cancels before the prompt", delay: 30 * time.Millisecond, replyFirst: "cancel", wantFirst: []string{"Hi!"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			config := testConfig()
+			config.GreetingDelay = tt.delay
+			h, _ := newTestBotHandler(t, fake, config, &fakeGenerator{invitation: "Come play!"})
+			h.processEvent(directMessage("U1", "hi"))
+
+			if got := fake.postsTo("DU1"); strings.Join(got, "|") != strings.Join(tt.wantFirst, "|") {
+				t.Errorf("replies = %q, want %q", got, tt.wantFirst)
+			}
+			if tt.replyFirst != "" {
+				h.processEvent(directMessage("U1", tt.replyFirst))
+			}
+			// Close waits for a prompt still due.
+			h.Close()
+			replies := fake.postsTo("DU1")
+			prompted := 0
+			for _, reply := range replies {
+				if reply == askNames {
+					prompted++
+				}
+			}
+			if want := map[bool]int{true: 1}[tt.wantPrompt]; prompted != want {
+				t.Errorf("replies = %q, want the names prompt on its own %d times", replies, want)
+			}
+			if tt.replyFirst != "" {
+				return
+			}
+			state, exists, err := h.conversationStates.Get("U1")
+			if err != nil || !exists || state.Step != "awaiting_names" {
+				t.Errorf("conversation = %+v (exists %v, err %v), want it awaiting_names", state, exists, err)
+			}
+		})
+	}
+}
+
+func TestExtractGameName(t *testing.T) {
+	const text = "let's do some Mario Kart this evening"
+	tests := []struct {
+		name       string
+		completion string
+		err        error
+		want       string
+	}{
+		{name: "the game", completion: "Mario Kart", want: "Mario Kart"},
+		{name: "quotes and emphasis are trimmed", completion: " \"*Mario Kart*.\"\n", want: "Mario Kart"},
+		{name: "the longest usable answer", completion: strings.Repeat("x", maxExtractedGameLength), want: strings.Repeat("x", maxExtractedGameLength)},
+		{name: "a longer answer is ignored", completion: strings.Repeat("x", maxExtractedGameLength+1), want: text},
+		{name: "several lines are ignored", completion: "Mario Kart\nor maybe Smash", want: text},
+		{name: "an empty answer is ignored", completion: "  ", want: text},
+		{name: "an error keeps the text", err: &GeneratorError{Kind: generatorTimedOut, Err: context.DeadlineExceeded}, want: text},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			generator := &fakeGenerator{completion: tt.completion, err: tt.err}
+			h, _ := newTestBotHandler(t, fake, testConfig(), generator)
+			if got := h.extractGameName(context.Background(), text); got != tt.want {
+				t.Errorf("extractGameName(%q) = %q, want %q", text, got, tt.want)
+			}
+			prompts := generator.completedPrompts()
+			if len(prompts) != 1 || prompts[0] != fmt.Sprintf(gameExtractionPrompt, text) {
+				t.Fatalf("prompts = %q, want the extraction prompt", prompts)
+			}
+			if !strings.Contains(prompts[0], `replied: "let's do some Mario Kart this evening".`) {
+				t.Errorf("prompt = %q, want the reply quoted", prompts[0])
+			}
+		})
+	}
+}
+
+func TestGameExtractionInConversation(t *testing.T) {
+	tests := []struct {
+		name        string
+		completion  string
+		wantConfirm string // the game the user is asked to confirm, "" when the text is used as typed
+	}{
+		{name: "confirmed before sending", completion: "Mario Kart", wantConfirm: "Mario Kart"},
+		{name: "an unusable answer sends the text as typed", completion: strings.Repeat("x", maxExtractedGameLength+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			config := testConfig()
+			config.LLMGameExtraction = true
+			generator := &fakeGenerator{invitation: "Come play!", completion: tt.completion}
+			h, _ := newTestBotHandler(t, fake, config, generator)
+			h.processEvent(directMessage("U1", "hi"))
+			h.processEvent(directMessage("U1", "bob"))
+			h.processEvent(directMessage("U1", "let's do some Mario Kart this evening"))
+
+			if tt.wantConfirm == "" {
+				if got := generator.invitedGames(); len(got) != 1 || got[0] != "let's do some Mario Kart this evening" || len(fake.postsTo("U2")) != 1 {
+					t.Errorf("invited to %q, want the game sent as typed", got)
+				}
+				return
+			}
+			replies := fake.postsTo("DU1")
+			if want := defaultReplyTemplates.render("game.confirm", replyData{Game: tt.wantConfirm}); len(replies) == 0 || replies[len(replies)-1] != want {
+				t.Fatalf("replies = %q, want the last to be %q", replies, want)
+			}
+			if got := len(fake.postsTo("U2")); got != 0 {
+				t.Fatalf("Bob got %d invitations before the game was confirmed", got)
+			}
+			h.processEvent(directMessage("U1", "yes"))
+			if got := generator.invitedGames(); len(got) != 1 || got[0] != tt.wantConfirm || len(fake.postsTo("U2")) != 1 {
+				t.Errorf("invited to %q, want Bob invited to %s", got, tt.wantConfirm)
+			}
+		})
+	}
+}
+
+func TestOversizedNamesAreRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		flow    string // "conversation" or "command"
+		names   string
+		wantErr string
+	}{
+		{name: "too long", flow: "conversation", names: strings.Repeat("bobby tables ", 10), wantErr: "that list is too long (over 50 characters)"},
+		{name: "too many names", flow: "conversation", names: "a, b, c, d, e, f", wantErr: "that's 6 names, but I can only match up to 5 at a time"},
+		{name: "too long in a command", flow: "command", names: strings.Repeat("bobby tables ", 10), wantErr: "that list is too long (over 50 characters)"},
+		{name: "too many names in a command", flow: "command", names: "a, b, c, d, e, f", wantErr: "that's 6 names, but I can only match up to 5 at a time"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			config := testConfig()
+			config.MaxNamesInputLength = 50
+			config.MaxNamesPerInvite = 5
+			config.MaxNameAttempts = 3
+			h, _ := newTestBotHandler(t, fake, config, &fakeGenerator{invitation: "Come play!"})
+			if tt.flow == "conversation" {
+				h.processEvent(directMessage("U1", "hi"))
+				h.processEvent(directMessage("U1", tt.names))
+			} else {
+				h.processEvent(directMessage("U1", `/invite "`+tt.names+`" "Catan"`))
+			}
+
+			replies := fake.postsTo("DU1")
+			if want := oversizedNamesReply(errors.New(tt.wantErr)); len(replies) == 0 || replies[len(replies)-1] != want {
+				t.Fatalf("replies = %q, want the last to be %q", replies, want)
+			}
+			if got := fake.usersListCalls(); got != 0 {
+				t.Errorf("users.list called %d times, want the input refused before matching", got)
+			}
+			if tt.flow == "conversation" {
+				state, exists, err := h.conversationStates.Get("U1")
+				if err != nil || !exists || state.Step != "awaiting_names" || state.NameAttempts != 0 {
+					t.Errorf("conversation = %+v (exists %v, err %v), want it awaiting_names without a used attempt", state, exists, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRepeatedNamesAreEscalated(t *testing.T) {
+	fake := newFakeSlack(t, testUsers...)
+	config := testConfig()
+	h, _ := newTestBotHandler(t, fake, config, &fakeGenerator{invitation: "Come play!"})
+	h.processEvent(directMessage("U1", "hi"))
+
+	steps := []struct {
+		text       string
+		wantRepeat bool // whether the reply offers a way around the matcher
+	}{
+		{text: "zed"},
+		{text: "  ZED ", wantRepeat: true},
+		{text: "zed", wantRepeat: true},
+		{text: "quinn"},
+		{text: "zed"},
+	}
+	for i, step := range steps {
+		h.processEvent(directMessage("U1", step.text))
+		replies := fake.postsTo("DU1")
+		reply := replies[len(replies)-1]
+		repeated := strings.Contains(reply, "That's the same list as last time") && strings.Contains(reply, "`GET /invite`")
+		if repeated != step.wantRepeat || !strings.Contains(reply, "Could not match the following names: ") {
+			t.Errorf("reply to message %d %q = %q, want repeat escalation: %v", i, step.text, reply, step.wantRepeat)
+		}
+		state, exists, err := h.conversationStates.Get("U1")
+		if err != nil || !exists || state.Step != "awaiting_names" {
+			t.Fatalf("conversation = %+v (exists %v, err %v), want it awaiting_names", state, exists, err)
+		}
+		if want := normalizeConversationInput(step.text); state.LastInput != want || state.NameAttempts != i+1 {
+			t.Errorf("after %q: LastInput = %q, NameAttempts = %d, want %q and %d", step.text, state.LastInput, state.NameAttempts, want, i+1)
+		}
+	}
+	if got := len(fake.postsTo("U2")) + len(fake.postsTo("U3")); got != 0 {
+		t.Errorf("sent %d invitations, want none", got)
+	}
+}
+
+func TestCallToAction(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("enabled=%t", enabled), func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			config := testConfig()
+			config.CallToAction = enabled
+			var err error
+			if config.PromptTemplate, err = parsePromptTemplate(defaultPromptTemplate); err != nil {
+				t.Fatal(err)
+			}
+			h, _ := newTestBotHandler(t, fake, config, &fakeGenerator{invitation: "Come play Catan!"})
+			h.processEvent(directMessage("U1", `/invite "bob" "Catan"`))
+
+			var invitations []fakePost
+			for _, post := range fake.allPosts() {
+				if post.Channel == "U2" {
+					invitations = append(invitations, post)
+				}
+			}
+			if len(invitations) != 1 || invitations[0].Text != "Come play Catan!" {
+				t.Fatalf("Bob got %+v, want one invitation", invitations)
+			}
+			blocks := invitations[0].Blocks
+			if got := strings.Contains(blocks, `"block_id":"suggested_replies"`) && strings.Contains(blocks, suggestedRepliesText); got != enabled {
+				t.Errorf("suggested replies in %s: %v, want %v", blocks, got, enabled)
+			}
+			if enabled && !strings.Contains(blocks, "Come play Catan!") {
+				t.Errorf("blocks %s should hold the invitation above the suggestions", blocks)
+			}
+
+			prompt, err := renderPrompt(config.PromptTemplate, promptData{Inviter: "Alice Archer", Recipients: "Bob Baker", Game: "Catan", Tone: defaultTone, Extras: NewGeminiGenerator(config).extras})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.HasSuffix(prompt, " "+callToActionPrompt); got != enabled {
+				t.Errorf("prompt = %q, want the call to action asked for: %v", prompt, enabled)
+			}
+		})
+	}
+}
+
+func TestNameSuggestions(t *testing.T) {
+	tests := []struct {
+		name        string
+		enabled     bool
+		err         error
+		wantReply   string // the start of the reply to "bob, zed"
+		wantPrompts int
+	}{
+		{name: "disabled lists the valid names", wantReply: "Could not match the following names: zed.\nValid user names include: ", wantPrompts: 0},
+		{name: "enabled suggests", enabled: true, wantReply: "Did you mean Bob Baker?\nPlease provide", wantPrompts: 1},
+		{name: "a failed suggestion falls back to the list", enabled: true, err: &GeneratorError{Kind: generatorTimedOut, Err: context.DeadlineExceeded}, wantReply: "Could not match the following names: zed.\nValid user names include: ", wantPrompts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			config := testConfig()
+			config.LLMNameSuggestions = tt.enabled
+			gen := &fakeGenerator{invitation: "Come play!", completion: "  Did you mean Bob Baker?  ", err: tt.err}
+			h, _ := newTestBotHandler(t, fake, config, gen)
+			h.processEvent(directMessage("U1", "hi"))
+			h.processEvent(directMessage("U1", "bob, zed"))
+
+			replies := fake.postsTo("DU1")
+			if reply := replies[len(replies)-1]; !strings.HasPrefix(reply, tt.wantReply) {
+				t.Errorf("reply = %q, want it to start with %q", reply, tt.wantReply)
+			}
+			prompts := gen.completedPrompts()
+			if len(prompts) != tt.wantPrompts {
+				t.Fatalf("completed %d prompts, want %d", len(prompts), tt.wantPrompts)
+			}
+			if tt.wantPrompts > 0 && !strings.Contains(prompts[0], "people named zed,") {
+				t.Errorf("prompt = %q, want it to name the unmatched names", prompts[0])
+			}
+			if got := len(fake.postsTo("U2")); got != 0 {
+				t.Errorf("Bob got %d invitations, want none until the names resolve", got)
+			}
+		})
+	}
+}
+
+func TestSelfInvites(t *testing.T) {
+	tests := []struct {
+		name       string
+		names      string   // the inviter Alice's reply naming recipients
+		allow      bool     // ALLOW_SELF_INVITE
+		wantSent   []string // who gets an invitation
+		wantStatus int      // the API's answer to the same recipients
+		wantReply  string   // what the conversation tells the inviter, if anything
+	}{
+		{name: "the inviter is removed", names: "alice, bob", wantSent: []string{"U2"}, wantStatus: http.StatusOK, wantReply: "You were removed from the recipients, since you can't invite yourself."},
+		{name: "only the inviter", names: "alice", wantStatus: http.StatusBadRequest, wantReply: "You can't invite only yourself. Who else do you want to invite?"},
+		{name: "allowed", names: "alice, bob", allow: true, wantSent: []string{"U1", "U2"}, wantStatus: http.StatusOK},
+	}
+	ids := map[string]string{"alice": "U1", "bob": "U2"}
+	for _, tt := range tests {
+		for _, flow := range []string{"api", "conversation"} {
+			t.Run(tt.name+"/"+flow, func(t *testing.T) {
+				fake := newFakeSlack(t, testUsers...)
+				config := testConfig()
+				config.AllowSelfInvite = tt.allow
+				if flow == "api" {
+					var userIDs []string
+					for _, name := range strings.Split(tt.names, ", ") {
+						userIDs = append(userIDs, ids[name])
+					}
+					h, _ := newTestInviteHandler(t, fake, config)
+					status, response := h.sendInvite(InviteRequest{GameName: "Catan", UserIDs: userIDs, InviterID: "U1", Description: "Come play"})
+					if status != tt.wantStatus {
+						t.Fatalf("sendInvite = %d %v, want %d", status, response, tt.wantStatus)
+					}
+				} else {
+					h, _ := newTestBotHandler(t, fake, config, &fakeGenerator{invitation: "Come play!"})
+					h.processEvent(directMessage("U1", "hi"))
+					h.processEvent(directMessage("U1", tt.names))
+					h.processEvent(directMessage("U1", "Catan"))
+					replies := strings.Join(fake.postsTo("DU1"), "\n")
+					if tt.wantReply != "" && !strings.Contains(replies, tt.wantReply) {
+						t.Errorf("replies = %q, want them to contain %q", replies, tt.wantReply)
+					}
+					if tt.allow && strings.Contains(replies, "yourself") {
+						t.Errorf("replies = %q, want the inviter kept without comment", replies)
+					}
+				}
+
+				var sent []string
+				for _, recipient := range []string{"U1", "U2"} {
+					if len(fake.postsTo(recipient)) > 0 {
+						sent = append(sent, recipient)
+					}
+				}
+				if strings.Join(sent, ",") != strings.Join(tt.wantSent, ",") {
+					t.Errorf("invited %q, want %q", sent, tt.wantSent)
+				}
+			})
+		}
+	}
+}
+
+func TestCancelDuringMaintenance(t *testing.T) {
+	fake := newFakeSlack(t, testUsers...)
+	config := testConfig()
+	h, _ := newTestBotHandler(t, fake, config, &fakeGenerator{invitation: "Come play!"})
+	h.processEvent(directMessage("U1", "hi"))
+	h.processEvent(directMessage("U1", "bob"))
+
+	// Maintenance starts while the user is naming the game.
+	config.MaintenanceMode = true
+	h.processEvent(directMessage("U1", "Catan"))
+	h.processEvent(directMessage("U1", "cancel"))
+
+	replies := fake.postsTo("DU1")
+	if len(replies) < 2 || replies[len(replies)-2] != maintenanceReply {
+		t.Errorf("replies = %q, want the game answered with the maintenance reply", replies)
+	}
+	if want := h.reply("cancel.done", replyData{}); len(replies) == 0 || replies[len(replies)-1] != want {
+		t.Errorf("replies = %q, want the last to be %q", replies, want)
+	}
+	if _, exists, err := h.conversationStates.Get("U1"); err != nil || exists {
+		t.Errorf("conversation still saved (%v, %v), want it cancelled", exists, err)
+	}
+	if got := fake.postsTo("U2"); len(got) != 0 {
+		t.Errorf("Bob got %q, want nothing sent", got)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// handledEventTypes lists the inner event types the bot knows how to process.
+var handledEventTypes = map[string]bool{
+	"app_mention": true,
+	"message":     true,
+}
+
+// isHandledEvent reports whether the callback is on the allowlist of events the bot acts on:
+// app mentions, and plain user messages in direct or group direct messages.
+func isHandledEvent(cb SlackEventCallback) bool {
+	if cb.Type != "event_callback" || !handledEventTypes[cb.Event.Type] {
+		return false
+	}
+	if cb.Event.Type == "message" {
+		return cb.Event.Subtype == "" && isDirectMessageEvent(cb.Event)
+	}
+	return true
+}
+
+// validateEventCallback inspects a decoded Slack callback for shape problems.
+// Problems that still leave the callback usable are only logged; the returned error is
+// non-nil only when the callback is clearly malformed and cannot be processed.
+func validateEventCallback(cb *SlackEventCallback) error {
+	switch cb.Type {
+	case "":
+		return errors.New("missing callback type")
+	case "url_verification":
+		if cb.Challenge == "" {
+			return errors.New("url_verification callback without challenge")
+		}
+		return nil
+	case "event_callback":
+		// validated below
+	default:
+		logger.Debug("Event validation: unexpected callback type", "callback_type", cb.Type)
+		return nil
+	}
+
+	event := cb.Event
+	if event.Type == "" {
+		return errors.New("event_callback without event type")
+	}
+	if !handledEventTypes[event.Type] {
+		logger.Debug("Event validation: unhandled event type", "event_type", event.Type)
+		return nil
+	}
+
+	var missing []string
+	if event.Channel == "" {
+		missing = append(missing, "channel")
+	}
+	// Bot messages carry a bot_id instead of a user.
+	if event.User == "" && event.BotID == "" {
+		missing = append(missing, "user")
+	}
+	if len(missing) > 0 {
+		logger.Debug("Event validation: event missing expected fields", "event_type", event.Type, "missing", missing)
+		if event.Channel == "" {
+			return fmt.Errorf("%s event without channel", event.Type)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,515 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/slack-go/slack"
+)
+
+// fakeSlack is an httptest server answering the Web API methods the bot uses. It records every
+// message posted and can fail posts to chosen channels.
+type fakeSlack struct {
+	server   *httptest.Server
+	users    []slack.User
+	channels []slack.Channel // served by conversations.list
+
+	mutex        sync.Mutex
+	posts        []fakePost
+	updates      []fakePost
+	ephemerals   map[string][]string // user -> texts posted only to them
+	scheduled    []fakeScheduled
+	views        []slack.ModalViewRequest // modals opened with views.open
+	postErrors   map[string]string        // channel -> Slack error to answer chat.postMessage with
+	updateErrors map[string]string        // channel -> Slack error to answer chat.update with
+	listError    string                   // Slack error to answer chat.scheduledMessages.list with
+	postDelay    time.Duration            // how long chat.postMessage takes to answer
+	postsActive  int                      // chat.postMessage requests being answered
+	postsPeak    int                      // the most chat.postMessage requests answered at once
+	usersDelay   time.Duration            // how long users.list takes to answer
+	usersCalls   int                      // users.list requests served
+	uploads      []fakeUpload             // files shared with files.uploadV2
+	uploadBodies map[string]string        // file ID -> content sent to its upload URL
+	uploadErrors map[string]string        // channel -> Slack error to answer files.completeUploadExternal with
+}
+
+// fakePost is a message the bot posted or updated.
+type fakePost struct {
+	Channel  string
+	Text     string
+	Blocks   string
+	TS       string
+	ThreadTS string // the parent message of a threaded reply
+	// Username and IconEmoji are the custom identity the message was posted as, if any.
+	Username  string
+	IconEmoji string
+}
+
+// fakeUpload is a file the bot shared in a channel.
+type fakeUpload struct {
+	Channel  string
+	Filename string
+	Title    string
+	Content  string
+}
+
+// fakeScheduled is a message the bot queued with chat.scheduleMessage.
+type fakeScheduled struct {
+	ID      string
+	Channel string
+	Text    string
+	PostAt  int64
+	Deleted bool // withdrawn with chat.deleteScheduledMessage
+}
+
+// newFakeSlack starts a fake Slack API serving users as the workspace directory.
+func newFakeSlack(t *testing.T, users ...slack.User) *fakeSlack {
+	t.Helper()
+	f := &fakeSlack{users: users, ephemerals: make(map[string][]string), postErrors: make(map[string]string), updateErrors: make(map[string]string), uploadBodies: make(map[string]string), uploadErrors: make(map[string]string)}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// client returns a Slack client talking to the fake.
+func (f *fakeSlack) client() *slack.Client {
+	return slack.New("xoxb-test", slack.OptionAPIURL(f.server.URL+"/"))
+}
+
+// addChannels adds channels to the ones conversations.list returns.
+func (f *fakeSlack) addChannels(channels ...slack.Channel) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.channels = append(f.channels, channels...)
+}
+
+// setUsers replaces the workspace directory served by users.list.
+func (f *fakeSlack) setUsers(users ...slack.User) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.users = users
+}
+
+// slowPosts makes chat.postMessage take delay to answer.
+func (f *fakeSlack) slowPosts(delay time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.postDelay = delay
+}
+
+// peakPosts returns the most chat.postMessage requests the fake answered at once.
+func (f *fakeSlack) peakPosts() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.postsPeak
+}
+
+// slowUsers makes users.list take delay to answer.
+func (f *fakeSlack) slowUsers(delay time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.usersDelay = delay
+}
+
+// usersListCalls returns how many users.list requests the fake served.
+func (f *fakeSlack) usersListCalls() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.usersCalls
+}
+
+// failPosts makes chat.postMessage to channel fail with slackError.
+func (f *fakeSlack) failPosts(channel, slackError string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.postErrors[channel] = slackError
+}
+
+// failUploads makes sharing files in channel fail with slackError.
+func (f *fakeSlack) failUploads(channel, slackError string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.uploadErrors[channel] = slackError
+}
+
+// allUploads returns a copy of every file shared.
+func (f *fakeSlack) allUploads() []fakeUpload {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]fakeUpload(nil), f.uploads...)
+}
+
+// failUpdates makes chat.update in channel fail with slackError.
+func (f *fakeSlack) failUpdates(channel, slackError string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.updateErrors[channel] = slackError
+}
+
+// failScheduledLists makes chat.scheduledMessages.list fail with slackError.
+func (f *fakeSlack) failScheduledLists(slackError string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.listError = slackError
+}
+
+// postsTo returns the texts posted to channel, in order.
+func (f *fakeSlack) postsTo(channel string) []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var texts []string
+	for _, post := range f.posts {
+		if post.Channel == channel {
+			texts = append(texts, post.Text)
+		}
+	}
+	return texts
+}
+
+// ephemeralsFor returns the texts posted only to userID, in order.
+func (f *fakeSlack) ephemeralsFor(userID string) []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]string(nil), f.ephemerals[userID]...)
+}
+
+// allPosts returns a copy of every recorded post.
+func (f *fakeSlack) allPosts() []fakePost {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]fakePost(nil), f.posts...)
+}
+
+// allScheduled returns a copy of every message queued with chat.scheduleMessage.
+func (f *fakeSlack) allScheduled() []fakeScheduled {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]fakeScheduled(nil), f.scheduled...)
+}
+
+// allViews returns a copy of every modal opened.
+func (f *fakeSlack) allViews() []slack.ModalViewRequest {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]slack.ModalViewRequest(nil), f.views...)
+}
+
+// allUpdates returns a copy of every recorded chat.update.
+func (f *fakeSlack) allUpdates() []fakePost {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]fakePost(nil), f.updates...)
+}
+
+func (f *fakeSlack) serve(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	method := strings.TrimPrefix(r.URL.Path, "/")
+	w.Header().Set("Content-Type", "application/json")
+	switch method {
+	case "users.list":
+		f.mutex.Lock()
+		f.usersCalls++
+		users, delay := f.users, f.usersDelay
+		f.mutex.Unlock()
+		time.Sleep(delay)
+		writeFakeJSON(w, map[string]any{"ok": true, "members": users})
+	case "users.info":
+		f.mutex.Lock()
+		users := f.users
+		f.mutex.Unlock()
+		for _, user := range users {
+			if user.ID == r.FormValue("user") {
+				writeFakeJSON(w, map[string]any{"ok": true, "user": user})
+				return
+			}
+		}
+		writeFakeJSON(w, map[string]any{"ok": false, "error": "user_not_found"})
+	case "conversations.list":
+		f.mutex.Lock()
+		channels := append([]slack.Channel(nil), f.channels...)
+		f.mutex.Unlock()
+		writeFakeJSON(w, map[string]any{"ok": true, "channels": channels, "response_metadata": map[string]any{"next_cursor": ""}})
+	case "conversations.open":
+		writeFakeJSON(w, map[string]any{"ok": true, "channel": map[string]any{"id": "D" + r.FormValue("users")}})
+	case "chat.postMessage":
+		f.mutex.Lock()
+		delay := f.postDelay
+		f.postsActive++
+		f.postsPeak = max(f.postsPeak, f.postsActive)
+		slackError := f.postErrors[r.FormValue("channel")]
+		var ts string
+		if slackError == "" {
+			ts = fakeTimestamp(len(f.posts) + 1)
+			f.posts = append(f.posts, fakePost{Channel: r.FormValue("channel"), Text: r.FormValue("text"), Blocks: r.FormValue("blocks"), TS: ts, ThreadTS: r.FormValue("thread_ts"), Username: r.FormValue("username"), IconEmoji: r.FormValue("icon_emoji")})
+		}
+		f.mutex.Unlock()
+		time.Sleep(delay)
+		f.mutex.Lock()
+		f.postsActive--
+		f.mutex.Unlock()
+		if slackError != "" {
+			writeFakeJSON(w, map[string]any{"ok": false, "error": slackError})
+			return
+		}
+		writeFakeJSON(w, map[string]any{"ok": true, "channel": r.FormValue("channel"), "ts": ts})
+	case "chat.postEphemeral":
+		f.mutex.Lock()
+		f.ephemerals[r.FormValue("user")] = append(f.ephemerals[r.FormValue("user")], r.FormValue("text"))
+		f.mutex.Unlock()
+		writeFakeJSON(w, map[string]any{"ok": true, "message_ts": fakeTimestamp(1)})
+	case "chat.scheduleMessage":
+		postAt, _ := strconv.ParseInt(r.FormValue("post_at"), 10, 64)
+		f.mutex.Lock()
+		id := fmt.Sprintf("Q%d", len(f.scheduled)+1)
+		f.scheduled = append(f.scheduled, fakeScheduled{ID: id, Channel: r.FormValue("channel"), Text: r.FormValue("text"), PostAt: postAt})
+		f.mutex.Unlock()
+		writeFakeJSON(w, map[string]any{"ok": true, "channel": r.FormValue("channel"), "scheduled_message_id": id, "post_at": postAt})
+	case "chat.scheduledMessages.list":
+		f.mutex.Lock()
+		listError := f.listError
+		f.mutex.Unlock()
+		if listError != "" {
+			writeFakeJSON(w, map[string]any{"ok": false, "error": listError})
+			return
+		}
+		channel := r.FormValue("channel")
+		oldest, _ := strconv.ParseInt(r.FormValue("oldest"), 10, 64)
+		latest, err := strconv.ParseInt(r.FormValue("latest"), 10, 64)
+		if err != nil {
+			latest = math.MaxInt64
+		}
+		f.mutex.Lock()
+		var messages []slack.ScheduledMessage
+		for i, scheduled := range f.scheduled {
+			if !scheduled.Deleted && (channel == "" || scheduled.Channel == channel) && scheduled.PostAt >= oldest && scheduled.PostAt <= latest {
+				messages = append(messages, slack.ScheduledMessage{ID: scheduled.ID, Channel: scheduled.Channel, PostAt: int(scheduled.PostAt), DateCreated: i + 1, Text: scheduled.Text})
+			}
+		}
+		f.mutex.Unlock()
+		writeFakeJSON(w, map[string]any{"ok": true, "scheduled_messages": messages})
+	case "chat.deleteScheduledMessage":
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		for i := range f.scheduled {
+			if f.scheduled[i].ID == r.FormValue("scheduled_message_id") && !f.scheduled[i].Deleted {
+				f.scheduled[i].Deleted = true
+				writeFakeJSON(w, map[string]any{"ok": true})
+				return
+			}
+		}
+		writeFakeJSON(w, map[string]any{"ok": false, "error": "invalid_scheduled_message_id"})
+	case "views.open":
+		// Views are posted as JSON rather than form-encoded.
+		var request struct {
+			View slack.ModalViewRequest `json:"view"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeFakeJSON(w, map[string]any{"ok": false, "error": "invalid_arguments"})
+			return
+		}
+		f.mutex.Lock()
+		f.views = append(f.views, request.View)
+		f.mutex.Unlock()
+		writeFakeJSON(w, map[string]any{"ok": true, "view": map[string]any{"id": fmt.Sprintf("V%d", len(f.views))}})
+	case "chat.update":
+		f.mutex.Lock()
+		if slackError := f.updateErrors[r.FormValue("channel")]; slackError != "" {
+			f.mutex.Unlock()
+			writeFakeJSON(w, map[string]any{"ok": false, "error": slackError})
+			return
+		}
+		f.updates = append(f.updates, fakePost{Channel: r.FormValue("channel"), Text: r.FormValue("text"), Blocks: r.FormValue("blocks"), TS: r.FormValue("ts")})
+		f.mutex.Unlock()
+		writeFakeJSON(w, map[string]any{"ok": true, "channel": r.FormValue("channel"), "ts": r.FormValue("ts")})
+	case "files.getUploadURLExternal":
+		f.mutex.Lock()
+		fileID := fmt.Sprintf("F%d|%s", len(f.uploadBodies)+1, r.FormValue("filename"))
+		f.uploadBodies[fileID] = ""
+		f.mutex.Unlock()
+		writeFakeJSON(w, map[string]any{"ok": true, "upload_url": f.server.URL + "/upload?file=" + url.QueryEscape(fileID), "file_id": fileID})
+	case "upload":
+		f.mutex.Lock()
+		f.uploadBodies[r.FormValue("file")] = r.FormValue("content")
+		f.mutex.Unlock()
+		w.WriteHeader(http.StatusOK)
+	case "files.completeUploadExternal":
+		var files []slack.FileSummary
+		if err := json.Unmarshal([]byte(r.FormValue("files")), &files); err != nil || len(files) != 1 {
+			writeFakeJSON(w, map[string]any{"ok": false, "error": "invalid_arguments"})
+			return
+		}
+		channel := r.FormValue("channel_id")
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		if slackError := f.uploadErrors[channel]; slackError != "" {
+			writeFakeJSON(w, map[string]any{"ok": false, "error": slackError})
+			return
+		}
+		_, filename, _ := strings.Cut(files[0].ID, "|")
+		f.uploads = append(f.uploads, fakeUpload{Channel: channel, Filename: filename, Title: files[0].Title, Content: f.uploadBodies[files[0].ID]})
+		writeFakeJSON(w, map[string]any{"ok": true, "files": files})
+	default:
+		writeFakeJSON(w, map[string]any{"ok": false, "error": "unknown_method"})
+	}
+}
+
+// fakeTimestamp builds a distinct Slack message timestamp for the nth message.
+func fakeTimestamp(n int) string {
+	return fmt.Sprintf("1700000000.%06d", n)
+}
+
+func writeFakeJSON(w http.ResponseWriter, body any) {
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// fakeGenerator writes a fixed invitation and counts how often it was asked. Prompt completions,
+// used for name suggestions and game extraction, answer completion.
+type fakeGenerator struct {
+	mutex      sync.Mutex
+	invitation string
+	completion string
+	err        error
+	calls      int
+	prompts    []string // the prompts completed, in order
+	games      []string // the games invitations were written for, in order
+}
+
+func (g *fakeGenerator) Complete(ctx context.Context, prompt string) (string, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.prompts = append(g.prompts, prompt)
+	return g.completion, g.err
+}
+
+func (g *fakeGenerator) Generate(ctx context.Context, inviter string, recipients []string, game string, opts GenerateOptions) (string, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.calls++
+	g.games = append(g.games, game)
+	return g.invitation, g.err
+}
+
+// completedPrompts returns a copy of the prompts completed so far.
+func (g *fakeGenerator) completedPrompts() []string {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return append([]string(nil), g.prompts...)
+}
+
+// invitedGames returns a copy of the games invitations were written for.
+func (g *fakeGenerator) invitedGames() []string {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return append([]string(nil), g.games...)
+}
+
+// callCount returns how many invitations were requested.
+func (g *fakeGenerator) callCount() int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.calls
+}
+
+// testConfig returns the configuration the handler tests start from.
+func testConfig() *Config {
+	return &Config{
+		Replies:          defaultReplyTemplates,
+		SendConcurrency:  2,
+		BlockedGames:     newGameBlocklist("", blockMatchExact),
+		MaxMessageLength: 3000,
+	}
+}
+
+// newTestBotHandler builds a SlackBotHandler against the fake Slack with in-memory state.
+func newTestBotHandler(t *testing.T, fake *fakeSlack, config *Config, generator InvitationGenerator) (*SlackBotHandler, Store) {
+	t.Helper()
+	store := NewInMemoryStore()
+	return newTestBotHandlerOn(t, fake, config, generator, store), store
+}
+
+// newTestBotHandlerOn builds a SlackBotHandler against the fake Slack keeping its state in
+// store, as a restarted process would.
+func newTestBotHandlerOn(t *testing.T, fake *fakeSlack, config *Config, generator InvitationGenerator, store Store) *SlackBotHandler {
+	t.Helper()
+	client := fake.client()
+	users := newUserCache(client, time.Minute)
+	h := NewSlackBotHandler(client, config, users, newMessageSender(client, nil, newSendPacer(0, 0), 0, 0),
+		newRecipientListStore(store, config.Regulars), newConversationStore(store, config.ConversationTTL), newInvitationWriter(config, users, generator),
+		newGameCooldowns(store, config.GameCooldown, config.GameCooldowns), newSeenEvents(store, config.EventDedupeWindow), newQuietHoursStore(store, users))
+	t.Cleanup(h.Close)
+	return h
+}
+
+// directMessage builds the callback for a direct message from userID.
+func directMessage(userID, text string) SlackEventCallback {
+	return SlackEventCallback{
+		Type: "event_callback",
+		Event: SlackEvent{
+			Type:        "message",
+			User:        userID,
+			Text:        text,
+			Channel:     "D" + userID,
+			ChannelType: "im",
+		},
+	}
+}
+
+// testUsers is a small workspace directory.
+var testUsers = []slack.User{
+	{ID: "U1", Name: "alice", RealName: "Alice Archer"},
+	{ID: "U2", Name: "bob", RealName: "Bob Baker"},
+	{ID: "U3", Name: "carol", RealName: "Carol Cooper"},
+}
+
+// countingQueue wraps the handler's event queues, recording the user of every step queued.
+type countingQueue struct {
+	eventQueue
+	mutex sync.Mutex
+	keys  []string
+}
+
+// countQueued makes h record what it queues, returning the record.
+func countQueued(h *SlackBotHandler) *countingQueue {
+	q := &countingQueue{eventQueue: h.queues}
+	h.queues = q
+	return q
+}
+
+func (q *countingQueue) enqueue(key string, run func()) {
+	q.mutex.Lock()
+	q.keys = append(q.keys, key)
+	q.mutex.Unlock()
+	q.eventQueue.enqueue(key, run)
+}
+
+// queued returns the users whose steps were queued, in order.
+func (q *countingQueue) queued() []string {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return append([]string(nil), q.keys...)
+}
+
+// postEvent sends body to h.HandleEvent as contentType and returns the response.
+func postEvent(h *SlackBotHandler, contentType, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/slack/events", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", contentType)
+	h.HandleEvent(c)
+	return w
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sync"
+
+	"github.com/slack-go/slack"
+)
+
+// Slack API methods whose missing_scope errors are explained to users.
+const (
+	methodPostMessage      = "chat.postMessage"
+	methodPostEphemeral    = "chat.postEphemeral"
+	methodUploadFile       = "files.getUploadURLExternal"
+	methodScheduleMessage  = "chat.scheduleMessage"
+	methodOpenConversation = "conversations.open"
+	methodDeleteScheduled  = "chat.deleteScheduledMessage"
+	methodGetScheduled     = "chat.scheduledMessages.list"
+)
+
+// defaultNeededScopes is the scope each method needs, used when Slack's response didn't say.
+var defaultNeededScopes = map[string]string{
+	methodPostMessage:      "chat:write",
+	methodPostEphemeral:    "chat:write",
+	methodUploadFile:       "files:write",
+	methodScheduleMessage:  "chat:write",
+	methodOpenConversation: "im:write",
+	methodDeleteScheduled:  "chat:write",
+	methodGetScheduled:     "chat:write",
+}
+
+// missingScopeError is a Slack missing_scope error with the scope the failed method needed.
+type missingScopeError struct {
+	Method   string
+	Needed   string // comma separated scopes the method needs, may be empty if unknown
+	Provided string // comma separated scopes the token has, may be empty if unknown
+	Err      error
+}
+
+func (e *missingScopeError) Error() string {
+	msg := "this action needs a Slack scope the app doesn't have"
+	if e.Needed != "" {
+		msg = fmt.Sprintf("this action needs the `%s` scope", e.Needed)
+	}
+	if e.Provided != "" {
+		msg += fmt.Sprintf(" (the app has `%s`)", e.Provided)
+	}
+	return msg + "; add it under OAuth & Permissions and reinstall the app"
+}
+
+func (e *missingScopeError) Unwrap() error {
+	return e.Err
+}
+
+// scopeTracker is the Slack client's HTTP client. slack-go drops the needed/provided fields
+// of missing_scope responses, so the tracker reads them off the raw responses and remembers
+// them per API method for explain.
+type scopeTracker struct {
+	client *http.Client
+	mutex  sync.Mutex
+	scopes map[string]missingScopeError // keyed by API method
+}
+
+// newScopeTracker wraps client, which does the actual requests.
+func newScopeTracker(client *http.Client) *scopeTracker {
+	return &scopeTracker{client: client, scopes: make(map[string]missingScopeError)}
+}
+
+// Do performs req and records the scope details of missing_scope responses.
+func (t *scopeTracker) Do(req *http.Request) (*http.Response, error) {
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if !bytes.Contains(body, []byte(`"missing_scope"`)) {
+		return resp, nil
+	}
+	var slackResp struct {
+		Error    string `json:"error"`
+		Needed   string `json:"needed"`
+		Provided string `json:"provided"`
+	}
+	if json.Unmarshal(body, &slackResp) == nil && slackResp.Error == "missing_scope" {
+		method := path.Base(req.URL.Path)
+		t.mutex.Lock()
+		t.scopes[method] = missingScopeError{Method: method, Needed: slackResp.Needed, Provided: slackResp.Provided}
+		t.mutex.Unlock()
+	}
+	return resp, nil
+}
+
+// explain turns a missing_scope error from method into a *missingScopeError naming the scope
+// to add. Other errors are returned unchanged.
+func (t *scopeTracker) explain(method string, err error) error {
+	var slackErr slack.SlackErrorResponse
+	if err == nil || !errors.As(err, &slackErr) || slackErr.Err != "missing_scope" {
+		return err
+	}
+	explained := missingScopeError{Method: method, Needed: defaultNeededScopes[method]}
+	if t != nil {
+		t.mutex.Lock()
+		if recorded, ok := t.scopes[method]; ok {
+			if recorded.Needed != "" {
+				explained.Needed = recorded.Needed
+			}
+			explained.Provided = recorded.Provided
+		}
+		t.mutex.Unlock()
+	}
+	explained.Err = err
+	return &explained
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+func TestMissingScopeErrorsNameTheScope(t *testing.T) {
+	tests := []struct {
+		name     string
+		response map[string]any // chat.postMessage's answer
+		want     string
+		wantErr  *missingScopeError
+	}{
+		{
+			name:     "scope details from Slack",
+			response: map[string]any{"ok": false, "error": "missing_scope", "needed": "chat:write.customize", "provided": "chat:write,im:write"},
+			want:     "this action needs the `chat:write.customize` scope (the app has `chat:write,im:write`); add it under OAuth & Permissions and reinstall the app",
+			wantErr:  &missingScopeError{Method: methodPostMessage, Needed: "chat:write.customize", Provided: "chat:write,im:write"},
+		},
+		{
+			name:     "the method's usual scope when Slack doesn't say",
+			response: map[string]any{"ok": false, "error": "missing_scope"},
+			want:     "this action needs the `chat:write` scope; add it under OAuth & Permissions and reinstall the app",
+			wantErr:  &missingScopeError{Method: methodPostMessage, Needed: "chat:write"},
+		},
+		{
+			name:     "other errors are left alone",
+			response: map[string]any{"ok": false, "error": "channel_not_found"},
+			want:     "channel_not_found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				writeFakeJSON(w, tt.response)
+			}))
+			t.Cleanup(server.Close)
+			scopes := newScopeTracker(server.Client())
+			client := slack.New("xoxb-test", slack.OptionAPIURL(server.URL+"/"), slack.OptionHTTPClient(scopes))
+			sender := newMessageSender(client, scopes, newSendPacer(0, 0), 0, 0)
+
+			_, _, err := sender.post("U2", slack.MsgOptionText("Come play Catan!", false))
+			if err == nil || err.Error() != tt.want {
+				t.Fatalf("post() error = %v, want %q", err, tt.want)
+			}
+			var scopeErr *missingScopeError
+			if !errors.As(err, &scopeErr) {
+				if tt.wantErr != nil {
+					t.Fatalf("post() error = %#v, want a *missingScopeError", err)
+				}
+				return
+			}
+			if tt.wantErr == nil {
+				t.Fatalf("post() error = %#v, want the Slack error unchanged", err)
+			}
+			if scopeErr.Method != tt.wantErr.Method || scopeErr.Needed != tt.wantErr.Needed || scopeErr.Provided != tt.wantErr.Provided {
+				t.Errorf("post() error = %+v, want %+v", scopeErr, tt.wantErr)
+			}
+			if !strings.Contains(errors.Unwrap(err).Error(), "missing_scope") {
+				t.Errorf("post() error wraps %v, want the Slack error", errors.Unwrap(err))
+			}
+		})
+	}
+}
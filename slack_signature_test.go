@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// signSlackRequest computes the X-Slack-Signature Slack would send for body at timestamp.
+func signSlackRequest(secret, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySlackRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const secret = "signing-secret"
+	const body = `{"type":"url_verification","challenge":"abc"}`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-6*time.Minute).Unix(), 10)
+	tests := []struct {
+		name       string
+		timestamp  string
+		signature  string
+		body       string // the body sent, if it differs from the one signed
+		unverified bool   // no signing secret is configured
+		wantStatus int
+	}{
+		{name: "signed", timestamp: now, signature: signSlackRequest(secret, now, body), wantStatus: http.StatusOK},
+		{name: "signed with another secret", timestamp: now, signature: signSlackRequest("other", now, body), wantStatus: http.StatusUnauthorized},
+		{name: "body changed after signing", timestamp: now, signature: signSlackRequest(secret, now, body), body: `{"type":"event_callback"}`, wantStatus: http.StatusUnauthorized},
+		{name: "timestamp older than five minutes", timestamp: stale, signature: signSlackRequest(secret, stale, body), wantStatus: http.StatusUnauthorized},
+		{name: "no signature headers", wantStatus: http.StatusUnauthorized},
+		{name: "signature isn't hex", timestamp: now, signature: "v0=zz", wantStatus: http.StatusUnauthorized},
+		{name: "no signing secret configured", unverified: true, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received string
+			configured := secret
+			if tt.unverified {
+				configured = ""
+			}
+			r := gin.New()
+			r.POST("/slack/events", verifySlackRequest(configured), func(c *gin.Context) {
+				data, _ := io.ReadAll(c.Request.Body)
+				received = string(data)
+				c.Status(http.StatusOK)
+			})
+
+			sent := body
+			if tt.body != "" {
+				sent = tt.body
+			}
+			req := httptest.NewRequest(http.MethodPost, "/slack/events", strings.NewReader(sent))
+			if tt.timestamp != "" {
+				req.Header.Set("X-Slack-Request-Timestamp", tt.timestamp)
+			}
+			if tt.signature != "" {
+				req.Header.Set("X-Slack-Signature", tt.signature)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && received != sent {
+				t.Errorf("handler read body %q, want %q", received, sent)
+			}
+			if tt.wantStatus != http.StatusOK && received != "" {
+				t.Errorf("handler ran for a rejected request")
+			}
+		})
+	}
+}
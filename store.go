@@ -0,0 +1,480 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Store is the key-value backend shared by every stateful feature (conversations, recipient
+// lists, ...). Features namespace their keys with a prefix such as "conversation:" and encode
+// values themselves, so switching STORE_BACKEND moves all state at once.
+type Store interface {
+	// Get returns the value stored under key, if any.
+	Get(key string) ([]byte, bool, error)
+	// Set stores value under key. A positive ttl expires the entry; zero keeps it forever.
+	Set(key string, value []byte, ttl time.Duration) error
+	// SetNX stores value under key like Set, but only if key doesn't exist yet, reporting
+	// whether it was stored. Callers use it to claim work exactly once across instances.
+	SetNX(key string, value []byte, ttl time.Duration) (bool, error)
+	// GetDel returns the value stored under key, if any, and removes it in the same step.
+	GetDel(key string) ([]byte, bool, error)
+	// Update stores what update returns for the value under key (ok is false when there is
+	// none), with no other write to key landing in between, so concurrent read-modify-writes
+	// can't overwrite each other. update may be called more than once and must not use the
+	// store; an error from it is returned as is and leaves key unchanged. ttl is as for Set.
+	Update(key string, ttl time.Duration, update func(value []byte, ok bool) ([]byte, error)) error
+	// Delete removes key, reporting whether it existed.
+	Delete(key string) (bool, error)
+	// Keys returns every key starting with prefix, in no particular order.
+	Keys(prefix string) ([]string, error)
+}
+
+// memoryEntry is a value held by InMemoryStore.
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time // zero for entries without a TTL
+}
+
+// expired reports whether the entry's TTL has passed.
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
+}
+
+// InMemoryStore keeps state in a map. It is lost on restart and is not shared between processes.
+// Expired entries are dropped when they are next read.
+type InMemoryStore struct {
+	mutex   sync.Mutex
+	entries map[string]memoryEntry
+}
+
+// NewInMemoryStore creates an empty in-memory store.
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		entries: make(map[string]memoryEntry),
+	}
+}
+
+// Get returns a copy of the value stored under key, if any.
+func (s *InMemoryStore) Get(key string) ([]byte, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if entry.expired(time.Now()) {
+		delete(s.entries, key)
+		return nil, false, nil
+	}
+	return append([]byte(nil), entry.value...), true, nil
+}
+
+// Set stores a copy of value under key.
+func (s *InMemoryStore) Set(key string, value []byte, ttl time.Duration) error {
+	entry := memoryEntry{value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		entry.expiresAt = time.Now().Add(ttl)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.entries[key] = entry
+	return nil
+}
+
+// SetNX stores a copy of value under key unless an unexpired entry already exists.
+func (s *InMemoryStore) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	entry := memoryEntry{value: append([]byte(nil), value...)}
+	now := time.Now()
+	if ttl > 0 {
+		entry.expiresAt = now.Add(ttl)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if existing, ok := s.entries[key]; ok && !existing.expired(now) {
+		return false, nil
+	}
+	s.entries[key] = entry
+	return true, nil
+}
+
+// GetDel returns the value stored under key, if any, and removes it.
+func (s *InMemoryStore) GetDel(key string) ([]byte, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entry, ok := s.entries[key]
+	delete(s.entries, key)
+	if !ok || entry.expired(time.Now()) {
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+// Update applies update to a copy of the value under key while holding the store's lock.
+func (s *InMemoryStore) Update(key string, ttl time.Duration, update func(value []byte, ok bool) ([]byte, error)) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	var current []byte
+	entry, ok := s.entries[key]
+	if ok = ok && !entry.expired(now); ok {
+		current = append([]byte(nil), entry.value...)
+	}
+	value, err := update(current, ok)
+	if err != nil {
+		return err
+	}
+	entry = memoryEntry{value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		entry.expiresAt = now.Add(ttl)
+	}
+	s.entries[key] = entry
+	return nil
+}
+
+// Delete removes key, reporting whether it existed.
+func (s *InMemoryStore) Delete(key string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entry, ok := s.entries[key]
+	delete(s.entries, key)
+	return ok && !entry.expired(time.Now()), nil
+}
+
+// Keys returns every unexpired key starting with prefix, sorted.
+func (s *InMemoryStore) Keys(prefix string) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	var keys []string
+	for key, entry := range s.entries {
+		if entry.expired(now) {
+			delete(s.entries, key)
+			continue
+		}
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// redisNamespace prefixes every key we write, so the bot can share a Redis database.
+const redisNamespace = "slack-game-inviter:"
+
+// redisUpdateAttempts bounds how often Update retries after another write to its key got in
+// first. Each retry means a competing update succeeded, so this is ample for the handful of
+// writers one key sees.
+const redisUpdateAttempts = 50
+
+// RedisStore keeps state in Redis, so it survives restarts and is shared by every instance.
+type RedisStore struct {
+	client  *redis.Client
+	timeout time.Duration
+}
+
+// NewRedisStore connects to the Redis server at url (e.g. "redis://localhost:6379/0").
+func NewRedisStore(url string) (*RedisStore, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	store := &RedisStore{
+		client:  redis.NewClient(options),
+		timeout: 2 * time.Second,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), store.timeout)
+	defer cancel()
+	if err := store.client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("connecting to Redis: %w", err)
+	}
+	return store, nil
+}
+
+// Get returns the value stored under key, if any.
+func (s *RedisStore) Get(key string) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	value, err := s.client.Get(ctx, redisNamespace+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set stores value under key, letting Redis expire it after ttl.
+func (s *RedisStore) Set(key string, value []byte, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	return s.client.Set(ctx, redisNamespace+key, value, ttl).Err()
+}
+
+// SetNX stores value under key with SET NX, letting Redis expire it after ttl.
+func (s *RedisStore) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	return s.client.SetNX(ctx, redisNamespace+key, value, ttl).Result()
+}
+
+// GetDel returns and removes the value stored under key with GETDEL, which needs Redis 6.2.
+func (s *RedisStore) GetDel(key string) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	value, err := s.client.GetDel(ctx, redisNamespace+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Update reads key under WATCH and writes the new value in a MULTI transaction, retrying
+// straight away when another client wrote key in between.
+func (s *RedisStore) Update(key string, ttl time.Duration, update func(value []byte, ok bool) ([]byte, error)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	key = redisNamespace + key
+	for attempt := 0; attempt < redisUpdateAttempts; attempt++ {
+		err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+			current, err := tx.Get(ctx, key).Bytes()
+			if err != nil && !errors.Is(err, redis.Nil) {
+				return err
+			}
+			value, err := update(current, err == nil)
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, key, value, ttl)
+				return nil
+			})
+			return err
+		}, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return fmt.Errorf("updating %s: still contended after %d attempts", strings.TrimPrefix(key, redisNamespace), redisUpdateAttempts)
+}
+
+// Delete removes key, reporting whether it existed.
+func (s *RedisStore) Delete(key string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	removed, err := s.client.Del(ctx, redisNamespace+key).Result()
+	if err != nil {
+		return false, err
+	}
+	return removed > 0, nil
+}
+
+// Keys returns every key starting with prefix, using SCAN so large databases aren't blocked.
+func (s *RedisStore) Keys(prefix string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	var keys []string
+	iter := s.client.Scan(ctx, 0, redisNamespace+prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, strings.TrimPrefix(iter.Val(), redisNamespace))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Ping checks that Redis is reachable.
+func (s *RedisStore) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	return s.client.Ping(ctx).Err()
+}
+
+// Close releases the Redis connection pool.
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+// pingableStore is a Store whose availability can be checked cheaply.
+type pingableStore interface {
+	Store
+	Ping() error
+}
+
+// fallbackStore serves from primary until it fails, then switches to an in-memory store so
+// conversations keep working on this instance, at the cost of state shared with other
+// instances. Every retryInterval it pings primary and switches back once it answers; state
+// written while degraded is dropped then, since it was never in primary.
+type fallbackStore struct {
+	primary       pingableStore
+	retryInterval time.Duration
+
+	mutex       sync.Mutex
+	fallback    *InMemoryStore // non-nil while degraded
+	lastAttempt time.Time
+}
+
+// newFallbackStore wraps primary with an in-memory fallback.
+func newFallbackStore(primary pingableStore, retryInterval time.Duration) *fallbackStore {
+	return &fallbackStore{
+		primary:       primary,
+		retryInterval: retryInterval,
+	}
+}
+
+// active returns the store to use: the fallback while degraded, unless it's time to retry
+// primary and primary answers.
+func (s *fallbackStore) active() Store {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.fallback == nil {
+		return s.primary
+	}
+	if time.Since(s.lastAttempt) < s.retryInterval {
+		return s.fallback
+	}
+	s.lastAttempt = time.Now()
+	if err := s.primary.Ping(); err != nil {
+		logger.Warn("Store still unavailable, staying on the in-memory fallback", "error", err)
+		return s.fallback
+	}
+	logger.Info("Store recovered, leaving the in-memory fallback and dropping state written while degraded")
+	s.fallback = nil
+	return s.primary
+}
+
+// degrade switches to the in-memory fallback after primary failed with err.
+func (s *fallbackStore) degrade(err error) Store {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.fallback == nil {
+		logger.Warn("Store failed, falling back to in-memory state on this instance", "error", err)
+		s.fallback = NewInMemoryStore()
+		s.lastAttempt = time.Now()
+	}
+	return s.fallback
+}
+
+// Get reads from the active store, falling back if primary fails.
+func (s *fallbackStore) Get(key string) ([]byte, bool, error) {
+	store := s.active()
+	value, ok, err := store.Get(key)
+	if err != nil && store == Store(s.primary) {
+		return s.degrade(err).Get(key)
+	}
+	return value, ok, err
+}
+
+// Set writes to the active store, falling back if primary fails.
+func (s *fallbackStore) Set(key string, value []byte, ttl time.Duration) error {
+	store := s.active()
+	err := store.Set(key, value, ttl)
+	if err != nil && store == Store(s.primary) {
+		return s.degrade(err).Set(key, value, ttl)
+	}
+	return err
+}
+
+// SetNX writes to the active store if key is absent there, falling back if primary fails.
+func (s *fallbackStore) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	store := s.active()
+	stored, err := store.SetNX(key, value, ttl)
+	if err != nil && store == Store(s.primary) {
+		return s.degrade(err).SetNX(key, value, ttl)
+	}
+	return stored, err
+}
+
+// GetDel reads and removes key in the active store, falling back if primary fails.
+func (s *fallbackStore) GetDel(key string) ([]byte, bool, error) {
+	store := s.active()
+	value, ok, err := store.GetDel(key)
+	if err != nil && store == Store(s.primary) {
+		return s.degrade(err).GetDel(key)
+	}
+	return value, ok, err
+}
+
+// Update rewrites key in the active store, falling back if primary fails. Errors from update
+// itself are returned without degrading.
+func (s *fallbackStore) Update(key string, ttl time.Duration, update func(value []byte, ok bool) ([]byte, error)) error {
+	store := s.active()
+	var updateErr error
+	err := store.Update(key, ttl, func(value []byte, ok bool) ([]byte, error) {
+		value, updateErr = update(value, ok)
+		return value, updateErr
+	})
+	if err != nil && updateErr == nil && store == Store(s.primary) {
+		return s.degrade(err).Update(key, ttl, update)
+	}
+	return err
+}
+
+// Delete removes key from the active store, falling back if primary fails.
+func (s *fallbackStore) Delete(key string) (bool, error) {
+	store := s.active()
+	removed, err := store.Delete(key)
+	if err != nil && store == Store(s.primary) {
+		return s.degrade(err).Delete(key)
+	}
+	return removed, err
+}
+
+// Keys lists keys in the active store, falling back if primary fails.
+func (s *fallbackStore) Keys(prefix string) ([]string, error) {
+	store := s.active()
+	keys, err := store.Keys(prefix)
+	if err != nil && store == Store(s.primary) {
+		return s.degrade(err).Keys(prefix)
+	}
+	return keys, err
+}
+
+// Close releases primary's connections, if it holds any.
+func (s *fallbackStore) Close() error {
+	return closeStore(s.primary)
+}
+
+// closeStore releases the connections held by store, for stores that hold any.
+func closeStore(store Store) error {
+	if closer, ok := store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// newStore builds the backend selected by STORE_BACKEND.
+func newStore(config *Config) (Store, error) {
+	switch config.StoreBackend {
+	case "", "memory":
+		return NewInMemoryStore(), nil
+	case "redis":
+		if config.RedisURL == "" {
+			return nil, errors.New("REDIS_URL is required when STORE_BACKEND=redis")
+		}
+		store, err := NewRedisStore(config.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("Using Redis store")
+		if config.RedisFallback {
+			return newFallbackStore(store, config.RedisRetryInterval), nil
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown STORE_BACKEND %q, expected \"memory\" or \"redis\"", config.StoreBackend)
+	}
+}
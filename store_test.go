@@ -0,0 +1,416 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// storeBackend builds an empty Store for the contract tests, with a function moving its
+// clock forward so TTLs can be tested without long sleeps.
+type storeBackend struct {
+	name     string
+	newStore func(t *testing.T) (Store, func(time.Duration))
+}
+
+// storeBackends are the Store implementations every contract test runs against. Redis is
+// served by miniredis, whose clock only moves when told to.
+var storeBackends = []storeBackend{
+	{name: "memory", newStore: func(t *testing.T) (Store, func(time.Duration)) {
+		return NewInMemoryStore(), time.Sleep
+	}},
+	{name: "redis", newStore: func(t *testing.T) (Store, func(time.Duration)) {
+		server := miniredis.RunT(t)
+		store, err := NewRedisStore("redis://" + server.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store, server.FastForward
+	}},
+}
+
+func TestStoreGetSet(t *testing.T) {
+	tests := []struct {
+		name      string
+		ttl       time.Duration
+		wait      time.Duration
+		wantOK    bool
+		wantValue string
+	}{
+		{name: "no TTL", wait: 5 * time.Millisecond, wantOK: true, wantValue: "value"},
+		{name: "before the TTL", ttl: time.Hour, wantOK: true, wantValue: "value"},
+		{name: "after the TTL", ttl: time.Millisecond, wait: 5 * time.Millisecond},
+	}
+	for _, backend := range storeBackends {
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				store, advance := backend.newStore(t)
+				if _, ok, err := store.Get("key"); err != nil || ok {
+					t.Fatalf("Get() before Set = %v, %v, want false, nil", ok, err)
+				}
+				if err := store.Set("key", []byte("old"), 0); err != nil {
+					t.Fatal(err)
+				}
+				// Set replaces the value and its TTL.
+				if err := store.Set("key", []byte("value"), tt.ttl); err != nil {
+					t.Fatal(err)
+				}
+				advance(tt.wait)
+				value, ok, err := store.Get("key")
+				if err != nil || ok != tt.wantOK || string(value) != tt.wantValue {
+					t.Errorf("Get() = %q, %v, %v, want %q, %v, nil", value, ok, err, tt.wantValue, tt.wantOK)
+				}
+			})
+		}
+	}
+}
+
+func TestStoreSetNX(t *testing.T) {
+	tests := []struct {
+		name        string
+		existing    []byte        // value stored before SetNX, nil for none
+		existingTTL time.Duration // TTL of the existing value
+		wait        time.Duration // how long to wait before SetNX
+		wantStored  bool
+		wantValue   string
+	}{
+		{name: "absent key", wantStored: true, wantValue: "new"},
+		{name: "existing key", existing: []byte("old"), wantValue: "old"},
+		{name: "existing key with a TTL", existing: []byte("old"), existingTTL: time.Hour, wantValue: "old"},
+		{name: "expired key", existing: []byte("old"), existingTTL: time.Millisecond, wait: 5 * time.Millisecond, wantStored: true, wantValue: "new"},
+	}
+	for _, backend := range storeBackends {
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				store, advance := backend.newStore(t)
+				if tt.existing != nil {
+					if err := store.Set("key", tt.existing, tt.existingTTL); err != nil {
+						t.Fatal(err)
+					}
+				}
+				advance(tt.wait)
+				stored, err := store.SetNX("key", []byte("new"), time.Hour)
+				if err != nil || stored != tt.wantStored {
+					t.Fatalf("SetNX() = %v, %v, want %v, nil", stored, err, tt.wantStored)
+				}
+				value, ok, err := store.Get("key")
+				if err != nil || !ok || string(value) != tt.wantValue {
+					t.Errorf("Get() = %q, %v, %v, want %q", value, ok, err, tt.wantValue)
+				}
+			})
+		}
+	}
+}
+
+func TestStoreSetNXConcurrent(t *testing.T) {
+	for _, backend := range storeBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			store, _ := backend.newStore(t)
+			var wg sync.WaitGroup
+			var mutex sync.Mutex
+			winners := 0
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					stored, err := store.SetNX("key", []byte("claimed"), time.Minute)
+					if err != nil {
+						t.Error(err)
+					}
+					if stored {
+						mutex.Lock()
+						winners++
+						mutex.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+			if winners != 1 {
+				t.Errorf("%d concurrent SetNX calls stored the key, want 1", winners)
+			}
+		})
+	}
+}
+
+func TestStoreGetDel(t *testing.T) {
+	tests := []struct {
+		name      string
+		existing  []byte
+		ttl       time.Duration
+		wait      time.Duration
+		wantOK    bool
+		wantValue string
+	}{
+		{name: "absent key"},
+		{name: "existing key", existing: []byte("value"), wantOK: true, wantValue: "value"},
+		{name: "expired key", existing: []byte("value"), ttl: time.Millisecond, wait: 5 * time.Millisecond},
+	}
+	for _, backend := range storeBackends {
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				store, advance := backend.newStore(t)
+				if tt.existing != nil {
+					if err := store.Set("key", tt.existing, tt.ttl); err != nil {
+						t.Fatal(err)
+					}
+				}
+				advance(tt.wait)
+				value, ok, err := store.GetDel("key")
+				if err != nil || ok != tt.wantOK || string(value) != tt.wantValue {
+					t.Fatalf("GetDel() = %q, %v, %v, want %q, %v, nil", value, ok, err, tt.wantValue, tt.wantOK)
+				}
+				if _, ok, _ := store.Get("key"); ok {
+					t.Error("key still present after GetDel")
+				}
+			})
+		}
+	}
+}
+
+func TestStoreUpdate(t *testing.T) {
+	errRefused := errors.New("refused")
+	tests := []struct {
+		name      string
+		existing  []byte
+		ttl       time.Duration
+		wait      time.Duration
+		updateErr error
+		wantSeen  string // the value update was given, "-" for none
+		wantValue string // stored afterwards
+	}{
+		{name: "absent key", wantSeen: "-", wantValue: "-+"},
+		{name: "existing key", existing: []byte("old"), wantSeen: "old", wantValue: "old+"},
+		{name: "expired key", existing: []byte("old"), ttl: time.Millisecond, wait: 5 * time.Millisecond, wantSeen: "-", wantValue: "-+"},
+		{name: "update fails", existing: []byte("old"), updateErr: errRefused, wantSeen: "old", wantValue: "old"},
+	}
+	for _, backend := range storeBackends {
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				store, advance := backend.newStore(t)
+				if tt.existing != nil {
+					if err := store.Set("key", tt.existing, tt.ttl); err != nil {
+						t.Fatal(err)
+					}
+				}
+				advance(tt.wait)
+				var seen string
+				err := store.Update("key", time.Hour, func(value []byte, ok bool) ([]byte, error) {
+					seen = string(value)
+					if !ok {
+						seen = "-"
+					}
+					return []byte(seen + "+"), tt.updateErr
+				})
+				if !errors.Is(err, tt.updateErr) || seen != tt.wantSeen {
+					t.Fatalf("Update() saw %q and returned %v, want %q and %v", seen, err, tt.wantSeen, tt.updateErr)
+				}
+				if value, _, err := store.Get("key"); err != nil || string(value) != tt.wantValue {
+					t.Errorf("Get() = %q, %v, want %q", value, err, tt.wantValue)
+				}
+			})
+		}
+	}
+}
+
+func TestStoreUpdateConcurrent(t *testing.T) {
+	for _, backend := range storeBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			store, _ := backend.newStore(t)
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					err := store.Update("key", time.Minute, func(value []byte, ok bool) ([]byte, error) {
+						return append(value, 'x'), nil
+					})
+					if err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+			if value, _, err := store.Get("key"); err != nil || len(value) != 20 {
+				t.Errorf("Get() = %q, %v, want every one of the 20 updates kept", value, err)
+			}
+		})
+	}
+}
+
+func TestStoreDelete(t *testing.T) {
+	tests := []struct {
+		name        string
+		existing    []byte
+		ttl         time.Duration
+		wait        time.Duration
+		wantRemoved bool
+	}{
+		{name: "absent key"},
+		{name: "existing key", existing: []byte("value"), wantRemoved: true},
+		{name: "expired key", existing: []byte("value"), ttl: time.Millisecond, wait: 5 * time.Millisecond},
+	}
+	for _, backend := range storeBackends {
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				store, advance := backend.newStore(t)
+				if tt.existing != nil {
+					if err := store.Set("key", tt.existing, tt.ttl); err != nil {
+						t.Fatal(err)
+					}
+				}
+				advance(tt.wait)
+				removed, err := store.Delete("key")
+				if err != nil || removed != tt.wantRemoved {
+					t.Fatalf("Delete() = %v, %v, want %v, nil", removed, err, tt.wantRemoved)
+				}
+				if _, ok, _ := store.Get("key"); ok {
+					t.Error("key still present after Delete")
+				}
+			})
+		}
+	}
+}
+
+func TestStoreKeys(t *testing.T) {
+	for _, backend := range storeBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			store, advance := backend.newStore(t)
+			entries := []struct {
+				key string
+				ttl time.Duration
+			}{
+				{key: "conversation:U1"},
+				{key: "conversation:U2", ttl: time.Hour},
+				{key: "conversation:U3", ttl: time.Millisecond}, // expired by the time Keys runs
+				{key: "conversations_total"},                    // shares the prefix without the colon
+				{key: "rsvp:inv1"},
+			}
+			for _, entry := range entries {
+				if err := store.Set(entry.key, []byte("value"), entry.ttl); err != nil {
+					t.Fatal(err)
+				}
+			}
+			advance(5 * time.Millisecond)
+			for prefix, want := range map[string][]string{
+				"conversation:": {"conversation:U1", "conversation:U2"},
+				"rsvp:":         {"rsvp:inv1"},
+				"reminder:":     nil,
+			} {
+				keys, err := store.Keys(prefix)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := sortedCopy(keys); strings.Join(got, ",") != strings.Join(want, ",") {
+					t.Errorf("Keys(%q) = %q, want %q", prefix, got, want)
+				}
+			}
+		})
+	}
+}
+
+// failingStore is a primary store that is down.
+type failingStore struct{ InMemoryStore }
+
+var errStoreDown = errors.New("store down")
+
+func (s *failingStore) SetNX(key string, value []byte, ttl time.Duration) (bool, error) {
+	return false, errStoreDown
+}
+
+func (s *failingStore) GetDel(key string) ([]byte, bool, error) {
+	return nil, false, errStoreDown
+}
+
+func (s *failingStore) Update(key string, ttl time.Duration, update func(value []byte, ok bool) ([]byte, error)) error {
+	return errStoreDown
+}
+
+func (s *failingStore) Ping() error { return errStoreDown }
+
+func TestFallbackStoreAtomicOperationsDegrade(t *testing.T) {
+	store := newFallbackStore(&failingStore{InMemoryStore: *NewInMemoryStore()}, time.Hour)
+	stored, err := store.SetNX("key", []byte("value"), time.Minute)
+	if err != nil || !stored {
+		t.Fatalf("SetNX() on a failed primary = %v, %v, want the fallback to store it", stored, err)
+	}
+	if stored, err := store.SetNX("key", []byte("other"), time.Minute); err != nil || stored {
+		t.Fatalf("second SetNX() = %v, %v, want false, nil", stored, err)
+	}
+	err = store.Update("key", time.Minute, func(value []byte, ok bool) ([]byte, error) {
+		return append(value, '!'), nil
+	})
+	if err != nil {
+		t.Fatalf("Update() on a failed primary = %v, want the fallback to update it", err)
+	}
+	value, ok, err := store.GetDel("key")
+	if err != nil || !ok || string(value) != "value!" {
+		t.Fatalf("GetDel() = %q, %v, %v, want \"value!\", true, nil", value, ok, err)
+	}
+}
+
+func TestFallbackStoreRidesOutRedisOutage(t *testing.T) {
+	server := miniredis.RunT(t)
+	redisStore, err := NewRedisStore("redis://" + server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { redisStore.Close() })
+	store := newFallbackStore(redisStore, 20*time.Millisecond)
+	get := func(key string) string {
+		t.Helper()
+		value, ok, err := store.Get(key)
+		if err != nil {
+			t.Fatalf("Get(%q) error = %v", key, err)
+		}
+		return map[bool]string{true: string(value)}[ok]
+	}
+
+	if err := store.Set("before", []byte("in redis"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := server.Get(redisNamespace + "before"); got != "in redis" {
+		t.Fatalf("Redis holds %q, want the write to reach it", got)
+	}
+
+	// Redis goes down: reads and writes are served from memory without errors.
+	server.SetError("LOADING Redis is loading the dataset in memory")
+	if err := store.Set("during", []byte("in memory"), 0); err != nil {
+		t.Fatalf("Set() while Redis is down = %v, want the fallback to take it", err)
+	}
+	if got := get("during"); got != "in memory" {
+		t.Errorf("Get(during) while Redis is down = %q, want %q", got, "in memory")
+	}
+	if got := get("before"); got != "" {
+		t.Errorf("Get(before) while Redis is down = %q, want nothing, since it is only in Redis", got)
+	}
+	if stored, err := store.SetNX("during", []byte("again"), time.Minute); err != nil || stored {
+		t.Errorf("SetNX(during) while Redis is down = %v, %v, want false, nil", stored, err)
+	}
+
+	// Redis recovers, but the store only retries it once the retry interval has passed.
+	server.SetError("")
+	if got := get("during"); got != "in memory" {
+		t.Errorf("Get(during) before the retry = %q, want the fallback still used", got)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if got := get("before"); got != "in redis" {
+		t.Errorf("Get(before) after recovering = %q, want %q", got, "in redis")
+	}
+	if got := get("during"); got != "" {
+		t.Errorf("Get(during) after recovering = %q, want state written while degraded dropped", got)
+	}
+	if err := store.Set("after", []byte("in redis"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := server.Get(redisNamespace + "after"); got != "in redis" {
+		t.Errorf("Redis holds %q, want writes to reach it again", got)
+	}
+	if server.Exists(redisNamespace + "during") {
+		t.Error("a write made while degraded reached Redis")
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Conversation steps counted by recordStep, in funnel order. Operators can compare adjacent
+// counters to see where users drop out of the DM flow.
+const (
+	stepStarted      = "started"       // a new conversation was opened
+	stepNamesMatched = "names_matched" // every recipient name resolved
+	stepGameProvided = "game_provided" // the user named a game
+	stepConfirmed    = "confirmed"     // the game was settled, as typed or by confirming the extracted name, and sending began
+	stepSent         = "sent"          // the invitation reached every recipient
+	stepSendFailed   = "send_failed"   // the invitation failed for at least one recipient
+	stepCancelled    = "cancelled"     // the user cancelled the conversation
+	stepExpired      = "expired"       // the conversation sat idle longer than ConversationTTL
+)
+
+// conversationFunnel lists the conversation steps in funnel order, for reporting.
+var conversationFunnel = []string{stepStarted, stepNamesMatched, stepGameProvided, stepConfirmed, stepSent, stepSendFailed, stepCancelled, stepExpired}
+
+// conversationSteps counts conversation step transitions by step name. It is served at /metrics.
+var conversationSteps = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "conversation_steps_total",
+	Help: "DM conversation step transitions, by step.",
+}, []string{"step"})
+
+// recordStep counts a conversation step transition for userID.
+func recordStep(step, userID string) {
+	conversationSteps.WithLabelValues(step).Inc()
+	logger.Info("Conversation step", "event_type", "conversation", "user_id", userID, "step", step)
+}
+
+// stepCount returns how many times step has been recorded since startup.
+func stepCount(step string) int64 {
+	var metric dto.Metric
+	if err := conversationSteps.WithLabelValues(step).Write(&metric); err != nil {
+		return 0
+	}
+	return int64(metric.GetCounter().GetValue())
+}
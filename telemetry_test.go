@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestConversationFunnelSteps(t *testing.T) {
+	tests := []struct {
+		name       string
+		extraction bool   // LLM_GAME_EXTRACTION
+		completion string // the extracted game name
+		blocked    string // BLOCKED_GAMES
+		messages   []string
+		want       map[string]int64
+	}{
+		{
+			name:     "full flow",
+			messages: []string{"hi", "bob", "Catan"},
+			want:     map[string]int64{stepStarted: 1, stepNamesMatched: 1, stepGameProvided: 1, stepConfirmed: 1, stepSent: 1},
+		},
+		{
+			name:       "full flow confirming an extracted game",
+			extraction: true,
+			completion: "Mario Kart",
+			messages:   []string{"hi", "bob", "let's do some Mario Kart tonight", "yes"},
+			want:       map[string]int64{stepStarted: 1, stepNamesMatched: 1, stepGameProvided: 1, stepConfirmed: 1, stepSent: 1},
+		},
+		{
+			name:     "another game named after a refusal",
+			blocked:  "poker",
+			messages: []string{"hi", "bob", "poker", "poker", "Catan"},
+			want:     map[string]int64{stepStarted: 1, stepNamesMatched: 1, stepGameProvided: 1, stepConfirmed: 1, stepSent: 1},
+		},
+		{
+			name:       "extracted game rejected",
+			extraction: true,
+			completion: "Mario Kart",
+			messages:   []string{"hi", "bob", "let's do some Mario Kart tonight", "no", "cancel"},
+			want:       map[string]int64{stepStarted: 1, stepNamesMatched: 1, stepCancelled: 1},
+		},
+		{
+			name:     "cancelled while naming recipients",
+			messages: []string{"hi", "cancel"},
+			want:     map[string]int64{stepStarted: 1, stepCancelled: 1},
+		},
+		{
+			name:     "cancelled while naming the game",
+			messages: []string{"hi", "bob", "stop"},
+			want:     map[string]int64{stepStarted: 1, stepNamesMatched: 1, stepCancelled: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			config := testConfig()
+			config.LLMGameExtraction = tt.extraction
+			config.BlockedGames = newGameBlocklist(tt.blocked, blockMatchExact)
+			h, _ := newTestBotHandler(t, fake, config, &fakeGenerator{invitation: "Come play!", completion: tt.completion})
+
+			before := make(map[string]int64)
+			for _, step := range conversationFunnel {
+				before[step] = stepCount(step)
+			}
+			for _, text := range tt.messages {
+				h.processEvent(directMessage("U1", text))
+			}
+			for _, step := range conversationFunnel {
+				if got := stepCount(step) - before[step]; got != tt.want[step] {
+					t.Errorf("step %q recorded %d times, want %d", step, got, tt.want[step])
+				}
+			}
+		})
+	}
+}
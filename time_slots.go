@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// actionPickTimeSlot is the action ID of the time slot select on invitations offering time_slots.
+const actionPickTimeSlot = "pick_time_slot"
+
+// timeSlotsBlockPrefix starts the block ID of the time slot select, which carries the signed
+// invite ID; an option value is only the slot's index.
+const timeSlotsBlockPrefix = "time_slots."
+
+// Slack allows 75 characters of option text; ten slots keep the select easy to scan.
+const (
+	maxTimeSlots      = 10
+	maxTimeSlotLength = 75
+)
+
+// validateTimeSlots checks the candidate times offered with an invitation.
+func validateTimeSlots(slots []string) error {
+	if len(slots) > maxTimeSlots {
+		return fmt.Errorf("time_slots can list at most %d times", maxTimeSlots)
+	}
+	seen := make(map[string]bool, len(slots))
+	for _, slot := range slots {
+		trimmed := strings.TrimSpace(slot)
+		switch {
+		case trimmed == "":
+			return errors.New("time_slots can't contain an empty time")
+		case len([]rune(trimmed)) > maxTimeSlotLength:
+			return fmt.Errorf("time slot %q is longer than %d characters", trimmed, maxTimeSlotLength)
+		case seen[strings.ToLower(trimmed)]:
+			return fmt.Errorf("time slot %q is listed twice", trimmed)
+		}
+		seen[strings.ToLower(trimmed)] = true
+	}
+	return nil
+}
+
+// timeSlotsBlock builds the select recipients pick their preferred time from.
+func timeSlotsBlock(inviteID string, slots []string, secret []byte) *slack.ActionBlock {
+	options := make([]*slack.OptionBlockObject, len(slots))
+	for i, slot := range slots {
+		options[i] = slack.NewOptionBlockObject(strconv.Itoa(i), slack.NewTextBlockObject("plain_text", strings.TrimSpace(slot), false, false), nil)
+	}
+	selectMenu := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic,
+		slack.NewTextBlockObject("plain_text", "Pick a time that works", false, false), actionPickTimeSlot, options...)
+	return slack.NewActionBlock(encodeInviteBlockID(timeSlotsBlockPrefix, inviteID, secret), selectMenu)
+}
+
+// errUnknownTimeSlot is returned for picks of a slot the invitation doesn't offer.
+var errUnknownTimeSlot = errors.New("the invitation doesn't offer that time")
+
+// pickSlot records userID's preferred time, the slot at index, and returns the updated tally and
+// userID's response. Picking a time without having answered counts as a maybe; a decline stands,
+// and its pick only counts once the recipient accepts or says maybe.
+func (t *rsvpTracker) pickSlot(inviteID, userID, name string, index int) (RSVPTally, rsvpResponse, error) {
+	record, err := t.update(inviteID, func(record *rsvpRecord, ok bool) error {
+		if !ok {
+			return fmt.Errorf("no RSVP record for invite %s", inviteID)
+		}
+		if index < 0 || index >= len(record.TimeSlots) {
+			return errUnknownTimeSlot
+		}
+		response := record.Responses[userID]
+		response.Name = name
+		response.TimeSlot = record.TimeSlots[index]
+		if response.Status == "" {
+			response.Status = rsvpInterested
+		}
+		response.RespondedAt = time.Now().UTC()
+		record.Responses[userID] = response
+		return nil
+	})
+	if err != nil {
+		return RSVPTally{}, rsvpResponse{}, err
+	}
+	return record.tally(), record.Responses[userID], nil
+}
+
+// pickTimeSlot handles a recipient choosing their preferred time from the select: the pick is
+// recorded, the roster updated and the inviter told.
+func (h *InteractionHandler) pickTimeSlot(callback *slack.InteractionCallback, action *slack.BlockAction) {
+	inviteID, err := decodeInviteBlockID(timeSlotsBlockPrefix, action.BlockID, h.secret)
+	if err != nil {
+		logger.Info("Ignoring time slot pick with an unusable block ID", "event_type", callback.Type, "user_id", callback.User.ID, "error", err)
+		return
+	}
+	index, err := strconv.Atoi(action.SelectedOption.Value)
+	if err != nil {
+		logger.Info("Ignoring time slot pick with an unusable value", "event_type", callback.Type, "user_id", callback.User.ID, "invite_id", inviteID, "error", err)
+		return
+	}
+	name := h.displayName(callback.User)
+	tally, response, err := h.rsvps.pickSlot(inviteID, callback.User.ID, name, index)
+	if err != nil {
+		logger.Error("Error recording the time slot pick", "event_type", callback.Type, "user_id", callback.User.ID, "invite_id", inviteID, "error", err)
+		return
+	}
+	slot := response.TimeSlot
+	logger.Info("Time slot picked", "event_type", callback.Type, "user_id", callback.User.ID, "invite_id", inviteID, "time_slot", slot)
+
+	channelID := callback.Container.ChannelID
+	if channelID == "" {
+		channelID = callback.Channel.ID
+	}
+	confirmation := fmt.Sprintf("You picked %s for the %s invite.", slot, tally.Game)
+	if response.Status == rsvpDeclined {
+		confirmation += " You've declined it, so your pick only counts if you accept or say maybe."
+	}
+	if _, err := h.slackClient.PostEphemeral(channelID, callback.User.ID, slack.MsgOptionText(confirmation, false)); err != nil {
+		logger.Error("Failed to confirm the time slot pick", "event_type", callback.Type, "user_id", callback.User.ID, "error", h.sender.scopes.explain(methodPostEphemeral, err))
+	}
+
+	h.pending.answered(inviteID, tally)
+	h.updateRoster(inviteID, inviteMessage{Channel: channelID, TS: callback.Container.MessageTs}, callback.Message.Blocks.BlockSet)
+	if tally.InviterID == "" || tally.InviterID == callback.User.ID {
+		return
+	}
+	h.notifyInviter(tally.InviterID, inviteID, fmt.Sprintf("%s picked %s for your %s invite.", name, slot, tally.Game), &tally)
+}
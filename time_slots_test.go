@@ -0,0 +1,198 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+func TestValidateTimeSlots(t *testing.T) {
+	tests := []struct {
+		name    string
+		slots   []string
+		wantErr string
+	}{
+		{name: "none"},
+		{name: "valid", slots: []string{"Fri 7pm", "Sat 2pm"}},
+		{name: "too many", slots: strings.Split("1,2,3,4,5,6,7,8,9,10,11", ","), wantErr: "at most 10"},
+		{name: "empty", slots: []string{"Fri 7pm", "  "}, wantErr: "empty time"},
+		{name: "too long", slots: []string{strings.Repeat("x", 76)}, wantErr: "longer than 75"},
+		{name: "repeated", slots: []string{"Fri 7pm", "fri 7PM "}, wantErr: "listed twice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTimeSlots(tt.slots)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validateTimeSlots(%q) = %v, want nil", tt.slots, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validateTimeSlots(%q) = %v, want an error containing %q", tt.slots, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// pickSlot has userID choose the slot at index from the select on inviteID's invitation.
+func pickSlot(h *InteractionHandler, userID, inviteID string, index int) {
+	callback := &slack.InteractionCallback{Type: slack.InteractionTypeBlockActions, User: slack.User{ID: userID}, Container: slack.Container{ChannelID: "D" + userID, MessageTs: "1700000000.000001"}}
+	h.router.dispatch(callback, &slack.BlockAction{
+		ActionID:       actionPickTimeSlot,
+		BlockID:        encodeInviteBlockID(timeSlotsBlockPrefix, inviteID, []byte(testActionSecret)),
+		SelectedOption: slack.OptionBlockObject{Value: strconv.Itoa(index)},
+	})
+}
+
+func TestTimeSlotPicks(t *testing.T) {
+	slots := []string{"Fri 7pm", "Sat 2pm", "Sun 5pm"}
+	type step struct {
+		userID   string
+		actionID string // an invitation button, or actionPickTimeSlot
+		slot     int
+	}
+	tests := []struct {
+		name        string
+		steps       []step
+		wantCounts  []int
+		wantPopular string
+		wantMaybe   []string
+		wantInviter string // the last notice the inviter got
+	}{
+		{
+			name:        "picks are tallied",
+			steps:       []step{{"U2", actionAcceptGame, 0}, {"U2", actionPickTimeSlot, 1}, {"U3", actionAcceptGame, 0}, {"U3", actionPickTimeSlot, 1}},
+			wantCounts:  []int{0, 2, 0},
+			wantPopular: "Sat 2pm",
+			wantMaybe:   []string{},
+			wantInviter: "Carol Cooper picked Sat 2pm for your Catan invite. So far: 2 accepted, 0 maybe, 0 declined. Most popular time: Sat 2pm (2).",
+		},
+		{
+			name:        "picking without answering counts as maybe",
+			steps:       []step{{"U2", actionPickTimeSlot, 2}},
+			wantCounts:  []int{0, 0, 1},
+			wantPopular: "Sun 5pm",
+			wantMaybe:   []string{"Bob Baker"},
+			wantInviter: "Bob Baker picked Sun 5pm for your Catan invite. So far: 0 accepted, 1 maybe, 0 declined. Most popular time: Sun 5pm (1).",
+		},
+		{
+			name:        "picking again moves the pick",
+			steps:       []step{{"U2", actionPickTimeSlot, 0}, {"U2", actionPickTimeSlot, 1}},
+			wantCounts:  []int{0, 1, 0},
+			wantPopular: "Sat 2pm",
+			wantMaybe:   []string{"Bob Baker"},
+			wantInviter: "Bob Baker picked Sat 2pm for your Catan invite. So far: 0 accepted, 1 maybe, 0 declined. Most popular time: Sat 2pm (1).",
+		},
+		{
+			name:        "a decline's pick doesn't count",
+			steps:       []step{{"U2", actionPickTimeSlot, 0}, {"U2", actionDeclineGame, 0}},
+			wantCounts:  []int{0, 0, 0},
+			wantMaybe:   []string{},
+			wantInviter: "Bob Baker declined your Catan invite. So far: 0 accepted, 0 maybe, 1 declined.",
+		},
+		{
+			name:        "a tie goes to the earliest time offered",
+			steps:       []step{{"U3", actionPickTimeSlot, 2}, {"U2", actionPickTimeSlot, 0}},
+			wantCounts:  []int{1, 0, 1},
+			wantPopular: "Fri 7pm",
+			wantMaybe:   []string{"Bob Baker", "Carol Cooper"},
+			wantInviter: "Bob Baker picked Fri 7pm for your Catan invite. So far: 0 accepted, 2 maybe, 0 declined. Most popular time: Fri 7pm (1).",
+		},
+		{
+			name:       "a slot the invitation doesn't offer is ignored",
+			steps:      []step{{"U2", actionPickTimeSlot, 3}},
+			wantCounts: []int{0, 0, 0},
+			wantMaybe:  []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlack(t, testUsers...)
+			invites, _ := newTestInviteHandler(t, fake, testConfig())
+			config := testConfig()
+			config.ActionSigningSecret = testActionSecret
+			invites.config = config
+			status, response := invites.sendInvite(InviteRequest{GameName: "Catan", UserIDs: []string{"U2", "U3"}, InviterID: "U1", TimeSlots: slots})
+			if status != http.StatusOK {
+				t.Fatalf("sendInvite = %d %v", status, response)
+			}
+			inviteID := response["invite_id"].(string)
+			for _, post := range fake.allPosts() {
+				if !strings.Contains(post.Blocks, actionPickTimeSlot) || !strings.Contains(post.Blocks, "Sat 2pm") {
+					t.Fatalf("invitation to %s lacks the time slot select: %s", post.Channel, post.Blocks)
+				}
+			}
+
+			client := fake.client()
+			sender := newMessageSender(client, nil, newSendPacer(0, 0), 0, 0)
+			h := NewInteractionHandler(client, newUserCache(client, time.Minute), sender, testActionSecret, nil, nil, nil, invites.rsvps, newInviterNotifier(NewInMemoryStore(), sender, 0), newPendingInvites(NewInMemoryStore(), 0, 0))
+			value := inviteActionValue{Game: "Catan", InviterID: "U1", InviteID: inviteID}
+			for _, s := range tt.steps {
+				if s.actionID == actionPickTimeSlot {
+					pickSlot(h, s.userID, inviteID, s.slot)
+				} else {
+					click(h, s.userID, s.actionID, value)
+				}
+			}
+			h.wait()
+
+			tally, _, err := invites.rsvps.get(inviteID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tally.TimeSlots) != len(slots) {
+				t.Fatalf("time slots = %+v, want %d", tally.TimeSlots, len(slots))
+			}
+			for i, want := range tt.wantCounts {
+				if tally.TimeSlots[i].Count != want {
+					t.Errorf("%s picked by %d, want %d", tally.TimeSlots[i].Time, tally.TimeSlots[i].Count, want)
+				}
+			}
+			if tally.PopularTimeSlot != tt.wantPopular {
+				t.Errorf("popular time = %q, want %q", tally.PopularTimeSlot, tt.wantPopular)
+			}
+			if strings.Join(tally.Maybe.Names, ",") != strings.Join(tt.wantMaybe, ",") {
+				t.Errorf("maybe = %q, want %q", tally.Maybe.Names, tt.wantMaybe)
+			}
+			notices := fake.postsTo("U1")
+			if tt.wantInviter == "" {
+				if len(notices) != 0 {
+					t.Errorf("inviter notified %q, want nothing", notices)
+				}
+				return
+			}
+			if len(notices) == 0 || notices[len(notices)-1] != tt.wantInviter {
+				t.Errorf("inviter notices = %q, want the last to be %q", notices, tt.wantInviter)
+			}
+		})
+	}
+}
+
+func TestInviteBlockIDRejectsTampering(t *testing.T) {
+	secret := []byte(testActionSecret)
+	blockID := encodeInviteBlockID(timeSlotsBlockPrefix, "inv1", secret)
+	tests := []struct {
+		name    string
+		blockID string
+		wantID  string
+		wantErr bool
+	}{
+		{name: "signed", blockID: blockID, wantID: "inv1"},
+		{name: "other invite", blockID: strings.Replace(blockID, "inv1", "inv2", 1), wantErr: true},
+		{name: "unsigned", blockID: timeSlotsBlockPrefix + "inv1", wantErr: true},
+		{name: "other block", blockID: "game_actions", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeInviteBlockID(timeSlotsBlockPrefix, tt.blockID, secret)
+			if (err != nil) != tt.wantErr || got != tt.wantID {
+				t.Errorf("decodeInviteBlockID(%q) = %q, %v; want %q, error %t", tt.blockID, got, err, tt.wantID, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// userCache keeps a copy of the workspace directory so matching doesn't fetch every user on each request.
+type userCache struct {
+	slackClient *slack.Client
+	ttl         time.Duration
+
+	refreshMutex sync.Mutex // serializes calls to GetUsers
+	mutex        sync.RWMutex
+	users        []slack.User
+	fetchedAt    time.Time
+}
+
+// newUserCache creates an empty cache whose entries are considered fresh for ttl.
+func newUserCache(slackClient *slack.Client, ttl time.Duration) *userCache {
+	return &userCache{
+		slackClient: slackClient,
+		ttl:         ttl,
+	}
+}
+
+// getCachedUsers returns the cached user list, fetching it from Slack when it is missing or stale.
+func (c *userCache) getCachedUsers() ([]slack.User, error) {
+	if users, ok := c.fresh(); ok {
+		return users, nil
+	}
+	return c.refresh(false)
+}
+
+// getCachedUsersContext is getCachedUsers bounded by ctx. When ctx ends first it returns ctx's
+// error, while the fetch keeps going in the background and fills the cache for the next caller.
+func (c *userCache) getCachedUsersContext(ctx context.Context) ([]slack.User, error) {
+	if users, ok := c.fresh(); ok {
+		return users, nil
+	}
+	return awaitUsers(ctx, func() ([]slack.User, error) { return c.refresh(false) })
+}
+
+// awaitUsers runs fetch in the background and waits for it until ctx ends.
+func awaitUsers(ctx context.Context, fetch func() ([]slack.User, error)) ([]slack.User, error) {
+	type result struct {
+		users []slack.User
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		users, err := fetch()
+		done <- result{users, err}
+	}()
+	select {
+	case r := <-done:
+		return r.users, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// forceRefresh fetches the user list from Slack regardless of the cache age.
+func (c *userCache) forceRefresh() ([]slack.User, error) {
+	return c.refresh(true)
+}
+
+// minForcedRefreshAge keeps refreshIfOlderThan callers, such as repeated unmatched names, from
+// hammering the rate-limited users.list API.
+const minForcedRefreshAge = time.Minute
+
+// refreshIfOlderThan fetches the user list from Slack if the cached copy is at least age old,
+// reporting whether it did. It lets callers pick up just-added users without waiting for the TTL.
+// It stops waiting for the fetch when ctx ends.
+func (c *userCache) refreshIfOlderThan(ctx context.Context, age time.Duration) ([]slack.User, bool, error) {
+	c.mutex.RLock()
+	fetchedAt := c.fetchedAt
+	c.mutex.RUnlock()
+	if time.Since(fetchedAt) < age {
+		return nil, false, nil
+	}
+	users, err := awaitUsers(ctx, func() ([]slack.User, error) { return c.refresh(true) })
+	if err != nil {
+		return nil, false, err
+	}
+	return users, true, nil
+}
+
+// fresh returns the cached users if they were fetched within the TTL.
+func (c *userCache) fresh() ([]slack.User, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.users == nil || time.Since(c.fetchedAt) > c.ttl {
+		return nil, false
+	}
+	return c.users, true
+}
+
+// refresh fetches the user list from Slack. Concurrent callers are serialized, and a caller that
+// waited on another refresh reuses its result instead of fetching again.
+func (c *userCache) refresh(force bool) ([]slack.User, error) {
+	requestedAt := time.Now()
+	c.refreshMutex.Lock()
+	defer c.refreshMutex.Unlock()
+
+	c.mutex.RLock()
+	users, fetchedAt := c.users, c.fetchedAt
+	c.mutex.RUnlock()
+	if users != nil {
+		if force && fetchedAt.After(requestedAt) {
+			return users, nil
+		}
+		if !force && time.Since(fetchedAt) <= c.ttl {
+			return users, nil
+		}
+	}
+
+	logger.Debug("Refreshing Slack user cache", "forced", force)
+	users, err := c.slackClient.GetUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	c.users = users
+	c.fetchedAt = time.Now()
+	c.mutex.Unlock()
+	logger.Info("Slack user cache refreshed", "users", len(users))
+	return users, nil
+}
+
+// botUserIDs returns the subset of ids that belong to bot accounts (including Slackbot).
+// IDs that aren't in the directory are left for Slack to reject.
+func (c *userCache) botUserIDs(ids []string) ([]string, error) {
+	users, err := c.getCachedUsers()
+	if err != nil {
+		return nil, err
+	}
+	bots := make(map[string]bool)
+	for _, u := range users {
+		if u.IsBot || u.ID == "USLACKBOT" {
+			bots[u.ID] = true
+		}
+	}
+	var found []string
+	for _, id := range ids {
+		if bots[id] {
+			found = append(found, id)
+		}
+	}
+	return found, nil
+}
+
+// lookup returns the cached user with the given ID, fetching the directory if needed.
+func (c *userCache) lookup(userID string) (slack.User, bool) {
+	users, err := c.getCachedUsers()
+	if err != nil {
+		logger.Error("Error fetching users for lookup", "user_id", userID, "error", err)
+		return slack.User{}, false
+	}
+	for _, u := range users {
+		if u.ID == userID {
+			return u, true
+		}
+	}
+	return slack.User{}, false
+}